@@ -1,6 +1,8 @@
 package asm_vm_register_base
 
 import (
+	"errors"
+	"fmt"
 	"go-compiler/utils"
 	"strconv"
 	"strings"
@@ -12,12 +14,35 @@ type Assembler struct {
 	Pc        int64     `json:"pc"`
 	CodeCount int64     `json:"code_count"`
 	Register  *Register `json:"register"`
+	// 符号表，标签名（不带 @）-> 地址
+	Symbols map[string]int64 `json:"symbols"`
+	// 出错的地方都带行号，Compile 的时候一起返回
+	Errors []error `json:"-"`
+
+	// 正在处理的行号，从 1 开始
+	line int
+	// 标签在哪一行定义的，报重复定义用
+	labelLines map[string]int
+	// 引用了标签的操作数，等所有标签都知道地址了再填
+	fixups []labelFixup
+	// 正在汇编的函数名，不在函数里是空的
+	function     string
+	functionLine int
+}
+
+type labelFixup struct {
+	label string
+	// 操作数在 Memory 里的下标
+	slot int
+	line int
 }
 
 func NewAssembler() *Assembler {
 	return &Assembler{
-		Memory:   make([]int64, 0),
-		Register: NewRegister(),
+		Memory:     make([]int64, 0),
+		Register:   NewRegister(),
+		Symbols:    make(map[string]int64),
+		labelLines: make(map[string]int),
 	}
 }
 
@@ -37,422 +62,304 @@ func (this *Assembler) AddCodeCount(count int64) {
 	this.CodeCount += count
 }
 
-func (this *Assembler) turnCodeToNum(code string) int64 {
-	// 数字、string、bool、null
-	// 前 3 位是类型
-	// 数字 000
-	// string 001
-	// bool 010
-	// null 011
-	var result int64
-	if code == "true" {
-		//result = (1 << 13) + 0
-	} else if code == "false" {
-		result = (2 << 13) + 0
-	} else if code == "null" {
-		result = (3 << 13) + 0
-	} else if strings.Contains("1234567890", string(code[0])) {
-		result, _ = strconv.ParseInt(code, 10, 64)
-	} else if strings.Contains("abcdefghijklmnopqrstuvwxyz", string(code[0])) {
-
-	}
-	return result
-}
-
-func (this *Assembler) opSet2(code []string) {
-	// set a1 true
-	this.Pc += 3
-	reg1 := code[1]
-	r1 := this.Register.ReturnRegByName(reg1)
-	num := this.turnCodeToNum(code[2])
-	this.Memory = append(this.Memory, InstructionSet2.Value(), r1, num)
-	this.CodeCount += 3
-}
-
-func (this *Assembler) opSub2(code []string) {
-	//sub2 a1 a2 a3
-	this.Pc += 4
-	reg1 := code[1]
-	reg2 := code[2]
-	reg3 := code[3]
-
-	r1 := this.Register.ReturnRegByName(reg1)
-	r2 := this.Register.ReturnRegByName(reg2)
-	r3 := this.Register.ReturnRegByName(reg3)
-
-	this.Memory = append(this.Memory, InstructionSubtract2.Value(), r1, r2, r3)
-	this.CodeCount += 4
-}
-
-func (this *Assembler) opAdd2(code []string) {
-	//add2 a1 a2 a3
-	this.Pc += 4
-	reg1 := code[1]
-	reg2 := code[2]
-	reg3 := code[3]
-
-	r1 := this.Register.ReturnRegByName(reg1)
-	r2 := this.Register.ReturnRegByName(reg2)
-	r3 := this.Register.ReturnRegByName(reg3)
-
-	this.Memory = append(this.Memory, InstructionAdd2.Value(), r1, r2, r3)
-	this.CodeCount += 4
-}
-
-func (this *Assembler) opMul2(code []string) {
-	//mul a1 a2 a3
-	this.Pc += 4
-	reg1 := code[1]
-	reg2 := code[2]
-	reg3 := code[3]
-
-	r1 := this.Register.ReturnRegByName(reg1)
-	r2 := this.Register.ReturnRegByName(reg2)
-	r3 := this.Register.ReturnRegByName(reg3)
-
-	this.Memory = append(this.Memory, InstructionMultiply2.Value(), r1, r2, r3)
-	this.CodeCount += 4
-}
-
-func (this *Assembler) opDiv2(code []string) {
-	//div2 a1 a2 a3
-	this.Pc += 4
-	reg1 := code[1]
-	reg2 := code[2]
-	reg3 := code[3]
-
-	r1 := this.Register.ReturnRegByName(reg1)
-	r2 := this.Register.ReturnRegByName(reg2)
-	r3 := this.Register.ReturnRegByName(reg3)
-
-	this.Memory = append(this.Memory, InstructionDiv2.Value(), r1, r2, r3)
-	this.CodeCount += 4
-}
-
-func (this *Assembler) opPush(code []string) {
-	//push reg
-	this.Pc += 2
-	reg1 := code[1]
-
-	r1 := this.Register.ReturnRegByName(reg1)
-
-	this.Memory = append(this.Memory, InstructionPush.Value(), r1)
-	this.CodeCount += 2
-}
-
-func (this *Assembler) opPop(code []string) {
-	//pop reg
-	this.Pc += 2
-	reg1 := code[1]
-
-	r1 := this.Register.ReturnRegByName(reg1)
-
-	this.Memory = append(this.Memory, InstructionPop.Value(), r1)
-	this.CodeCount += 2
-}
-
-func (this *Assembler) opBoolAnd(code []string) {
-	//bool_and a1 a2 a3
-	this.Pc += 4
-	reg1 := code[1]
-	reg2 := code[2]
-	reg3 := code[3]
-
-	r1 := this.Register.ReturnRegByName(reg1)
-	r2 := this.Register.ReturnRegByName(reg2)
-	r3 := this.Register.ReturnRegByName(reg3)
-
-	this.Memory = append(this.Memory, InstructionBoolAnd.Value(), r1, r2, r3)
-	this.CodeCount += 4
-}
-
-func (this *Assembler) opBoolOr(code []string) {
-	//bool_or a1 a2 a3
-	this.Pc += 4
-	reg1 := code[1]
-	reg2 := code[2]
-	reg3 := code[3]
-
-	r1 := this.Register.ReturnRegByName(reg1)
-	r2 := this.Register.ReturnRegByName(reg2)
-	r3 := this.Register.ReturnRegByName(reg3)
-
-	this.Memory = append(this.Memory, InstructionBoolOr.Value(), r1, r2, r3)
-	this.CodeCount += 4
-}
-
-func (this *Assembler) opBoolLessThan(code []string) {
-	//bool_lt a1 a2 a3
-	this.Pc += 4
-	reg1 := code[1]
-	reg2 := code[2]
-	reg3 := code[3]
-
-	r1 := this.Register.ReturnRegByName(reg1)
-	r2 := this.Register.ReturnRegByName(reg2)
-	r3 := this.Register.ReturnRegByName(reg3)
-
-	this.Memory = append(this.Memory, InstructionBoolLessThan.Value(), r1, r2, r3)
-	this.CodeCount += 4
-}
-
-func (this *Assembler) opBoolLessThanEquals(code []string) {
-	//bool_lte a1 a2 a3
-	this.Pc += 4
-	reg1 := code[1]
-	reg2 := code[2]
-	reg3 := code[3]
-
-	r1 := this.Register.ReturnRegByName(reg1)
-	r2 := this.Register.ReturnRegByName(reg2)
-	r3 := this.Register.ReturnRegByName(reg3)
-
-	this.Memory = append(this.Memory, InstructionBoolLessThanEquals.Value(), r1, r2, r3)
-	this.CodeCount += 4
+func (this *Assembler) errorf(line int, format string, args ...interface{}) {
+	this.Errors = append(this.Errors, fmt.Errorf("line %d: %s", line, fmt.Sprintf(format, args...)))
 }
 
-func (this *Assembler) opBoolGreaterThan(code []string) {
-	//bool_gt a1 a2 a3
-	this.Pc += 4
-	reg1 := code[1]
-	reg2 := code[2]
-	reg3 := code[3]
-
-	r1 := this.Register.ReturnRegByName(reg1)
-	r2 := this.Register.ReturnRegByName(reg2)
-	r3 := this.Register.ReturnRegByName(reg3)
-
-	this.Memory = append(this.Memory, InstructionBoolGreaterThan.Value(), r1, r2, r3)
-	this.CodeCount += 4
-}
-
-func (this *Assembler) opBoolGreaterThanEquals(code []string) {
-	//bool_gte a1 a2 a3
-	this.Pc += 4
-	reg1 := code[1]
-	reg2 := code[2]
-	reg3 := code[3]
-
-	r1 := this.Register.ReturnRegByName(reg1)
-	r2 := this.Register.ReturnRegByName(reg2)
-	r3 := this.Register.ReturnRegByName(reg3)
-
-	this.Memory = append(this.Memory, InstructionBoolGreaterThanEquals.Value(), r1, r2, r3)
-	this.CodeCount += 4
-}
-
-func (this *Assembler) opBoolEquals(code []string) {
-	//bool_eq a1 a2 a3
-	this.Pc += 4
-	reg1 := code[1]
-	reg2 := code[2]
-	reg3 := code[3]
-
-	r1 := this.Register.ReturnRegByName(reg1)
-	r2 := this.Register.ReturnRegByName(reg2)
-	r3 := this.Register.ReturnRegByName(reg3)
-
-	this.Memory = append(this.Memory, InstructionBoolEquals.Value(), r1, r2, r3)
-	this.CodeCount += 4
-}
-
-func (this *Assembler) opBoolNotEquals(code []string) {
-	//bool_neq a1 a2 a3
-	this.Pc += 4
-	reg1 := code[1]
-	reg2 := code[2]
-	reg3 := code[3]
-
-	r1 := this.Register.ReturnRegByName(reg1)
-	r2 := this.Register.ReturnRegByName(reg2)
-	r3 := this.Register.ReturnRegByName(reg3)
-
-	this.Memory = append(this.Memory, InstructionBoolNotEquals.Value(), r1, r2, r3)
-	this.CodeCount += 4
+// 地址操作数，可以是数字也可以是 @标签
+// 标签先填 0 记下来，操作数接下来就放在 Memory 的末尾
+func (this *Assembler) addressOperand(operand string) int64 {
+	if strings.HasPrefix(operand, "@") {
+		this.fixups = append(this.fixups, labelFixup{
+			label: operand[1:],
+			slot:  len(this.Memory),
+			line:  this.line,
+		})
+		return 0
+	}
+	return this.turnCodeToNum(operand)
 }
 
-func (this *Assembler) opPlusAssign(code []string) {
-	//num_plus_eq a1 a2 a3
-	this.Pc += 4
-	reg1 := code[1]
-	reg2 := code[2]
-	reg3 := code[3]
-
-	r1 := this.Register.ReturnRegByName(reg1)
-	r2 := this.Register.ReturnRegByName(reg2)
-	r3 := this.Register.ReturnRegByName(reg3)
-
-	this.Memory = append(this.Memory, InstructionPlusAssign.Value(), r1, r2, r3)
-	this.CodeCount += 4
+// @label 单独一行是定义标签，地址就是下一条指令的地址
+func (this *Assembler) defineLabel(code []string) {
+	name := code[0][1:]
+	if len(code) > 1 {
+		this.errorf(this.line, "unexpected %q after label @%s", code[1], name)
+		return
+	}
+	if len(name) == 0 {
+		this.errorf(this.line, "empty label name")
+		return
+	}
+	if line, ok := this.labelLines[name]; ok {
+		this.errorf(this.line, "duplicate label @%s, first defined at line %d", name, line)
+		return
+	}
+	this.labelLines[name] = this.line
+	this.Symbols[name] = this.Pc
 }
 
-func (this *Assembler) opSubtractAssign(code []string) {
-	//num_sub_eq a1 a2 a3
-	this.Pc += 4
-	reg1 := code[1]
-	reg2 := code[2]
-	reg3 := code[3]
-
-	r1 := this.Register.ReturnRegByName(reg1)
-	r2 := this.Register.ReturnRegByName(reg2)
-	r3 := this.Register.ReturnRegByName(reg3)
-
-	this.Memory = append(this.Memory, InstructionSubtractAssign.Value(), r1, r2, r3)
-	this.CodeCount += 4
+// 第二遍，把引用标签的操作数填上地址
+func (this *Assembler) resolveLabels() {
+	for _, fixup := range this.fixups {
+		address, ok := this.Symbols[fixup.label]
+		if !ok {
+			this.errorf(fixup.line, "undefined label @%s", fixup.label)
+			continue
+		}
+		this.Memory[fixup.slot] = address
+	}
+	this.fixups = nil
 }
 
-func (this *Assembler) opMultiplyAssign(code []string) {
-	//num_mul_eq a1 a2 a3
-	this.Pc += 4
-	reg1 := code[1]
-	reg2 := code[2]
-	reg3 := code[3]
-
-	r1 := this.Register.ReturnRegByName(reg1)
-	r2 := this.Register.ReturnRegByName(reg2)
-	r3 := this.Register.ReturnRegByName(reg3)
+// 立即数按 16 位存，有符号无符号都可以
+const (
+	minImmediate = -(1 << 15)
+	maxImmediate = 1<<16 - 1
+	// .function / .call 的个数，栈上最多放这么多值
+	maxStackValues = (HeapStart - StackStart) / 2
+)
 
-	this.Memory = append(this.Memory, InstructionMultiplyAssign.Value(), r1, r2, r3)
-	this.CodeCount += 4
+// 按 instructionOperands 检查操作数的个数和种类，有错就不生成这条指令
+func (this *Assembler) checkOperands(code []string) bool {
+	op := code[0]
+	kinds := instructionOperands[instructionByName[op]]
+	operands := code[1:]
+	if len(operands) != len(kinds) {
+		this.errorf(this.line, "%s needs %d operands, got %d", op, len(kinds), len(operands))
+		return false
+	}
+	ok := true
+	for i, kind := range kinds {
+		switch kind {
+		case operandRegister:
+			ok = this.checkRegister(op, operands[i]) && ok
+		case operandImmediate:
+			ok = this.checkNumber(op, "immediate", operands[i], minImmediate, maxImmediate) && ok
+		case operandAddress:
+			// 标签在第二遍检查
+			if !strings.HasPrefix(operands[i], "@") {
+				ok = this.checkNumber(op, "address", operands[i], 0, MemorySize-1) && ok
+			}
+		}
+	}
+	return ok
 }
 
-func (this *Assembler) opDivideAssign(code []string) {
-	//num_div_eq a1 a2 a3
-	this.Pc += 4
-	reg1 := code[1]
-	reg2 := code[2]
-	reg3 := code[3]
-
-	r1 := this.Register.ReturnRegByName(reg1)
-	r2 := this.Register.ReturnRegByName(reg2)
-	r3 := this.Register.ReturnRegByName(reg3)
-
-	this.Memory = append(this.Memory, InstructionDivideAssign.Value(), r1, r2, r3)
-	this.CodeCount += 4
+func (this *Assembler) checkRegister(op string, operand string) bool {
+	if _, ok := registerCodes[operand]; !ok {
+		this.errorf(this.line, "%s: invalid register %q", op, operand)
+		return false
+	}
+	return true
 }
 
-func (this *Assembler) opSaveFromRegister2(code []string) {
-	//save_from_register a1 a2
-	this.Pc += 3
-	reg1 := code[1]
-	reg2 := code[2]
-
-	r1 := this.Register.ReturnRegByName(reg1)
-	r2 := this.Register.ReturnRegByName(reg2)
-
-	this.Memory = append(this.Memory, InstructionSaveFromRegister2.Value(), r1, r2)
-	this.CodeCount += 3
+// 数字要在 [min, max] 里，立即数还可以是 true false null
+func (this *Assembler) checkNumber(op string, kind string, operand string, min int64, max int64) bool {
+	if kind == "immediate" && (operand == "true" || operand == "false" || operand == "null") {
+		return true
+	}
+	value, err := strconv.ParseInt(operand, 10, 64)
+	if err != nil && !errors.Is(err, strconv.ErrRange) {
+		this.errorf(this.line, "%s: invalid %s %q", op, kind, operand)
+		return false
+	}
+	if err != nil || value < min || value > max {
+		this.errorf(this.line, "%s: %s %s out of range [%d, %d]", op, kind, operand, min, max)
+		return false
+	}
+	return true
+}
+
+// 伪指令的操作数个数，最少和最多
+var pseudoOperandCounts = map[Instruction][2]int{
+	InstructionPseudoFunction:    {1, 2},
+	InstructionPseudoReturn:      {0, 1},
+	InstructionPseudoFuncVar:     {1, 1},
+	InstructionPseudoCall:        {1, 2},
+	InstructionPseudoEndFunction: {0, 0},
+}
+
+func (this *Assembler) checkPseudoOperands(code []string) bool {
+	op := code[0]
+	ins := instructionByName[op]
+	count := pseudoOperandCounts[ins]
+	operands := code[1:]
+	if len(operands) < count[0] || len(operands) > count[1] {
+		if count[0] == count[1] {
+			this.errorf(this.line, "%s needs %d operands, got %d", op, count[0], len(operands))
+		} else {
+			this.errorf(this.line, "%s needs %d to %d operands, got %d", op, count[0], count[1], len(operands))
+		}
+		return false
+	}
+	switch ins {
+	case InstructionPseudoReturn:
+		if len(operands) == 1 {
+			return this.checkRegister(op, operands[0])
+		}
+	case InstructionPseudoFunction, InstructionPseudoCall:
+		if len(operands) == 2 {
+			return this.checkNumber(op, "count", operands[1], 0, maxStackValues)
+		}
+	}
+	return true
 }
 
-func (this *Assembler) opLoadFromRegister2(code []string) {
-	//load_from_register a1 a2
-	this.Pc += 3
-	reg1 := code[1]
-	reg2 := code[2]
-
-	r1 := this.Register.ReturnRegByName(reg1)
-	r2 := this.Register.ReturnRegByName(reg2)
-
-	this.Memory = append(this.Memory, InstructionLoadFromRegister2.Value(), r1, r2)
-	this.CodeCount += 3
-}
+func (this *Assembler) turnCodeToNum(code string) int64 {
+	// 数字、bool、null，类型标记见 ValueTypeNumber
+	var result int64
+	if code == "true" {
+		result = ValueTrue
+	} else if code == "false" {
+		result = ValueFalse
+	} else if code == "null" {
+		result = ValueNull
+	} else if strings.Contains("1234567890-", string(code[0])) {
+		result, _ = strconv.ParseInt(code, 10, 64)
+	} else if strings.Contains("abcdefghijklmnopqrstuvwxyz", string(code[0])) {
 
-func (this *Assembler) opJump(code []string) {
-	//jump @fuck
-	//this.Pc += 3
-	//reg1 := code[1]
-	//reg2 := code[2]
-	//
-	//r1 := this.Register.ReturnRegByName(reg1)
-	//r2 := this.Register.ReturnRegByName(reg2)
-	//
-	//this.Memory = append(this.Memory, InstructionSaveFromRegister2.Value(), r1, r2)
-	//this.CodeCount += 3
+	}
+	return result
 }
 
-func (this *Assembler) opJumpFromRegister(code []string) {
-	//jump @fuck
-	//this.Pc += 3
-	//reg1 := code[1]
-	//reg2 := code[2]
-	//
-	//r1 := this.Register.ReturnRegByName(reg1)
-	//r2 := this.Register.ReturnRegByName(reg2)
-	//
-	//this.Memory = append(this.Memory, InstructionSaveFromRegister2.Value(), r1, r2)
-	//this.CodeCount += 3
+// emit 按 instructionOperands 把一行汇编变成机器码，操作数已经检查过了
+func (this *Assembler) emit(code []string) {
+	ins := instructionByName[code[0]]
+	kinds := instructionOperands[ins]
+	this.Memory = append(this.Memory, ins.Value())
+	for i, kind := range kinds {
+		operand := code[i+1]
+		var value int64
+		switch kind {
+		case operandRegister:
+			value = this.Register.ReturnRegByName(operand)
+		case operandImmediate:
+			value = this.turnCodeToNum(operand)
+		case operandAddress:
+			value = this.addressOperand(operand)
+		}
+		this.Memory = append(this.Memory, value)
+	}
+	this.Pc += int64(len(kinds) + 1)
+	this.CodeCount += int64(len(kinds) + 1)
+}
+
+// emitInstruction 伪指令展开的时候用
+func (this *Assembler) emitInstruction(ins Instruction, operands ...string) {
+	this.emit(append([]string{ins.Name()}, operands...))
+}
+
+// 函数的调用约定，伪指令在这里展开成真的指令
+//
+// 栈往高地址长，一个函数的栈帧是
+//
+//	参数 0 … 参数 n-1、返回地址、调用方的 fp、局部变量 0 …
+//	                                        ^ fp
+//
+// 共 n 个参数的时候第 i 个参数在 fp - 4 - 2(n-i)，第 i 个局部变量在 fp + 2i
+// 寄存器都是调用方保存的，调用之后还要用的临时值调用方自己 push/pop，返回值放在 c1
+//
+//	.call @f n         set2 f1 <返回地址>; push f1; jump @f
+//	                   回来以后退掉 n 个参数：set2 f1 2n; sub2 sp f1 sp
+//	.function @f n     @f; push fp; mov2 sp fp; 留出 n 个局部变量：set2 f1 2n; add2 sp f1 sp
+//	.func_var x        标一下参数，地址生成汇编的时候已经算好了，不生成指令
+//	.return a1         mov2 a1 c1; mov2 fp sp; pop fp; pop f1; jump_from_register f1
+//	.return            返回 null
+//	.end_function      函数结尾，跟 .return 一样返回 null
+func (this *Assembler) opPseudoFunction(code []string) {
+	if this.function != "" {
+		this.errorf(this.line, "nested .function, @%s starts at line %d", this.function, this.functionLine)
+		return
+	}
+	if len(code) < 2 || !strings.HasPrefix(code[1], "@") {
+		this.errorf(this.line, ".function needs a @name")
+		return
+	}
+	this.defineLabel(code[1:2])
+	this.function = code[1][1:]
+	this.functionLine = this.line
+
+	this.emitInstruction(InstructionPush, "fp")
+	this.emitInstruction(InstructionMove2, "sp", "fp")
+	if len(code) > 2 {
+		this.adjustStack(InstructionAdd2, this.turnCodeToNum(code[2]))
+	}
 }
 
-func (this *Assembler) opHalt(code []string) {
-	//halt
-	this.Pc += 1
-	this.Memory = append(this.Memory, InstructionHalt.Value())
-	this.CodeCount += 1
+func (this *Assembler) opPseudoReturn(code []string) {
+	if this.function == "" {
+		this.errorf(this.line, ".return outside .function")
+		return
+	}
+	if len(code) > 1 {
+		this.emitInstruction(InstructionMove2, code[1], "c1")
+	} else {
+		this.emitInstruction(InstructionSet2, "c1", "null")
+	}
+	this.emitInstruction(InstructionMove2, "fp", "sp")
+	this.emitInstruction(InstructionPop, "fp")
+	this.emitInstruction(InstructionPop, "f1")
+	this.emitInstruction(InstructionJumpFromRegister, "f1")
 }
 
-func (this *Assembler) opFuncInfo(op string) func(code []string) {
-	fun := map[string]func(asm []string){
-		InstructionSet2.Name(): this.opSet2,
-		// +-*/
-		InstructionAdd2.Name():      this.opAdd2,
-		InstructionSubtract2.Name(): this.opSub2,
-		InstructionMultiply2.Name(): this.opMul2,
-		InstructionDiv2.Name():      this.opDiv2,
-		// save \load
-		InstructionSaveFromRegister2.Name(): this.opSaveFromRegister2,
-		InstructionLoadFromRegister2.Name(): this.opLoadFromRegister2,
-		// bool
-		InstructionBoolAnd.Name():               this.opBoolAnd,
-		InstructionBoolOr.Name():                this.opBoolOr,
-		InstructionBoolGreaterThan.Name():       this.opBoolGreaterThan,
-		InstructionBoolGreaterThanEquals.Name(): this.opBoolGreaterThanEquals,
-		InstructionBoolLessThan.Name():          this.opBoolLessThan,
-		InstructionBoolLessThanEquals.Name():    this.opBoolLessThanEquals,
-		InstructionBoolEquals.Name():            this.opBoolEquals,
-		InstructionBoolNotEquals.Name():         this.opBoolNotEquals,
-		// push pop
-		InstructionPush.Name(): this.opPush,
-		InstructionPop.Name():  this.opPop,
-		// += -= *= /=
-		InstructionPlusAssign.Name():     this.opPlusAssign,
-		InstructionSubtractAssign.Name(): this.opSubtractAssign,
-		InstructionMultiplyAssign.Name(): this.opMultiplyAssign,
-		InstructionDivideAssign.Name():   this.opDivideAssign,
-		// jump
-		InstructionJump.Name():             this.opJump,
-		InstructionJumpFromRegister.Name(): this.opJumpFromRegister,
-		// halt
-		InstructionHalt.Name(): this.opHalt,
+func (this *Assembler) opPseudoFuncVar(code []string) {
+	if this.function == "" {
+		this.errorf(this.line, ".func_var outside .function")
 	}
-	return fun[op]
 }
 
-// todo
-func (this *Assembler) opPseudoFunction(code []string) {
+func (this *Assembler) opPseudoEndFunction(code []string) {
+	if this.function == "" {
+		this.errorf(this.line, ".end_function outside .function")
+		return
+	}
+	this.opPseudoReturn([]string{".return"})
+	this.function = ""
 }
 
-// todo
-func (this *Assembler) opPseudoReturn(code []string) {
-
+func (this *Assembler) opPseudoCall(code []string) {
+	if len(code) < 2 || !strings.HasPrefix(code[1], "@") {
+		this.errorf(this.line, ".call needs a @name")
+		return
+	}
+	// set2 3 格、push 2 格、jump 2 格，返回地址是 jump 的下一条
+	returnAddress := this.Pc + 7
+	this.emitInstruction(InstructionSet2, "f1", strconv.FormatInt(returnAddress, 10))
+	this.emitInstruction(InstructionPush, "f1")
+	this.emitInstruction(InstructionJump, code[1])
+	if len(code) > 2 {
+		this.adjustStack(InstructionSubtract2, this.turnCodeToNum(code[2]))
+	}
 }
 
-// todo
-func (this *Assembler) opPseudoFuncVar(code []string) {
-
+// sp 加减 n 格值（一个值 2 格），n 是 0 就不用生成
+func (this *Assembler) adjustStack(ins Instruction, n int64) {
+	if n == 0 {
+		return
+	}
+	this.emitInstruction(InstructionSet2, "f1", strconv.FormatInt(2*n, 10))
+	this.emitInstruction(ins, "sp", "f1", "sp")
 }
 
-func (this *Assembler) opPseudoFuncInfo(op string) func(code []string) {
-	fun := map[string]func(asm []string){
-		InstructionPseudoFunction.Name(): this.opPseudoFunction,
-		InstructionPseudoReturn.Name():   this.opPseudoReturn,
-		InstructionPseudoFuncVar.Name():  this.opPseudoFuncVar,
-	}
-	return fun[op]
+// 伪指令名 -> 展开的函数
+var pseudoInstructions = map[string]func(this *Assembler, code []string){
+	InstructionPseudoFunction.Name():    (*Assembler).opPseudoFunction,
+	InstructionPseudoReturn.Name():      (*Assembler).opPseudoReturn,
+	InstructionPseudoFuncVar.Name():     (*Assembler).opPseudoFuncVar,
+	InstructionPseudoCall.Name():        (*Assembler).opPseudoCall,
+	InstructionPseudoEndFunction.Name(): (*Assembler).opPseudoEndFunction,
 }
 
-// 这里去掉注释啥的
+// 去掉 ; 开头的注释，行数不变，报错的行号还是对的
 func (this *Assembler) preProcessAsm(asm string) string {
-	return asm
+	lines := strings.Split(asm, "\n")
+	for i, line := range lines {
+		if index := strings.Index(line, ";"); index >= 0 {
+			lines[i] = line[:index]
+		}
+	}
+	return strings.Join(lines, "\n")
 }
 
 func (this *Assembler) compileMachineCode(asm string) []int64 {
@@ -462,6 +369,7 @@ func (this *Assembler) compileMachineCode(asm string) []int64 {
 	lines := strings.Split(asm, "\n")
 	var i = 0
 	for i < len(lines) {
+		this.line = i + 1
 		lines[i] = strings.TrimSpace(lines[i])
 		// 跳过空行
 		if len(lines[i]) == 0 {
@@ -469,7 +377,7 @@ func (this *Assembler) compileMachineCode(asm string) []int64 {
 			continue
 		}
 		// 将指令分割成数组
-		var line = strings.Split(lines[i], " ")
+		var line = strings.Fields(lines[i])
 		op := string(line[0])
 		utils.LogInfo("op", op)
 		op = strings.TrimSpace(op)
@@ -479,12 +387,22 @@ func (this *Assembler) compileMachineCode(asm string) []int64 {
 		}
 		if string(op[0]) == "@" {
 			// 处理地址
+			this.defineLabel(line)
 		} else if string(op[0]) == "." {
 			// 处理伪指令
-			this.opPseudoFuncInfo(op)(line)
+			fun, ok := pseudoInstructions[op]
+			if !ok {
+				this.errorf(this.line, "unknown pseudo instruction %q", op)
+			} else if this.checkPseudoOperands(line) {
+				fun(this, line)
+			}
 		} else {
-			// 处理指令
-			this.opFuncInfo(op)(line)
+			// 处理指令，操作数的种类都在 instructionOperands 里
+			if _, ok := instructionOperands[instructionByName[op]]; !ok {
+				this.errorf(this.line, "unknown instruction %q", op)
+			} else if this.checkOperands(line) {
+				this.emit(line)
+			}
 		}
 		i += 1
 	}
@@ -492,7 +410,14 @@ func (this *Assembler) compileMachineCode(asm string) []int64 {
 	return memory
 }
 
-func (this *Assembler) Compile() []int64 {
+// Compile 分两遍：第一遍生成机器码、记下标签的地址，第二遍把标签填进跳转指令
+// 标签未定义、重复定义都会报错，符号表在 Symbols 里
+// 指令不认识、操作数个数不对、寄存器不对、立即数超出范围也会报错，出错的指令不生成
+func (this *Assembler) Compile() ([]int64, error) {
 	this.Memory = this.compileMachineCode(this.Asm)
-	return this.Memory
+	if this.function != "" {
+		this.errorf(this.functionLine, "missing .end_function for @%s", this.function)
+	}
+	this.resolveLabels()
+	return this.Memory, errors.Join(this.Errors...)
 }
@@ -0,0 +1,179 @@
+package asm_vm_register_base
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAssemblerLabels(t *testing.T) {
+	// 跟 TestVMJump 里手算地址的程序一样，这里用标签
+	assembler := NewAssembler()
+	assembler.AddAsm(`
+		set2 a1 0
+		set2 a2 5
+		set2 a3 1
+		set2 c1 0
+	@loop
+		bool_gt a2 c1 f1
+		while f1 @body
+		jump @end
+	@body
+		add2 a1 a2 a1
+		sub2 a2 a3 a2
+		jump @loop
+	@end
+		halt
+	`)
+	memory, err := assembler.Compile()
+	if err != nil {
+		t.Fatalf("asm error: %v", err)
+	}
+
+	a1, a2, a3, c1, f1 := registerCodes["a1"], registerCodes["a2"], registerCodes["a3"], registerCodes["c1"], registerCodes["f1"]
+	expected := []int64{
+		InstructionSet2.Value(), a1, 0,
+		InstructionSet2.Value(), a2, 5,
+		InstructionSet2.Value(), a3, 1,
+		InstructionSet2.Value(), c1, 0,
+		InstructionBoolGreaterThan.Value(), a2, c1, f1,
+		InstructionWhile.Value(), f1, 21,
+		InstructionJump.Value(), 31,
+		InstructionAdd2.Value(), a1, a2, a1,
+		InstructionSubtract2.Value(), a2, a3, a2,
+		InstructionJump.Value(), 12,
+		InstructionHalt.Value(),
+	}
+	if !reflect.DeepEqual(memory, expected) {
+		t.Errorf("memory wrong.\ngot=%v\nwant=%v", memory, expected)
+	}
+	symbols := map[string]int64{"loop": 12, "body": 21, "end": 31}
+	if !reflect.DeepEqual(assembler.Symbols, symbols) {
+		t.Errorf("symbols wrong. got=%v, want=%v", assembler.Symbols, symbols)
+	}
+
+	vm := NewVM(memory)
+	if err := vm.Run(); err != nil {
+		t.Fatalf("vm error: %v", err)
+	}
+	if vm.Register("a1") != 15 {
+		t.Errorf("a1 wrong. got=%d", vm.Register("a1"))
+	}
+}
+
+func TestAssemblerLabelErrors(t *testing.T) {
+	tests := []struct {
+		asm      string
+		expected string
+	}{
+		{"jump @nowhere\nhalt", "line 1: undefined label @nowhere"},
+		{"set2 a1 1\nif a1 @a\n@a\nhalt\n@a\nhalt", "line 5: duplicate label @a, first defined at line 3"},
+		{"@a halt", `line 1: unexpected "halt" after label @a`},
+		{"@\nhalt", "line 1: empty label name"},
+		{"jump @x\n@y\n@y\nload2 @z a1", "line 3: duplicate label @y, first defined at line 2\nline 1: undefined label @x\nline 4: undefined label @z"},
+	}
+
+	for _, tt := range tests {
+		assembler := NewAssembler()
+		assembler.AddAsm(tt.asm)
+		_, err := assembler.Compile()
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("%q: error wrong.\ngot=%v\nwant=%s", tt.asm, err, tt.expected)
+		}
+	}
+}
+
+func TestAssemblerFunctionErrors(t *testing.T) {
+	tests := []struct {
+		asm      string
+		expected string
+	}{
+		{".return a1", "line 1: .return outside .function"},
+		{".func_var x", "line 1: .func_var outside .function"},
+		{".end_function", "line 1: .end_function outside .function"},
+		{".function @f 0\n.function @g 0\n.end_function", "line 2: nested .function, @f starts at line 1"},
+		{"halt\n.function @f 1\nset2 a1 1", "line 2: missing .end_function for @f"},
+		{".call @nowhere 0\nhalt", "line 1: undefined label @nowhere"},
+		{".call f 0", "line 1: .call needs a @name"},
+	}
+
+	for _, tt := range tests {
+		assembler := NewAssembler()
+		assembler.AddAsm(tt.asm)
+		_, err := assembler.Compile()
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("%q: error wrong.\ngot=%v\nwant=%s", tt.asm, err, tt.expected)
+		}
+	}
+}
+
+func TestAssemblerDiagnostics(t *testing.T) {
+	tests := []struct {
+		asm      string
+		expected string
+	}{
+		{"set2 a1 1\nadd3 a1 a1 a1", `line 2: unknown instruction "add3"`},
+		{".fn @f", `line 1: unknown pseudo instruction ".fn"`},
+		{"add2 a1 a2", "line 1: add2 needs 3 operands, got 2"},
+		{"halt a1", "line 1: halt needs 0 operands, got 1"},
+		{"push a4", `line 1: push: invalid register "a4"`},
+		{"add2 a1 x1 b2", "line 1: add2: invalid register \"x1\"\nline 1: add2: invalid register \"b2\""},
+		{"set2 a1 foo", `line 1: set2: invalid immediate "foo"`},
+		{"set2 a1 65536", "line 1: set2: immediate 65536 out of range [-32768, 65535]"},
+		{"load_fp2 -32769 a1", "line 1: load_fp2: immediate -32769 out of range [-32768, 65535]"},
+		{"set2 a1 99999999999999999999", "line 1: set2: immediate 99999999999999999999 out of range [-32768, 65535]"},
+		{"load2 65536 a1", "line 1: load2: address 65536 out of range [0, 65535]"},
+		{"jump -1", "line 1: jump: address -1 out of range [0, 65535]"},
+		{"jump top", `line 1: jump: invalid address "top"`},
+		{".call @f 1 2", "line 1: .call needs 1 to 2 operands, got 3"},
+		{".call @f -1\n@f\nhalt", "line 1: .call: count -1 out of range [0, 12288]"},
+		{".function @f x\n.end_function", "line 1: .function: invalid count \"x\"\nline 2: .end_function outside .function"},
+		{".function @f 0\n.return r1\n.end_function", `line 2: .return: invalid register "r1"`},
+		{".function @f 0\n.end_function a1", "line 2: .end_function needs 0 operands, got 1\nline 1: missing .end_function for @f"},
+		// 出错的指令不生成，后面的还接着检查
+		{"set2 a1\nmul2 a1 a1\nhalt", "line 1: set2 needs 2 operands, got 1\nline 2: mul2 needs 3 operands, got 2"},
+	}
+
+	for _, tt := range tests {
+		assembler := NewAssembler()
+		assembler.AddAsm(tt.asm)
+		_, err := assembler.Compile()
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("%q: error wrong.\ngot=%v\nwant=%s", tt.asm, err, tt.expected)
+		}
+	}
+}
+
+func TestAssemblerComments(t *testing.T) {
+	assembler := NewAssembler()
+	assembler.AddAsm(`
+		; a1 = 3 * 4
+		set2 a1 3 ; 第一个数
+		set2 a2 4;第二个数
+		mul2 a1 a2 a1
+	@end ; 标签后面也可以有注释
+		halt
+		;
+	`)
+	memory, err := assembler.Compile()
+	if err != nil {
+		t.Fatalf("asm error: %v", err)
+	}
+	if len(memory) != 11 || assembler.Symbols["end"] != 10 {
+		t.Errorf("comments not stripped. memory=%v symbols=%v", memory, assembler.Symbols)
+	}
+	vm := NewVM(memory)
+	if err := vm.Run(); err != nil {
+		t.Fatalf("vm error: %v", err)
+	}
+	if vm.Register("a1") != 12 {
+		t.Errorf("a1 wrong. got=%d", vm.Register("a1"))
+	}
+
+	// 注释不影响行号
+	assembler = NewAssembler()
+	assembler.AddAsm("; 注释\nset2 a1 1 ; ok\npop")
+	_, err = assembler.Compile()
+	if err == nil || err.Error() != "line 3: pop needs 1 operands, got 0" {
+		t.Errorf("error wrong. got=%v", err)
+	}
+}
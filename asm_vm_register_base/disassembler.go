@@ -0,0 +1,149 @@
+package asm_vm_register_base
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// 反汇编，把 Assembler.Compile 生成的机器码变回汇编
+//
+//	@label_12
+//	    bool_gt a2 c1 f1         ; 12
+//
+// 每条指令后面的注释是它的地址，跳转的目标如果是一条指令的开头就换成标签，
+// symbols 里有名字的用原来的名字，没有的叫 label_<地址>
+// 输出可以直接给 Assembler，汇编出来的机器码和原来的一样
+// 伪指令已经展开过了，反汇编出来的是展开以后的指令
+func Disassemble(memory []int64, symbols map[string]int64) (string, error) {
+	// 1. 先按指令切开，记下每条指令的开头
+	starts := make(map[int64]bool)
+	var pc int64
+	for pc < int64(len(memory)) {
+		kinds, err := decodeAt(memory, pc)
+		if err != nil {
+			return "", err
+		}
+		starts[pc] = true
+		pc += 1 + int64(len(kinds))
+	}
+	starts[pc] = true
+
+	// 2. 标签，地址 -> 名字
+	labels := make(map[int64][]string)
+	for name, address := range symbols {
+		labels[address] = append(labels[address], name)
+	}
+	for _, names := range labels {
+		sort.Strings(names)
+	}
+	pc = 0
+	for pc < int64(len(memory)) {
+		ins := instructionByValue[memory[pc]]
+		kinds := instructionOperands[ins]
+		for i, kind := range kinds {
+			address := memory[pc+1+int64(i)]
+			if kind == operandAddress && isJump(ins) && starts[address] && len(labels[address]) == 0 {
+				labels[address] = []string{uniqueLabel(fmt.Sprintf("label_%d", address), symbols)}
+			}
+		}
+		pc += 1 + int64(len(kinds))
+	}
+
+	// 3. 输出
+	var asm strings.Builder
+	writeLabels := func(address int64) {
+		for _, name := range labels[address] {
+			asm.WriteString("@" + name + "\n")
+		}
+	}
+	pc = 0
+	for pc < int64(len(memory)) {
+		writeLabels(pc)
+		ins := instructionByValue[memory[pc]]
+		kinds := instructionOperands[ins]
+		fields := []string{ins.Name()}
+		for i, kind := range kinds {
+			operand := memory[pc+1+int64(i)]
+			switch {
+			case kind == operandRegister:
+				fields = append(fields, registerName(operand))
+			case kind == operandAddress && isJump(ins) && starts[operand]:
+				fields = append(fields, "@"+labels[operand][0])
+			case kind == operandImmediate && !isNumber(operand):
+				fields = append(fields, immediateName(operand))
+			default:
+				fields = append(fields, fmt.Sprintf("%d", operand))
+			}
+		}
+		asm.WriteString(fmt.Sprintf("    %-28s ; %d\n", strings.Join(fields, " "), pc))
+		pc += 1 + int64(len(kinds))
+	}
+	// 指向程序末尾的标签
+	writeLabels(pc)
+	return asm.String(), nil
+}
+
+// pc 处指令的操作数，指令不对、寄存器不对、操作数不够都报错
+func decodeAt(memory []int64, pc int64) ([]operandKind, error) {
+	op := memory[pc]
+	if op < 0 || op > 255 || instructionByValue[op].name == "" {
+		return nil, fmt.Errorf("invalid instruction %d at %d", op, pc)
+	}
+	ins := instructionByValue[op]
+	kinds, ok := instructionOperands[ins]
+	if !ok {
+		return nil, fmt.Errorf("pseudo instruction %s at %d can not be disassembled", ins.name, pc)
+	}
+	if pc+int64(len(kinds)) >= int64(len(memory)) {
+		return nil, fmt.Errorf("%s at %d: missing operands", ins.name, pc)
+	}
+	for i, kind := range kinds {
+		operand := memory[pc+1+int64(i)]
+		if kind == operandRegister && !validRegisterCode(operand) {
+			return nil, fmt.Errorf("%s at %d: invalid register %d", ins.name, pc, operand)
+		}
+	}
+	return kinds, nil
+}
+
+// 只有跳转的地址是代码地址，load2 save2 的是数据地址
+func isJump(ins Instruction) bool {
+	switch ins {
+	case InstructionJump, InstructionIf, InstructionWhile, InstructionFor:
+		return true
+	}
+	return false
+}
+
+// 立即数里的 true false null，跟 turnCodeToNum 反过来
+func immediateName(value int64) string {
+	switch value {
+	case ValueTrue:
+		return "true"
+	case ValueFalse:
+		return "false"
+	case ValueNull:
+		return "null"
+	}
+	return fmt.Sprintf("%d", value)
+}
+
+func registerName(code int64) string {
+	for name, c := range registerCodes {
+		if c == code {
+			return name
+		}
+	}
+	return ""
+}
+
+// 生成的标签名不能和 symbols 里的重名
+func uniqueLabel(name string, symbols map[string]int64) string {
+	for {
+		if _, ok := symbols[name]; !ok {
+			return name
+		}
+		name += "_"
+	}
+}
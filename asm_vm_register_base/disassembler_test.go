@@ -0,0 +1,159 @@
+package asm_vm_register_base
+
+import (
+	"math/rand"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func assembleForTest(t *testing.T, asm string) ([]int64, map[string]int64) {
+	t.Helper()
+	assembler := NewAssembler()
+	assembler.AddAsm(asm)
+	memory, err := assembler.Compile()
+	if err != nil {
+		t.Fatalf("asm error: %v\nasm=\n%s", err, asm)
+	}
+	return memory, assembler.Symbols
+}
+
+func TestDisassemble(t *testing.T) {
+	memory, symbols := assembleForTest(t, `
+		set2 a1 0
+		set2 a2 5
+	@loop
+		bool_gt a2 c1 f1
+		while f1 @body
+		jump @end
+	@body
+		add2 a1 a2 a1
+		sub2 a2 a3 a2
+		load2 32768 c1
+		jump @loop
+	@end
+	`)
+
+	// 没有符号表的时候按地址起名字
+	expected := `    set2 a1 0                    ; 0
+    set2 a2 5                    ; 3
+@label_6
+    bool_gt a2 c1 f1             ; 6
+    while f1 @label_15           ; 10
+    jump @label_28               ; 13
+@label_15
+    add2 a1 a2 a1                ; 15
+    sub2 a2 a3 a2                ; 19
+    load2 32768 c1               ; 23
+    jump @label_6                ; 26
+@label_28
+    halt                         ; 28
+`
+	memory = append(memory, InstructionHalt.Value())
+	asm, err := Disassemble(memory, nil)
+	if err != nil {
+		t.Fatalf("disassemble error: %v", err)
+	}
+	if asm != expected {
+		t.Errorf("asm wrong.\ngot=\n%s\nwant=\n%s", asm, expected)
+	}
+
+	// 有符号表用原来的名字
+	asm, err = Disassemble(memory[:len(memory)-1], symbols)
+	if err != nil {
+		t.Fatalf("disassemble error: %v", err)
+	}
+	for _, s := range []string{"@loop\n", "while f1 @body ", "jump @end ", "jump @loop ", "@end\n"} {
+		if !strings.Contains(asm, s) {
+			t.Errorf("asm should contain %q.\nasm=\n%s", s, asm)
+		}
+	}
+}
+
+func TestDisassembleErrors(t *testing.T) {
+	tests := []struct {
+		program  []int64
+		expected string
+	}{
+		{[]int64{18}, "invalid instruction 18 at 0"},
+		{[]int64{InstructionHalt.Value(), -1}, "invalid instruction -1 at 1"},
+		{[]int64{InstructionPseudoCall.Value()}, "pseudo instruction .call at 0 can not be disassembled"},
+		{[]int64{InstructionAdd2.Value(), registerCodes["a1"], registerCodes["a2"]}, "add2 at 0: missing operands"},
+		{[]int64{InstructionPush.Value(), 7}, "push at 0: invalid register 7"},
+	}
+
+	for _, tt := range tests {
+		_, err := Disassemble(tt.program, nil)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("error wrong. got=%v, want=%q", err, tt.expected)
+		}
+	}
+}
+
+// assemble(disassemble(x)) == x
+func TestDisassembleRoundTrip(t *testing.T) {
+	check := func(memory []int64, symbols map[string]int64) {
+		t.Helper()
+		asm, err := Disassemble(memory, symbols)
+		if err != nil {
+			t.Fatalf("disassemble error: %v", err)
+		}
+		got, _ := assembleForTest(t, asm)
+		if !reflect.DeepEqual(got, memory) {
+			t.Fatalf("round trip wrong.\ngot=%v\nwant=%v\nasm=\n%s", got, memory, asm)
+		}
+	}
+
+	// 从 IR 生成的程序，带函数调用和各种跳转
+	codes := []string{
+		"var fact = function(n) {\nif (n <= 1) { return 1 }\nreturn n * fact(n - 1)\n}\nvar r = fact(6)",
+		"var r = 0\nfor (var i = 0; i < 5; i += 1) { if (i > 2) { r += i } else { r = -r } }",
+		"var r = 0\nwhile (r < 10) { r = r + 1 + (2 + (3 + (4 + 5))) }",
+	}
+	for _, code := range codes {
+		memory, symbols := assembleForTest(t, generateForTest(t, lowerForTest(t, code)))
+		check(memory, symbols)
+		check(memory, nil)
+	}
+
+	// 随机生成合法的机器码
+	random := rand.New(rand.NewSource(1))
+	registers := []string{"a1", "a2", "a3", "c1", "f1", "sp", "fp"}
+	instructions := []Instruction{}
+	for _, ins := range InstructionAll() {
+		if _, ok := instructionOperands[ins]; ok {
+			instructions = append(instructions, ins)
+		}
+	}
+	for n := 0; n < 200; n++ {
+		var memory []int64
+		var starts []int64
+		for len(memory) < 100 {
+			starts = append(starts, int64(len(memory)))
+			ins := instructions[random.Intn(len(instructions))]
+			memory = append(memory, ins.Value())
+			for _, kind := range instructionOperands[ins] {
+				switch kind {
+				case operandRegister:
+					memory = append(memory, registerCodes[registers[random.Intn(len(registers))]])
+				case operandImmediate:
+					memory = append(memory, int64(random.Intn(maxImmediate-minImmediate+1)+minImmediate))
+				case operandAddress:
+					// 一半跳到指令开头，一半随便一个地址
+					if random.Intn(2) == 0 {
+						memory = append(memory, int64(random.Intn(120)))
+					} else {
+						memory = append(memory, int64(random.Intn(MemorySize)))
+					}
+				}
+			}
+		}
+		symbols := map[string]int64{}
+		for i := 0; i < 3; i++ {
+			symbols["s"+strconv.Itoa(i)] = starts[random.Intn(len(starts))]
+		}
+		check(memory, symbols)
+		check(memory, nil)
+	}
+}
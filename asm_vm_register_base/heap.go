@@ -0,0 +1,180 @@
+package asm_vm_register_base
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// 堆，放字符串和数组
+//
+// 堆在内存的最后 8192 格 [HeapStart, MemorySize)，从低往高分配，不回收
+// 一个对象是长度加元素，跟栈上一样一个值占 2 格
+//
+//	address + 0        长度 n
+//	address + 2 + 2i   第 i 个元素，i < n
+//
+// 字符串的元素是字符的编码，数组的元素是任意的值
+// 寄存器里放的是类型标记加上对象相对 HeapStart 的位置，13 位刚好放得下整个堆
+//
+//	字符串 ValueTypeString + (address - HeapStart)
+//	数组   ValueTypeArray + (address - HeapStart)
+const (
+	HeapSize  = 1 << 13
+	HeapStart = MemorySize - HeapSize
+)
+
+// 对象头和元素占的格数
+func objectSize(length int64) int64 {
+	return 2 + 2*length
+}
+
+func isObjectType(valueType int64) bool {
+	return valueType == ValueTypeString || valueType == ValueTypeArray
+}
+
+// 分配一个 length 个元素的对象，元素都是 fill
+func (this *VM) allocate(valueType int64, length int64, fill int64) (int64, error) {
+	if length < 0 {
+		return 0, fmt.Errorf("negative length %d", length)
+	}
+	size := objectSize(length)
+	if this.HeapTop+size > MemorySize {
+		return 0, fmt.Errorf("heap overflow: %d more cells, %d left", size, MemorySize-this.HeapTop)
+	}
+	address := this.HeapTop
+	this.HeapTop += size
+	this.Memory[address] = length
+	for i := int64(0); i < length; i++ {
+		this.Memory[address+2+2*i] = fill
+	}
+	return valueType + (address - HeapStart), nil
+}
+
+// 从值里拿出对象的类型、地址和长度，不是分配过的对象就报错
+func (this *VM) object(value int64) (int64, int64, int64, error) {
+	t := valueType(value)
+	address := HeapStart + value&(HeapSize-1)
+	if !isObjectType(t) || address >= this.HeapTop {
+		return 0, 0, 0, fmt.Errorf("%d is not a string or array", value)
+	}
+	return t, address, this.Memory[address], nil
+}
+
+func (this *VM) element(value int64, index int64) (*int64, error) {
+	_, address, length, err := this.object(value)
+	if err != nil {
+		return nil, err
+	}
+	if index < 0 || index >= length {
+		return nil, fmt.Errorf("index %d out of range [0, %d)", index, length)
+	}
+	return &this.Memory[address+2+2*index], nil
+}
+
+// 把 values 里的对象依次复制到一个新的对象里，类型要一样
+func (this *VM) join(values ...int64) (int64, error) {
+	var valueType, length int64
+	for i, value := range values {
+		t, _, n, err := this.object(value)
+		if err != nil {
+			return 0, err
+		}
+		if i > 0 && t != valueType {
+			return 0, fmt.Errorf("can not join %s and %s", typeName(valueType), typeName(t))
+		}
+		valueType = t
+		length += n
+	}
+	result, err := this.allocate(valueType, length, 0)
+	if err != nil {
+		return 0, err
+	}
+	// 分配完再拿地址，value 可能就是刚才的对象
+	_, to, _, _ := this.object(result)
+	to += 2
+	for _, value := range values {
+		_, from, n, _ := this.object(value)
+		copy(this.Memory[to:to+2*n], this.Memory[from+2:from+2+2*n])
+		to += 2 * n
+	}
+	return result, nil
+}
+
+func typeName(valueType int64) string {
+	switch valueType {
+	case ValueTypeNumber:
+		return "number"
+	case ValueTypeString:
+		return "string"
+	case ValueTypeBool:
+		return "bool"
+	case ValueTypeNull:
+		return "null"
+	case ValueTypeArray:
+		return "array"
+	}
+	return "unknown"
+}
+
+// equals == 按类型比，null 可以跟什么都比，别的类型不一样就报错
+// 字符串比内容，数组比是不是同一个，跟栈虚拟机一样
+func (this *VM) equals(left int64, right int64) (bool, error) {
+	if left == ValueNull || right == ValueNull {
+		return left == right, nil
+	}
+	leftType, rightType := valueType(left), valueType(right)
+	if leftType != rightType {
+		return false, fmt.Errorf("unsupported types for comparison: %s %s", typeName(leftType), typeName(rightType))
+	}
+	if leftType != ValueTypeString || left == right {
+		return left == right, nil
+	}
+	_, leftAddress, leftLength, err := this.object(left)
+	if err != nil {
+		return false, err
+	}
+	_, rightAddress, rightLength, err := this.object(right)
+	if err != nil {
+		return false, err
+	}
+	if leftLength != rightLength {
+		return false, nil
+	}
+	for i := int64(0); i < leftLength; i++ {
+		if this.Memory[leftAddress+2+2*i] != this.Memory[rightAddress+2+2*i] {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// Inspect 把值转成字符串，格式跟栈虚拟机的 Inspect 一样
+func (this *VM) Inspect(value int64) string {
+	switch {
+	case isNumber(value):
+		return strconv.FormatInt(value, 10)
+	case value == ValueTrue:
+		return "true"
+	case value == ValueFalse:
+		return "false"
+	case value == ValueNull:
+		return "null"
+	}
+	valueType, address, length, err := this.object(value)
+	if err != nil {
+		return strconv.FormatInt(value, 10)
+	}
+	if valueType == ValueTypeString {
+		var s strings.Builder
+		for i := int64(0); i < length; i++ {
+			s.WriteRune(rune(this.Memory[address+2+2*i]))
+		}
+		return s.String()
+	}
+	items := []string{}
+	for i := int64(0); i < length; i++ {
+		items = append(items, this.Inspect(this.Memory[address+2+2*i]))
+	}
+	return fmt.Sprintf("%+v", items)
+}
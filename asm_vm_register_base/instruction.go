@@ -26,6 +26,18 @@ import "fmt"
 //20	multiply2	将两个16位寄存器值相乘
 //21    push reg 把数据推到栈上，栈指针 + 2
 //22    pop reg 把数据从栈上退出来，栈指针 - 2
+//39    mov2 r1 r2 把 r1 复制到 r2
+//40    load_fp2 n r 从 fp + n 的地址加载值到寄存器，n 可以是负数
+//41    save_fp2 r n 将寄存器值保存到 fp + n 的地址
+//42    new_array r1 r2 在堆上分配 r1 个元素的数组，元素是 null，r2 是数组
+//43    new_string r1 r2 在堆上分配 r1 个字符的字符串，字符是 0，r2 是字符串
+//44    get_index2 r1 r2 r3 r3 = r1[r2]，字符串取出来的是字符的编码
+//45    set_index2 r1 r2 r3 r1[r2] = r3
+//46    len2 r1 r2 r2 是字符串或数组 r1 的长度
+//47    copy2 r1 r2 复制一份 r1 到 r2，元素不深拷贝
+//48    concat2 r1 r2 r3 把 r1 r2 接起来放到新的对象 r3，两个都是字符串或者都是数组
+//49    print2 r 把 r 按 VM.Inspect 的格式输出一行
+//53    plus2 r1 r2 r3 源码里的 +，r1 r2 都是字符串的时候跟 concat2 一样，别的跟 add2 一样
 // Instruction
 
 type Instruction struct {
@@ -35,6 +47,9 @@ type Instruction struct {
 
 var (
 	validInstructions = []Instruction{}
+	// 内存里的一个数就是一条指令，直接用 value 当下标查
+	instructionByValue [256]Instruction
+	instructionByName  = map[string]Instruction{}
 
 	InstructionHalt = newInstruction("halt", 255)
 	// 16位指令
@@ -66,19 +81,118 @@ var (
 	InstructionMultiplyAssign        = newInstruction("num_mul_eq", 36)
 	InstructionDivideAssign          = newInstruction("num_div_eq", 37)
 	InstructionJump                  = newInstruction("jump", 38)
+	InstructionMove2                 = newInstruction("mov2", 39)
+	InstructionLoadFp2               = newInstruction("load_fp2", 40)
+	InstructionSaveFp2               = newInstruction("save_fp2", 41)
+	// 堆上的字符串和数组，布局见 heap.go
+	InstructionNewArray  = newInstruction("new_array", 42)
+	InstructionNewString = newInstruction("new_string", 43)
+	InstructionGetIndex2 = newInstruction("get_index2", 44)
+	InstructionSetIndex2 = newInstruction("set_index2", 45)
+	InstructionLen2      = newInstruction("len2", 46)
+	InstructionCopy2     = newInstruction("copy2", 47)
+	InstructionConcat2   = newInstruction("concat2", 48)
+	InstructionPrint2    = newInstruction("print2", 49)
 
 	InstructionIf    = newInstruction("if", 50)
 	InstructionWhile = newInstruction("while", 51)
 	InstructionFor   = newInstruction("for", 52)
 
+	InstructionPlus2 = newInstruction("plus2", 53)
+
 	InstructionPseudoFunction = newInstruction(".function", 100)
 	InstructionPseudoReturn   = newInstruction(".return", 101)
 	InstructionPseudoFuncVar  = newInstruction(".func_var", 102)
+	// 函数的伪指令怎么展开见 asm_to_bytecode.go 的调用约定
+	InstructionPseudoCall        = newInstruction(".call", 103)
+	InstructionPseudoEndFunction = newInstruction(".end_function", 104)
 )
 
+// 操作数的种类，机器码里每个操作数占一格
+type operandKind int
+
+const (
+	operandRegister  operandKind = iota // 寄存器编号，见 registerCodes
+	operandImmediate                    // 立即数
+	operandAddress                      // 内存地址
+)
+
+// 每条指令后面跟的操作数，伪指令不会出现在机器码里，所以不在这张表里
+// 读写的方向都是从左往右，比如 load2 @addr a1、save2 a1 @addr、add2 a1 a2 a3（a3 = a1 + a2）
+var instructionOperands = map[Instruction][]operandKind{
+	InstructionHalt:                  {},
+	InstructionSet2:                  {operandRegister, operandImmediate},
+	InstructionLoad2:                 {operandAddress, operandRegister},
+	InstructionAdd2:                  {operandRegister, operandRegister, operandRegister},
+	InstructionSave2:                 {operandRegister, operandAddress},
+	InstructionSubtract2:             {operandRegister, operandRegister, operandRegister},
+	InstructionLoadFromRegister2:     {operandRegister, operandRegister},
+	InstructionSaveFromRegister2:     {operandRegister, operandRegister},
+	InstructionJumpFromRegister:      {operandRegister},
+	InstructionShiftRight:            {operandRegister, operandRegister, operandRegister},
+	InstructionBitAnd:                {operandRegister, operandRegister, operandRegister},
+	InstructionMultiply2:             {operandRegister, operandRegister, operandRegister},
+	InstructionDiv2:                  {operandRegister, operandRegister, operandRegister},
+	InstructionPush:                  {operandRegister},
+	InstructionPop:                   {operandRegister},
+	InstructionBoolAnd:               {operandRegister, operandRegister, operandRegister},
+	InstructionBoolLessThan:          {operandRegister, operandRegister, operandRegister},
+	InstructionBoolGreaterThan:       {operandRegister, operandRegister, operandRegister},
+	InstructionBoolLessThanEquals:    {operandRegister, operandRegister, operandRegister},
+	InstructionBoolGreaterThanEquals: {operandRegister, operandRegister, operandRegister},
+	InstructionBoolEquals:            {operandRegister, operandRegister, operandRegister},
+	InstructionBoolNotEquals:         {operandRegister, operandRegister, operandRegister},
+	InstructionBoolOr:                {operandRegister, operandRegister, operandRegister},
+	InstructionBoolNot:               {operandRegister, operandRegister},
+	InstructionPlusAssign:            {operandRegister, operandRegister, operandRegister},
+	InstructionSubtractAssign:        {operandRegister, operandRegister, operandRegister},
+	InstructionMultiplyAssign:        {operandRegister, operandRegister, operandRegister},
+	InstructionDivideAssign:          {operandRegister, operandRegister, operandRegister},
+	InstructionJump:                  {operandAddress},
+	InstructionMove2:                 {operandRegister, operandRegister},
+	InstructionLoadFp2:               {operandImmediate, operandRegister},
+	InstructionSaveFp2:               {operandRegister, operandImmediate},
+	InstructionNewArray:              {operandRegister, operandRegister},
+	InstructionNewString:             {operandRegister, operandRegister},
+	InstructionGetIndex2:             {operandRegister, operandRegister, operandRegister},
+	InstructionSetIndex2:             {operandRegister, operandRegister, operandRegister},
+	InstructionLen2:                  {operandRegister, operandRegister},
+	InstructionCopy2:                 {operandRegister, operandRegister},
+	InstructionConcat2:               {operandRegister, operandRegister, operandRegister},
+	InstructionPrint2:                {operandRegister},
+	InstructionPlus2:                 {operandRegister, operandRegister, operandRegister},
+	// 寄存器是真就跳到地址，否则往下走
+	InstructionIf:    {operandRegister, operandAddress},
+	InstructionWhile: {operandRegister, operandAddress},
+	InstructionFor:   {operandRegister, operandAddress},
+}
+
+// 编译的时候不知道值是什么类型
+const valueTypeUnknown = -1
+
+// 源码里的 + 用哪条指令，left right 是编译的时候知道的两边的类型
+// 有一边是字符串就用 concat2，有一边是数字就用 add2，都不知道的时候用 plus2，运行的时候再看
+func plusInstruction(left int64, right int64) Instruction {
+	switch {
+	case left == ValueTypeString || right == ValueTypeString:
+		return InstructionConcat2
+	case left == ValueTypeNumber || right == ValueTypeNumber:
+		return InstructionAdd2
+	}
+	return InstructionPlus2
+}
+
 func newInstruction(name string, value int64) Instruction {
+	if value < 0 || value > 255 {
+		panic(fmt.Errorf("Instruction value out of range: (%s %d)", name, value))
+	}
+	if instructionByValue[value].name != "" {
+		panic(fmt.Errorf("duplicate Instruction value: (%s %d)", name, value))
+	}
 	o := Instruction{name: name, value: value}
 	validInstructions = append(validInstructions, o)
+	instructionByValue[value] = o
+	instructionByName[name] = o
 	return o
 }
 
@@ -87,12 +201,21 @@ func InstructionAll() []Instruction {
 }
 
 func (t Instruction) valid() bool {
-	for _, v := range InstructionAll() {
-		if v == t {
-			return true
-		}
+	return t.value >= 0 && t.value < 256 && t.name != "" && instructionByValue[t.value] == t
+}
+
+func GetInstructionFromName(s string) Instruction {
+	if v, ok := instructionByName[s]; ok {
+		return v
+	}
+	panic(fmt.Errorf("invalid Instruction name: (%+v)", s))
+}
+
+func GetInstructionFromValue(i int64) Instruction {
+	if i >= 0 && i < 256 && instructionByValue[i].name != "" {
+		return instructionByValue[i]
 	}
-	return false
+	panic(fmt.Errorf("invalid Instruction value: (%+v)", i))
 }
 
 func (t Instruction) Value() int64 {
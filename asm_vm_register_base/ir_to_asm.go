@@ -0,0 +1,355 @@
+package asm_vm_register_base
+
+import (
+	"errors"
+	"fmt"
+	"go-compiler/ir"
+	"strings"
+)
+
+// GenerateAsmFromIR 从 IR 生成汇编，寄存器虚拟机只从 IR 生成汇编
+//
+// 全局变量在栈底，第 i 个在 StackStart + 2i，
+// 顶层代码在前面，halt 以后是函数，函数按 asm_to_bytecode.go 的调用约定展开
+//
+// IR 的变量分两种
+//   - 只在一个块里用的（Function.LocalVars）用虚拟寄存器，交给 allocateRegisters 分配
+//   - 别的放在栈帧里，函数的参数在调用方压的位置，其他的从 fp 往上放，
+//     顶层代码的放在全局变量后面
+//
+// 块的标签是 @<函数名>.b<编号>，源码里的名字没有点，不会和函数的标签重名
+// 寄存器虚拟机只有整数、字符串和数组，小数这些 IR 里有但是这里没有的都返回 error
+func GenerateAsmFromIR(program *ir.Program) (string, error) {
+	this := &irAsmGenerator{program: program}
+	var asm strings.Builder
+
+	// 顶层代码的 fp 就是栈底，变量放在全局变量后面
+	globals := int64(len(program.Globals))
+	body, slots := this.function(program.Main, globals)
+	if slots > 0 {
+		asm.WriteString(fmt.Sprintf("set2 f1 %v\nadd2 sp f1 sp\n", 2*slots))
+	}
+	// 顶层代码的 return 是 halt
+	asm.WriteString(body)
+
+	for _, fn := range program.Functions {
+		body, slots := this.function(fn, 0)
+		asm.WriteString(fmt.Sprintf(".function @%v %v\n", fn.Name, slots))
+		for _, p := range fn.Params {
+			asm.WriteString(fmt.Sprintf(".func_var %v\n", p.Name))
+		}
+		asm.WriteString(body)
+		asm.WriteString(".end_function\n")
+	}
+	if len(this.errors) > 0 {
+		return "", errors.Join(this.errors...)
+	}
+	return asm.String(), nil
+}
+
+// GlobalAddress 第 index 个全局变量的地址
+func GlobalAddress(index int) int64 {
+	return StackStart + 2*int64(index)
+}
+
+type irAsmGenerator struct {
+	program *ir.Program
+	fn      *ir.Function
+	asm     strings.Builder
+	// 放在栈帧里的变量，相对 fp 的位置
+	slots map[*ir.Var]int64
+	// 只在一个块里用的变量的虚拟寄存器
+	registers map[*ir.Var]string
+	local     map[*ir.Var]*ir.Block
+	counter   int
+	// 生成不了的指令，生成完一起返回
+	errors []error
+}
+
+// 生成一个函数的汇编，slotBase 前面的位置已经被占了
+// 返回分好寄存器的汇编和栈帧里一共要留的位置（包括 slotBase）
+func (this *irAsmGenerator) function(fn *ir.Function, slotBase int64) (string, int64) {
+	this.fn, this.counter = fn, 0
+	this.asm.Reset()
+	this.slots = make(map[*ir.Var]int64)
+	this.registers = make(map[*ir.Var]string)
+	this.local = fn.LocalVars()
+
+	n := int64(len(fn.Params))
+	for i, p := range fn.Params {
+		this.slots[p] = -4 - 2*(n-int64(i))
+	}
+	slots := slotBase
+	for _, v := range fn.Vars {
+		_, isLocal := this.local[v]
+		if _, isParam := this.slots[v]; !isLocal && !isParam {
+			this.slots[v] = 2 * slots
+			slots += 1
+		}
+	}
+
+	for i, block := range fn.Blocks {
+		var next *ir.Block
+		if i+1 < len(fn.Blocks) {
+			next = fn.Blocks[i+1]
+		}
+		this.asm.WriteString("@" + this.label(block) + "\n")
+		for _, ins := range block.Instructions {
+			this.instruction(ins, next)
+		}
+	}
+	asm, spills := allocateRegisters(this.asm.String(), slots)
+	return asm, slots + spills
+}
+
+func (this *irAsmGenerator) label(block *ir.Block) string {
+	return fmt.Sprintf("%s.%s", this.fn.Name, block.Name())
+}
+
+func (this *irAsmGenerator) newRegister() string {
+	this.counter += 1
+	return fmt.Sprintf("v%d", this.counter)
+}
+
+func (this *irAsmGenerator) errorf(format string, args ...interface{}) {
+	this.errors = append(this.errors, fmt.Errorf("%s: %s", this.fn.Name, fmt.Sprintf(format, args...)))
+}
+
+func (this *irAsmGenerator) emit(format string, args ...interface{}) {
+	this.asm.WriteString(fmt.Sprintf(format, args...) + "\n")
+}
+
+// 把操作数放进寄存器
+func (this *irAsmGenerator) operand(value ir.Value) string {
+	switch v := value.(type) {
+	case *ir.Var:
+		if reg, ok := this.registers[v]; ok {
+			return reg
+		}
+		reg := this.newRegister()
+		this.emit("load_fp2 %v %v", this.slots[v], reg)
+		return reg
+	case *ir.Const:
+		reg := this.newRegister()
+		switch v.Kind {
+		case ir.ConstInt:
+			this.intConst(v.Int, reg)
+		case ir.ConstBool:
+			this.emit("set2 %v %v", reg, v.Bool)
+		case ir.ConstNull:
+			this.emit("set2 %v null", reg)
+		case ir.ConstString:
+			this.stringConst(v.Str, reg)
+		default:
+			this.errorf("register vm only supports integers, got %v", v)
+		}
+		return reg
+	}
+	this.errorf("invalid operand %v", value)
+	return this.newRegister()
+}
+
+// 立即数放不下的整数每次拼 15 位：reg = high * 32768 + low
+func (this *irAsmGenerator) intConst(n int64, reg string) {
+	if n >= minImmediate && n <= maxImmediate {
+		this.emit("set2 %v %v", reg, n)
+		return
+	}
+	if n < MinNumber || n > MaxNumber {
+		this.errorf("integer %d out of range [%d, %d]", n, int64(MinNumber), int64(MaxNumber))
+		return
+	}
+	high, shift, scaled, low := this.newRegister(), this.newRegister(), this.newRegister(), this.newRegister()
+	this.intConst(n>>15, high)
+	this.emit("set2 %v %v\nmul2 %v %v %v", shift, 1<<15, high, shift, scaled)
+	this.emit("set2 %v %v\nadd2 %v %v %v", low, n&(1<<15-1), scaled, low, reg)
+}
+
+// 字符串在堆上分配，一个字符一个元素
+func (this *irAsmGenerator) stringConst(s string, reg string) {
+	chars := []rune(s)
+	length := this.newRegister()
+	this.emit("set2 %v %v\nnew_string %v %v", length, len(chars), length, reg)
+	for i, c := range chars {
+		if c > maxImmediate {
+			this.errorf("character %q out of range", c)
+			continue
+		}
+		index, char := this.newRegister(), this.newRegister()
+		this.emit("set2 %v %v\nset2 %v %v\nset_index2 %v %v %v", index, i, char, c, reg, index, char)
+	}
+}
+
+// 结果写到哪个寄存器，放在栈帧里的变量写完还要 store
+func (this *irAsmGenerator) dest(v *ir.Var) string {
+	if _, ok := this.local[v]; ok {
+		if _, ok := this.registers[v]; !ok {
+			this.registers[v] = this.newRegister()
+		}
+		return this.registers[v]
+	}
+	return this.newRegister()
+}
+
+func (this *irAsmGenerator) store(v *ir.Var, reg string) {
+	if _, ok := this.local[v]; ok {
+		return
+	}
+	this.emit("save_fp2 %v %v", reg, this.slots[v])
+}
+
+var irInstructions = map[ir.Op]Instruction{
+	ir.OpAdd: InstructionAdd2,
+	ir.OpSub: InstructionSubtract2,
+	ir.OpMul: InstructionMultiply2,
+	ir.OpDiv: InstructionDiv2,
+	ir.OpEq:  InstructionBoolEquals,
+	ir.OpNe:  InstructionBoolNotEquals,
+	ir.OpLt:  InstructionBoolLessThan,
+	ir.OpLe:  InstructionBoolLessThanEquals,
+	ir.OpGt:  InstructionBoolGreaterThan,
+	ir.OpGe:  InstructionBoolGreaterThanEquals,
+}
+
+func (this *irAsmGenerator) instruction(ins *ir.Instruction, next *ir.Block) {
+	// 先把操作数都放进寄存器
+	args := make([]string, 0, len(ins.Args))
+	if ins.Op != ir.OpArray {
+		for _, arg := range ins.Args {
+			args = append(args, this.operand(arg))
+		}
+	}
+
+	switch ins.Op {
+	case ir.OpCopy:
+		// 放在栈帧里的变量直接存，不用再过一个寄存器
+		if _, ok := this.local[ins.Dest]; !ok {
+			this.store(ins.Dest, args[0])
+			break
+		}
+		this.emit("mov2 %v %v", args[0], this.dest(ins.Dest))
+	case ir.OpNeg:
+		zero, reg := this.newRegister(), this.dest(ins.Dest)
+		this.emit("set2 %v 0\nsub2 %v %v %v", zero, zero, args[0], reg)
+		this.store(ins.Dest, reg)
+	case ir.OpNot:
+		reg := this.dest(ins.Dest)
+		this.emit("bool_not %v %v", args[0], reg)
+		this.store(ins.Dest, reg)
+	case ir.OpArray:
+		// 先分配再一个一个填
+		length, reg := this.newRegister(), this.dest(ins.Dest)
+		this.emit("set2 %v %v\nnew_array %v %v", length, len(ins.Args), length, reg)
+		for i, arg := range ins.Args {
+			value := this.operand(arg)
+			index := this.newRegister()
+			this.emit("set2 %v %v\nset_index2 %v %v %v", index, i, reg, index, value)
+		}
+		this.store(ins.Dest, reg)
+	case ir.OpIndex:
+		reg := this.dest(ins.Dest)
+		this.emit("get_index2 %v %v %v", args[0], args[1], reg)
+		this.store(ins.Dest, reg)
+	case ir.OpSetIndex:
+		this.emit("set_index2 %v %v %v", args[0], args[1], args[2])
+	case ir.OpLoadGlobal:
+		reg := this.dest(ins.Dest)
+		this.emit("load2 %v %v", GlobalAddress(this.program.Global(ins.Name)), reg)
+		this.store(ins.Dest, reg)
+	case ir.OpStoreGlobal:
+		this.emit("save2 %v %v", args[0], GlobalAddress(this.program.Global(ins.Name)))
+	case ir.OpCall:
+		for _, arg := range args {
+			this.emit("push %v", arg)
+		}
+		this.emit(".call @%v %v", ins.Name, len(args))
+		// 返回值在 c1
+		if ins.Dest != nil {
+			reg := this.dest(ins.Dest)
+			this.emit("mov2 c1 %v", reg)
+			this.store(ins.Dest, reg)
+		}
+	case ir.OpBuiltin:
+		this.builtin(ins, args)
+	case ir.OpJump:
+		if ins.Targets[0] != next {
+			this.emit("jump @%v", this.label(ins.Targets[0]))
+		}
+	case ir.OpBranch:
+		this.emit("if %v @%v", args[0], this.label(ins.Targets[0]))
+		if ins.Targets[1] != next {
+			this.emit("jump @%v", this.label(ins.Targets[1]))
+		}
+	case ir.OpReturn:
+		switch {
+		case this.fn == this.program.Main:
+			this.emit(InstructionHalt.Name())
+		case len(args) == 0:
+			this.emit(".return")
+		default:
+			this.emit(".return %v", args[0])
+		}
+	case ir.OpMod:
+		// 没有取余的指令，a % b = a - a / b * b，除法往 0 取整，余数跟 a 同号，跟栈虚拟机一样
+		quotient, product, reg := this.newRegister(), this.newRegister(), this.dest(ins.Dest)
+		this.emit("div2 %v %v %v\nmul2 %v %v %v", args[0], args[1], quotient, quotient, args[1], product)
+		this.emit("sub2 %v %v %v", args[0], product, reg)
+		this.store(ins.Dest, reg)
+	default:
+		instruction, ok := irInstructions[ins.Op]
+		if !ok {
+			this.errorf("register vm does not support %s", ins.Op.Name())
+			return
+		}
+		if ins.Op == ir.OpAdd {
+			instruction = plusInstruction(constType(ins.Args[0]), constType(ins.Args[1]))
+		}
+		reg := this.dest(ins.Dest)
+		this.emit("%v %v %v %v", instruction.Name(), args[0], args[1], reg)
+		this.store(ins.Dest, reg)
+	}
+}
+
+// 常量的类型，变量是什么类型不知道
+func constType(value ir.Value) int64 {
+	c, ok := value.(*ir.Const)
+	if !ok {
+		return valueTypeUnknown
+	}
+	switch c.Kind {
+	case ir.ConstInt:
+		return ValueTypeNumber
+	case ir.ConstString:
+		return ValueTypeString
+	}
+	return valueTypeUnknown
+}
+
+// 内置函数直接展开成指令
+func (this *irAsmGenerator) builtin(ins *ir.Instruction, args []string) {
+	var reg string
+	if ins.Dest != nil {
+		reg = this.dest(ins.Dest)
+	} else {
+		reg = this.newRegister()
+	}
+	switch {
+	case ins.Name == "len" && len(args) == 1:
+		this.emit("len2 %v %v", args[0], reg)
+	case ins.Name == "push" && len(args) == 2:
+		one, tail, zero := this.newRegister(), this.newRegister(), this.newRegister()
+		this.emit("set2 %v 1\nnew_array %v %v", one, one, tail)
+		this.emit("set2 %v 0\nset_index2 %v %v %v", zero, tail, zero, args[1])
+		this.emit("concat2 %v %v %v", args[0], tail, reg)
+	case ins.Name == "log":
+		for _, arg := range args {
+			this.emit("print2 %v", arg)
+		}
+		this.emit("set2 %v null", reg)
+	default:
+		this.errorf("register vm does not support builtin %s with %d arguments", ins.Name, len(args))
+	}
+	if ins.Dest != nil {
+		this.store(ins.Dest, reg)
+	}
+}
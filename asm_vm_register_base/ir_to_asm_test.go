@@ -0,0 +1,335 @@
+package asm_vm_register_base
+
+import (
+	"bytes"
+	"go-compiler/ir"
+	sansLexer "go-compiler/lexer"
+	sansParser "go-compiler/parser"
+	"reflect"
+	"testing"
+)
+
+func lowerForTest(t *testing.T, code string) *ir.Program {
+	t.Helper()
+	lexer := sansLexer.NewSansLangLexer(code)
+	tokensLexer := sansLexer.TokenList{
+		Tokens: lexer.TokenList(),
+	}
+	program, err := ir.Lower(sansParser.NewSansLangParser(&tokensLexer).Parse())
+	if err != nil {
+		t.Fatalf("lower error: %v", err)
+	}
+	return program
+}
+
+func generateForTest(t *testing.T, program *ir.Program) string {
+	t.Helper()
+	asm, err := GenerateAsmFromIR(program)
+	if err != nil {
+		t.Fatalf("GenerateAsmFromIR error: %v", err)
+	}
+	return asm
+}
+
+func runIRProgram(t *testing.T, code string) (*VM, *ir.Program) {
+	t.Helper()
+	program := lowerForTest(t, code)
+	asm := generateForTest(t, program)
+	assembler := NewAssembler()
+	assembler.AddAsm(asm)
+	memory, err := assembler.Compile()
+	if err != nil {
+		t.Fatalf("asm error: %v\nasm=\n%s", err, asm)
+	}
+	vm := NewVM(memory)
+	vm.Output = &bytes.Buffer{}
+	if err := vm.Run(); err != nil {
+		t.Fatalf("vm error: %v\nasm=\n%s", err, asm)
+	}
+	return vm, program
+}
+
+// 生成汇编、汇编、跑起来，返回全局变量的值
+func runRegisterCode(t *testing.T, code string, names ...string) []int64 {
+	t.Helper()
+	_, values := runRegisterProgram(t, code, names...)
+	return values
+}
+
+func runRegisterProgram(t *testing.T, code string, names ...string) (*VM, []int64) {
+	t.Helper()
+	vm, program := runIRProgram(t, code)
+	values := []int64{}
+	for _, name := range names {
+		values = append(values, vm.Memory[GlobalAddress(program.Global(name))])
+	}
+	return vm, values
+}
+
+func TestGenerateAsmFromIR(t *testing.T) {
+	program := lowerForTest(t, "var a = 1\nwhile (a < 10) { a = a * 2 }")
+	// 先把全局变量的位置留出来
+	expected := `set2 f1 2
+add2 sp f1 sp
+@main.b0
+set2 a1 1
+save2 a1 32768
+@main.b1
+load2 32768 a1
+set2 a2 10
+bool_lt a1 a2 a1
+if a1 @main.b2
+jump @main.b3
+@main.b2
+load2 32768 a1
+set2 a2 2
+mul2 a1 a2 a1
+save2 a1 32768
+jump @main.b1
+@main.b3
+halt
+`
+	if got := generateForTest(t, program); got != expected {
+		t.Errorf("asm wrong.\ngot=\n%s\nwant=\n%s", got, expected)
+	}
+}
+
+func TestRegisterIR(t *testing.T) {
+	tests := []struct {
+		code     string
+		expected int64
+	}{
+		{"var r = 1 + 2 * 3 - -4", 11},
+		{"var a = push([1, 2], 3)\nvar r = a[2] + len(a)", 6},
+		{"var a = [1, 2]\na[1] += 5\nvar r = a[1]", 7},
+		{`var r = len("你好")`, 2},
+		{"var s = \"ab\"\nvar r = len(s + \"cd\") + len(s + s)", 8},
+		// 立即数放不下的常量分几次拼出来
+		{"var r = 1600000000 - 100000", 1599900000},
+		{"var r = 140737488355327", MaxNumber},
+		{"var r = false or 3", 3},
+		// 取余用除法拼出来，余数跟被除数同号
+		{"var r = 17 % 5", 2},
+		{"var r = -17 % 5", -2},
+		{"var r = 17 % -5", 2},
+		{"var a = 100000\nvar r = (a * a + 7) % a", 7},
+		// 0 也是真的
+		{"var r = 0 or 3", 0},
+		{`
+			var fib = function(n) {
+				if (n < 2) {
+					return n
+				}
+				return fib(n - 1) + fib(n - 2)
+			}
+			var r = fib(15)
+		`, 610},
+		// 一个循环里有好几个 break
+		{`
+			var r = 0
+			while (true) {
+				r += 1
+				if (r == 3) {
+					break
+				}
+				if (r > 10) {
+					break
+				}
+			}
+		`, 3},
+		// 跨块的变量放在栈帧里
+		{`
+			var sum = function(n) {
+				var s = 0
+				for (var i = 0; i < n; i += 1) {
+					if (i == 1) {
+						continue
+					}
+					s += i
+				}
+				return s
+			}
+			var r = sum(5)
+		`, 9},
+	}
+
+	for _, tt := range tests {
+		vm, program := runIRProgram(t, tt.code)
+		got := vm.Memory[GlobalAddress(program.Global("r"))]
+		if got != tt.expected {
+			t.Errorf("%q: r wrong. got=%d, want=%d", tt.code, got, tt.expected)
+		}
+	}
+}
+
+// 寄存器虚拟机没有的东西返回 error，不 panic
+func TestGenerateAsmFromIRErrors(t *testing.T) {
+	tests := []struct {
+		code     string
+		expected string
+	}{
+		{"var a = 1.5", "main: register vm only supports integers, got 1.5"},
+		{"var f = function() { return 2.5 * 2 }", "f: register vm only supports integers, got 2.5"},
+		{"var a = 140737488355328", "main: integer 140737488355328 out of range [-140737488355328, 140737488355327]"},
+		{"var a = len(1, 2)", "main: register vm does not support builtin len with 2 arguments"},
+	}
+
+	for _, tt := range tests {
+		_, err := GenerateAsmFromIR(lowerForTest(t, tt.code))
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("%q: error wrong. got=%v, want=%q", tt.code, err, tt.expected)
+		}
+	}
+}
+
+func TestRegisterFunctionCall(t *testing.T) {
+	tests := []struct {
+		code     string
+		expected []int64
+	}{
+		{`
+			var fact = function(n) {
+				if (n <= 1) {
+					return 1
+				}
+				return n * fact(n - 1)
+			}
+			var r = fact(6)
+		`, []int64{720}},
+		{`
+			var fib = function(n) {
+				if (n < 2) {
+					return n
+				}
+				return fib(n - 1) + fib(n - 2)
+			}
+			var r = fib(15)
+		`, []int64{610}},
+		// 参数的顺序、局部变量、调用前正在用的临时值
+		{`
+			var sub = function(a, b) {
+				var d = a - b
+				return d
+			}
+			var r = 100 + sub(10, 3) * sub(5, 3)
+		`, []int64{114}},
+		// 没有 return 返回 null，函数里可以改全局变量
+		{`
+			var g = 1
+			var set = function(x) {
+				g = x
+			}
+			var r = set(7)
+		`, []int64{7, ValueNull}},
+	}
+
+	for _, tt := range tests {
+		names := []string{"r"}
+		if len(tt.expected) == 2 {
+			names = []string{"g", "r"}
+		}
+		got := runRegisterCode(t, tt.code, names...)
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("result wrong. got=%v, want=%v\ncode=%s", got, tt.expected, tt.code)
+		}
+	}
+}
+
+func TestRegisterControlFlow(t *testing.T) {
+	tests := []struct {
+		code     string
+		expected int64
+	}{
+		// 没有 else 的 if，条件不成立的时候不能走进去
+		{"var r = 1\nif (r > 5) { r = 2 }", 1},
+		{"var r = 1\nif (r < 5) { r = 2 }", 2},
+		{"var r = 1\nif (r > 5) { r = 2 } else { r = 3 }", 3},
+		{"var r = 1\nif (r > 5) { r = 2 } else if (r == 1) { if (r > 0) { r = 4 } else { r = 5 } } else { r = 6 }", 4},
+		{"var r = 0\nvar i = 0\nwhile (i < 10) { i += 1\nr = r + i }", 55},
+		{"var r = 0\nfor (var i = 0; i < 5; i += 1) { r += i }", 10},
+		{"var r = -3\nr = -r", 3},
+		{"var r = not (1 > 2)", ValueTrue},
+	}
+
+	for _, tt := range tests {
+		got := runRegisterCode(t, tt.code, "r")
+		if got[0] != tt.expected {
+			t.Errorf("result wrong. got=%v, want=%v\ncode=%s", got[0], tt.expected, tt.code)
+		}
+	}
+}
+
+func TestRegisterHeap(t *testing.T) {
+	tests := []struct {
+		code     string
+		expected string
+	}{
+		{`var r = "hello"`, "hello"},
+		{`var r = ""`, ""},
+		{`var r = "你好"[1]`, "22909"},
+		{`var r = len("hello")`, "5"},
+		// 字符串的 + 是接起来，不知道类型的时候运行的时候再看
+		{`var s = "ab"` + "\n" + `var r = s + "cd"`, "abcd"},
+		{`var s = "ab"` + "\n" + `var t = "cd"` + "\n" + `var r = s + t`, "abcd"},
+		{`var r = "a"` + "\n" + `r += "b"`, "ab"},
+		{"var a = 16385\nvar r = a + a", "32770"},
+		{`var r = [1, 2 + 3, true, null, "s"]`, "[1 5 true null s]"},
+		{`var r = []`, "[]"},
+		{`var r = [[1, 2], [3]][0][1]`, "2"},
+		{`var r = len([1, 2, 3])`, "3"},
+		{"var a = [1, 2, 3]\na[1] = 20\nvar r = a", "[1 20 3]"},
+		{"var a = [0, 0]\nvar r = a[0] = 7\nr = [r, a[0]]", "[7 7]"},
+		// push 返回新的数组，原来的不变
+		{"var a = [1]\nvar b = push(a, 2)\nvar r = [a, b]", "[[1] [1 2]]"},
+		// 数组里的值活过函数调用
+		{`
+			var sum = function(a) {
+				var s = 0
+				for (var i = 0; i < len(a); i += 1) {
+					s += a[i]
+				}
+				return s
+			}
+			var r = [sum([1, 2, 3]), sum([]), sum([10, sum([1, 1])])]
+		`, "[6 0 12]"},
+		{`
+			var range = function(n) {
+				var a = []
+				for (var i = 0; i < n; i += 1) {
+					a = push(a, i * i)
+				}
+				return a
+			}
+			var r = range(5)
+		`, "[0 1 4 9 16]"},
+	}
+
+	for _, tt := range tests {
+		vm, values := runRegisterProgram(t, tt.code, "r")
+		if got := vm.Inspect(values[0]); got != tt.expected {
+			t.Errorf("result wrong. got=%s, want=%s\ncode=%s", got, tt.expected, tt.code)
+		}
+	}
+}
+
+func TestRegisterLog(t *testing.T) {
+	tests := []struct {
+		code     string
+		expected string
+	}{
+		{`var r = log(1)`, "1\n"},
+		{`var r = log()`, ""},
+		{`var r = log("a", [1, "b"], true, null, 2 + 3)`, "a\n[1 b]\ntrue\nnull\n5\n"},
+		{"var i = 0\nwhile (i < 3) {\n  log(i)\n  i += 1\n}\nvar r = null", "0\n1\n2\n"},
+	}
+
+	for _, tt := range tests {
+		vm, values := runRegisterProgram(t, tt.code, "r")
+		if got := vm.Output.(*bytes.Buffer).String(); got != tt.expected {
+			t.Errorf("output wrong. got=%q, want=%q\ncode=%s", got, tt.expected, tt.code)
+		}
+		if values[0] != ValueNull {
+			t.Errorf("log should return null, got=%s", vm.Inspect(values[0]))
+		}
+	}
+}
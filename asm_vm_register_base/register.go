@@ -1,37 +1,26 @@
 package asm_vm_register_base
 
-import "fmt"
-
+// 汇编器用来查寄存器的编号
 type Register struct {
-	RegisterPointer int
 }
 
 func NewRegister() *Register {
-	return &Register{
-		RegisterPointer: 1,
-	}
-}
-
-// 分配和回收寄存器
-func (this *Register) ReturnRegAlloc() string {
-	s := fmt.Sprintf("a%d", this.RegisterPointer)
-	this.RegisterPointer += 1
-	return s
+	return &Register{}
 }
 
-func (this *Register) ReturnRegPop() string {
-	this.RegisterPointer -= 1
-	s := fmt.Sprintf("a%d", this.RegisterPointer)
-	return s
+// 寄存器在机器码里的编号，高 4 位是寄存器的序号
+// a1 a2 a3 分给虚拟寄存器，c1 放函数返回值，f1 给伪指令展开用，c1 f1 也用来中转溢出的值
+// sp 栈指针，指向栈顶的下一个空位，fp 当前函数栈帧的起点
+var registerCodes = map[string]int64{
+	"a1": 0b00010000,
+	"a2": 0b00100000,
+	"a3": 0b00110000,
+	"c1": 0b01000000,
+	"f1": 0b01010000,
+	"sp": 0b01100000,
+	"fp": 0b01110000,
 }
 
 func (this *Register) ReturnRegByName(name string) int64 {
-	registerMap := map[string]int{
-		"a1": 0b00010000,
-		"a2": 0b00100000,
-		"a3": 0b00110000,
-		"c1": 0b01000000,
-		"f1": 0b01010000,
-	}
-	return int64(registerMap[name])
+	return registerCodes[name]
 }
@@ -0,0 +1,225 @@
+package asm_vm_register_base
+
+import (
+	"fmt"
+	"go-compiler/utils"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// 线性扫描分配寄存器（Poletto & Sarkar）
+//
+// GenerateAsmFromIR 生成的汇编里每个值用一个虚拟寄存器 v1 v2 …，一个块里的值不会跨过标签，
+// 所以按行号算出每个虚拟寄存器从定义到最后一次使用的区间，就是它的活跃区间
+//
+//   - 区间按起点排序，依次分给 a1 a2 a3，结束的区间把寄存器还回来
+//   - 没有空闲寄存器的时候，结束得最晚的那个溢出到栈帧里
+//   - 寄存器是调用方保存的，跨过 .call 的区间直接溢出
+//
+// 溢出的值放在 fp 往上第 slotBase 个值以后（前面是局部变量或者全局变量），
+// 读的时候用 c1 f1 中转，写的时候先写 c1 再 save_fp2
+var allocatableRegisters = []string{"a1", "a2", "a3"}
+
+var virtualRegisterPattern = regexp.MustCompile(`^v[0-9]+$`)
+
+type liveInterval struct {
+	name  string
+	start int
+	end   int
+	// 分到的寄存器，溢出的时候是空的
+	register string
+	// 溢出的时候在第几个栈槽
+	slot int64
+}
+
+// 指令里第几个操作数是写的，其他的寄存器操作数都是读的
+func writtenOperand(name string) int {
+	switch name {
+	case InstructionSet2.Name(), InstructionPop.Name():
+		return 1
+	case InstructionLoad2.Name(), InstructionLoadFromRegister2.Name(), InstructionLoadFp2.Name(),
+		InstructionMove2.Name(), InstructionBoolNot.Name(),
+		InstructionNewArray.Name(), InstructionNewString.Name(), InstructionLen2.Name(), InstructionCopy2.Name():
+		return 2
+	case InstructionSetIndex2.Name():
+		// 三个都是读的
+		return 0
+	}
+	ins, ok := instructionByName[name]
+	if !ok {
+		return 0
+	}
+	kinds := instructionOperands[ins]
+	if len(kinds) == 3 && kinds[0] == operandRegister && kinds[1] == operandRegister && kinds[2] == operandRegister {
+		return 3
+	}
+	return 0
+}
+
+// allocateRegisters 把 asm 里的虚拟寄存器换成 a1 a2 a3，返回新的 asm 和用掉的栈槽数
+func allocateRegisters(asm string, slotBase int64) (string, int64) {
+	lines := strings.Split(strings.TrimSuffix(asm, "\n"), "\n")
+	if asm == "" {
+		lines = nil
+	}
+
+	// 1. 算活跃区间
+	intervals := make(map[string]*liveInterval)
+	var order []*liveInterval
+	var calls, labels []int
+	for i, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(fields[0], "@"):
+			labels = append(labels, i)
+		case fields[0] == InstructionPseudoCall.Name():
+			calls = append(calls, i)
+		}
+		for _, field := range fields[1:] {
+			if !virtualRegisterPattern.MatchString(field) {
+				continue
+			}
+			interval, ok := intervals[field]
+			if !ok {
+				interval = &liveInterval{name: field, start: i, end: i}
+				intervals[field] = interval
+				order = append(order, interval)
+			}
+			interval.end = i
+		}
+	}
+	for _, interval := range order {
+		for _, label := range labels {
+			if interval.start < label && label < interval.end {
+				utils.LogError("allocateRegisters value lives across label", interval.name, lines[label])
+			}
+		}
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return order[i].start < order[j].start
+	})
+
+	// 2. 按起点扫描
+	free := append([]string{}, allocatableRegisters...)
+	var active []*liveInterval
+	var freeSlots []int64
+	var spilledActive []*liveInterval
+	var slots int64
+	// 空出来的栈槽只能给从当前位置开始的区间，更早开始的区间前半段可能和栈槽原来的主人重叠
+	spill := func(interval *liveInterval, reuse bool) {
+		interval.register = ""
+		if reuse && len(freeSlots) > 0 {
+			interval.slot = freeSlots[0]
+			freeSlots = freeSlots[1:]
+		} else {
+			interval.slot = slots
+			slots += 1
+		}
+		spilledActive = append(spilledActive, interval)
+	}
+	for _, interval := range order {
+		// 结束的区间把寄存器和栈槽还回来，同一行先读后写，所以 end == start 也可以复用
+		var stillActive []*liveInterval
+		for _, a := range active {
+			if a.end <= interval.start {
+				free = append(free, a.register)
+			} else {
+				stillActive = append(stillActive, a)
+			}
+		}
+		active = stillActive
+		var stillSpilled []*liveInterval
+		for _, s := range spilledActive {
+			if s.end <= interval.start {
+				freeSlots = append(freeSlots, s.slot)
+			} else {
+				stillSpilled = append(stillSpilled, s)
+			}
+		}
+		spilledActive = stillSpilled
+		sort.Strings(free)
+		sort.Slice(freeSlots, func(i, j int) bool { return freeSlots[i] < freeSlots[j] })
+
+		crossCall := false
+		for _, call := range calls {
+			if interval.start < call && call < interval.end {
+				crossCall = true
+				break
+			}
+		}
+		if crossCall {
+			spill(interval, true)
+			continue
+		}
+
+		if len(free) > 0 {
+			interval.register = free[0]
+			free = free[1:]
+			active = append(active, interval)
+			continue
+		}
+
+		// 没有寄存器了，结束得最晚的溢出
+		furthest := 0
+		for i, a := range active {
+			if a.end > active[furthest].end {
+				furthest = i
+			}
+		}
+		victim := active[furthest]
+		if victim.end > interval.end {
+			interval.register = victim.register
+			active[furthest] = interval
+			spill(victim, false)
+		} else {
+			spill(interval, true)
+		}
+	}
+
+	// 3. 改写汇编
+	var result strings.Builder
+	for i, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			result.WriteString(line + "\n")
+			continue
+		}
+		written := writtenOperand(fields[0])
+		var before, after string
+		// 读的溢出值依次用 c1 f1 中转
+		scratch := []string{"c1", "f1"}
+		for j := 1; j < len(fields); j++ {
+			interval, ok := intervals[fields[j]]
+			if !ok {
+				continue
+			}
+			if interval.register != "" {
+				fields[j] = interval.register
+				continue
+			}
+			offset := 2 * (slotBase + interval.slot)
+			if j == written {
+				fields[j] = "c1"
+				after += fmt.Sprintf("%s c1 %v\n", InstructionSaveFp2.Name(), offset)
+				continue
+			}
+			if len(scratch) == 0 {
+				utils.LogError("allocateRegisters too many spilled operands", lines[i])
+			}
+			fields[j] = scratch[0]
+			before += fmt.Sprintf("%s %v %s\n", InstructionLoadFp2.Name(), offset, scratch[0])
+			scratch = scratch[1:]
+		}
+		result.WriteString(before)
+		// 两边都溢出的 mov2 就是 mov2 c1 c1
+		if !(fields[0] == InstructionMove2.Name() && fields[1] == fields[2]) {
+			result.WriteString(strings.Join(fields, " ") + "\n")
+		}
+		result.WriteString(after)
+	}
+	return result.String(), slots
+}
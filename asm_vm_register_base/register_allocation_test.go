@@ -0,0 +1,86 @@
+package asm_vm_register_base
+
+import (
+	"testing"
+)
+
+func TestAllocateRegisters(t *testing.T) {
+	tests := []struct {
+		asm      string
+		slotBase int64
+		expected string
+		spills   int64
+	}{
+		// 同一行先读后写，结束的寄存器马上可以用
+		{
+			"set2 v1 1\nset2 v2 2\nadd2 v1 v2 v3\npush v3\n",
+			0,
+			"set2 a1 1\nset2 a2 2\nadd2 a1 a2 a1\npush a1\n",
+			0,
+		},
+		// 寄存器不够，结束得最晚的 v1 溢出，溢出的槽在 slotBase 后面
+		{
+			"set2 v1 1\nset2 v2 2\nset2 v3 3\nset2 v4 4\nadd2 v3 v4 v5\nadd2 v2 v5 v6\nadd2 v1 v6 v7\n",
+			3,
+			"set2 c1 1\nsave_fp2 c1 6\nset2 a2 2\nset2 a3 3\nset2 a1 4\nadd2 a3 a1 a1\nadd2 a2 a1 a1\nload_fp2 6 c1\nadd2 c1 a1 a1\n",
+			1,
+		},
+		// 跨过调用的值放到栈上，mov2 c1 到溢出的值不用中转
+		{
+			"set2 v1 5\n.call @f 0\nmov2 c1 v2\nadd2 v1 v2 v3\n.call @f 0\nmov2 c1 v4\n",
+			0,
+			"set2 c1 5\nsave_fp2 c1 0\n.call @f 0\nmov2 c1 a1\nload_fp2 0 c1\nadd2 c1 a1 a1\n.call @f 0\nmov2 c1 a1\n",
+			1,
+		},
+		{
+			"set2 v1 5\n.call @f 0\n.call @g 0\nmov2 c1 v2\nmov2 v1 v3\n.return v3\n",
+			0,
+			"set2 c1 5\nsave_fp2 c1 0\n.call @f 0\n.call @g 0\nmov2 c1 a1\nload_fp2 0 c1\nmov2 c1 a1\n.return a1\n",
+			1,
+		},
+		{"", 2, "", 0},
+	}
+
+	for _, tt := range tests {
+		asm, spills := allocateRegisters(tt.asm, tt.slotBase)
+		if asm != tt.expected || spills != tt.spills {
+			t.Errorf("%q: allocation wrong.\ngot=\n%s(%d spills)\nwant=\n%s(%d spills)", tt.asm, asm, spills, tt.expected, tt.spills)
+		}
+	}
+}
+
+func TestRegisterSpill(t *testing.T) {
+	tests := []struct {
+		code     string
+		expected int64
+	}{
+		// 同时活着的值比 a1 a2 a3 多
+		{"var r = 1 + (2 + (3 + (4 + (5 + 6))))", 21},
+		{"var a = 2\nvar r = a * (a + (a * (a + (a - (a + 1)))))", 8},
+		// 调用前算好的值要活过调用
+		{`
+			var id = function(x) {
+				return x
+			}
+			var r = 1 + id(2) * (3 + id(4)) - id(id(5))
+		`, 10},
+		// 函数里溢出的值放在局部变量后面
+		{`
+			var id = function(x) {
+				return x
+			}
+			var f = function(a) {
+				var b = a + 1
+				return a * (b + (a + (b + id(a + (b + (a + b))))))
+			}
+			var r = f(2)
+		`, 36},
+	}
+
+	for _, tt := range tests {
+		got := runRegisterCode(t, tt.code, "r")
+		if got[0] != tt.expected {
+			t.Errorf("result wrong. got=%v, want=%v\ncode=%s", got[0], tt.expected, tt.code)
+		}
+	}
+}
@@ -0,0 +1,387 @@
+package asm_vm_register_base
+
+import (
+	"fmt"
+	"go-compiler/utils"
+	"io"
+	"os"
+)
+
+// 寄存器虚拟机，执行 Assembler.Compile 生成的机器码
+//
+// 内存一格是一个 int64，地址按格算，机器码从 0 开始放
+//
+//	[0, StackStart)          程序
+//	[StackStart, HeapStart)  栈，往高地址长，push 一次占 2 格
+//	[HeapStart, MemorySize)  堆，字符串和数组，见 heap.go
+//
+// 值在寄存器和内存里按 int64 存，数字直接存，别的类型见下面的类型标记
+const (
+	MemorySize = 1 << 16
+	StackStart = 1 << 15
+)
+
+// 值的类型标记，在第 48 位往上，低 13 位放对象在堆上的位置或者布尔值
+// 数字只能在 [MinNumber, MaxNumber] 里，算出来超出范围就报错，不会跟类型标记混在一起
+const (
+	ValueTypeNumber = 0 << 48
+	ValueTypeString = 1 << 48
+	ValueTypeBool   = 2 << 48
+	ValueTypeNull   = 3 << 48
+	ValueTypeArray  = 4 << 48
+
+	ValueFalse = ValueTypeBool + 0
+	ValueTrue  = ValueTypeBool + 1
+	ValueNull  = ValueTypeNull + 0
+
+	MinNumber = -1 << 47
+	MaxNumber = 1<<47 - 1
+)
+
+type VM struct {
+	Memory []int64
+	// 下一条要执行的指令地址
+	Pc     int64
+	Halted bool
+	// 堆上下一个空位
+	HeapTop int64
+	// print2 输出到这里
+	Output io.Writer
+
+	// 按寄存器编号的高 4 位存，a1 是 1，sp 是 6
+	registers   [8]int64
+	programSize int
+}
+
+var (
+	spIndex = registerCodes["sp"] >> 4
+	fpIndex = registerCodes["fp"] >> 4
+)
+
+func NewVM(program []int64) *VM {
+	memory := make([]int64, MemorySize)
+	copy(memory, program)
+	vm := &VM{
+		Memory:      memory,
+		Pc:          0,
+		HeapTop:     HeapStart,
+		Output:      os.Stdout,
+		programSize: len(program),
+	}
+	vm.SetRegister("sp", StackStart)
+	vm.SetRegister("fp", StackStart)
+	return vm
+}
+
+// Register 读寄存器，name 是 a1、a2、a3、c1、f1、sp、fp
+func (this *VM) Register(name string) int64 {
+	code, ok := registerCodes[name]
+	if !ok {
+		utils.LogError("VM.Register invalid register", name)
+	}
+	return this.registers[code>>4]
+}
+
+func (this *VM) SetRegister(name string, value int64) {
+	code, ok := registerCodes[name]
+	if !ok {
+		utils.LogError("VM.SetRegister invalid register", name)
+	}
+	this.registers[code>>4] = value
+}
+
+// Run 一直执行到 halt
+func (this *VM) Run() error {
+	if this.programSize > StackStart {
+		return fmt.Errorf("program too large: %d > %d", this.programSize, StackStart)
+	}
+	for !this.Halted {
+		if err := this.Step(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Step 执行一条指令，出错的时候 Pc 停在这条指令上
+func (this *VM) Step() error {
+	if this.Halted {
+		return nil
+	}
+	pc := this.Pc
+	if pc < 0 || pc >= StackStart {
+		return fmt.Errorf("pc out of program memory: %d", pc)
+	}
+	op := this.Memory[pc]
+	if op < 0 || op > 255 || instructionByValue[op].name == "" {
+		return fmt.Errorf("invalid instruction %d at %d", op, pc)
+	}
+	ins := instructionByValue[op]
+	kinds, ok := instructionOperands[ins]
+	if !ok {
+		return fmt.Errorf("pseudo instruction %s at %d can not be executed", ins.name, pc)
+	}
+	if pc+int64(len(kinds)) >= MemorySize {
+		return fmt.Errorf("%s at %d: missing operands", ins.name, pc)
+	}
+	operands := this.Memory[pc+1 : pc+1+int64(len(kinds))]
+	for i, kind := range kinds {
+		if kind == operandRegister && !validRegisterCode(operands[i]) {
+			return fmt.Errorf("%s at %d: invalid register %d", ins.name, pc, operands[i])
+		}
+	}
+	utils.LogInfo("register vm", pc, ins.name, operands)
+
+	// 先把 pc 挪到下一条，跳转指令再改掉
+	this.Pc = pc + 1 + int64(len(kinds))
+	err := this.execute(ins, operands)
+	if err != nil {
+		this.Pc = pc
+		return fmt.Errorf("%s at %d: %v", ins.name, pc, err)
+	}
+	return nil
+}
+
+func (this *VM) execute(ins Instruction, operands []int64) error {
+	// 寄存器操作数在 Step 里检查过了
+	reg := func(i int) *int64 {
+		return &this.registers[operands[i]>>4]
+	}
+
+	switch ins {
+	case InstructionHalt:
+		this.Halted = true
+	case InstructionSet2:
+		*reg(0) = operands[1]
+	case InstructionLoad2:
+		v, err := this.load(operands[0])
+		if err != nil {
+			return err
+		}
+		*reg(1) = v
+	case InstructionSave2:
+		return this.save(operands[1], *reg(0))
+	case InstructionLoadFromRegister2:
+		v, err := this.load(*reg(0))
+		if err != nil {
+			return err
+		}
+		*reg(1) = v
+	case InstructionSaveFromRegister2:
+		return this.save(*reg(1), *reg(0))
+	case InstructionLoadFp2:
+		v, err := this.load(this.registers[fpIndex] + operands[0])
+		if err != nil {
+			return err
+		}
+		*reg(1) = v
+	case InstructionSaveFp2:
+		return this.save(this.registers[fpIndex]+operands[1], *reg(0))
+	case InstructionMove2:
+		*reg(1) = *reg(0)
+	case InstructionPush:
+		sp := &this.registers[spIndex]
+		if *sp < StackStart || *sp+2 > HeapStart {
+			return fmt.Errorf("stack overflow")
+		}
+		this.Memory[*sp] = *reg(0)
+		*sp += 2
+	case InstructionPop:
+		sp := &this.registers[spIndex]
+		if *sp-2 < StackStart || *sp > HeapStart {
+			return fmt.Errorf("stack underflow")
+		}
+		*sp -= 2
+		*reg(0) = this.Memory[*sp]
+	case InstructionJump:
+		this.Pc = operands[0]
+	case InstructionJumpFromRegister:
+		this.Pc = *reg(0)
+	case InstructionIf, InstructionWhile, InstructionFor:
+		if truthy(*reg(0)) {
+			this.Pc = operands[1]
+		}
+	case InstructionBoolNot:
+		*reg(1) = boolValue(!truthy(*reg(0)))
+	case InstructionNewArray, InstructionNewString:
+		valueType, fill := int64(ValueTypeArray), int64(ValueNull)
+		if ins == InstructionNewString {
+			valueType, fill = ValueTypeString, 0
+		}
+		v, err := this.allocate(valueType, *reg(0), fill)
+		if err != nil {
+			return err
+		}
+		*reg(1) = v
+	case InstructionGetIndex2:
+		element, err := this.element(*reg(0), *reg(1))
+		if err != nil {
+			return err
+		}
+		*reg(2) = *element
+	case InstructionSetIndex2:
+		element, err := this.element(*reg(0), *reg(1))
+		if err != nil {
+			return err
+		}
+		*element = *reg(2)
+	case InstructionLen2:
+		_, _, length, err := this.object(*reg(0))
+		if err != nil {
+			return err
+		}
+		*reg(1) = length
+	case InstructionCopy2:
+		v, err := this.join(*reg(0))
+		if err != nil {
+			return err
+		}
+		*reg(1) = v
+	case InstructionConcat2:
+		v, err := this.join(*reg(0), *reg(1))
+		if err != nil {
+			return err
+		}
+		*reg(2) = v
+	case InstructionPlus2:
+		// 两边都是字符串的时候接起来，其他的跟 add2 一样
+		var v int64
+		var err error
+		if valueType(*reg(0)) == ValueTypeString && valueType(*reg(1)) == ValueTypeString {
+			v, err = this.join(*reg(0), *reg(1))
+		} else {
+			v, err = binaryOperation(InstructionAdd2, *reg(0), *reg(1))
+		}
+		if err != nil {
+			return err
+		}
+		*reg(2) = v
+	case InstructionPrint2:
+		fmt.Fprintln(this.Output, this.Inspect(*reg(0)))
+	case InstructionBoolEquals, InstructionBoolNotEquals:
+		equal, err := this.equals(*reg(0), *reg(1))
+		if err != nil {
+			return err
+		}
+		if ins == InstructionBoolNotEquals {
+			equal = !equal
+		}
+		*reg(2) = boolValue(equal)
+	default:
+		// 剩下的都是 r3 = r1 op r2
+		result, err := binaryOperation(ins, *reg(0), *reg(1))
+		if err != nil {
+			return err
+		}
+		*reg(2) = result
+	}
+	return nil
+}
+
+func binaryOperation(ins Instruction, left int64, right int64) (int64, error) {
+	switch ins {
+	case InstructionAdd2, InstructionPlusAssign, InstructionSubtract2, InstructionSubtractAssign,
+		InstructionMultiply2, InstructionMultiplyAssign, InstructionDiv2, InstructionDivideAssign,
+		InstructionShiftRight, InstructionBitAnd:
+		// 字符串和数组的值是堆上的位置，拿来算没有意义
+		if valueType(left) != ValueTypeNumber || valueType(right) != ValueTypeNumber {
+			return 0, fmt.Errorf("unsupported types %s %s", typeName(valueType(left)), typeName(valueType(right)))
+		}
+	case InstructionBoolLessThan, InstructionBoolLessThanEquals, InstructionBoolGreaterThan, InstructionBoolGreaterThanEquals:
+		// 只有数字能比大小，跟栈虚拟机一样
+		if valueType(left) != ValueTypeNumber || valueType(right) != ValueTypeNumber {
+			return 0, fmt.Errorf("unsupported types for comparison: %s %s", typeName(valueType(left)), typeName(valueType(right)))
+		}
+	}
+
+	switch ins {
+	case InstructionAdd2, InstructionPlusAssign:
+		return numberResult(left + right)
+	case InstructionSubtract2, InstructionSubtractAssign:
+		return numberResult(left - right)
+	case InstructionMultiply2, InstructionMultiplyAssign:
+		result := left * right
+		if left != 0 && result/left != right {
+			return 0, fmt.Errorf("integer overflow")
+		}
+		return numberResult(result)
+	case InstructionDiv2, InstructionDivideAssign:
+		if right == 0 {
+			return 0, fmt.Errorf("division by zero")
+		}
+		return numberResult(left / right)
+	case InstructionShiftRight:
+		if right < 0 {
+			return 0, fmt.Errorf("negative shift count %d", right)
+		}
+		// 逻辑右移
+		return numberResult(int64(uint64(left) >> uint64(right)))
+	case InstructionBitAnd:
+		return numberResult(left & right)
+	case InstructionBoolAnd:
+		return boolValue(truthy(left) && truthy(right)), nil
+	case InstructionBoolOr:
+		return boolValue(truthy(left) || truthy(right)), nil
+	case InstructionBoolLessThan:
+		return boolValue(left < right), nil
+	case InstructionBoolLessThanEquals:
+		return boolValue(left <= right), nil
+	case InstructionBoolGreaterThan:
+		return boolValue(left > right), nil
+	case InstructionBoolGreaterThanEquals:
+		return boolValue(left >= right), nil
+	}
+	return 0, fmt.Errorf("unknown instruction")
+}
+
+// 算出来的数字超出范围就会跟类型标记混在一起，直接报错
+func numberResult(result int64) (int64, error) {
+	if !isNumber(result) {
+		return 0, fmt.Errorf("integer overflow")
+	}
+	return result, nil
+}
+
+func isNumber(value int64) bool {
+	return value >= MinNumber && value <= MaxNumber
+}
+
+// 值的类型标记，数字是 ValueTypeNumber
+func valueType(value int64) int64 {
+	if isNumber(value) {
+		return ValueTypeNumber
+	}
+	return value &^ (HeapSize - 1)
+}
+
+func (this *VM) load(address int64) (int64, error) {
+	if address < 0 || address >= MemorySize {
+		return 0, fmt.Errorf("address out of range: %d", address)
+	}
+	return this.Memory[address], nil
+}
+
+func (this *VM) save(address int64, value int64) error {
+	if address < 0 || address >= MemorySize {
+		return fmt.Errorf("address out of range: %d", address)
+	}
+	this.Memory[address] = value
+	return nil
+}
+
+// registerCodes 里的编号是 a1 的 0b0001_0000 到 fp 的 0b0111_0000，低 4 位都是 0
+func validRegisterCode(code int64) bool {
+	return code&0b1111 == 0 && code >= 0b0001_0000 && code <= 0b0111_0000
+}
+
+// false 和 null 是假，其他都是真，0 也是真，跟栈虚拟机一样
+func truthy(value int64) bool {
+	return value != ValueFalse && value != ValueNull
+}
+
+func boolValue(b bool) int64 {
+	if b {
+		return ValueTrue
+	}
+	return ValueFalse
+}
@@ -0,0 +1,337 @@
+package asm_vm_register_base
+
+import (
+	"strings"
+	"testing"
+)
+
+func runAsm(t *testing.T, asm string) *VM {
+	t.Helper()
+	assembler := NewAssembler()
+	assembler.AddAsm(asm)
+	memory, err := assembler.Compile()
+	if err != nil {
+		t.Fatalf("asm error: %v\nasm=\n%s", err, asm)
+	}
+	vm := NewVM(memory)
+	if err := vm.Run(); err != nil {
+		t.Fatalf("vm error: %v\nasm=\n%s", err, asm)
+	}
+	return vm
+}
+
+func TestVMRegisters(t *testing.T) {
+	tests := []struct {
+		asm      string
+		register string
+		expected int64
+	}{
+		{"set2 a1 7", "a1", 7},
+		{"set2 a1 6\nset2 a2 3\nadd2 a1 a2 a3", "a3", 9},
+		{"set2 a1 6\nset2 a2 3\nsub2 a1 a2 a3", "a3", 3},
+		{"set2 a1 6\nset2 a2 3\nmul2 a1 a2 c1", "c1", 18},
+		{"set2 a1 7\nset2 a2 2\ndiv2 a1 a2 f1", "f1", 3},
+		{"set2 a1 6\nset2 a2 3\nnum_plus_eq a1 a2 a1", "a1", 9},
+		{"set2 a1 6\nset2 a2 3\nnum_sub_eq a1 a2 a1", "a1", 3},
+		{"set2 a1 6\nset2 a2 3\nnum_mul_eq a1 a2 a1", "a1", 18},
+		{"set2 a1 6\nset2 a2 3\nnum_div_eq a1 a2 a1", "a1", 2},
+		{"set2 a1 12\nset2 a2 2\nshift_right a1 a2 a3", "a3", 3},
+		{"set2 a1 12\nset2 a2 10\nbit_and a1 a2 a3", "a3", 8},
+		// bool
+		{"set2 a1 true", "a1", ValueTrue},
+		{"set2 a1 false", "a1", ValueFalse},
+		{"set2 a1 null", "a1", ValueNull},
+		{"set2 a1 1\nset2 a2 2\nbool_lt a1 a2 a3", "a3", ValueTrue},
+		{"set2 a1 2\nset2 a2 2\nbool_lt a1 a2 a3", "a3", ValueFalse},
+		{"set2 a1 2\nset2 a2 2\nbool_lte a1 a2 a3", "a3", ValueTrue},
+		{"set2 a1 3\nset2 a2 2\nbool_gt a1 a2 a3", "a3", ValueTrue},
+		{"set2 a1 1\nset2 a2 2\nbool_gte a1 a2 a3", "a3", ValueFalse},
+		{"set2 a1 2\nset2 a2 2\nbool_eq a1 a2 a3", "a3", ValueTrue},
+		{"set2 a1 2\nset2 a2 2\nbool_neq a1 a2 a3", "a3", ValueFalse},
+		// 0 也是真的，跟栈虚拟机一样
+		{"set2 a1 true\nset2 a2 0\nbool_and a1 a2 a3", "a3", ValueTrue},
+		{"set2 a1 true\nset2 a2 null\nbool_and a1 a2 a3", "a3", ValueFalse},
+		{"set2 a1 false\nset2 a2 5\nbool_or a1 a2 a3", "a3", ValueTrue},
+		{"set2 a1 null\nbool_not a1 a2", "a2", ValueTrue},
+		{"set2 a1 3\nbool_not a1 a2", "a2", ValueFalse},
+		{"set2 a1 3\nmov2 a1 c1", "c1", 3},
+		{"mov2 sp a1", "a1", StackStart},
+	}
+
+	for _, tt := range tests {
+		vm := runAsm(t, tt.asm+"\nhalt\n")
+		if got := vm.Register(tt.register); got != tt.expected {
+			t.Errorf("%q: %s wrong. got=%d, want=%d", tt.asm, tt.register, got, tt.expected)
+		}
+	}
+}
+
+func TestVMMemory(t *testing.T) {
+	vm := runAsm(t, `
+		set2 a1 11
+		set2 a2 22
+		push a1
+		push a2
+		pop a3
+		save2 a3 40000
+		load2 40000 c1
+		set2 f1 40002
+		save_from_register2 a1 f1
+		load_from_register2 f1 a2
+		set2 f1 40010
+		mov2 f1 fp
+		save_fp2 a1 -2
+		load_fp2 -2 a3
+		halt
+	`)
+	if vm.Register("sp") != StackStart+2 {
+		t.Errorf("sp wrong. got=%d, want=%d", vm.Register("sp"), StackStart+2)
+	}
+	if vm.Memory[StackStart] != 11 {
+		t.Errorf("stack wrong. got=%d", vm.Memory[StackStart])
+	}
+	if vm.Memory[40000] != 22 || vm.Register("c1") != 22 {
+		t.Errorf("save2/load2 wrong. memory=%d c1=%d", vm.Memory[40000], vm.Register("c1"))
+	}
+	if vm.Memory[40002] != 11 || vm.Register("a2") != 11 {
+		t.Errorf("save_from_register2/load_from_register2 wrong. memory=%d a2=%d", vm.Memory[40002], vm.Register("a2"))
+	}
+	if vm.Memory[40008] != 11 || vm.Register("a3") != 11 {
+		t.Errorf("save_fp2/load_fp2 wrong. memory=%d a3=%d", vm.Memory[40008], vm.Register("a3"))
+	}
+}
+
+func TestVMHeap(t *testing.T) {
+	vm := runAsm(t, `
+		set2 a1 2
+		new_array a1 a2     ; [null null]
+		set2 a1 0
+		set2 a3 7
+		set_index2 a2 a1 a3 ; [7 null]
+		copy2 a2 c1         ; 复制一份再改原来的
+		set2 a1 1
+		set_index2 a2 a1 a3 ; [7 7]
+		concat2 a2 c1 f1    ; [7 7 7 null]
+		get_index2 f1 a1 a3
+		save2 a3 40000
+		len2 f1 a1
+		save2 a1 40002
+		push f1
+		set2 a1 1
+		new_string a1 a2
+		set2 a3 0
+		set2 c1 104
+		set_index2 a2 a3 c1
+		concat2 a2 a2 c1    ; "hh"
+		pop f1
+		halt
+	`)
+	// 对象头是长度，元素从第 2 格开始，一个值 2 格
+	if vm.Memory[HeapStart] != 2 || vm.Memory[HeapStart+2] != 7 || vm.Memory[HeapStart+4] != 7 {
+		t.Errorf("array layout wrong. memory=%v", vm.Memory[HeapStart:HeapStart+6])
+	}
+	if vm.Register("a2") != ValueTypeString+22 {
+		t.Errorf("string value wrong. got=%d, want=%d", vm.Register("a2"), ValueTypeString+22)
+	}
+	// 2 个、2 个、4 个元素的数组，1 个、2 个字符的字符串
+	if vm.HeapTop != HeapStart+6+6+10+4+6 {
+		t.Errorf("heap top wrong. got=%d", vm.HeapTop-HeapStart)
+	}
+	if vm.Memory[40000] != 7 || vm.Memory[40002] != 4 {
+		t.Errorf("get_index2/len2 wrong. got=%d %d", vm.Memory[40000], vm.Memory[40002])
+	}
+	inspects := map[string]string{"f1": "[7 7 7 null]", "c1": "hh", "a2": "h"}
+	for reg, expected := range inspects {
+		if got := vm.Inspect(vm.Register(reg)); got != expected {
+			t.Errorf("%s wrong. got=%s, want=%s", reg, got, expected)
+		}
+	}
+}
+
+// 数字跟类型标记分开，再大的数字也还是数字
+func TestVMNumbers(t *testing.T) {
+	vm := runAsm(t, `
+		set2 a1 16385
+		set2 a2 8192
+		mul2 a1 a2 a3
+		bool_eq a1 a1 c1
+		halt
+	`)
+	inspects := map[string]string{"a1": "16385", "a2": "8192", "a3": "134225920", "c1": "true"}
+	for reg, expected := range inspects {
+		if got := vm.Inspect(vm.Register(reg)); got != expected {
+			t.Errorf("%s wrong. got=%s, want=%s", reg, got, expected)
+		}
+	}
+}
+
+// plus2 两边都是字符串的时候接起来，其他的跟 add2 一样
+func TestVMPlus(t *testing.T) {
+	vm := runAsm(t, `
+		set2 a1 1
+		new_string a1 a2
+		set2 a3 0
+		set2 c1 104
+		set_index2 a2 a3 c1
+		plus2 a2 a2 f1
+		set2 a1 6
+		set2 a2 3
+		plus2 a1 a2 a3
+		halt
+	`)
+	inspects := map[string]string{"f1": "hh", "a3": "9"}
+	for reg, expected := range inspects {
+		if got := vm.Inspect(vm.Register(reg)); got != expected {
+			t.Errorf("%s wrong. got=%s, want=%s", reg, got, expected)
+		}
+	}
+}
+
+// bool_eq 字符串比内容，null 跟什么都能比
+func TestVMEquals(t *testing.T) {
+	vm := runAsm(t, `
+		set2 a1 1
+		new_string a1 a2
+		new_string a1 a3
+		set2 a1 0
+		set2 c1 104
+		set_index2 a2 a1 c1
+		set_index2 a3 a1 c1
+		bool_eq a2 a3 f1    ; 两个 "h"
+		set2 c1 null
+		bool_neq a2 c1 a3
+		set2 a1 0
+		bool_eq a1 c1 a1
+		halt
+	`)
+	inspects := map[string]string{"f1": "true", "a3": "true", "a1": "false"}
+	for reg, expected := range inspects {
+		if got := vm.Inspect(vm.Register(reg)); got != expected {
+			t.Errorf("%s wrong. got=%s, want=%s", reg, got, expected)
+		}
+	}
+}
+
+func TestVMJump(t *testing.T) {
+	a1, a2, a3, c1, f1 := registerCodes["a1"], registerCodes["a2"], registerCodes["a3"], registerCodes["c1"], registerCodes["f1"]
+
+	// a1 = 1 + 2 + ... + 5，跳转的地址是手算的
+	program := []int64{
+		InstructionSet2.Value(), a1, 0, // 0
+		InstructionSet2.Value(), a2, 5, // 3
+		InstructionSet2.Value(), a3, 1, // 6
+		InstructionSet2.Value(), c1, 0, // 9
+		InstructionBoolGreaterThan.Value(), a2, c1, f1, // 12
+		InstructionWhile.Value(), f1, 21, // 16
+		InstructionJump.Value(), 31, // 19
+		InstructionAdd2.Value(), a1, a2, a1, // 21
+		InstructionSubtract2.Value(), a2, a3, a2, // 25
+		InstructionJump.Value(), 12, // 29
+		InstructionHalt.Value(), // 31
+	}
+	vm := NewVM(program)
+	if err := vm.Run(); err != nil {
+		t.Fatalf("vm error: %v", err)
+	}
+	if vm.Register("a1") != 15 {
+		t.Errorf("while loop wrong. got=%d", vm.Register("a1"))
+	}
+	if vm.Pc != 32 {
+		t.Errorf("pc wrong. got=%d", vm.Pc)
+	}
+
+	// if 和 jump_from_register
+	program = []int64{
+		InstructionSet2.Value(), a1, ValueFalse, // 0
+		InstructionIf.Value(), a1, 13, // 3
+		InstructionSet2.Value(), a2, 17, // 6
+		InstructionJumpFromRegister.Value(), a2, // 9
+		InstructionHalt.Value(),        // 11
+		InstructionHalt.Value(),        // 12
+		InstructionSet2.Value(), a3, 1, // 13
+		InstructionHalt.Value(),        // 16
+		InstructionSet2.Value(), c1, 2, // 17
+		InstructionHalt.Value(), // 20
+	}
+	vm = NewVM(program)
+	if err := vm.Run(); err != nil {
+		t.Fatalf("vm error: %v", err)
+	}
+	if vm.Register("a3") != 0 || vm.Register("c1") != 2 {
+		t.Errorf("if/jump_from_register wrong. a3=%d c1=%d", vm.Register("a3"), vm.Register("c1"))
+	}
+}
+
+func TestVMErrors(t *testing.T) {
+	tests := []struct {
+		program  []int64
+		expected string
+	}{
+		{[]int64{InstructionSet2.Value(), registerCodes["a1"], 1, InstructionDiv2.Value(), registerCodes["a1"], registerCodes["a2"], registerCodes["a3"]}, "div2 at 3: division by zero"},
+		{[]int64{InstructionPop.Value(), registerCodes["a1"]}, "pop at 0: stack underflow"},
+		{[]int64{InstructionPush.Value(), 7}, "push at 0: invalid register 7"},
+		{[]int64{18}, "invalid instruction 18 at 0"},
+		{[]int64{InstructionPseudoReturn.Value()}, "pseudo instruction .return at 0 can not be executed"},
+		{[]int64{InstructionJump.Value(), -1}, "pc out of program memory: -1"},
+		{[]int64{InstructionLoad2.Value(), MemorySize, registerCodes["a1"]}, "load2 at 0: address out of range: 65536"},
+		// 超出范围的数字会跟类型标记混在一起
+		{[]int64{InstructionSet2.Value(), registerCodes["a1"], MaxNumber, InstructionAdd2.Value(), registerCodes["a1"], registerCodes["a1"], registerCodes["a2"]}, "add2 at 3: integer overflow"},
+		{[]int64{InstructionSet2.Value(), registerCodes["a1"], MaxNumber, InstructionMultiply2.Value(), registerCodes["a1"], registerCodes["a1"], registerCodes["a2"]}, "mul2 at 3: integer overflow"},
+		// 类型不一样不能比
+		{[]int64{InstructionSet2.Value(), registerCodes["a1"], ValueTrue, InstructionBoolEquals.Value(), registerCodes["a1"], registerCodes["a2"], registerCodes["a3"]}, "bool_eq at 3: unsupported types for comparison: bool number"},
+		{[]int64{InstructionSet2.Value(), registerCodes["a1"], ValueTrue, InstructionBoolLessThan.Value(), registerCodes["a1"], registerCodes["a1"], registerCodes["a3"]}, "bool_lt at 3: unsupported types for comparison: bool bool"},
+		// 类型对但是还没分配
+		{[]int64{InstructionSet2.Value(), registerCodes["a1"], ValueTypeString, InstructionLen2.Value(), registerCodes["a1"], registerCodes["a2"]}, "len2 at 3: 281474976710656 is not a string or array"},
+	}
+
+	for _, tt := range tests {
+		vm := NewVM(tt.program)
+		err := vm.Run()
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("error wrong. got=%v, want=%q", err, tt.expected)
+		}
+	}
+}
+
+func TestVMHeapErrors(t *testing.T) {
+	tests := []struct {
+		asm      string
+		expected string
+	}{
+		{"set2 a1 -1\nnew_array a1 a2", "new_array at 3: negative length -1"},
+		{"set2 a1 5000\nnew_array a1 a2", "new_array at 3: heap overflow: 10002 more cells, 8192 left"},
+		{"set2 a1 2\nnew_array a1 a2\nset2 a1 2\nget_index2 a2 a1 a3", "get_index2 at 9: index 2 out of range [0, 2)"},
+		{"set2 a1 0\nnew_array a1 a2\nset2 a1 -1\nset_index2 a2 a1 a3", "set_index2 at 9: index -1 out of range [0, 0)"},
+		{"set2 a1 3\nlen2 a1 a2", "len2 at 3: 3 is not a string or array"},
+		{"set2 a1 8192\nlen2 a1 a2", "len2 at 3: 8192 is not a string or array"},
+		{"set2 a1 1\nnew_array a1 a2\nnew_string a1 a3\nconcat2 a2 a3 c1", "concat2 at 9: can not join array and string"},
+		// 堆上的值是位置，布尔和 null 也不是数字，都不能拿来算
+		{"set2 a1 1\nnew_string a1 a2\nadd2 a1 a2 a3", "add2 at 6: unsupported types number string"},
+		{"set2 a1 1\nnew_array a1 a2\nplus2 a2 a2 a3", "plus2 at 6: unsupported types array array"},
+		{"set2 a1 true\nset2 a2 2\nmul2 a1 a2 a3", "mul2 at 6: unsupported types bool number"},
+		{"set2 a1 4\nset2 a2 null\nnum_div_eq a1 a2 a3", "num_div_eq at 6: unsupported types number null"},
+	}
+
+	for _, tt := range tests {
+		assembler := NewAssembler()
+		assembler.AddAsm(tt.asm + "\nhalt")
+		memory, err := assembler.Compile()
+		if err != nil {
+			t.Fatalf("asm error: %v", err)
+		}
+		err = NewVM(memory).Run()
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("%q: error wrong. got=%v, want=%q", tt.asm, err, tt.expected)
+		}
+	}
+}
+
+// 每条机器指令 vm 都要认识，伪指令只给汇编器用
+func TestVMCoversInstructions(t *testing.T) {
+	for _, ins := range InstructionAll() {
+		_, ok := instructionOperands[ins]
+		if strings.HasPrefix(ins.Name(), ".") == ok {
+			t.Errorf("instruction %s: operands registered=%v", ins.Name(), ok)
+		}
+	}
+}
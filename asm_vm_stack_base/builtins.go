@@ -3,14 +3,27 @@ package asm_vm_stack_base
 import (
 	"fmt"
 	"go-compiler/utils"
+	"io"
+	"math"
+	"math/big"
+	"os"
+	"strconv"
+	"unicode/utf8"
 )
 
 const (
 	BuiltinFuncNameLen  = "len"
 	BuiltinFuncNamePush = "push"
 	BuiltinFuncNameLog  = "log"
+	// 数字转换
+	BuiltinFuncNameBigInt = "bigint"
+	BuiltinFuncNameInt    = "int"
+	BuiltinFuncNameFloat  = "float"
 )
 
+// log 输出到这里，测试的时候可以换掉
+var Output io.Writer = os.Stdout
+
 // 暂时用全局吧
 var Builtins = []struct {
 	Name    string
@@ -27,9 +40,10 @@ var Builtins = []struct {
 
 			switch arg := args[0].(type) {
 			case *ArrayObject:
-				return &NumberObject{Value: float64(len(arg.Values))}
+				return &IntegerObject{Value: int64(len(arg.Values))}
 			case *StringObject:
-				return &NumberObject{Value: float64(len(arg.Value))}
+				// 按字符算，跟寄存器虚拟机一样
+				return &IntegerObject{Value: int64(utf8.RuneCountInString(arg.Value))}
 			default:
 				utils.LogErrorFormat("argument to %q not supported, got %s",
 					BuiltinFuncNameLen, args[0].ValueType())
@@ -42,7 +56,7 @@ var Builtins = []struct {
 		BuiltinFuncNameLog,
 		&BuiltinObject{Func: func(args ...Object) Object {
 			for _, arg := range args {
-				fmt.Println(arg.Inspect())
+				fmt.Fprintln(Output, arg.Inspect())
 			}
 
 			return nil
@@ -74,6 +88,113 @@ var Builtins = []struct {
 		},
 		},
 	},
+	{BuiltinFuncNameBigInt, &BuiltinObject{Func: builtinBigInt}},
+	{BuiltinFuncNameInt, &BuiltinObject{Func: builtinInt}},
+	{BuiltinFuncNameFloat, &BuiltinObject{Func: builtinFloat}},
+}
+
+// bigint(x) 整数、整数值的小数、十进制字符串转成大整数
+func builtinBigInt(args ...Object) Object {
+	if len(args) != 1 {
+		utils.LogErrorFormat("wrong number of arguments. got=%d, want=1",
+			len(args))
+		return nil
+	}
+
+	switch arg := args[0].(type) {
+	case *IntegerObject:
+		return &BigIntObject{Value: big.NewInt(arg.Value)}
+	case *BigIntObject:
+		return arg
+	case *FloatObject:
+		if arg.Value != math.Trunc(arg.Value) || math.IsInf(arg.Value, 0) {
+			utils.LogErrorFormat("argument to %q must be an integral number, got %s",
+				BuiltinFuncNameBigInt, arg.Inspect())
+			return nil
+		}
+		v, _ := big.NewFloat(arg.Value).Int(nil)
+		return &BigIntObject{Value: v}
+	case *StringObject:
+		v, ok := new(big.Int).SetString(arg.Value, 10)
+		if !ok {
+			utils.LogErrorFormat("invalid integer string for %q: %q",
+				BuiltinFuncNameBigInt, arg.Value)
+			return nil
+		}
+		return &BigIntObject{Value: v}
+	default:
+		utils.LogErrorFormat("argument to %q not supported, got %s",
+			BuiltinFuncNameBigInt, args[0].ValueType())
+		return nil
+	}
+}
+
+// int(x) 转成 int64 整数，小数向 0 取整，超出 int64 的返回 null
+func builtinInt(args ...Object) Object {
+	if len(args) != 1 {
+		utils.LogErrorFormat("wrong number of arguments. got=%d, want=1",
+			len(args))
+		return nil
+	}
+
+	switch arg := args[0].(type) {
+	case *IntegerObject:
+		return arg
+	case *BigIntObject:
+		if !arg.Value.IsInt64() {
+			utils.LogErrorFormat("argument to %q out of range: %s",
+				BuiltinFuncNameInt, arg.Inspect())
+			return nil
+		}
+		return &IntegerObject{Value: arg.Value.Int64()}
+	case *FloatObject:
+		v := math.Trunc(arg.Value)
+		// float64(math.MaxInt64) 是 2^63，已经放不下了
+		if math.IsNaN(v) || v < math.MinInt64 || v >= math.MaxInt64 {
+			utils.LogErrorFormat("argument to %q out of range: %s",
+				BuiltinFuncNameInt, arg.Inspect())
+			return nil
+		}
+		return &IntegerObject{Value: int64(v)}
+	case *StringObject:
+		v, err := strconv.ParseInt(arg.Value, 10, 64)
+		if err != nil {
+			utils.LogErrorFormat("invalid integer string for %q: %q",
+				BuiltinFuncNameInt, arg.Value)
+			return nil
+		}
+		return &IntegerObject{Value: v}
+	default:
+		utils.LogErrorFormat("argument to %q not supported, got %s",
+			BuiltinFuncNameInt, args[0].ValueType())
+		return nil
+	}
+}
+
+// float(x) 转成小数，大整数取最接近的值
+func builtinFloat(args ...Object) Object {
+	if len(args) != 1 {
+		utils.LogErrorFormat("wrong number of arguments. got=%d, want=1",
+			len(args))
+		return nil
+	}
+
+	switch arg := args[0].(type) {
+	case *IntegerObject, *BigIntObject, *FloatObject:
+		return &FloatObject{Value: toFloat(arg)}
+	case *StringObject:
+		v, err := strconv.ParseFloat(arg.Value, 64)
+		if err != nil {
+			utils.LogErrorFormat("invalid number string for %q: %q",
+				BuiltinFuncNameFloat, arg.Value)
+			return nil
+		}
+		return &FloatObject{Value: v}
+	default:
+		utils.LogErrorFormat("argument to %q not supported, got %s",
+			BuiltinFuncNameFloat, args[0].ValueType())
+		return nil
+	}
 }
 
 func GetBuiltinByName(name string) *BuiltinObject {
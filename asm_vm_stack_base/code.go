@@ -79,6 +79,7 @@ var definitions = map[OpCode]*Definition{
 	OpCodeSub:               {OpCodeSub.Name(), 0, 0},
 	OpCodeMul:               {OpCodeMul.Name(), 0, 0},
 	OpCodeDiv:               {OpCodeDiv.Name(), 0, 0},
+	OpCodeMod:               {OpCodeMod.Name(), 0, 0},
 	OpCodePop:               {OpCodePop.Name(), 0, 0},
 	OpCodeTrue:              {OpCodeTrue.Name(), 0, 0},
 	OpCodeFalse:             {OpCodeFalse.Name(), 0, 0},
@@ -99,8 +100,10 @@ var definitions = map[OpCode]*Definition{
 	OpCodeObjectCall: {OpCodeObjectCall.Name(), 0, 0},
 	//OpCodeBreak:       {OpCodeBreak.Name(), 0, 0},
 
-	OpCodeJump:          {OpCodeJump.Name(), 2, 1},
-	OpCodeJumpNotTruthy: {OpCodeJumpNotTruthy.Name(), 2, 1},
+	OpCodeJump:               {OpCodeJump.Name(), 2, 1},
+	OpCodeJumpNotTruthy:      {OpCodeJumpNotTruthy.Name(), 2, 1},
+	OpCodeJumpNotTruthyOrPop: {OpCodeJumpNotTruthyOrPop.Name(), 2, 1},
+	OpCodeJumpTruthyOrPop:    {OpCodeJumpTruthyOrPop.Name(), 2, 1},
 	// 全局变量能占有 65536 字节
 	OpCodeSetGlobal: {OpCodeSetGlobal.Name(), 2, 1},
 	OpCodeGetGlobal: {OpCodeGetGlobal.Name(), 2, 1},
@@ -108,9 +111,12 @@ var definitions = map[OpCode]*Definition{
 	OpCodeSetLocal: {OpCodeSetLocal.Name(), 1, 1},
 	OpCodeGetLocal: {OpCodeGetLocal.Name(), 1, 1},
 	//
-	OpCodeArray:  {OpCodeArray.Name(), 2, 1},
-	OpCodeDict:   {OpCodeDict.Name(), 2, 1},
-	OpCodeReturn: {OpCodeReturn.Name(), 0, 0},
+	OpCodeArray: {OpCodeArray.Name(), 2, 1},
+	OpCodeDict:  {OpCodeDict.Name(), 2, 1},
+	// 要拼接的值的个数
+	OpCodeTemplate: {OpCodeTemplate.Name(), 2, 1},
+	OpCodeSetIndex: {OpCodeSetIndex.Name(), 0, 0},
+	OpCodeReturn:   {OpCodeReturn.Name(), 0, 0},
 	// closure，第一个数函数在常量池的索引，第二个数用于指定栈中有多少自由变量需要转移到即将创建的闭包中
 	OpCodeClosure:      {OpCodeClosure.Name(), 2, 2},
 	OpCodeFunctionCall: {OpCodeFunctionCall.Name(), 2, 1},
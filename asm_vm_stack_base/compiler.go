@@ -5,6 +5,10 @@ import (
 	"go-compiler/utils"
 )
 
+// Compiler 直接从 AST 生成字节码，repl 和 sans run --ast 用它
+// 闭包、字典、模板字符串、默认参数、剩余参数、大整数 IR 还没有，只有这里能编译，
+// sans run 降低成 IR 失败的时候也退回到这里；IR 支持的程序走 CompileIR，两条路的结果由 difftest 比较
+// 类两条路都不支持
 type Compiler struct {
 	instructions Instructions
 	constants    []Object
@@ -57,23 +61,23 @@ func NewCompiler() *Compiler {
 
 func (c *Compiler) Compile(node parser.Node) {
 	switch node.Type() {
-	case parser.AstTypeProgram.Name():
+	case parser.AstTypeProgram:
 		bodys := node.(parser.Program).Body
 		for _, body := range bodys {
 			c.Compile(body)
 		}
-	case parser.AstTypeBlockStatement.Name():
+	case parser.AstTypeBlockStatement:
 		body := node.(parser.BlockStatement).Body
 		for _, item := range body {
 			c.Compile(item)
 		}
-	case parser.AstTypeExpressionStatement.Name():
+	case parser.AstTypeExpressionStatement:
 		e := node.(parser.ExpressionStatement).Exp
 		if e != nil {
 			c.Compile(e)
 		}
 		c.emit(OpCodePop)
-	case parser.AstTypeVariableDeclaration.Name():
+	case parser.AstTypeVariableDeclaration:
 		n := node.(parser.VariableDeclaration)
 		name := n.Name.(parser.Identifier).Value
 		utils.LogInfo("define variable", name)
@@ -85,11 +89,19 @@ func (c *Compiler) Compile(node parser.Node) {
 		} else {
 			c.emit(OpCodeSetLocal, symbol.Index)
 		}
-	case parser.AstTypeAssignmentExpression.Name():
+	case parser.AstTypeAssignmentExpression:
 		n := node.(parser.AssignmentExpression)
 		// 先处理 = 的赋值
 		switch n.Operator {
 		case "=":
+			if member, ok := n.Left.(parser.MemberExpression); ok && member.ElementType == "array_dict" {
+				// SetIndex 把值留在栈上
+				c.Compile(member.Object)
+				c.Compile(member.Property)
+				c.Compile(n.Right)
+				c.emit(OpCodeSetIndex)
+				return
+			}
 			name := n.Left.(parser.Identifier).Value
 			utils.LogInfo("assign variable", name)
 			symbol, ok := c.symbolTable.Resolve(name)
@@ -109,7 +121,7 @@ func (c *Compiler) Compile(node parser.Node) {
 		default:
 			utils.LogError("unimplemented operator", n.Operator)
 		}
-	case parser.AstTypeIdentifier.Name():
+	case parser.AstTypeIdentifier:
 		n := node.(parser.Identifier)
 		symbol, ok := c.symbolTable.Resolve(n.Value)
 		if !ok {
@@ -117,7 +129,7 @@ func (c *Compiler) Compile(node parser.Node) {
 		}
 
 		c.loadSymbol(symbol)
-	case parser.AstTypeUnaryExpression.Name():
+	case parser.AstTypeUnaryExpression:
 		n := node.(parser.UnaryExpression)
 		c.Compile(n.Value)
 		switch n.Operator {
@@ -128,8 +140,12 @@ func (c *Compiler) Compile(node parser.Node) {
 		default:
 			utils.LogError("unknown operator", n.Operator)
 		}
-	case parser.AstTypeBinaryExpression.Name():
+	case parser.AstTypeBinaryExpression:
 		op := node.(parser.BinaryExpression).Operator
+		if op == "and" || op == "or" {
+			c.compileLogical(node.(parser.BinaryExpression))
+			return
+		}
 		c.Compile(node.(parser.BinaryExpression).Left)
 		c.Compile(node.(parser.BinaryExpression).Right)
 		switch op {
@@ -141,6 +157,8 @@ func (c *Compiler) Compile(node parser.Node) {
 			c.emit(OpCodeMul)
 		case "/":
 			c.emit(OpCodeDiv)
+		case "%":
+			c.emit(OpCodeMod)
 		case "==":
 			c.emit(OpCodeEquals)
 		case "!=":
@@ -165,22 +183,35 @@ func (c *Compiler) Compile(node parser.Node) {
 		default:
 			utils.LogError("unknown operator", op)
 		}
-	case parser.AstTypeNumberLiteral.Name():
-		v := node.(parser.NumberLiteral).Value
-		integer := &NumberObject{Value: v}
-		c.emit(OpCodeConstant, c.addConstant(integer))
-	case parser.AstTypeStringLiteral.Name():
+		switch op {
+		case "+=", "-=", "*=", "/=":
+			// a += b 算完还要存回 a，值留在栈上
+			c.storeBack(node.(parser.BinaryExpression).Left)
+		}
+	case parser.AstTypeNumberLiteral:
+		n := node.(parser.NumberLiteral)
+		var number Object = &FloatObject{Value: n.Value}
+		if v, ok := n.BigValue(); ok {
+			// 带 n 后缀的总是大整数，没有后缀的放不下 int64 才用大整数
+			if n.IsBigInt() {
+				number = &BigIntObject{Value: v}
+			} else {
+				number = newInteger(v)
+			}
+		}
+		c.emit(OpCodeConstant, c.addConstant(number))
+	case parser.AstTypeStringLiteral:
 		v := node.(parser.StringLiteral).Value
 		literal := &StringObject{Value: v}
 		c.emit(OpCodeConstant, c.addConstant(literal))
-	case parser.AstTypeBooleanLiteral.Name():
+	case parser.AstTypeBooleanLiteral:
 		v := node.(parser.BooleanLiteral).Value
 		if v {
 			c.emit(OpCodeTrue)
 		} else {
 			c.emit(OpCodeFalse)
 		}
-	case parser.AstTypeIfStatement.Name():
+	case parser.AstTypeIfStatement:
 		n := node.(parser.IfStatement)
 		condition := n.Condition
 		c.Compile(condition)
@@ -214,7 +245,7 @@ func (c *Compiler) Compile(node parser.Node) {
 		}
 		afterAlternative := len(c.currentInstructions())
 		c.changeOperand(jumpPos, afterAlternative)
-	case parser.AstTypeWhileStatement.Name():
+	case parser.AstTypeWhileStatement:
 		// 标记进来条件前的地址
 		inLoopBeforePos := len(c.currentInstructions())
 		// 要标记进入了一个循环
@@ -227,14 +258,9 @@ func (c *Compiler) Compile(node parser.Node) {
 
 		// 用 9999 当占位符,如果 condition 不是真的就跳到 while 结束
 		jumpNotTruthyPos := c.emit(OpCodeJumpNotTruthy, 9999)
+		// 循环体的值不要，pop 留着，不然每转一圈栈上多一个
 		c.Compile(n.Body)
 
-		// 在这里检测有没有
-		// 把 pop 去掉
-		if c.lastInstructionIs(OpCodePop) {
-			c.removeLastPop()
-		}
-
 		// 跳到条件编译前
 		jumpPos := c.emit(OpCodeJump, 9999)
 
@@ -258,13 +284,13 @@ func (c *Compiler) Compile(node parser.Node) {
 		// 将占位符换成跳到条件编译前的地址
 		c.changeOperand(jumpPos, inLoopBeforePos)
 		c.outLoop()
-	case parser.AstTypeBreakStatement.Name():
+	case parser.AstTypeBreakStatement:
 		jumpPos := c.emit(OpCodeJump, 9999)
 		c.setBreakAddress(jumpPos)
-	case parser.AstTypeContinueStatement.Name():
+	case parser.AstTypeContinueStatement:
 		jumpPos := c.emit(OpCodeJump, 9999)
 		c.setContinueAddress(jumpPos)
-	case parser.AstTypeForStatement.Name():
+	case parser.AstTypeForStatement:
 		// 先编译 初始化
 		n := node.(parser.ForStatement)
 		init := n.Init
@@ -291,6 +317,8 @@ func (c *Compiler) Compile(node parser.Node) {
 
 		if n.Update != nil {
 			c.Compile(n.Update)
+			// update 是表达式，值不要
+			c.emit(OpCodePop)
 		}
 
 		c.emit(OpCodeJump, inLoopConditionBeforePos)
@@ -299,11 +327,8 @@ func (c *Compiler) Compile(node parser.Node) {
 		c.changeOperand(jumLoopBodyPos, inLoopBodyBeforePos)
 
 		c.Compile(n.Body)
-
-		// 在这里检测有没有 pop，把 pop 去掉
-		if c.lastInstructionIs(OpCodePop) {
-			c.removeLastPop()
-		}
+		// 循环体跑完去 update
+		c.emit(OpCodeJump, inLoopUpdateBeforePos)
 
 		afterConsequencePos := len(c.currentInstructions())
 
@@ -324,18 +349,33 @@ func (c *Compiler) Compile(node parser.Node) {
 
 		c.outLoop()
 
-	case parser.AstTypeNullLiteral.Name():
+	case parser.AstTypeNullLiteral:
 		_, ok := node.(parser.NullLiteral)
 		if ok {
 			c.emit(OpCodeNull)
 		}
-	case parser.AstTypeArrayLiteral.Name():
+	case parser.AstTypeArrayLiteral:
 		vs := node.(parser.ArrayLiteral).Values
 		for _, v := range vs {
 			c.Compile(v)
 		}
 		c.emit(OpCodeArray, len(vs))
-	case parser.AstTypeDictLiteral.Name():
+	case parser.AstTypeTemplateLiteral:
+		// 字符串部分和 ${} 里的值按顺序压栈，空字符串不用压
+		t := node.(parser.TemplateLiteral)
+		numParts := 0
+		for i, quasi := range t.Quasis {
+			if quasi != "" {
+				c.emit(OpCodeConstant, c.addConstant(&StringObject{Value: quasi}))
+				numParts += 1
+			}
+			if i < len(t.Expressions) {
+				c.Compile(t.Expressions[i])
+				numParts += 1
+			}
+		}
+		c.emit(OpCodeTemplate, numParts)
+	case parser.AstTypeDictLiteral:
 		kvs := node.(parser.DictLiteral).Values
 		for _, kv := range kvs {
 			k := kv.(parser.PropertyAssignment).Key
@@ -344,14 +384,26 @@ func (c *Compiler) Compile(node parser.Node) {
 			c.Compile(v)
 		}
 		c.emit(OpCodeDict, len(kvs)*2)
-	case parser.AstTypeFunctionExpression.Name():
+	case parser.AstTypeFunctionExpression:
 		utils.LogInfo("function in?")
-		c.enterScope()
 		functionNode := node.(parser.FunctionExpression)
 
+		// 默认值在定义函数的地方求值，按顺序压栈，OpCodeClosure 的时候收进闭包
+		numDefaults := 0
+		hasRest := false
 		for _, p := range functionNode.Params {
-			id := p.(parser.Identifier)
-			c.symbolTable.Define(id.Value)
+			switch p.Type() {
+			case parser.AstTypeDefaultParameter:
+				c.Compile(p.(parser.DefaultParameter).Value)
+				numDefaults += 1
+			case parser.AstTypeRestParameter:
+				hasRest = true
+			}
+		}
+
+		c.enterScope()
+		for _, p := range functionNode.Params {
+			c.symbolTable.Define(paramName(p))
 		}
 		// 这里能做处理，假设 body 没有数据，直接加上一个 null
 		c.Compile(functionNode.Body)
@@ -381,12 +433,14 @@ func (c *Compiler) Compile(node parser.Node) {
 			Instructions:  instructions,
 			NumLocals:     numLocals,
 			NumParameters: len(functionNode.Params),
+			NumDefaults:   numDefaults,
+			HasRest:       hasRest,
 		}
 
 		fnIndex := c.addConstant(compiledFn)
 		// 闭包，第一个数函数在常量池的索引，第二个数用于指定栈中有多少自由变量需要转移到即将创建的闭包中
 		c.emit(OpCodeClosure, fnIndex, len(freeSymbols))
-	case parser.AstTypeCallExpression.Name():
+	case parser.AstTypeCallExpression:
 		n := node.(parser.CallExpression)
 
 		c.Compile(n.Object)
@@ -395,7 +449,7 @@ func (c *Compiler) Compile(node parser.Node) {
 			c.Compile(arg)
 		}
 		c.emit(OpCodeFunctionCall, len(n.Args))
-	case parser.AstTypeMemberExpression.Name():
+	case parser.AstTypeMemberExpression:
 		n := node.(parser.MemberExpression)
 
 		if n.ElementType == "array_dict" {
@@ -404,7 +458,7 @@ func (c *Compiler) Compile(node parser.Node) {
 			c.emit(OpCodeObjectCall)
 		}
 		// todo 支持点语法
-	case parser.AstTypeReturnStatement.Name():
+	case parser.AstTypeReturnStatement:
 		v := node.(parser.ReturnStatement).Value
 		if v != nil {
 			c.Compile(v)
@@ -515,6 +569,39 @@ func (c *Compiler) addConstant(obj Object) int {
 	return len(c.constants) - 1
 }
 
+// and / or 的值是最后算的那一边，跟 ir.Lower 一样，左边就能定下来的时候不算右边
+func (c *Compiler) compileLogical(n parser.BinaryExpression) {
+	c.Compile(n.Left)
+	op := OpCodeJumpNotTruthyOrPop
+	if n.Operator == "or" {
+		op = OpCodeJumpTruthyOrPop
+	}
+	jumpPos := c.emit(op, 9999)
+	c.Compile(n.Right)
+	c.changeOperand(jumpPos, len(c.currentInstructions()))
+}
+
+func (c *Compiler) storeBack(left parser.Node) {
+	if left.Type() != parser.AstTypeIdentifier {
+		utils.LogError("invalid left of compound assignment", left.Type())
+	}
+	name := left.(parser.Identifier).Value
+	symbol, ok := c.symbolTable.Resolve(name)
+	if !ok {
+		utils.LogError("undefined variable", name)
+	}
+	switch symbol.Scope {
+	case GlobalScope:
+		c.emit(OpCodeSetGlobal, symbol.Index)
+		c.emit(OpCodeGetGlobal, symbol.Index)
+	case LocalScope:
+		c.emit(OpCodeSetLocal, symbol.Index)
+		c.emit(OpCodeGetLocal, symbol.Index)
+	default:
+		utils.LogError("can not assign to", name)
+	}
+}
+
 func (c *Compiler) loadSymbol(s Symbol) {
 	switch s.Scope {
 	case GlobalScope:
@@ -573,9 +660,40 @@ type Bytecode struct {
 	Constants    []Object
 }
 
+// Globals 全局变量的名字和在 VM.Global 里的下标
+func (c *Compiler) Globals() map[string]int {
+	table := c.symbolTable
+	for table.Outer != nil {
+		table = table.Outer
+	}
+	globals := make(map[string]int)
+	for name, symbol := range table.store {
+		if symbol.Scope == GlobalScope {
+			globals[name] = symbol.Index
+		}
+	}
+	return globals
+}
+
 func (c *Compiler) ReturnBytecode() *Bytecode {
 	return &Bytecode{
 		Instructions: c.currentInstructions(),
 		Constants:    c.constants,
 	}
 }
+
+// 参数的名字，默认参数和 ...rest 的名字也得是标识符
+func paramName(p parser.Node) string {
+	name := p
+	switch param := p.(type) {
+	case parser.DefaultParameter:
+		name = param.Name
+	case parser.RestParameter:
+		name = param.Name
+	}
+	identifier, ok := name.(parser.Identifier)
+	if !ok {
+		utils.LogError("invalid function param", p.Type())
+	}
+	return identifier.Value
+}
@@ -2,9 +2,11 @@ package asm_vm_stack_base
 
 import (
 	"fmt"
+	"go-compiler/internal/testutil"
 	sansLexer "go-compiler/lexer"
 	sansParser "go-compiler/parser"
 	"go-compiler/utils"
+	"strings"
 	"testing"
 )
 
@@ -217,6 +219,33 @@ func TestIf(t *testing.T) {
 	runCompilerTests(t, tests)
 }
 
+func TestLogical(t *testing.T) {
+	tests := []CompilerTest{
+		{
+			input:             "1 and 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []Instructions{
+				GenerateByte(OpCodeConstant, 0),
+				// 左边是假的时候跳到 Pop，左边就是结果
+				GenerateByte(OpCodeJumpNotTruthyOrPop, 9),
+				GenerateByte(OpCodeConstant, 1),
+				GenerateByte(OpCodePop),
+			},
+		},
+		{
+			input:             "1 or 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []Instructions{
+				GenerateByte(OpCodeConstant, 0),
+				GenerateByte(OpCodeJumpTruthyOrPop, 9),
+				GenerateByte(OpCodeConstant, 1),
+				GenerateByte(OpCodePop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
 func TestWhile(t *testing.T) {
 	tests := []CompilerTest{
 		{
@@ -234,10 +263,12 @@ func TestWhile(t *testing.T) {
 				GenerateByte(OpCodeConstant, 1),  // 12
 				GenerateByte(OpCodeEquals),       // 13
 				// body
-				GenerateByte(OpCodeJumpNotTruthy, 25), // 16
+				GenerateByte(OpCodeJumpNotTruthy, 29), // 16
 				GenerateByte(OpCodeConstant, 2),       // 19
 				GenerateByte(OpCodeSetGlobal, 0),      // 22
-				GenerateByte(OpCodeJump, 6),           // 25
+				GenerateByte(OpCodeGetGlobal, 0),      // 25
+				GenerateByte(OpCodePop),               // 26
+				GenerateByte(OpCodeJump, 6),           // 29
 			},
 		},
 		{
@@ -256,20 +287,49 @@ func TestWhile(t *testing.T) {
 				i = 2
 			} i
 			`,
-			expectedConstants: []interface{}{0, 0, 1},
+			expectedConstants: []interface{}{0, 0, 1, 0, 0, 2},
 			expectedInstructions: []Instructions{
 				// pre
 				GenerateByte(OpCodeConstant, 0),  // 3
 				GenerateByte(OpCodeSetGlobal, 0), // 6
-				// conition
-				GenerateByte(OpCodeGetGlobal, 0), // 9
-				GenerateByte(OpCodeConstant, 1),  // 12
-				GenerateByte(OpCodeEquals),       // 13
-				// body
-				GenerateByte(OpCodeJumpNotTruthy, 25), // 16
-				GenerateByte(OpCodeConstant, 2),       // 19
-				GenerateByte(OpCodeSetGlobal, 0),      // 22
-				GenerateByte(OpCodeJump, 6),           // 25
+				// 外层 while 条件
+				GenerateByte(OpCodeGetGlobal, 0),      // 9
+				GenerateByte(OpCodeConstant, 1),       // 12
+				GenerateByte(OpCodeEquals),            // 13
+				GenerateByte(OpCodeJumpNotTruthy, 75), // 16
+				// i = 1
+				GenerateByte(OpCodeConstant, 2),  // 19
+				GenerateByte(OpCodeSetGlobal, 0), // 22
+				GenerateByte(OpCodeGetGlobal, 0), // 25
+				GenerateByte(OpCodePop),          // 26
+				// 内层 while 条件
+				GenerateByte(OpCodeTrue),              // 27
+				GenerateByte(OpCodeJumpNotTruthy, 62), // 30
+				// if(i == 0)
+				GenerateByte(OpCodeGetGlobal, 0),      // 33
+				GenerateByte(OpCodeConstant, 3),       // 36
+				GenerateByte(OpCodeEquals),            // 37
+				GenerateByte(OpCodeJumpNotTruthy, 46), // 40
+				// break
+				GenerateByte(OpCodeJump, 62), // 43
+				GenerateByte(OpCodeJump, 59), // 46
+				// else: i = 0
+				GenerateByte(OpCodeConstant, 4),  // 49
+				GenerateByte(OpCodeSetGlobal, 0), // 52
+				GenerateByte(OpCodeGetGlobal, 0), // 55
+				GenerateByte(OpCodePop),          // 56
+				// continue
+				GenerateByte(OpCodeJump, 26), // 59
+				GenerateByte(OpCodeJump, 26), // 62
+				// i = 2
+				GenerateByte(OpCodeConstant, 5),  // 65
+				GenerateByte(OpCodeSetGlobal, 0), // 68
+				GenerateByte(OpCodeGetGlobal, 0), // 71
+				GenerateByte(OpCodePop),          // 72
+				GenerateByte(OpCodeJump, 6),      // 75
+				// i
+				GenerateByte(OpCodeGetGlobal, 0), // 78
+				GenerateByte(OpCodePop),          // 79
 			},
 		},
 	}
@@ -383,6 +443,29 @@ func TestStringAndArrayAndObject(t *testing.T) {
 				GenerateByte(OpCodePop),
 			},
 		},
+		{
+			input:             "`a${1}b${2 + 3}`",
+			expectedConstants: []interface{}{"a", 1, "b", 2, 3},
+			expectedInstructions: []Instructions{
+				GenerateByte(OpCodeConstant, 0),
+				GenerateByte(OpCodeConstant, 1),
+				GenerateByte(OpCodeConstant, 2),
+				GenerateByte(OpCodeConstant, 3),
+				GenerateByte(OpCodeConstant, 4),
+				GenerateByte(OpCodeAdd),
+				GenerateByte(OpCodeTemplate, 4),
+				GenerateByte(OpCodePop),
+			},
+		},
+		{
+			input:             "`${1}`",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []Instructions{
+				GenerateByte(OpCodeConstant, 0),
+				GenerateByte(OpCodeTemplate, 1),
+				GenerateByte(OpCodePop),
+			},
+		},
 	}
 
 	runCompilerTests(t, tests)
@@ -591,6 +674,30 @@ func TestClosure(t *testing.T) {
 	runCompilerTests(t, tests)
 }
 
+// 参数的名字不是标识符的时候报错，不能直接崩掉
+func TestInvalidParam(t *testing.T) {
+	number := sansParser.NumberLiteral{Value: 1, Raw: "1"}
+	params := []sansParser.Node{
+		sansParser.DefaultParameter{Name: number, Value: number},
+		sansParser.RestParameter{Name: number},
+		number,
+	}
+	for _, p := range params {
+		func() {
+			defer func() {
+				r := recover()
+				if r == nil || !strings.Contains(fmt.Sprint(r), "invalid function param") {
+					t.Errorf("%s: error wrong. got=%v", p.Type(), r)
+				}
+			}()
+			NewCompiler().Compile(sansParser.FunctionExpression{
+				Params: []sansParser.Node{p},
+				Body:   sansParser.BlockStatement{},
+			})
+		}()
+	}
+}
+
 func runCompilerTests(t *testing.T, tests []CompilerTest) {
 	for _, tt := range tests {
 		fmt.Printf("--- %s ---\n", tt.input)
@@ -645,9 +752,12 @@ func testConstants(t *testing.T, expected []interface{}, actual []Object) error
 }
 
 func testIntegerObject(expected int64, actual Object) error {
-	result, ok := actual.(*NumberObject)
+	result, ok := actual.(*IntegerObject)
 	if !ok {
-		return fmt.Errorf("object is not Integer. got=%T (%+v)", result.Value, expected)
+		return fmt.Errorf("object is not Integer. got=%T (%+v)", actual, actual)
+	}
+	if result.Value != expected {
+		return fmt.Errorf("object has wrong value. got=%d, want=%d", result.Value, expected)
 	}
 	return nil
 }
@@ -696,3 +806,19 @@ func testInstructions(expected []Instructions, actual Instructions) error {
 
 	return nil
 }
+
+func BenchmarkCompiler(b *testing.B) {
+	lexer := sansLexer.SansLangLexer{}
+	lexer.Code = testutil.GenerateProgram(1000)
+	tokensLexer := sansLexer.TokenList{
+		Tokens: lexer.TokenList(),
+	}
+	parser := sansParser.NewSansLangParser(&tokensLexer)
+	ast := parser.Parse()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		compiler := NewCompiler()
+		compiler.Compile(ast)
+	}
+}
@@ -0,0 +1,283 @@
+package asm_vm_stack_base
+
+import (
+	"go-compiler/ir"
+	"go-compiler/utils"
+	"math"
+)
+
+// CompileIR 从 IR 生成字节码，和 Compile 生成的字节码在同一个 VM 上跑
+//
+// 每个 IR 函数编译成一个 CompiledFunctionObject，顶层的代码也当成一个函数，
+// 字节码里只有 Closure main; FunctionCall 0; Pop
+// IR 的变量都放在栈帧的局部变量里，参数在最前面，一条三地址指令就是
+// 把操作数压栈、做运算、SetLocal 结果
+// 只在一个块里用的临时变量用完就把位置还回去，块开头的时候这些位置都是空的
+func CompileIR(program *ir.Program) *Bytecode {
+	c := &irCompiler{program: program, functions: map[string]int{}}
+	compiled := make([]*CompiledFunctionObject, len(program.Functions))
+	// 先把所有函数放进常量池，函数之间可以互相调用
+	for i, fn := range program.Functions {
+		compiled[i] = &CompiledFunctionObject{NumParameters: len(fn.Params)}
+		c.functions[fn.Name] = c.addConstant(compiled[i])
+	}
+	main := &CompiledFunctionObject{}
+	mainIndex := c.addConstant(main)
+
+	for i, fn := range program.Functions {
+		c.compileFunction(fn, compiled[i])
+	}
+	c.compileFunction(program.Main, main)
+
+	var instructions Instructions
+	instructions = append(instructions, GenerateByte(OpCodeClosure, mainIndex, 0)...)
+	instructions = append(instructions, GenerateByte(OpCodeFunctionCall, 0)...)
+	instructions = append(instructions, GenerateByte(OpCodePop)...)
+	return &Bytecode{Instructions: instructions, Constants: c.constants}
+}
+
+type irCompiler struct {
+	program   *ir.Program
+	constants []Object
+	// 函数名 -> 常量池的下标
+	functions map[string]int
+
+	// 正在编译的函数
+	instructions Instructions
+	slots        map[*ir.Var]int
+	// 跳转的位置和要跳去的块，块的地址最后填
+	jumps []irJump
+}
+
+type irJump struct {
+	position int
+	target   *ir.Block
+}
+
+func (c *irCompiler) addConstant(obj Object) int {
+	c.constants = append(c.constants, obj)
+	return len(c.constants) - 1
+}
+
+func (c *irCompiler) emit(op OpCode, operands ...int) int {
+	position := len(c.instructions)
+	c.instructions = append(c.instructions, GenerateByte(op, operands...)...)
+	return position
+}
+
+func (c *irCompiler) compileFunction(fn *ir.Function, obj *CompiledFunctionObject) {
+	c.instructions, c.jumps = Instructions{}, nil
+	obj.NumLocals = c.allocateSlots(fn)
+
+	addresses := make(map[*ir.Block]int)
+	for i, block := range fn.Blocks {
+		addresses[block] = len(c.instructions)
+		var next *ir.Block
+		if i+1 < len(fn.Blocks) {
+			next = fn.Blocks[i+1]
+		}
+		for _, ins := range block.Instructions {
+			c.compileInstruction(ins, next)
+		}
+	}
+	for _, jump := range c.jumps {
+		op := GetOpCodeFromValue(c.instructions[jump.position])
+		copy(c.instructions[jump.position:], GenerateByte(op, addresses[jump.target]))
+	}
+	obj.Instructions = c.instructions
+}
+
+// 给 IR 的变量分局部变量的位置，返回用掉的位置数
+func (c *irCompiler) allocateSlots(fn *ir.Function) int {
+	c.slots = make(map[*ir.Var]int)
+	local := fn.LocalVars()
+	numSlots := 0
+	for _, v := range fn.Vars {
+		if _, ok := local[v]; !ok {
+			c.slots[v] = numSlots
+			numSlots += 1
+		}
+	}
+	shared := numSlots
+
+	for _, block := range fn.Blocks {
+		// 块里最后一次用到的位置
+		lastUse := make(map[*ir.Var]int)
+		for i, ins := range block.Instructions {
+			for _, v := range ins.Vars() {
+				lastUse[v] = i
+			}
+		}
+		var free []int
+		for slot := numSlots - 1; slot >= shared; slot-- {
+			free = append(free, slot)
+		}
+		for i, ins := range block.Instructions {
+			// 同一条指令先读后写，读完的位置马上可以给结果用
+			for _, v := range ins.Vars() {
+				if _, ok := local[v]; ok && lastUse[v] == i {
+					free = append(free, c.slots[v])
+					lastUse[v] = -1
+				}
+			}
+			dest := ins.Dest
+			if dest == nil {
+				continue
+			}
+			if _, ok := local[dest]; !ok {
+				continue
+			}
+			if _, ok := c.slots[dest]; ok && lastUse[dest] >= i {
+				// 块里又定义了一次，还用原来的位置
+				continue
+			}
+			if len(free) == 0 {
+				free = append(free, numSlots)
+				numSlots += 1
+			}
+			c.slots[dest] = free[len(free)-1]
+			free = free[:len(free)-1]
+			// 结果没人用的，位置马上还回去
+			if last, ok := lastUse[dest]; !ok || last < i {
+				free = append(free, c.slots[dest])
+			}
+		}
+	}
+	if numSlots > math.MaxUint8+1 {
+		utils.LogError("CompileIR too many locals", fn.Name, numSlots)
+	}
+	return numSlots
+}
+
+func (c *irCompiler) push(value ir.Value) {
+	switch v := value.(type) {
+	case *ir.Var:
+		c.emit(OpCodeGetLocal, c.slots[v])
+	case *ir.Const:
+		switch v.Kind {
+		case ir.ConstInt:
+			c.emit(OpCodeConstant, c.addConstant(&IntegerObject{Value: v.Int}))
+		case ir.ConstFloat:
+			c.emit(OpCodeConstant, c.addConstant(&FloatObject{Value: v.Float}))
+		case ir.ConstString:
+			c.emit(OpCodeConstant, c.addConstant(&StringObject{Value: v.Str}))
+		case ir.ConstBool:
+			if v.Bool {
+				c.emit(OpCodeTrue)
+			} else {
+				c.emit(OpCodeFalse)
+			}
+		default:
+			c.emit(OpCodeNull)
+		}
+	}
+}
+
+// 栈顶的结果存进 dest，没有 dest 的扔掉
+func (c *irCompiler) store(dest *ir.Var) {
+	if dest == nil {
+		c.emit(OpCodePop)
+		return
+	}
+	c.emit(OpCodeSetLocal, c.slots[dest])
+}
+
+func (c *irCompiler) jump(op OpCode, target *ir.Block) {
+	c.jumps = append(c.jumps, irJump{position: c.emit(op, 9999), target: target})
+}
+
+var irOpCodes = map[ir.Op]OpCode{
+	ir.OpAdd: OpCodeAdd,
+	ir.OpSub: OpCodeSub,
+	ir.OpMul: OpCodeMul,
+	ir.OpDiv: OpCodeDiv,
+	ir.OpMod: OpCodeMod,
+	ir.OpEq:  OpCodeEquals,
+	ir.OpNe:  OpCodeNotEquals,
+	ir.OpLt:  OpCodeLessThan,
+	ir.OpLe:  OpCodeLessThanEquals,
+	ir.OpGt:  OpCodeGreaterThan,
+	ir.OpGe:  OpCodeGreaterThanEquals,
+	ir.OpNeg: OpCodeMinus,
+	ir.OpNot: OpCodeNot,
+}
+
+// next 是下一个块，跳到下一个块的 jump 不用生成
+func (c *irCompiler) compileInstruction(ins *ir.Instruction, next *ir.Block) {
+	switch ins.Op {
+	case ir.OpCopy:
+		c.push(ins.Args[0])
+		c.store(ins.Dest)
+	case ir.OpArray:
+		for _, arg := range ins.Args {
+			c.push(arg)
+		}
+		c.emit(OpCodeArray, len(ins.Args))
+		c.store(ins.Dest)
+	case ir.OpIndex:
+		c.push(ins.Args[0])
+		c.push(ins.Args[1])
+		c.emit(OpCodeObjectCall)
+		c.store(ins.Dest)
+	case ir.OpSetIndex:
+		for _, arg := range ins.Args {
+			c.push(arg)
+		}
+		c.emit(OpCodeSetIndex)
+		c.emit(OpCodePop)
+	case ir.OpLoadGlobal:
+		c.emit(OpCodeGetGlobal, c.program.Global(ins.Name))
+		c.store(ins.Dest)
+	case ir.OpStoreGlobal:
+		c.push(ins.Args[0])
+		c.emit(OpCodeSetGlobal, c.program.Global(ins.Name))
+	case ir.OpCall, ir.OpBuiltin:
+		if ins.Op == ir.OpCall {
+			c.emit(OpCodeClosure, c.functions[ins.Name], 0)
+		} else {
+			c.emit(OpCodeGetBuiltin, builtinIndex(ins.Name))
+		}
+		for _, arg := range ins.Args {
+			c.push(arg)
+		}
+		c.emit(OpCodeFunctionCall, len(ins.Args))
+		c.store(ins.Dest)
+	case ir.OpJump:
+		if ins.Targets[0] != next {
+			c.jump(OpCodeJump, ins.Targets[0])
+		}
+	case ir.OpBranch:
+		c.push(ins.Args[0])
+		c.jump(OpCodeJumpNotTruthy, ins.Targets[1])
+		if ins.Targets[0] != next {
+			c.jump(OpCodeJump, ins.Targets[0])
+		}
+	case ir.OpReturn:
+		if len(ins.Args) == 0 {
+			c.emit(OpCodeNull)
+		} else {
+			c.push(ins.Args[0])
+		}
+		c.emit(OpCodeReturn)
+	default:
+		op, ok := irOpCodes[ins.Op]
+		if !ok {
+			utils.LogError("CompileIR unknown op", ins.Op.Name())
+		}
+		for _, arg := range ins.Args {
+			c.push(arg)
+		}
+		c.emit(op)
+		c.store(ins.Dest)
+	}
+}
+
+func builtinIndex(name string) int {
+	for i, builtin := range Builtins {
+		if builtin.Name == name {
+			return i
+		}
+	}
+	utils.LogError("CompileIR unknown builtin", name)
+	return -1
+}
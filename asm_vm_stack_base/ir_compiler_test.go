@@ -0,0 +1,103 @@
+package asm_vm_stack_base
+
+import (
+	"fmt"
+	"go-compiler/ir"
+	sansLexer "go-compiler/lexer"
+	sansParser "go-compiler/parser"
+	"strings"
+	"testing"
+)
+
+func lowerForTest(t *testing.T, input string) *ir.Program {
+	t.Helper()
+	lexer := sansLexer.NewSansLangLexer(input)
+	tokensLexer := sansLexer.TokenList{
+		Tokens: lexer.TokenList(),
+	}
+	program, err := ir.Lower(sansParser.NewSansLangParser(&tokensLexer).Parse())
+	if err != nil {
+		t.Fatalf("lower error: %v", err)
+	}
+	return program
+}
+
+func TestCompileIR(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"var r = 1 + 2 * 3", 7},
+		{"var r = 1.5 * 2", 3.0},
+		{`var r = "a" + "b"`, "ab"},
+		{"var a = push([1, 2], 3)\nvar r = a[2] + len(a)", 6},
+		{"var a = [1, 2]\na[1] += 5\nvar r = a[1]", 7},
+		{"var r = false or \"s\"", "s"},
+		{"var r = 1 and not 2", false},
+		{`
+			var fib = function(n) {
+				if (n < 2) {
+					return n
+				}
+				return fib(n - 1) + fib(n - 2)
+			}
+			var r = fib(15)
+		`, 610},
+		// 一个循环里有好几个 break
+		{`
+			var r = 0
+			while (true) {
+				r += 1
+				if (r == 3) {
+					break
+				}
+				if (r > 10) {
+					break
+				}
+			}
+		`, 3},
+		{`
+			var sum = function(n) {
+				var s = 0
+				for (var i = 0; i < n; i += 1) {
+					if (i == 1) {
+						continue
+					}
+					s += i
+				}
+				return s
+			}
+			var r = sum(5)
+		`, 9},
+	}
+
+	for _, tt := range tests {
+		program := lowerForTest(t, tt.input)
+		vm := NewVM(CompileIR(program))
+		if err := vm.Run(); err != nil {
+			t.Fatalf("vm error: %s\ninput=%s", err, tt.input)
+		}
+		testExpectedObject(t, tt.expected, vm.Global(program.Global("r")))
+	}
+}
+
+// 只在一个块里用的临时变量用完就还回去，顶层代码再长局部变量也不会超过 256 个
+func TestCompileIRSlots(t *testing.T) {
+	var input strings.Builder
+	for i := 0; i < 300; i++ {
+		fmt.Fprintf(&input, "var x%d = %d * 2 + 1\n", i, i)
+	}
+	program := lowerForTest(t, input.String())
+	bytecode := CompileIR(program)
+	// 常量池里先是函数，然后是顶层代码
+	main := bytecode.Constants[len(program.Functions)].(*CompiledFunctionObject)
+	if main.NumLocals != 1 {
+		t.Errorf("wrong number of locals. got=%d, want=1", main.NumLocals)
+	}
+
+	vm := NewVM(bytecode)
+	if err := vm.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	testExpectedObject(t, 599, vm.Global(program.Global("x299")))
+}
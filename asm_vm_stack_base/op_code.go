@@ -8,12 +8,17 @@ type OpCode struct {
 }
 
 var (
-	validOpCodes            = []OpCode{}
+	validOpCodes = []OpCode{}
+	// 指令是一个 byte，直接用 value 当下标，vm 每条指令都要查一次
+	opCodeByValue [256]OpCode
+	opCodeByName  = map[string]OpCode{}
+
 	OpCodeConstant          = newOpCode("Constant", 1)
 	OpCodeAdd               = newOpCode("Add", 2)
 	OpCodeSub               = newOpCode("Sub", 3)
 	OpCodeMul               = newOpCode("Mul", 4)
 	OpCodeDiv               = newOpCode("Div", 5)
+	OpCodeMod               = newOpCode("Mod", 6)
 	OpCodePop               = newOpCode("Pop", 10)
 	OpCodeTrue              = newOpCode("True", 20)
 	OpCodeFalse             = newOpCode("False", 21)
@@ -35,6 +40,9 @@ var (
 	OpCodeJump          = newOpCode("Jump", 41)
 	OpCodeObjectCall    = newOpCode("ObjectCall", 42)
 	//OpCodeBreak         = newOpCode("Break", 43)
+	// and / or 用：栈顶的值不用算右边的时候跳过去，值留在栈上当结果，不然扔掉
+	OpCodeJumpNotTruthyOrPop = newOpCode("JumpNotTruthyOrPop", 44)
+	OpCodeJumpTruthyOrPop    = newOpCode("JumpTruthyOrPop", 45)
 
 	OpCodeSetGlobal = newOpCode("SetGlobal", 50)
 	OpCodeGetGlobal = newOpCode("GetGlobal", 51)
@@ -43,6 +51,10 @@ var (
 
 	OpCodeArray = newOpCode("Array", 54)
 	OpCodeDict  = newOpCode("Dict", 55)
+	// 模板字符串，把栈顶的几个值转成字符串拼起来
+	OpCodeTemplate = newOpCode("Template", 56)
+	// a[i] = v，栈上依次是 a i v，存完把 v 留在栈上
+	OpCodeSetIndex = newOpCode("SetIndex", 57)
 
 	OpCodeReturn       = newOpCode("Return", 60)
 	OpCodeClosure      = newOpCode("Closure", 61)
@@ -54,8 +66,16 @@ var (
 )
 
 func newOpCode(name string, value int64) OpCode {
+	if value <= 0 || value > 255 {
+		panic(fmt.Errorf("OpCode value out of range: (%s %d)", name, value))
+	}
+	if opCodeByValue[value].name != "" {
+		panic(fmt.Errorf("duplicate OpCode value: (%s %d)", name, value))
+	}
 	o := OpCode{name: name, value: value}
 	validOpCodes = append(validOpCodes, o)
+	opCodeByValue[value] = o
+	opCodeByName[name] = o
 	return o
 }
 
@@ -88,28 +108,20 @@ func (t OpCode) NamePtr() *string {
 }
 
 func (t OpCode) valid() bool {
-	for _, v := range OpCodeAll() {
-		if v == t {
-			return true
-		}
-	}
-	return false
+	return t.value > 0 && t.value < 256 && opCodeByValue[t.value] == t
 }
 
 func GetOpCodeFromName(s string) OpCode {
-	for _, v := range OpCodeAll() {
-		if v.name == s {
-			return v
-		}
+	if v, ok := opCodeByName[s]; ok {
+		return v
 	}
 	panic(fmt.Errorf("invalid Opcode name: (%+v)", s))
 }
 
 func GetOpCodeFromValue(op byte) OpCode {
-	for _, v := range OpCodeAll() {
-		if v.Value() == int64(op) {
-			return v
-		}
+	v := opCodeByValue[op]
+	if v.name == "" {
+		panic(fmt.Errorf("invalid Opcode value: (%+v)", op))
 	}
-	panic(fmt.Errorf("invalid Opcode value: (%+v)", op))
+	return v
 }
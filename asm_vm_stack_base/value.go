@@ -1,22 +1,60 @@
 package asm_vm_stack_base
 
-import "fmt"
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
 
 type Object interface {
 	ValueType() string
 	Inspect() string
 }
 
-type NumberObject struct {
+// 整数，int64
+type IntegerObject struct {
+	Value int64
+}
+
+func (n IntegerObject) ValueType() string {
+	return "IntegerObject"
+}
+
+func (n IntegerObject) Inspect() string {
+	return strconv.FormatInt(n.Value, 10)
+}
+
+// 小数，float64
+type FloatObject struct {
 	Value float64
 }
 
-func (n NumberObject) ValueType() string {
-	return "NumberObject"
+func (n FloatObject) ValueType() string {
+	return "FloatObject"
 }
 
-func (n NumberObject) Inspect() string {
-	return fmt.Sprintf("%f", n.Value)
+func (n FloatObject) Inspect() string {
+	// 用最短的写法，整数值的小数带上 .0，和整数区分开
+	s := strconv.FormatFloat(n.Value, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eIN") {
+		s += ".0"
+	}
+	return s
+}
+
+// 大整数，整数运算溢出 int64 的时候自动变成大整数
+// 运算结果能放回 int64 的会变回 IntegerObject
+type BigIntObject struct {
+	Value *big.Int
+}
+
+func (n BigIntObject) ValueType() string {
+	return "BigIntObject"
+}
+
+func (n BigIntObject) Inspect() string {
+	return n.Value.String()
 }
 
 type BoolObject struct {
@@ -82,6 +120,20 @@ func (d DictKeyObject) Inspect() string {
 	return fmt.Sprintf("%+v", d.Key.Inspect())
 }
 
+// 大整数做字典 key 的时候用
+// *big.Int 按指针比较，所以存成十进制字符串
+type BigIntKeyObject struct {
+	Value string
+}
+
+func (k BigIntKeyObject) ValueType() string {
+	return "BigIntKeyObject"
+}
+
+func (k BigIntKeyObject) Inspect() string {
+	return k.Value
+}
+
 type DictObject struct {
 	Pairs map[DictKeyObject]Object `json:"values"`
 }
@@ -120,6 +172,10 @@ type CompiledFunctionObject struct {
 	Instructions  Instructions `json:"instructions"`
 	NumLocals     int          `json:"numLocals"`
 	NumParameters int          `json:"numParameters"`
+	// 带默认值的参数个数，默认参数都在普通参数后面
+	NumDefaults int `json:"numDefaults"`
+	// 最后一个参数是 ...rest，多出来的参数打包成数组
+	HasRest bool `json:"hasRest"`
 }
 
 func (b CompiledFunctionObject) ValueType() string {
@@ -131,8 +187,9 @@ func (d CompiledFunctionObject) Inspect() string {
 }
 
 type ClosureObject struct {
-	Fn   *CompiledFunctionObject
-	Free []Object
+	Fn       *CompiledFunctionObject
+	Free     []Object
+	Defaults []Object // 默认参数的值，创建闭包的时候算好
 }
 
 func (b ClosureObject) ValueType() string {
@@ -3,6 +3,9 @@ package asm_vm_stack_base
 import (
 	"fmt"
 	"go-compiler/utils"
+	"math"
+	"math/big"
+	"strings"
 )
 
 const (
@@ -72,13 +75,16 @@ func (vm *VM) Run() error {
 
 		op := ins[ip]
 		opCode := GetOpCodeFromValue(op)
-		utils.LogInfo("op opCode vm.sp", op, opCode, vm.sp)
 		//debug mode
-		for index, object := range vm.stack {
-			if object == nil {
-				continue
+		// 每条指令都会走到这里，不开调试输出的时候连参数都不要准备，也不要扫整个栈
+		if utils.Verbose {
+			utils.LogInfo("op opCode vm.sp", op, opCode, vm.sp)
+			for index, object := range vm.stack {
+				if object == nil {
+					continue
+				}
+				utils.LogInfo("stack item ", index, object)
 			}
-			utils.LogInfo("stack item ", index, object)
 		}
 		switch opCode {
 		case OpCodeConstant:
@@ -91,7 +97,7 @@ func (vm *VM) Run() error {
 			}
 		case OpCodePop:
 			vm.pop()
-		case OpCodeMul, OpCodeAdd, OpCodeSub, OpCodeDiv, OpCodeAddEquals, OpCodeSubEquals, OpCodeMulEquals, OpCodeDivEquals:
+		case OpCodeMul, OpCodeAdd, OpCodeSub, OpCodeDiv, OpCodeMod, OpCodeAddEquals, OpCodeSubEquals, OpCodeMulEquals, OpCodeDivEquals:
 			err := vm.executeBinaryOperation(opCode)
 			if err != nil {
 				return err
@@ -112,28 +118,33 @@ func (vm *VM) Run() error {
 				return err
 			}
 		case OpCodeNot:
+			// 这里不能直接 return，后面还有指令要跑
 			operand := vm.pop()
-
-			switch operand {
-			case &BoolObject{Value: true}:
-				return vm.push(&BoolObject{Value: false})
-			case &BoolObject{Value: false}:
-				return vm.push(&BoolObject{Value: true})
-			case &NullObject{}:
-				return vm.push(&BoolObject{Value: true})
-			default:
-				return vm.push(&BoolObject{Value: false})
+			err := vm.push(&BoolObject{Value: !isTruthy(operand)})
+			if err != nil {
+				return err
 			}
 		case OpCodeMinus:
-			operand := vm.pop()
-
-			numType := NumberObject{}.ValueType()
-			if operand.ValueType() != numType {
+			var result Object
+			switch operand := vm.pop().(type) {
+			case *IntegerObject:
+				if operand.Value == math.MinInt64 {
+					// -MinInt64 放不下 int64
+					result = newInteger(new(big.Int).Neg(big.NewInt(operand.Value)))
+				} else {
+					result = &IntegerObject{Value: -operand.Value}
+				}
+			case *BigIntObject:
+				result = newInteger(new(big.Int).Neg(operand.Value))
+			case *FloatObject:
+				result = &FloatObject{Value: -operand.Value}
+			default:
 				return fmt.Errorf("unsupported type for negation: %s", operand.ValueType())
 			}
-
-			value := operand.(*NumberObject).Value
-			return vm.push(&NumberObject{Value: -value})
+			err := vm.push(result)
+			if err != nil {
+				return err
+			}
 		case OpCodeNull:
 			err := vm.push(&NullObject{})
 			if err != nil {
@@ -148,6 +159,15 @@ func (vm *VM) Run() error {
 			if !isTruthy(condition) {
 				vm.currentFrame().ip = pos - 1
 			}
+		case OpCodeJumpNotTruthyOrPop, OpCodeJumpTruthyOrPop:
+			pos := int(ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			if isTruthy(vm.stack[vm.sp-1]) == (opCode == OpCodeJumpTruthyOrPop) {
+				vm.currentFrame().ip = pos - 1
+			} else {
+				vm.pop()
+			}
 		case OpCodeJump:
 			pos := int(ReadUint16(ins[ip+1:]))
 			vm.currentFrame().ip = pos - 1
@@ -203,6 +223,17 @@ func (vm *VM) Run() error {
 			if err != nil {
 				return err
 			}
+		case OpCodeTemplate:
+			numParts := int(ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			str := vm.buildTemplate(vm.sp-numParts, vm.sp)
+			vm.sp = vm.sp - numParts
+
+			err := vm.push(str)
+			if err != nil {
+				return err
+			}
 		case OpCodeDict:
 			numElements := int(ReadUint16(ins[ip+1:]))
 			vm.currentFrame().ip += 2
@@ -221,6 +252,15 @@ func (vm *VM) Run() error {
 			if err != nil {
 				return err
 			}
+		case OpCodeSetIndex:
+			value := vm.pop()
+			index := vm.pop()
+			arrayDictObject := vm.pop()
+
+			err := vm.executeSetIndex(arrayDictObject, index, value)
+			if err != nil {
+				return err
+			}
 		case OpCodeClosure:
 			utils.LogInfo("in OpCodeClosure")
 			// 已编译函数在常量池中的索引
@@ -280,6 +320,15 @@ func (vm *VM) buildArray(startIndex, endIndex int) Object {
 	return &ArrayObject{Values: elements}
 }
 
+// 每个值都用 Inspect 转成字符串，字符串就是它本身
+func (vm *VM) buildTemplate(startIndex, endIndex int) Object {
+	var sb strings.Builder
+	for i := startIndex; i < endIndex; i++ {
+		sb.WriteString(vm.stack[i].Inspect())
+	}
+	return &StringObject{Value: sb.String()}
+}
+
 func (vm *VM) buildDict(startIndex, endIndex int) Object {
 	dictPairs := make(map[DictKeyObject]Object, 0)
 
@@ -288,25 +337,11 @@ func (vm *VM) buildDict(startIndex, endIndex int) Object {
 		value := vm.stack[i+1]
 
 		// 只支持 string and number
-		switch key.ValueType() {
-		case NumberObject{}.ValueType():
-			k, ok := key.(*NumberObject)
-			if !ok {
-				utils.LogError("unusable as dict key: %s", k.ValueType())
-			}
-
-			dictPairs[DictKeyObject{Key: NumberObject{Value: k.Value}}] = value
-		case StringObject{}.ValueType():
-			k, ok := key.(*StringObject)
-			if !ok {
-				utils.LogError("unusable as dict key: %s", k.ValueType())
-			}
-
-			dictPairs[DictKeyObject{Key: StringObject{Value: k.Value}}] = value
-
-		default:
+		dictKey, ok := newDictKey(key)
+		if !ok {
 			utils.LogError("unusable as hash key: %s", key.ValueType())
 		}
+		dictPairs[dictKey] = value
 
 	}
 
@@ -327,13 +362,44 @@ func (vm *VM) executeFunctionCall(numArgs int) error {
 }
 
 func (vm *VM) callFunctionClosure(cl *ClosureObject, numArgs int) error {
-	if numArgs != cl.Fn.NumParameters {
+	// 参数分三段：必传参数、默认参数、...rest
+	numPositional := cl.Fn.NumParameters
+	if cl.Fn.HasRest {
+		numPositional -= 1
+	}
+	numRequired := numPositional - cl.Fn.NumDefaults
+	if numArgs < numRequired || (!cl.Fn.HasRest && numArgs > numPositional) {
 		utils.LogError("callFunctionClosure", fmt.Sprintf("wrong number of arguments: want=%d, got=%d", cl.Fn.NumParameters, numArgs))
 		return fmt.Errorf("wrong number of arguments: want=%d, got=%d",
 			cl.Fn.NumParameters, numArgs)
 	}
 
-	frame := NewFrame(cl, vm.sp-numArgs)
+	basePointer := vm.sp - numArgs
+	// 多出来的参数打包成数组
+	var rest Object
+	if cl.Fn.HasRest {
+		if numArgs > numPositional {
+			rest = vm.buildArray(basePointer+numPositional, vm.sp)
+			vm.sp = basePointer + numPositional
+		} else {
+			rest = &ArrayObject{Values: []Object{}}
+		}
+	}
+	// 没传的参数用默认值补上
+	for i := vm.sp - basePointer; i < numPositional; i++ {
+		err := vm.push(cl.Defaults[i-numRequired])
+		if err != nil {
+			return err
+		}
+	}
+	if rest != nil {
+		err := vm.push(rest)
+		if err != nil {
+			return err
+		}
+	}
+
+	frame := NewFrame(cl, basePointer)
 	vm.pushFrame(frame)
 
 	vm.sp = frame.basePointer + cl.Fn.NumLocals
@@ -362,43 +428,86 @@ func (vm *VM) executeComparison(op OpCode) error {
 	left := vm.pop()
 
 	utils.LogInfo("executeComparison look left right", left, right)
-	numType := NumberObject{}.ValueType()
 
-	if left.ValueType() == numType || right.ValueType() == numType {
-		return vm.executeIntegerComparison(op, left, right)
+	if isNumber(left) && isNumber(right) {
+		return vm.executeNumberComparison(op, left, right)
+	}
+	if op != OpCodeEquals && op != OpCodeNotEquals {
+		return fmt.Errorf("unsupported types for comparison: %s %s", left.ValueType(), right.ValueType())
 	}
 
-	switch op {
-	case OpCodeEquals:
-		return vm.push(&BoolObject{Value: right.(*BoolObject).Value == left.(*BoolObject).Value})
-	case OpCodeNotEquals:
-		return vm.push(&BoolObject{Value: right.(*BoolObject).Value != left.(*BoolObject).Value})
-	default:
-		return fmt.Errorf("unknown operator: %+v %s %s", op, left.ValueType(), right.ValueType())
+	equal, err := objectEquals(left, right)
+	if err != nil {
+		return err
+	}
+	if op == OpCodeNotEquals {
+		equal = !equal
+	}
+	return vm.push(&BoolObject{Value: equal})
+}
+
+// objectEquals 不是数字的 == 按类型比，null 可以跟什么都比，别的类型不一样就报错
+// 字符串比内容，数组、字典、函数比是不是同一个
+func objectEquals(left, right Object) (bool, error) {
+	_, leftNull := left.(*NullObject)
+	_, rightNull := right.(*NullObject)
+	if leftNull || rightNull {
+		return leftNull && rightNull, nil
+	}
+	if left.ValueType() != right.ValueType() {
+		return false, fmt.Errorf("unsupported types for comparison: %s %s", left.ValueType(), right.ValueType())
+	}
+	switch l := left.(type) {
+	case *BoolObject:
+		return l.Value == right.(*BoolObject).Value, nil
+	case *StringObject:
+		return l.Value == right.(*StringObject).Value, nil
 	}
+	return left == right, nil
 }
 
-func (vm *VM) executeIntegerComparison(op OpCode, left, right Object) error {
-	leftValue := left.(*NumberObject).Value
-	rightValue := right.(*NumberObject).Value
+// 两边都是整数按整数比（包括大整数），有一边是小数就都转成小数比
+func (vm *VM) executeNumberComparison(op OpCode, left, right Object) error {
+	if !isNumber(left) || !isNumber(right) {
+		return fmt.Errorf("unsupported types for comparison: %s %s", left.ValueType(), right.ValueType())
+	}
 
-	utils.LogInfo("executeIntegerComparison look left right", left, right)
+	utils.LogInfo("executeNumberComparison look left right", left, right)
+
+	var result bool
+	var err error
+	l, ok1 := left.(*IntegerObject)
+	r, ok2 := right.(*IntegerObject)
+	if ok1 && ok2 {
+		result, err = compareNumber(op, l.Value, r.Value)
+	} else if isInteger(left) && isInteger(right) {
+		// 有大整数，用 Cmp 的结果和 0 比
+		result, err = compareNumber(op, int64(toBigInt(left).Cmp(toBigInt(right))), 0)
+	} else {
+		result, err = compareNumber(op, toFloat(left), toFloat(right))
+	}
+	if err != nil {
+		return err
+	}
+	return vm.push(&BoolObject{Value: result})
+}
 
+func compareNumber[T int64 | float64](op OpCode, leftValue, rightValue T) (bool, error) {
 	switch op {
 	case OpCodeEquals:
-		return vm.push(&BoolObject{Value: leftValue == rightValue})
+		return leftValue == rightValue, nil
 	case OpCodeNotEquals:
-		return vm.push(&BoolObject{Value: rightValue != leftValue})
+		return leftValue != rightValue, nil
 	case OpCodeGreaterThan:
-		return vm.push(&BoolObject{Value: leftValue > rightValue})
+		return leftValue > rightValue, nil
 	case OpCodeGreaterThanEquals:
-		return vm.push(&BoolObject{Value: leftValue >= rightValue})
+		return leftValue >= rightValue, nil
 	case OpCodeLessThan:
-		return vm.push(&BoolObject{Value: leftValue < rightValue})
+		return leftValue < rightValue, nil
 	case OpCodeLessThanEquals:
-		return vm.push(&BoolObject{Value: leftValue <= rightValue})
+		return leftValue <= rightValue, nil
 	default:
-		return fmt.Errorf("unknown operator: %+v ", op)
+		return false, fmt.Errorf("unknown operator: %+v ", op)
 	}
 }
 
@@ -409,12 +518,17 @@ func (vm *VM) executeBinaryOperation(op OpCode) error {
 	leftType := left.ValueType()
 	rightType := right.ValueType()
 
-	numType := NumberObject{}.ValueType()
+	intType := IntegerObject{}.ValueType()
 	strType := StringObject{}.ValueType()
 
 	switch {
-	case leftType == numType && rightType == numType:
+	case leftType == intType && rightType == intType:
 		return vm.executeBinaryIntegerOperation(op, left, right)
+	case isInteger(left) && isInteger(right):
+		return vm.executeBinaryBigIntOperation(op, toBigInt(left), toBigInt(right))
+	case isNumber(left) && isNumber(right):
+		// 整数和小数混着算，整数提升成小数
+		return vm.executeBinaryFloatOperation(op, toFloat(left), toFloat(right))
 	case leftType == strType && rightType == strType:
 		return vm.executeBinaryStringOperation(op, left, right)
 	default:
@@ -423,29 +537,80 @@ func (vm *VM) executeBinaryOperation(op OpCode) error {
 }
 
 func (vm *VM) executeBinaryAssignmentOperation(op OpCode) error {
-	right := vm.pop()
-	left := vm.pop()
+	return vm.executeBinaryOperation(op)
+}
 
-	leftType := left.ValueType()
-	rightType := right.ValueType()
+// 整数运算
+// 除法向 0 取整，除以 0 是运行时错误，溢出 int64 就换成大整数重新算
+func (vm *VM) executeBinaryIntegerOperation(op OpCode, left, right Object) error {
+	leftValue := left.(*IntegerObject).Value
+	rightValue := right.(*IntegerObject).Value
 
-	numType := NumberObject{}.ValueType()
-	strType := StringObject{}.ValueType()
+	var result int64
+	overflow := false
 
-	switch {
-	case leftType == numType && rightType == numType:
-		return vm.executeBinaryIntegerOperation(op, left, right)
-	case leftType == strType && rightType == strType:
-		return vm.executeBinaryStringOperation(op, left, right)
+	switch op {
+	case OpCodeAdd, OpCodeAddEquals:
+		result = leftValue + rightValue
+		overflow = (leftValue^result)&(rightValue^result) < 0
+	case OpCodeSub, OpCodeSubEquals:
+		result = leftValue - rightValue
+		overflow = (leftValue^rightValue)&(leftValue^result) < 0
+	case OpCodeMul, OpCodeMulEquals:
+		result = leftValue * rightValue
+		overflow = leftValue != 0 && (result/leftValue != rightValue || (leftValue == -1 && rightValue == math.MinInt64))
+	case OpCodeDiv, OpCodeDivEquals:
+		if rightValue == 0 {
+			return fmt.Errorf("integer division by zero")
+		}
+		overflow = leftValue == math.MinInt64 && rightValue == -1
+		result = leftValue / rightValue
+	case OpCodeMod:
+		if rightValue == 0 {
+			return fmt.Errorf("integer division by zero")
+		}
+		result = leftValue % rightValue
 	default:
-		return fmt.Errorf("unsupported types for binary operation: %s %s", leftType, rightType)
+		return fmt.Errorf("unknown integer operator: %+v", op)
 	}
+	if overflow {
+		return vm.executeBinaryBigIntOperation(op, big.NewInt(leftValue), big.NewInt(rightValue))
+	}
+
+	return vm.push(&IntegerObject{Value: result})
 }
 
-func (vm *VM) executeBinaryIntegerOperation(op OpCode, left, right Object) error {
-	leftValue := left.(*NumberObject).Value
-	rightValue := right.(*NumberObject).Value
+// 大整数运算，规则和整数一样，结果能放进 int64 的变回 IntegerObject
+func (vm *VM) executeBinaryBigIntOperation(op OpCode, leftValue, rightValue *big.Int) error {
+	result := new(big.Int)
 
+	switch op {
+	case OpCodeAdd, OpCodeAddEquals:
+		result.Add(leftValue, rightValue)
+	case OpCodeSub, OpCodeSubEquals:
+		result.Sub(leftValue, rightValue)
+	case OpCodeMul, OpCodeMulEquals:
+		result.Mul(leftValue, rightValue)
+	case OpCodeDiv, OpCodeDivEquals:
+		if rightValue.Sign() == 0 {
+			return fmt.Errorf("integer division by zero")
+		}
+		// Quo 和 Rem 向 0 取整，和 int64 的 / % 一致
+		result.Quo(leftValue, rightValue)
+	case OpCodeMod:
+		if rightValue.Sign() == 0 {
+			return fmt.Errorf("integer division by zero")
+		}
+		result.Rem(leftValue, rightValue)
+	default:
+		return fmt.Errorf("unknown integer operator: %+v", op)
+	}
+
+	return vm.push(newInteger(result))
+}
+
+// 小数运算，按 IEEE 754，除以 0 得到 Inf
+func (vm *VM) executeBinaryFloatOperation(op OpCode, leftValue, rightValue float64) error {
 	var result float64
 
 	switch op {
@@ -457,11 +622,13 @@ func (vm *VM) executeBinaryIntegerOperation(op OpCode, left, right Object) error
 		result = leftValue * rightValue
 	case OpCodeDiv, OpCodeDivEquals:
 		result = leftValue / rightValue
+	case OpCodeMod:
+		result = math.Mod(leftValue, rightValue)
 	default:
-		return fmt.Errorf("unknown integer operator: %+v", op)
+		return fmt.Errorf("unknown float operator: %+v", op)
 	}
 
-	return vm.push(&NumberObject{Value: result})
+	return vm.push(&FloatObject{Value: result})
 }
 
 func (vm *VM) executeBinaryStringOperation(op OpCode, left, right Object) error {
@@ -477,8 +644,10 @@ func (vm *VM) executeBinaryStringOperation(op OpCode, left, right Object) error
 
 func (vm *VM) executeObjectCallExpression(left, index Object) error {
 	switch {
-	case left.ValueType() == ArrayObject{}.ValueType() && index.ValueType() == NumberObject{}.ValueType():
+	case left.ValueType() == ArrayObject{}.ValueType() && index.ValueType() == IntegerObject{}.ValueType():
 		return vm.executeArrayIndex(left, index)
+	case left.ValueType() == ArrayObject{}.ValueType():
+		return fmt.Errorf("array index must be integer, got %s", index.ValueType())
 	case left.ValueType() == DictObject{}.ValueType():
 		return vm.executeDictIndex(left, index)
 	default:
@@ -488,8 +657,7 @@ func (vm *VM) executeObjectCallExpression(left, index Object) error {
 
 func (vm *VM) executeArrayIndex(array, index Object) error {
 	arrayObject := array.(*ArrayObject)
-	// 这里可能是多个类型
-	i := int64(index.(*NumberObject).Value)
+	i := index.(*IntegerObject).Value
 	maxNum := int64(len(arrayObject.Values) - 1)
 
 	if i < 0 || i > maxNum {
@@ -503,38 +671,40 @@ func (vm *VM) executeArrayIndex(array, index Object) error {
 func (vm *VM) executeDictIndex(hash, index Object) error {
 	hashObject := hash.(*DictObject)
 
-	var pair Object
+	key, ok := newDictKey(index)
+	if !ok {
+		return fmt.Errorf("unusable as dict key: %s", index.ValueType())
+	}
+	pair, ok := hashObject.Pairs[key]
+	if !ok {
+		return vm.push(&NullObject{})
+	}
 
-	// todo
-	// 1.数字、string 、变量
-	switch index.ValueType() {
-	case NumberObject{}.ValueType():
-		key, ok := index.(*NumberObject)
-		if !ok {
-			return fmt.Errorf("unusable as dict key: %s", index.ValueType())
-		}
+	return vm.push(pair)
+}
 
-		pair, ok = hashObject.Pairs[DictKeyObject{Key: NumberObject{Value: key.Value}}]
+// 数组越界和寄存器虚拟机一样报错，不会自己变长
+func (vm *VM) executeSetIndex(left, index, value Object) error {
+	switch left := left.(type) {
+	case *ArrayObject:
+		i, ok := index.(*IntegerObject)
 		if !ok {
-			obj := &NullObject{}
-			return vm.push(obj)
+			return fmt.Errorf("array index must be integer, got %s", index.ValueType())
 		}
-	case StringObject{}.ValueType():
-		key, ok := index.(*StringObject)
-		if !ok {
-			return fmt.Errorf("unusable as dict key: %s", index.ValueType())
+		if i.Value < 0 || i.Value >= int64(len(left.Values)) {
+			return fmt.Errorf("index %d out of range [0, %d)", i.Value, len(left.Values))
 		}
-
-		pair, ok = hashObject.Pairs[DictKeyObject{Key: StringObject{Value: key.Value}}]
+		left.Values[i.Value] = value
+	case *DictObject:
+		key, ok := newDictKey(index)
 		if !ok {
-			obj := &NullObject{}
-			return vm.push(obj)
+			return fmt.Errorf("unusable as dict key: %s", index.ValueType())
 		}
+		left.Pairs[key] = value
 	default:
-		return fmt.Errorf("unusable as dict key: %s", index.ValueType())
+		return fmt.Errorf("index assignment not supported: %s", left.ValueType())
 	}
-
-	return vm.push(pair)
+	return vm.push(value)
 }
 
 func (vm *VM) push(o Object) error {
@@ -561,7 +731,15 @@ func (vm *VM) pushFunctionClosure(constIndex, numFree int) error {
 	}
 	vm.sp = vm.sp - numFree
 
-	closure := &ClosureObject{Fn: function, Free: free}
+	// 自由变量下面是默认参数的值
+	numDefaults := function.NumDefaults
+	defaults := make([]Object, numDefaults)
+	for i := 0; i < numDefaults; i++ {
+		defaults[i] = vm.stack[vm.sp-numDefaults+i]
+	}
+	vm.sp = vm.sp - numDefaults
+
+	closure := &ClosureObject{Fn: function, Free: free, Defaults: defaults}
 	return vm.push(closure)
 }
 
@@ -579,6 +757,11 @@ func (vm *VM) GetStackTop() Object {
 	return vm.stack[vm.sp-1]
 }
 
+// Global 第 index 个全局变量，下标见 Compiler.Globals
+func (vm *VM) Global(index int) Object {
+	return vm.globals[index]
+}
+
 func (vm *VM) GetLastStackItem() Object {
 	return vm.stack[vm.sp]
 }
@@ -593,3 +776,79 @@ func isTruthy(obj Object) bool {
 		return true
 	}
 }
+
+func isNumber(obj Object) bool {
+	switch obj.(type) {
+	case *IntegerObject, *BigIntObject, *FloatObject:
+		return true
+	}
+	return false
+}
+
+func isInteger(obj Object) bool {
+	switch obj.(type) {
+	case *IntegerObject, *BigIntObject:
+		return true
+	}
+	return false
+}
+
+// toFloat 整数提升成小数，调用前要先用 isNumber 判断
+func toFloat(obj Object) float64 {
+	switch obj := obj.(type) {
+	case *IntegerObject:
+		return float64(obj.Value)
+	case *BigIntObject:
+		f, _ := new(big.Float).SetInt(obj.Value).Float64()
+		return f
+	case *FloatObject:
+		return obj.Value
+	}
+	panic(fmt.Errorf("not a number: %s", obj.ValueType()))
+}
+
+// toBigInt 调用前要先用 isInteger 判断，返回的值不能改
+func toBigInt(obj Object) *big.Int {
+	switch obj := obj.(type) {
+	case *IntegerObject:
+		return big.NewInt(obj.Value)
+	case *BigIntObject:
+		return obj.Value
+	}
+	panic(fmt.Errorf("not an integer: %s", obj.ValueType()))
+}
+
+// newInteger 放得进 int64 的用 IntegerObject，放不下的用 BigIntObject
+func newInteger(v *big.Int) Object {
+	if v.IsInt64() {
+		return &IntegerObject{Value: v.Int64()}
+	}
+	return &BigIntObject{Value: v}
+}
+
+// newDictKey 字典的 key 只支持 string 和数字
+// 值是整数的小数当成整数，所以 d[1]、d[1.0] 和 d[bigint(1)] 是同一个 key
+func newDictKey(obj Object) (DictKeyObject, bool) {
+	switch obj := obj.(type) {
+	case *IntegerObject:
+		return DictKeyObject{Key: IntegerObject{Value: obj.Value}}, true
+	case *BigIntObject:
+		return newIntegerDictKey(obj.Value), true
+	case *FloatObject:
+		if obj.Value == math.Trunc(obj.Value) && !math.IsInf(obj.Value, 0) {
+			v, _ := big.NewFloat(obj.Value).Int(nil)
+			return newIntegerDictKey(v), true
+		}
+		return DictKeyObject{Key: FloatObject{Value: obj.Value}}, true
+	case *StringObject:
+		return DictKeyObject{Key: StringObject{Value: obj.Value}}, true
+	}
+	return DictKeyObject{}, false
+}
+
+func newIntegerDictKey(v *big.Int) DictKeyObject {
+	if v.IsInt64() {
+		return DictKeyObject{Key: IntegerObject{Value: v.Int64()}}
+	}
+	return DictKeyObject{Key: BigIntKeyObject{Value: v.String()}}
+}
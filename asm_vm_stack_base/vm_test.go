@@ -5,6 +5,9 @@ import (
 	sansLexer "go-compiler/lexer"
 	sansParser "go-compiler/parser"
 	"go-compiler/utils"
+	"math"
+	"math/big"
+	"strings"
 	"testing"
 )
 
@@ -34,6 +37,15 @@ func TestVm(t *testing.T) {
 		{"5 + 2 * 10", 25},
 		{"-1", -1},
 		{"not true", false},
+		{"-1 + 2", 1},
+		{"not false == true", true},
+		// and / or 的值是最后算的那一边，0 也是真的
+		{"var a = 0 var b = a and 1 b", 1},
+		{"0 or 1", 0},
+		{"null or 2", 2},
+		{"false and 3", false},
+		{"1 and 2", 2},
+		{"var i = 0 false and (i = 1) true or (i = 2) i", 0},
 	}
 
 	runVmTests(t, tests)
@@ -43,6 +55,7 @@ func TestVmVar(t *testing.T) {
 	tests := []vmTestCase{
 		{"var a = 1", 1},
 		{"var a = 1 a = a + 2", 3},
+		{"var 数量 = 1 数量 = 数量 + 2", 3},
 	}
 
 	runVmTests(t, tests)
@@ -98,11 +111,154 @@ func TestConditionals(t *testing.T) {
 			}
 		} i`, 2,
 		},
+		// 循环体每次都要跑，跑完不能在栈上留东西
+		{`
+		var s = 0
+		for(var i = 0; i < 4; i = i + 1) {
+			s = s + i
+		} s`, 6,
+		},
+		{`
+		var i = 0
+		while (i < 3000) {
+			i = i + 1
+		} i`, 3000,
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestIntegerAndFloat(t *testing.T) {
+	tests := []vmTestCase{
+		{"7 / 2", 3},
+		{"-7 / 2", -3},
+		{"7 % 3", 1},
+		{"-7 % 3", -1},
+		{"7.0 / 2", 3.5},
+		{"1 + 0.5", 1.5},
+		{"2 * 1.5", 3.0},
+		{"7.5 % 2", 1.5},
+		{"-1.5", -1.5},
+		{"1 == 1.0", true},
+		{"1 < 1.5", true},
+		{"2 >= 2.0", true},
+		{"9223372036854775807", 9223372036854775807},
+		{"0x7fff_ffff_ffff_ffff - 1", 9223372036854775806},
+		{"1e3", 1000.0},
+		{"[1, 2, 3][len([1])]", 2},
 	}
 
 	runVmTests(t, tests)
 }
 
+func TestIntegerRuntimeErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		err   string
+	}{
+		{"1 / 0", "integer division by zero"},
+		{"1 % 0", "integer division by zero"},
+		{"99999999999999999999 / 0", "integer division by zero"},
+		{"123n % 0", "integer division by zero"},
+		{"[1, 2][0.5]", "array index must be integer"},
+		{"var a = [1, 2] a[2] = 1", "index 2 out of range [0, 2)"},
+		{`1 == "1"`, "unsupported types for comparison: IntegerObject StringObject"},
+		{`"a" < "b"`, "unsupported types for comparison: StringObject StringObject"},
+		{"true != [1]", "unsupported types for comparison: BoolObject ArrayObject"},
+	}
+
+	for _, tt := range tests {
+		_, err := runVm(tt.input)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: want error %q, got %v", tt.input, tt.err, err)
+		}
+	}
+}
+
+func TestBigInt(t *testing.T) {
+	tests := []struct {
+		input     string
+		valueType string
+		inspect   string
+	}{
+		// 溢出自动变成大整数
+		{"9223372036854775807 + 1", "BigIntObject", "9223372036854775808"},
+		{"-9223372036854775807 - 2", "BigIntObject", "-9223372036854775809"},
+		{"4611686018427387904 * 2", "BigIntObject", "9223372036854775808"},
+		{"-9223372036854775807 - 1", "IntegerObject", "-9223372036854775808"},
+		{"-(-9223372036854775807 - 1)", "BigIntObject", "9223372036854775808"},
+		{"(-9223372036854775807 - 1) / -1", "BigIntObject", "9223372036854775808"},
+		// 放不下 int64 的字面量和 n 后缀
+		{"99999999999999999999", "BigIntObject", "99999999999999999999"},
+		{"0xFFFF_FFFF_FFFF_FFFF_FF / 0x100", "BigIntObject", "18446744073709551615"},
+		{"123n", "BigIntObject", "123"},
+		{"1" + strings.Repeat("0", 400) + "n / 1" + strings.Repeat("0", 399), "IntegerObject", "10"},
+		{"1" + strings.Repeat("0", 400) + " - 1", "BigIntObject", strings.Repeat("9", 400)},
+		// 结果放得进 int64 的变回整数
+		{"99999999999999999999 - 99999999999999999998", "IntegerObject", "1"},
+		{"123n + 1", "IntegerObject", "124"},
+		{"-99999999999999999999 / 7", "BigIntObject", "-14285714285714285714"},
+		{"-99999999999999999999 % 7", "IntegerObject", "-1"},
+		{"99999999999999999999 + 0.5", "FloatObject", "1e+20"},
+		// 比较
+		{"99999999999999999999 > 9223372036854775807", "BoolObject", "true"},
+		{"123n == 123", "BoolObject", "true"},
+		{"99999999999999999999 != 99999999999999999999", "BoolObject", "false"},
+		{"-99999999999999999999 < 1.5", "BoolObject", "true"},
+		// 字典 key
+		{`{99999999999999999999: "a"}[99999999999999999998 + 1]`, "StringObject", "a"},
+		{`{1: "a"}[1n]`, "StringObject", "a"},
+		{`{1e20: "a"}[100000000000000000000]`, "StringObject", "a"},
+		// 转换
+		{"bigint(5)", "BigIntObject", "5"},
+		{`bigint("123456789012345678901234567890")`, "BigIntObject", "123456789012345678901234567890"},
+		{"bigint(1e20)", "BigIntObject", "100000000000000000000"},
+		{"bigint(1.5)", "NullObject", "null"},
+		{"int(123n)", "IntegerObject", "123"},
+		{"int(-2.7)", "IntegerObject", "-2"},
+		{`int("42")`, "IntegerObject", "42"},
+		{"int(99999999999999999999)", "NullObject", "null"},
+		{"float(99999999999999999999)", "FloatObject", "1e+20"},
+		{"float(3)", "FloatObject", "3.0"},
+		{`float("1.5")`, "FloatObject", "1.5"},
+	}
+
+	for _, tt := range tests {
+		vm, err := runVm(tt.input)
+		if err != nil {
+			t.Errorf("%s: vm error: %s", tt.input, err)
+			continue
+		}
+		result := vm.GetStackTop()
+		if result.ValueType() != tt.valueType || result.Inspect() != tt.inspect {
+			t.Errorf("%s: got=%s %s, want=%s %s", tt.input, result.ValueType(), result.Inspect(), tt.valueType, tt.inspect)
+		}
+	}
+}
+
+func TestNumberInspect(t *testing.T) {
+	tests := []struct {
+		object   Object
+		expected string
+	}{
+		{&IntegerObject{Value: 1}, "1"},
+		{&IntegerObject{Value: -42}, "-42"},
+		{&FloatObject{Value: 2}, "2.0"},
+		{&FloatObject{Value: 0.1}, "0.1"},
+		{&FloatObject{Value: 1.5e-7}, "1.5e-07"},
+		{&FloatObject{Value: 1e21}, "1e+21"},
+		{&FloatObject{Value: math.Inf(1)}, "+Inf"},
+		{&BigIntObject{Value: new(big.Int).Lsh(big.NewInt(1), 70)}, "1180591620717411303424"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.object.Inspect(); got != tt.expected {
+			t.Errorf("Inspect() = %q, want %q", got, tt.expected)
+		}
+	}
+}
+
 func TestGlobalVariableStatements(t *testing.T) {
 	tests := []vmTestCase{
 		{"var one = 1\none", 1},
@@ -118,6 +274,29 @@ func TestStringExpressions(t *testing.T) {
 		{`"sans"`, "sans"},
 		{`"sans" + "one"`, "sansone"},
 		{`"sans" + "one" + "beloved"`, "sansonebeloved"},
+		{`"你好" + "😀"`, "你好😀"},
+		{"`sans`", "sans"},
+		{"var name = \"sans\"\n`hi ${name}!`", "hi sans!"},
+		{"`${1 + 2} ${7 / 2.0} ${true} ${null} ${99999999999999999999}`", "3 3.5 true null 99999999999999999999"},
+		{"`${[1, 2]}${\"\"}`", "[1 2]"},
+		{"`a${ `b${ {\"k\": 1}[\"k\"] }c` }d`", "ab1cd"},
+		{"var f = function(x) { return `<${x}>` }\nf(1) + f(`2`)", "<1><2>"},
+	}
+
+	runVmTests(t, tests)
+}
+
+// 不是数字的 == 按类型比，字符串比内容，数组比是不是同一个
+func TestEquality(t *testing.T) {
+	tests := []vmTestCase{
+		{`"ab" == "a" + "b"`, true},
+		{`"ab" != "ab"`, false},
+		{`"ab" == null`, false},
+		{"null == null", true},
+		{"0 != null", true},
+		{"true == (1 < 2)", true},
+		{"var a = [1]\na == a", true},
+		{"var a = [1]\na == [1]", false},
 	}
 
 	runVmTests(t, tests)
@@ -141,7 +320,7 @@ func TestObjectLiterals(t *testing.T) {
 		{
 			`{"1": 2}`,
 			map[DictKeyObject]Object{
-				DictKeyObject{Key: StringObject{Value: "1"}}: NumberObject{Value: 2},
+				DictKeyObject{Key: StringObject{Value: "1"}}: IntegerObject{Value: 2},
 			},
 		},
 	}
@@ -154,8 +333,12 @@ func TestArrayDictIndexExpression(t *testing.T) {
 		{"[1, 2, 3][1]", 2},
 		{"[1, 2, 3][0 + 2]", 3},
 		{"[[1, 2, 3]][0][0]", 1},
-		{`{"k":1}["k"]`, &NumberObject{Value: 1}},
-		{`var a = 1 {a:1}[a]`, &NumberObject{Value: 1}},
+		{`{"k":1}["k"]`, &IntegerObject{Value: 1}},
+		{`var a = 1 {a:1}[a]`, &IntegerObject{Value: 1}},
+		{`{1: "a"}[1.0]`, "a"},
+		{`{1.5: "a"}[1.5]`, "a"},
+		{"var a = [1, 2] a[1] = 5 a[1] + a[0]", 6},
+		{`var d = {"k": 1} d["j"] = 2 d["j"]`, 2},
 	}
 
 	runVmTests(t, tests)
@@ -164,6 +347,7 @@ func TestArrayDictIndexExpression(t *testing.T) {
 func TestBuiltinsExpression(t *testing.T) {
 	tests := []vmTestCase{
 		{`len([1,2])`, 2},
+		{`len("你好")`, 2},
 		{`log("1")`, &NullObject{}},
 		{`push([1],1)`, []int{1, 1}},
 		{`push(["s"],"s")`, []string{"s", "s"}},
@@ -177,6 +361,8 @@ func TestBinaryAssignmentExpression(t *testing.T) {
 	tests := []vmTestCase{
 		{`var a = 1 a *= 1`, 1},
 		{`var a = "1" a += "12"`, "112"},
+		{`var c = 10 c += 5 c`, 15},
+		{`var c = 10 c -= 5 c *= 3 c`, 15},
 	}
 
 	runVmTests(t, tests)
@@ -334,6 +520,88 @@ func TestCallingFunctionsLocal(t *testing.T) {
 	runVmTests(t, tests)
 }
 
+func TestCallingFunctionsWithExpressionArgs(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			input: `
+		 const identity = function(a) { a }
+		 var b = 1
+		 identity(b + 1)
+		`,
+			expected: 2,
+		},
+		{
+			input: `
+		 const sum = function(a, b) { return a + b }
+		 sum(sum(1, 2), sum(3, 4) * 2)
+		`,
+			expected: 17,
+		},
+		{
+			input: `
+		 const apply = function(f, x) { f(x) }
+		 apply(function(a) { a * 10 }, 5)
+		`,
+			expected: 50,
+		},
+		{
+			input: `
+		 const sum = function(a, b) { return a + b }
+		 sum(
+		 	-1,
+		 	[1, 2][1],
+		 )
+		`,
+			expected: 1,
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestCallingFunctionsWithDefaultAndRestParams(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			input: `
+		 const add = function(a, b = 10) { a + b }
+		 add(1) + add(1, 2)
+		`,
+			expected: 14,
+		},
+		{
+			input: `
+		 var base = 5
+		 const add = function(a = base, b = base * 2) { a + b }
+		 add()
+		`,
+			expected: 15,
+		},
+		{
+			input: `
+		 const count = function(a, ...rest) { len(rest) }
+		 count(1) + count(1, 2, 3) * 10
+		`,
+			expected: 20,
+		},
+		{
+			input: `
+		 const second = function(a, b = 2, ...rest) { rest[1] }
+		 second(1, 2, 3, 4)
+		`,
+			expected: 4,
+		},
+		{
+			input: `
+		 const all = function(...rest) { rest }
+		 all(1, 2)
+		`,
+			expected: []int{1, 2},
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
 func TestClosureCall(t *testing.T) {
 	tests := []vmTestCase{
 		{
@@ -403,21 +671,7 @@ func runVmTests(t *testing.T, tests []vmTestCase) {
 	t.Helper()
 
 	for _, tt := range tests {
-		lexer := sansLexer.SansLangLexer{}
-		lexer.Code = tt.input
-		tokenList := lexer.TokenList()
-		tokensLexer := sansLexer.TokenList{
-			Tokens: tokenList,
-		}
-		parser := sansParser.NewSansLangParser(&tokensLexer)
-		ast := parser.Parse()
-		compiler := NewCompiler()
-		compiler.Compile(ast)
-		bytecode := compiler.ReturnBytecode()
-		utils.LogInfo("bytecode: %+v", bytecode)
-
-		vm := NewVM(bytecode)
-		err := vm.Run()
+		vm, err := runVm(tt.input)
 		if err != nil {
 			t.Fatalf("vm error: %s", err)
 		}
@@ -429,6 +683,24 @@ func runVmTests(t *testing.T, tests []vmTestCase) {
 	}
 }
 
+func runVm(input string) (*VM, error) {
+	lexer := sansLexer.SansLangLexer{}
+	lexer.Code = input
+	tokenList := lexer.TokenList()
+	tokensLexer := sansLexer.TokenList{
+		Tokens: tokenList,
+	}
+	parser := sansParser.NewSansLangParser(&tokensLexer)
+	ast := parser.Parse()
+	compiler := NewCompiler()
+	compiler.Compile(ast)
+	bytecode := compiler.ReturnBytecode()
+	utils.LogInfo("bytecode: %+v", bytecode)
+
+	vm := NewVM(bytecode)
+	return vm, vm.Run()
+}
+
 func testExpectedObject(t *testing.T, expected interface{}, actual Object) {
 	t.Helper()
 
@@ -452,13 +724,18 @@ func testExpectedObject(t *testing.T, expected interface{}, actual Object) {
 		if e.Value != actual.(*StringObject).Value {
 			t.Errorf("object has wrong value. got=%q, want=%q", actual.(*StringObject).Value, e.Value)
 		}
-	case *NumberObject:
-		if e.Value != actual.(*NumberObject).Value {
-			t.Errorf("object has wrong value. got=%v, want=%v", actual.(*NumberObject).Value, e.Value)
+	case float64:
+		err := testFloatObjectValue(e, actual)
+		if err != nil {
+			t.Errorf("testFloatObject failed: %s", err)
+		}
+	case *IntegerObject:
+		if e.Value != actual.(*IntegerObject).Value {
+			t.Errorf("object has wrong value. got=%v, want=%v", actual.(*IntegerObject).Value, e.Value)
 		}
 	case *BoolObject:
 		if e.Value != actual.(*BoolObject).Value {
-			t.Errorf("object has wrong value. got=%v, want=%v", actual.(*NumberObject).Value, e.Value)
+			t.Errorf("object has wrong value. got=%v, want=%v", actual.(*BoolObject).Value, e.Value)
 		}
 	case *NullObject:
 		err := testNullObjectValue(e, actual)
@@ -559,6 +836,27 @@ func testExpectedObject(t *testing.T, expected interface{}, actual Object) {
 			actualValue := actualValues[i]
 			testExpectedObject(t, value, actualValue)
 		}
+	case map[DictKeyObject]Object:
+		dict, ok := actual.(*DictObject)
+		if !ok {
+			t.Errorf("object not Dict: %T (%+v)", actual, actual)
+			return
+		}
+		if len(dict.Pairs) != len(e) {
+			t.Errorf("hash has wrong number of Pairs. want=%d, got=%d", len(e), len(dict.Pairs))
+			return
+		}
+		// 值在 vm 里是指针，期望值是值类型，用 Inspect 比较
+		for expectedKey, expectedValue := range e {
+			actualValue, ok := dict.Pairs[expectedKey]
+			if !ok {
+				t.Errorf("no pair for key %s", expectedKey.Inspect())
+				continue
+			}
+			if actualValue.Inspect() != expectedValue.Inspect() {
+				t.Errorf("pair %s has wrong value. got=%s, want=%s", expectedKey.Inspect(), actualValue.Inspect(), expectedValue.Inspect())
+			}
+		}
 	case nil:
 		result, ok := actual.(*NullObject)
 		if !ok {
@@ -571,11 +869,23 @@ func testExpectedObject(t *testing.T, expected interface{}, actual Object) {
 }
 
 func testIntegerObjectValue(expected int64, actual Object) error {
-	result, ok := actual.(*NumberObject)
+	result, ok := actual.(*IntegerObject)
+	if !ok {
+		return fmt.Errorf("object is not Integer. got=%T (%+v)", actual, actual)
+	}
+	if result.Value != expected {
+		return fmt.Errorf("object has wrong value. got=%+v, want=%+v",
+			result.Value, expected)
+	}
+	return nil
+}
+
+func testFloatObjectValue(expected float64, actual Object) error {
+	result, ok := actual.(*FloatObject)
 	if !ok {
-		return fmt.Errorf("object is not Integer. got=%T (%+v)", result.Value, expected)
+		return fmt.Errorf("object is not Float. got=%T (%+v)", actual, actual)
 	}
-	if int64(result.Value) != expected {
+	if result.Value != expected {
 		return fmt.Errorf("object has wrong value. got=%+v, want=%+v",
 			result.Value, expected)
 	}
@@ -615,3 +925,44 @@ func testBoolObjectValue(expected bool, actual Object) error {
 
 	return nil
 }
+
+func BenchmarkGetOpCodeFromValue(b *testing.B) {
+	ops := []byte{}
+	for _, op := range OpCodeAll() {
+		ops = append(ops, byte(op.Value()))
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		GetOpCodeFromValue(ops[i%len(ops)])
+	}
+}
+
+// 一个循环跑 loops 次，每次大概 15 条指令
+func BenchmarkVMRun(b *testing.B) {
+	loops := 1000
+	lexer := sansLexer.NewSansLangLexer(fmt.Sprintf(`
+		var i = 0
+		var s = 0
+		while (i < %d) {
+			s = s + i * 2
+			i = i + 1
+		}
+		s`, loops))
+	tokensLexer := sansLexer.TokenList{
+		Tokens: lexer.TokenList(),
+	}
+	ast := sansParser.NewSansLangParser(&tokensLexer).Parse()
+	compiler := NewCompiler()
+	compiler.Compile(ast)
+	bytecode := compiler.ReturnBytecode()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		vm := NewVM(bytecode)
+		if err := vm.Run(); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N*loops), "ns/loop")
+}
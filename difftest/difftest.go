@@ -0,0 +1,240 @@
+package difftest
+
+import (
+	"bytes"
+	"fmt"
+	"go-compiler/asm_vm_register_base"
+	"go-compiler/asm_vm_stack_base"
+	"go-compiler/ir"
+	sansLexer "go-compiler/lexer"
+	sansParser "go-compiler/parser"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// 差分测试：同一个程序在几个后端上跑，打印的内容和全局变量的值都要一样
+//
+// 值都转成 Inspect 的字符串再比，函数不算全局变量（IR 里的函数不占变量）
+// 降低成 IR 出错、编译出错（utils.LogError 会 panic）和运行出错都当成 error，几个后端都出错也算一样
+
+// Result 一个后端跑完的结果
+type Result struct {
+	Output  string
+	Globals map[string]string
+}
+
+// Backend 以后加别的解释器实现这个接口就行
+type Backend interface {
+	Name() string
+	Run(program sansParser.Program) (Result, error)
+}
+
+// StackBackend 先降低成 IR，用 Passes 优化，再生成栈虚拟机的字节码
+type StackBackend struct {
+	Passes []string
+}
+
+func (this StackBackend) Name() string {
+	return irBackendName("stack", this.Passes)
+}
+
+func (this StackBackend) Run(program sansParser.Program) (result Result, err error) {
+	// log 是全局的，跑完换回来
+	var output bytes.Buffer
+	previous := asm_vm_stack_base.Output
+	asm_vm_stack_base.Output = &output
+	defer func() {
+		asm_vm_stack_base.Output = previous
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+
+	p, err := ir.Lower(program)
+	if err != nil {
+		return Result{}, err
+	}
+	ir.Optimize(p, this.Passes)
+	vm := asm_vm_stack_base.NewVM(asm_vm_stack_base.CompileIR(p))
+	if err := vm.Run(); err != nil {
+		return Result{}, err
+	}
+
+	globals := make(map[string]string)
+	for index, name := range p.Globals {
+		if value := vm.Global(index); value != nil {
+			globals[name] = value.Inspect()
+		}
+	}
+	return Result{Output: output.String(), Globals: globals}, nil
+}
+
+// RegisterBackend 先降低成 IR，用 Passes 优化，再生成寄存器虚拟机的汇编
+type RegisterBackend struct {
+	Passes []string
+}
+
+func (this RegisterBackend) Name() string {
+	return irBackendName("register", this.Passes)
+}
+
+func (this RegisterBackend) Run(program sansParser.Program) (result Result, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+
+	p, err := ir.Lower(program)
+	if err != nil {
+		return Result{}, err
+	}
+	ir.Optimize(p, this.Passes)
+	asm, err := asm_vm_register_base.GenerateAsmFromIR(p)
+	if err != nil {
+		return Result{}, err
+	}
+	assembler := asm_vm_register_base.NewAssembler()
+	assembler.AddAsm(asm)
+	memory, err := assembler.Compile()
+	if err != nil {
+		return Result{}, err
+	}
+	var output bytes.Buffer
+	vm := asm_vm_register_base.NewVM(memory)
+	vm.Output = &output
+	if err := vm.Run(); err != nil {
+		return Result{}, err
+	}
+
+	globals := make(map[string]string)
+	for index, name := range p.Globals {
+		globals[name] = vm.Inspect(vm.Memory[asm_vm_register_base.GlobalAddress(index)])
+	}
+	return Result{Output: output.String(), Globals: globals}, nil
+}
+
+// StackASTBackend 栈虚拟机的 Compiler 直接从 AST 生成字节码，repl 和 sans run --ast 用的是它
+type StackASTBackend struct{}
+
+func (StackASTBackend) Name() string {
+	return "stack-ast"
+}
+
+func (StackASTBackend) Run(program sansParser.Program) (result Result, err error) {
+	var output bytes.Buffer
+	previous := asm_vm_stack_base.Output
+	asm_vm_stack_base.Output = &output
+	defer func() {
+		asm_vm_stack_base.Output = previous
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+
+	compiler := asm_vm_stack_base.NewCompiler()
+	compiler.Compile(program)
+	vm := asm_vm_stack_base.NewVM(compiler.ReturnBytecode())
+	if err := vm.Run(); err != nil {
+		return Result{}, err
+	}
+
+	globals := make(map[string]string)
+	for name, index := range compiler.Globals() {
+		value := vm.Global(index)
+		if _, ok := value.(*asm_vm_stack_base.ClosureObject); ok || value == nil {
+			continue
+		}
+		globals[name] = value.Inspect()
+	}
+	return Result{Output: output.String(), Globals: globals}, nil
+}
+
+// 有优化的时候名字后面带上 pass，比如 stack[constprop,dce]
+func irBackendName(name string, passes []string) string {
+	if len(passes) == 0 {
+		return name
+	}
+	return name + "[" + strings.Join(passes, ",") + "]"
+}
+
+// Divergence 结果不一样的程序，Backends、Results、Errors 按顺序对应
+type Divergence struct {
+	Program  string
+	Backends []string
+	Results  []Result
+	Errors   []error
+}
+
+func (this *Divergence) Error() string {
+	var s strings.Builder
+	fmt.Fprintf(&s, "%s: backends disagree", this.Program)
+	for i, name := range this.Backends {
+		if this.Errors[i] != nil {
+			fmt.Fprintf(&s, "\n  %s: error: %v", name, this.Errors[i])
+			continue
+		}
+		fmt.Fprintf(&s, "\n  %s: output=%q globals=%s", name, this.Results[i].Output, formatGlobals(this.Results[i].Globals))
+	}
+	return s.String()
+}
+
+func formatGlobals(globals map[string]string) string {
+	names := make([]string, 0, len(globals))
+	for name := range globals {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	items := make([]string, 0, len(names))
+	for _, name := range names {
+		items = append(items, fmt.Sprintf("%s=%s", name, globals[name]))
+	}
+	return "{" + strings.Join(items, " ") + "}"
+}
+
+// Parse 解析 sans 源码，词法错误和语法错误当成 error
+func Parse(code string) (program sansParser.Program, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	lexer := sansLexer.NewSansLangLexer(code)
+	tokens := sansLexer.TokenList{Tokens: lexer.TokenList()}
+	if len(lexer.Errors) > 0 {
+		return sansParser.Program{}, fmt.Errorf("%v", lexer.Errors[0])
+	}
+	return sansParser.NewSansLangParser(&tokens).ParseProgram()
+}
+
+// Compare 在每个后端上跑 code，结果都一样返回 nil
+func Compare(name string, code string, backends ...Backend) (*Divergence, error) {
+	program, err := Parse(code)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+
+	d := &Divergence{Program: name}
+	same := true
+	for i, backend := range backends {
+		result, err := backend.Run(program)
+		d.Backends = append(d.Backends, backend.Name())
+		d.Results = append(d.Results, result)
+		d.Errors = append(d.Errors, err)
+		if i > 0 && !sameResult(d.Results[0], d.Errors[0], result, err) {
+			same = false
+		}
+	}
+	if same {
+		return nil, nil
+	}
+	return d, nil
+}
+
+func sameResult(a Result, aErr error, b Result, bErr error) bool {
+	if aErr != nil || bErr != nil {
+		return aErr != nil && bErr != nil
+	}
+	return a.Output == b.Output && reflect.DeepEqual(a.Globals, b.Globals)
+}
@@ -0,0 +1,240 @@
+package difftest
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"go-compiler/ir"
+	sansParser "go-compiler/parser"
+)
+
+var backends = []Backend{
+	StackBackend{},
+	RegisterBackend{},
+	StackASTBackend{},
+	StackBackend{Passes: ir.PassesForLevel(2)},
+	RegisterBackend{Passes: ir.PassesForLevel(2)},
+}
+
+// testdata 里的程序在所有后端上跑，报第一个结果不一样的程序
+func TestCorpus(t *testing.T) {
+	runCorpus(t, backends...)
+}
+
+// 每个优化单独开，结果和不优化的一样
+func TestCorpusEachPass(t *testing.T) {
+	for _, pass := range ir.Passes {
+		passes := []string{pass.Name}
+		runCorpus(t, StackBackend{}, StackBackend{Passes: passes}, RegisterBackend{Passes: passes})
+	}
+}
+
+func runCorpus(t *testing.T, backends ...Backend) {
+	t.Helper()
+	files, err := filepath.Glob(filepath.Join("testdata", "*.sans"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no programs in testdata")
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		code, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		d, err := Compare(filepath.Base(file), string(code), backends...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d != nil {
+			t.Fatal(d)
+		}
+	}
+}
+
+// 循环体里的不变量挪出循环，结果不变；循环一次都不跑的时候挪出去的 k * 2 也不能算
+func TestLoopInvariantHoisted(t *testing.T) {
+	code := `
+var f = function(n, k) {
+    var s = 0
+    var i = 0
+    while (i < n) {
+        s = s + k * 2
+        i = i + 1
+    }
+    return s
+}
+log(f(5, 3), f(0, "x"))
+`
+	passes := []string{"licm", "copyprop"}
+	program, err := Parse(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := ir.Lower(program)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ir.Optimize(p, passes)
+	for _, block := range p.Function("f").Blocks {
+		for _, ins := range block.Instructions {
+			if ins.Op == ir.OpMul && inLoop(block) {
+				t.Errorf("%s not hoisted out of %s\n%s", ins, block.Name(), p)
+			}
+		}
+	}
+
+	d, err := Compare("licm", code, StackBackend{}, StackBackend{Passes: passes}, RegisterBackend{Passes: passes}, StackASTBackend{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d != nil {
+		t.Fatal(d)
+	}
+}
+
+// 从 block 出发能不能走回 block
+func inLoop(block *ir.Block) bool {
+	visited := make(map[*ir.Block]bool)
+	worklist := append([]*ir.Block{}, block.Succs...)
+	for len(worklist) > 0 {
+		b := worklist[len(worklist)-1]
+		worklist = worklist[:len(worklist)-1]
+		if b == block {
+			return true
+		}
+		if !visited[b] {
+			visited[b] = true
+			worklist = append(worklist, b.Succs...)
+		}
+	}
+	return false
+}
+
+// 假的后端，用来检查差分本身
+type fakeBackend struct {
+	name   string
+	result Result
+	err    error
+}
+
+func (this fakeBackend) Name() string {
+	return this.name
+}
+
+func (this fakeBackend) Run(program sansParser.Program) (Result, error) {
+	return this.result, this.err
+}
+
+func TestCompare(t *testing.T) {
+	one := Result{Output: "1\n", Globals: map[string]string{"a": "1"}}
+	two := Result{Output: "1\n", Globals: map[string]string{"a": "2"}}
+	tests := []struct {
+		backends []Backend
+		expected string
+	}{
+		{[]Backend{fakeBackend{"x", one, nil}, fakeBackend{"y", one, nil}}, ""},
+		{[]Backend{fakeBackend{"x", Result{}, fmt.Errorf("boom")}, fakeBackend{"y", Result{}, fmt.Errorf("bang")}}, ""},
+		{
+			[]Backend{fakeBackend{"x", one, nil}, fakeBackend{"y", two, nil}},
+			"p: backends disagree\n  x: output=\"1\\n\" globals={a=1}\n  y: output=\"1\\n\" globals={a=2}",
+		},
+		{
+			[]Backend{fakeBackend{"x", one, nil}, fakeBackend{"y", one, nil}, fakeBackend{"z", Result{}, fmt.Errorf("boom")}},
+			"p: backends disagree\n  x: output=\"1\\n\" globals={a=1}\n  y: output=\"1\\n\" globals={a=1}\n  z: error: boom",
+		},
+	}
+
+	for _, tt := range tests {
+		d, err := Compare("p", "var a = 1", tt.backends...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := ""
+		if d != nil {
+			got = d.Error()
+		}
+		if got != tt.expected {
+			t.Errorf("divergence wrong.\ngot=%s\nwant=%s", got, tt.expected)
+		}
+	}
+}
+
+// 真的后端在不一样的地方也要报出来
+// 类型不一样的 == 和不是数字的比大小，每个后端都是运行错误
+func TestComparisonTypeMismatch(t *testing.T) {
+	for _, code := range []string{`var a = 1 == "1"`, `var a = true != 0`, `var a = "a" < "b"`} {
+		program, err := Parse(code)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, backend := range backends {
+			if _, err := backend.Run(program); err == nil {
+				t.Errorf("%s: %s should fail", code, backend.Name())
+			}
+		}
+	}
+}
+
+// IR 还没有的特性只有 stack-ast 能跑，IR 的后端要返回 Lower 的错误，不能 panic
+func TestIRUnsupported(t *testing.T) {
+	tests := []struct {
+		code    string
+		output  string
+		irError string
+	}{
+		{"var d = {\"a\": 1}\nlog(d[\"a\"])", "1\n", "ir does not support DictLiteral"},
+		{"var f = function(a, b = 2) { return a + b }\nlog(f(1))", "3\n", "ir does not support DefaultParameter"},
+		{"var f = function(a, ...b) { return a }\nlog(f(1, 2))", "1\n", "ir does not support RestParameter"},
+		{"var a = 1\nlog(`a=${a}`)", "a=1\n", "ir does not support TemplateLiteral"},
+		{"log(123456789012345678901234567890)", "123456789012345678901234567890\n", "ir only supports int64 integers, got 123456789012345678901234567890"},
+		{"log(5n)", "5\n", "ir only supports int64 integers, got 5n"},
+		{
+			"var f = function() {\n    var n = 1\n    var g = function() { return n }\n    return g\n}\nlog(f()())",
+			"1\n",
+			"ir does not support closures, n is in an outer function",
+		},
+	}
+
+	for _, tt := range tests {
+		program, err := Parse(tt.code)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := StackASTBackend{}.Run(program)
+		if err != nil {
+			t.Errorf("%q: stack-ast error: %v", tt.code, err)
+		} else if result.Output != tt.output {
+			t.Errorf("%q: stack-ast output wrong. got=%q want=%q", tt.code, result.Output, tt.output)
+		}
+		for _, backend := range backends {
+			if _, ok := backend.(StackASTBackend); ok {
+				continue
+			}
+			_, err := backend.Run(program)
+			if err == nil || err.Error() != tt.irError {
+				t.Errorf("%q: %s error wrong. got=%v want=%s", tt.code, backend.Name(), err, tt.irError)
+			}
+		}
+	}
+}
+
+func TestCompareBackends(t *testing.T) {
+	// 寄存器后端只有整数
+	d, err := Compare("float", "var a = 1.5", backends...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d == nil || d.Errors[0] != nil || d.Errors[1] == nil {
+		t.Fatalf("float should only fail on the register backend. got=%v", d)
+	}
+	if !strings.HasPrefix(d.Error(), "float: backends disagree\n  stack: output=\"\" globals={a=1.5}\n  register: error: ") {
+		t.Errorf("divergence wrong. got=%s", d.Error())
+	}
+}
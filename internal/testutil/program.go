@@ -0,0 +1,18 @@
+package testutil
+
+import (
+	"fmt"
+	"strings"
+)
+
+// GenerateProgram 生成 n 组变量定义、if 和 while 组成的大程序，一组 3 行 3 条顶层语句
+// 只给 parser、语义分析和编译器的测试和 benchmark 用
+func GenerateProgram(n int) string {
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&b, "var a%d = %d + 2 * 3 - 1\n", i, i)
+		fmt.Fprintf(&b, "if (a%d > 10) { a%d = a%d - 1 } else { a%d = a%d + 1 }\n", i, i, i, i, i)
+		fmt.Fprintf(&b, "while (a%d < 0) { a%d += 1 }\n", i, i)
+	}
+	return b.String()
+}
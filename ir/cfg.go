@@ -0,0 +1,276 @@
+package ir
+
+import (
+	"fmt"
+)
+
+// ComputeCFG 根据每个块结尾的指令重新算前驱和后继
+// 从入口走不到的块删掉，剩下的块按原来的顺序重新编号
+// phi 里已经不是前驱的块来的操作数也删掉
+func (this *Function) ComputeCFG() {
+	reachable := make(map[*Block]bool)
+	var walk func(block *Block)
+	walk = func(block *Block) {
+		if reachable[block] {
+			return
+		}
+		reachable[block] = true
+		if t := block.Terminator(); t != nil {
+			for _, target := range t.Targets {
+				walk(target)
+			}
+		}
+	}
+	if len(this.Blocks) > 0 {
+		walk(this.Blocks[0])
+	}
+
+	blocks := []*Block{}
+	for _, block := range this.Blocks {
+		if reachable[block] {
+			block.ID = len(blocks)
+			block.Preds, block.Succs = nil, nil
+			blocks = append(blocks, block)
+		}
+	}
+	this.Blocks = blocks
+	for _, block := range blocks {
+		t := block.Terminator()
+		if t == nil {
+			continue
+		}
+		for _, target := range t.Targets {
+			// branch 两边是同一个块的时候只算一次
+			if containsBlock(block.Succs, target) {
+				continue
+			}
+			block.Succs = append(block.Succs, target)
+			target.Preds = append(target.Preds, block)
+		}
+	}
+	for _, block := range blocks {
+		for _, phi := range block.Phis() {
+			args, targets := phi.Args[:0], phi.Targets[:0]
+			for i, target := range phi.Targets {
+				if containsBlock(block.Preds, target) {
+					args, targets = append(args, phi.Args[i]), append(targets, target)
+				}
+			}
+			phi.Args, phi.Targets = args, targets
+		}
+	}
+}
+
+// Phis 块开头的 phi
+func (this *Block) Phis() []*Instruction {
+	n := 0
+	for n < len(this.Instructions) && this.Instructions[n].Op == OpPhi {
+		n++
+	}
+	return this.Instructions[:n]
+}
+
+func containsBlock(blocks []*Block, block *Block) bool {
+	for _, b := range blocks {
+		if b == block {
+			return true
+		}
+	}
+	return false
+}
+
+// ReversePostorder 逆后序，除了回边，前驱都排在后继前面
+func (this *Function) ReversePostorder() []*Block {
+	visited := make(map[*Block]bool)
+	var order []*Block
+	var walk func(block *Block)
+	walk = func(block *Block) {
+		visited[block] = true
+		for _, succ := range block.Succs {
+			if !visited[succ] {
+				walk(succ)
+			}
+		}
+		order = append(order, block)
+	}
+	if len(this.Blocks) > 0 {
+		walk(this.Blocks[0])
+	}
+	for i, j := 0, len(order)-1; i < j; i, j = i+1, j-1 {
+		order[i], order[j] = order[j], order[i]
+	}
+	return order
+}
+
+// Verify 检查函数是不是合法的 IR，降低和优化以后都可以调
+//
+//   - 每个块最后一条是结尾的指令，中间没有
+//   - 跳去的块在函数里，前驱后继和结尾的指令对得上
+//   - 用到的变量都在 Vars 里，操作数的个数对
+//   - phi 在块的最前面，每个前驱正好一个操作数
+func (this *Function) Verify() error {
+	if len(this.Blocks) == 0 {
+		return fmt.Errorf("%s: no blocks", this.Name)
+	}
+	vars := make(map[*Var]bool)
+	for _, v := range this.Vars {
+		vars[v] = true
+	}
+	for _, p := range this.Params {
+		if !vars[p] {
+			return fmt.Errorf("%s: param %s not in vars", this.Name, p)
+		}
+	}
+	blocks := make(map[*Block]bool)
+	for i, block := range this.Blocks {
+		if block.ID != i {
+			return fmt.Errorf("%s: block %s at %d", this.Name, block.Name(), i)
+		}
+		blocks[block] = true
+	}
+
+	for _, block := range this.Blocks {
+		where := func(ins *Instruction) string {
+			return fmt.Sprintf("%s: %s: %s", this.Name, block.Name(), ins)
+		}
+		if block.Terminator() == nil {
+			return fmt.Errorf("%s: %s: missing terminator", this.Name, block.Name())
+		}
+		for i, ins := range block.Instructions {
+			if ins.Op.IsTerminator() != (i == len(block.Instructions)-1) {
+				return fmt.Errorf("%s: terminator in the middle of the block", where(ins))
+			}
+			if ins.Op == OpPhi {
+				if i > 0 && block.Instructions[i-1].Op != OpPhi {
+					return fmt.Errorf("%s: phi after other instructions", where(ins))
+				}
+				if len(ins.Targets) != len(block.Preds) {
+					return fmt.Errorf("%s: phi needs one operand for each pred", where(ins))
+				}
+				for j, target := range ins.Targets {
+					if !containsBlock(block.Preds, target) || containsBlock(ins.Targets[:j], target) {
+						return fmt.Errorf("%s: phi needs one operand for each pred", where(ins))
+					}
+				}
+			}
+			if ins.Dest != nil && !vars[ins.Dest] {
+				return fmt.Errorf("%s: %s not in vars", where(ins), ins.Dest)
+			}
+			for _, v := range ins.Vars() {
+				if !vars[v] {
+					return fmt.Errorf("%s: %s not in vars", where(ins), v)
+				}
+			}
+			for _, target := range ins.Targets {
+				if !blocks[target] {
+					return fmt.Errorf("%s: target not in function", where(ins))
+				}
+			}
+			if err := checkShape(ins); err != nil {
+				return fmt.Errorf("%s: %v", where(ins), err)
+			}
+		}
+		for _, succ := range block.Succs {
+			if !containsBlock(block.Terminator().Targets, succ) || !containsBlock(succ.Preds, block) {
+				return fmt.Errorf("%s: %s: stale cfg, run ComputeCFG", this.Name, block.Name())
+			}
+		}
+		for _, target := range block.Terminator().Targets {
+			if !containsBlock(block.Succs, target) {
+				return fmt.Errorf("%s: %s: stale cfg, run ComputeCFG", this.Name, block.Name())
+			}
+		}
+	}
+	return nil
+}
+
+// 操作数和结果的个数
+func checkShape(ins *Instruction) error {
+	// args 是 -1 的时候操作数的个数不限
+	args, dest, targets := 1, true, 0
+	switch ins.Op {
+	case OpCopy, OpNeg, OpNot:
+	case OpAdd, OpSub, OpMul, OpDiv, OpMod, OpEq, OpNe, OpLt, OpLe, OpGt, OpGe, OpIndex:
+		args = 2
+	case OpArray:
+		args = -1
+	case OpSetIndex:
+		args, dest = 3, false
+	case OpLoadGlobal:
+		args = 0
+	case OpStoreGlobal:
+		dest = false
+	case OpCall, OpBuiltin:
+		// 结果不用的调用可以没有 Dest
+		args, dest = -1, ins.Dest != nil
+	case OpJump:
+		args, dest, targets = 0, false, 1
+	case OpBranch:
+		dest, targets = false, 2
+	case OpPhi:
+		args, targets = len(ins.Targets), len(ins.Targets)
+	case OpReturn:
+		if len(ins.Args) > 1 {
+			return fmt.Errorf("return takes at most 1 operand, got %d", len(ins.Args))
+		}
+		args, dest = len(ins.Args), false
+	default:
+		return fmt.Errorf("unknown op %v", ins.Op)
+	}
+	if args >= 0 && len(ins.Args) != args {
+		return fmt.Errorf("%s needs %d operands, got %d", ins.Op, args, len(ins.Args))
+	}
+	if dest != (ins.Dest != nil) {
+		return fmt.Errorf("%s: wrong destination", ins.Op)
+	}
+	if len(ins.Targets) != targets {
+		return fmt.Errorf("%s needs %d targets, got %d", ins.Op, targets, len(ins.Targets))
+	}
+	switch ins.Op {
+	case OpLoadGlobal, OpStoreGlobal, OpCall, OpBuiltin:
+		if ins.Name == "" {
+			return fmt.Errorf("%s: missing name", ins.Op)
+		}
+	}
+	return nil
+}
+
+// LocalVars 只在一个块里用的变量：定义和使用都在这个块里，并且先定义后使用
+// 这样的变量在块开头是死的，后端可以放进临时的寄存器或者栈槽，块结束就可以还回去
+// 参数不算，参数在入口的时候就有值了
+func (this *Function) LocalVars() map[*Var]*Block {
+	home := make(map[*Var]*Block)
+	shared := make(map[*Var]bool)
+	for _, p := range this.Params {
+		shared[p] = true
+	}
+	for _, block := range this.Blocks {
+		defined := make(map[*Var]bool)
+		for _, ins := range block.Instructions {
+			for _, v := range ins.Vars() {
+				// 先用后定义，用的是别的块或者上一圈的值
+				if !defined[v] {
+					shared[v] = true
+				}
+				if b, ok := home[v]; ok && b != block {
+					shared[v] = true
+				}
+				home[v] = block
+			}
+			if ins.Dest != nil {
+				if b, ok := home[ins.Dest]; ok && b != block {
+					shared[ins.Dest] = true
+				}
+				home[ins.Dest] = block
+				defined[ins.Dest] = true
+			}
+		}
+	}
+	local := make(map[*Var]*Block)
+	for v, block := range home {
+		if !shared[v] {
+			local[v] = block
+		}
+	}
+	return local
+}
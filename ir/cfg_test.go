@@ -0,0 +1,129 @@
+package ir
+
+import (
+	"sort"
+	"strings"
+	"testing"
+)
+
+func blockNames(blocks []*Block) string {
+	names := []string{}
+	for _, block := range blocks {
+		names = append(names, block.Name())
+	}
+	return strings.Join(names, " ")
+}
+
+func TestComputeCFG(t *testing.T) {
+	// return 后面的代码走不到，已经删掉了
+	program := lower(t, `
+		var f = function(n) {
+			while (n > 0) {
+				if (n == 5) {
+					return n
+					n = 0
+				}
+				n -= 1
+			}
+			return 0
+		}
+	`)
+	fn := program.Function("f")
+	tests := []struct {
+		block string
+		preds string
+		succs string
+	}{
+		{"b0", "", "b1"},
+		{"b1", "b0 b4", "b2 b5"},
+		{"b2", "b1", "b3 b4"},
+		{"b3", "b2", ""},
+		{"b4", "b2", "b1"},
+		{"b5", "b1", ""},
+	}
+	if len(fn.Blocks) != len(tests) {
+		t.Fatalf("wrong number of blocks. got=%d, want=%d\n%s", len(fn.Blocks), len(tests), fn)
+	}
+	for i, tt := range tests {
+		block := fn.Blocks[i]
+		if block.Name() != tt.block || blockNames(block.Preds) != tt.preds || blockNames(block.Succs) != tt.succs {
+			t.Errorf("%s: preds=%q succs=%q, want %s: preds=%q succs=%q\n%s",
+				block.Name(), blockNames(block.Preds), blockNames(block.Succs), tt.block, tt.preds, tt.succs, fn)
+		}
+	}
+
+	if got := blockNames(fn.ReversePostorder()); got != "b0 b1 b5 b2 b4 b3" {
+		t.Errorf("reverse postorder wrong. got=%s", got)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	tests := []struct {
+		build    func(fn *Function)
+		expected string
+	}{
+		{func(fn *Function) {}, "f: no blocks"},
+		{func(fn *Function) {
+			fn.NewBlock()
+		}, "f: b0: missing terminator"},
+		{func(fn *Function) {
+			b := fn.NewBlock()
+			b.Instructions = []*Instruction{{Op: OpReturn}, {Op: OpReturn}}
+		}, "f: b0: return: terminator in the middle of the block"},
+		{func(fn *Function) {
+			b := fn.NewBlock()
+			b.Instructions = []*Instruction{{Op: OpAdd, Dest: fn.NewVar(""), Args: []Value{IntConst(1)}}, {Op: OpReturn}}
+		}, "f: b0: %0 = add 1: add needs 2 operands, got 1"},
+		{func(fn *Function) {
+			b := fn.NewBlock()
+			b.Instructions = []*Instruction{{Op: OpReturn, Args: []Value{&Var{Name: "x"}}}}
+		}, "f: b0: return %x: %x not in vars"},
+		{func(fn *Function) {
+			b := fn.NewBlock()
+			b.Instructions = []*Instruction{{Op: OpStoreGlobal, Args: []Value{IntConst(1)}}, {Op: OpReturn}}
+		}, "f: b0: store_global 1: store_global: missing name"},
+		{func(fn *Function) {
+			b := fn.NewBlock()
+			b.Instructions = []*Instruction{{Op: OpJump, Targets: []*Block{{}}}}
+		}, "f: b0: jump b0: target not in function"},
+		// 改了跳转没有重新算前驱后继
+		{func(fn *Function) {
+			b0, b1 := fn.NewBlock(), fn.NewBlock()
+			b0.Instructions = []*Instruction{{Op: OpJump, Targets: []*Block{b1}}}
+			b1.Instructions = []*Instruction{{Op: OpReturn}}
+		}, "f: b0: stale cfg, run ComputeCFG"},
+	}
+
+	for _, tt := range tests {
+		fn := &Function{Name: "f"}
+		tt.build(fn)
+		err := fn.Verify()
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("error wrong. got=%v, want=%s", err, tt.expected)
+		}
+	}
+}
+
+func TestLocalVars(t *testing.T) {
+	program := lower(t, `
+		var f = function(n) {
+			var s = n + 1
+			var t = 0
+			while (t < s) {
+				var u = t * 2
+				t = t + u + 1
+			}
+			return s and t
+		}
+	`)
+	fn := program.Function("f")
+	var names []string
+	for v := range fn.LocalVars() {
+		names = append(names, v.Name)
+	}
+	sort.Strings(names)
+	// s t 跨块，and 的结果 %9 在两个块里赋值，u 和算出来马上用掉的临时变量不跨块
+	if got := strings.Join(names, " "); got != "1 4 5 7 8 u" {
+		t.Errorf("local vars wrong. got=%s\n%s", got, fn)
+	}
+}
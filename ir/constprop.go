@@ -0,0 +1,149 @@
+package ir
+
+import (
+	"math"
+)
+
+// ConstantPropagation 操作数都是常量的运算直接算出来，用到结果的地方换成常量，
+// 条件是常量的 branch 变成 jump，走不到的块删掉
+//
+// 两个虚拟机不一样的地方不折叠：只算整数、布尔和 null，
+// 整数溢出（栈虚拟机会变成大整数）、除以 0 留到运行的时候
+func ConstantPropagation(fn *Function) bool {
+	changed := false
+	for {
+		subst := make(map[*Var]Value)
+		remove := make(map[*Instruction]bool)
+		branches := false
+		for _, block := range fn.Blocks {
+			for _, ins := range block.Instructions {
+				// 前面算出来的常量先换进来
+				for i, arg := range ins.Args {
+					if v, ok := arg.(*Var); ok {
+						if c, ok := subst[v]; ok {
+							ins.Args[i] = c
+						}
+					}
+				}
+				if ins.Op == OpBranch {
+					if c, ok := ins.Args[0].(*Const); ok {
+						target := ins.Targets[1]
+						if constTruth(c) {
+							target = ins.Targets[0]
+						}
+						ins.Op, ins.Args, ins.Targets = OpJump, nil, []*Block{target}
+						branches = true
+					}
+					continue
+				}
+				if c := foldInstruction(ins); c != nil {
+					subst[ins.Dest] = c
+					remove[ins] = true
+				}
+			}
+		}
+		fn.substitute(subst)
+		fn.removeInstructions(remove)
+		if branches {
+			fn.ComputeCFG()
+		}
+		if len(remove) == 0 && !branches {
+			return changed
+		}
+		changed = true
+	}
+}
+
+// 跟两个虚拟机一样，false 和 null 是假，其他都是真
+func constTruth(c *Const) bool {
+	switch c.Kind {
+	case ConstBool:
+		return c.Bool
+	case ConstNull:
+		return false
+	}
+	return true
+}
+
+// 算出指令的结果，算不了返回 nil
+func foldInstruction(ins *Instruction) *Const {
+	switch ins.Op {
+	case OpCopy:
+		c, _ := ins.Args[0].(*Const)
+		return c
+	case OpPhi:
+		c, _ := phiValue(ins).(*Const)
+		return c
+	case OpNeg:
+		if c, ok := ins.Args[0].(*Const); ok && c.Kind == ConstInt && c.Int != math.MinInt64 {
+			return IntConst(-c.Int)
+		}
+	case OpNot:
+		if c, ok := ins.Args[0].(*Const); ok {
+			return BoolConst(!constTruth(c))
+		}
+	}
+	if !ins.Op.IsBinary() {
+		return nil
+	}
+	a, aConst := ins.Args[0].(*Const)
+	b, bConst := ins.Args[1].(*Const)
+	if !aConst || !bConst || a.Kind != b.Kind {
+		return nil
+	}
+	// 同一种的布尔和 null 只比较相等
+	if a.Kind == ConstBool || a.Kind == ConstNull {
+		switch ins.Op {
+		case OpEq:
+			return BoolConst(a.Equal(b))
+		case OpNe:
+			return BoolConst(!a.Equal(b))
+		}
+		return nil
+	}
+	if a.Kind != ConstInt {
+		return nil
+	}
+	return foldInt(ins.Op, a.Int, b.Int)
+}
+
+func foldInt(op Op, a int64, b int64) *Const {
+	switch op {
+	case OpAdd:
+		if r := a + b; (r > a) == (b > 0) {
+			return IntConst(r)
+		}
+	case OpSub:
+		if r := a - b; (r < a) == (b > 0) {
+			return IntConst(r)
+		}
+	case OpMul:
+		if a == 0 || b == 0 {
+			return IntConst(0)
+		}
+		if r := a * b; r/b == a && !(a == -1 && b == math.MinInt64) && !(b == -1 && a == math.MinInt64) {
+			return IntConst(r)
+		}
+	case OpDiv:
+		if b != 0 && !(a == math.MinInt64 && b == -1) {
+			return IntConst(a / b)
+		}
+	case OpMod:
+		if b != 0 && !(a == math.MinInt64 && b == -1) {
+			return IntConst(a % b)
+		}
+	case OpEq:
+		return BoolConst(a == b)
+	case OpNe:
+		return BoolConst(a != b)
+	case OpLt:
+		return BoolConst(a < b)
+	case OpLe:
+		return BoolConst(a <= b)
+	case OpGt:
+		return BoolConst(a > b)
+	case OpGe:
+		return BoolConst(a >= b)
+	}
+	return nil
+}
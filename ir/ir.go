@@ -0,0 +1,382 @@
+package ir
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// 中间表示：三地址码，按基本块组织成控制流图
+//
+// AST 只在 Lower 里降低一次，栈虚拟机（asm_vm_stack_base.CompileIR）和
+// 寄存器虚拟机（asm_vm_register_base.GenerateAsmFromIR）都从这里生成代码，
+// 优化只要在 IR 上写一遍
+//
+//	function f(%n) {
+//	b0:
+//	    %1 = lt %n 2
+//	    branch %1 b1 b2
+//	b1:
+//	    return %n
+//	b2:
+//	    …
+//	}
+//
+// 函数里的变量（参数、局部变量、临时变量）都是 Var，全局变量只能用 load_global / store_global 读写，
+// 因为别的函数也能改它。每个基本块最后一条是跳转或者返回，中间没有跳转
+type Op struct {
+	name  string
+	value int64
+}
+
+var (
+	validOps  = []Op{}
+	opByValue = map[int64]Op{}
+	opByName  = map[string]Op{}
+
+	// %d = a
+	OpCopy = newOp("copy", 1)
+	// %d = a op b
+	OpAdd = newOp("add", 2)
+	OpSub = newOp("sub", 3)
+	OpMul = newOp("mul", 4)
+	OpDiv = newOp("div", 5)
+	OpMod = newOp("mod", 6)
+	OpEq  = newOp("eq", 7)
+	OpNe  = newOp("ne", 8)
+	OpLt  = newOp("lt", 9)
+	OpLe  = newOp("le", 10)
+	OpGt  = newOp("gt", 11)
+	OpGe  = newOp("ge", 12)
+	// %d = op a
+	OpNeg = newOp("neg", 13)
+	OpNot = newOp("not", 14)
+
+	// %d = [a, b, …]
+	OpArray = newOp("array", 20)
+	// %d = a[i]
+	OpIndex = newOp("index", 21)
+	// a[i] = v
+	OpSetIndex = newOp("set_index", 22)
+
+	// %d = 全局变量 Name
+	OpLoadGlobal = newOp("load_global", 30)
+	// 全局变量 Name = a
+	OpStoreGlobal = newOp("store_global", 31)
+
+	// %d = Name(a, b, …)，Name 是 Program 里的函数
+	OpCall = newOp("call", 40)
+	// %d = Name(a, b, …)，Name 是内置函数 len push log
+	OpBuiltin = newOp("builtin", 41)
+
+	// 结尾的指令
+	// jump Targets[0]
+	OpJump = newOp("jump", 50)
+	// a 是真的去 Targets[0]，不然去 Targets[1]
+	OpBranch = newOp("branch", 51)
+	// return a，没有 a 返回 null
+	OpReturn = newOp("return", 52)
+
+	// %d = 从 Targets[i] 来的时候是 Args[i]，只在 SSA 里有，放在块的最前面
+	OpPhi = newOp("phi", 60)
+)
+
+func newOp(name string, value int64) Op {
+	if _, ok := opByValue[value]; ok {
+		panic(fmt.Errorf("duplicate Op value: (%s %d)", name, value))
+	}
+	o := Op{name: name, value: value}
+	validOps = append(validOps, o)
+	opByValue[value] = o
+	opByName[name] = o
+	return o
+}
+
+func OpAll() []Op {
+	return validOps
+}
+
+func (o Op) Name() string {
+	return o.name
+}
+
+func (o Op) Value() int64 {
+	return o.value
+}
+
+func (o Op) String() string {
+	return o.name
+}
+
+// IsTerminator 基本块最后一条指令
+func (o Op) IsTerminator() bool {
+	return o == OpJump || o == OpBranch || o == OpReturn
+}
+
+// IsBinary 两个操作数算出一个值
+func (o Op) IsBinary() bool {
+	return o.value >= OpAdd.value && o.value <= OpGe.value
+}
+
+// HasSideEffect 结果不用也不能删掉的指令
+func (o Op) HasSideEffect() bool {
+	switch o {
+	case OpSetIndex, OpStoreGlobal, OpCall, OpBuiltin:
+		return true
+	}
+	return o.IsTerminator()
+}
+
+// IsPure 结果只取决于操作数的指令，可以合并，也可以挪出循环
+// array 每次都是新的数组，index 读到的元素会被改，都不算
+func (o Op) IsPure() bool {
+	return o.IsBinary() || o == OpNeg || o == OpNot
+}
+
+// Value 指令的操作数，*Var 或者 *Const
+type Value interface {
+	String() string
+}
+
+// Var 函数里的变量，名字在一个函数里不重复
+// 源码里的变量用源码的名字，Lower 生成的临时变量是数字
+type Var struct {
+	Name string
+}
+
+func (v *Var) String() string {
+	return "%" + v.Name
+}
+
+type ConstKind int
+
+const (
+	ConstInt ConstKind = iota
+	ConstFloat
+	ConstString
+	ConstBool
+	ConstNull
+)
+
+type Const struct {
+	Kind  ConstKind
+	Int   int64
+	Float float64
+	Str   string
+	Bool  bool
+}
+
+func IntConst(v int64) *Const {
+	return &Const{Kind: ConstInt, Int: v}
+}
+
+func FloatConst(v float64) *Const {
+	return &Const{Kind: ConstFloat, Float: v}
+}
+
+func StringConst(v string) *Const {
+	return &Const{Kind: ConstString, Str: v}
+}
+
+func BoolConst(v bool) *Const {
+	return &Const{Kind: ConstBool, Bool: v}
+}
+
+func NullConst() *Const {
+	return &Const{Kind: ConstNull}
+}
+
+func (c *Const) String() string {
+	switch c.Kind {
+	case ConstInt:
+		return strconv.FormatInt(c.Int, 10)
+	case ConstFloat:
+		// 小数总带小数点，和整数分得开
+		s := strconv.FormatFloat(c.Float, 'g', -1, 64)
+		if !strings.ContainsAny(s, ".eEn") {
+			s += ".0"
+		}
+		return s
+	case ConstString:
+		return strconv.Quote(c.Str)
+	case ConstBool:
+		return strconv.FormatBool(c.Bool)
+	}
+	return "null"
+}
+
+// Equal 两个常量是同一个值
+func (c *Const) Equal(other *Const) bool {
+	return *c == *other
+}
+
+type Instruction struct {
+	Op Op
+	// 结果，没有结果的是 nil
+	Dest *Var
+	Args []Value
+	// 全局变量、函数、内置函数的名字
+	Name string
+	// jump 和 branch 跳去的块，phi 的每个操作数从哪个前驱来
+	Targets []*Block
+}
+
+func (this *Instruction) String() string {
+	var s strings.Builder
+	if this.Dest != nil {
+		s.WriteString(this.Dest.String() + " = ")
+	}
+	s.WriteString(this.Op.Name())
+	if this.Op == OpPhi {
+		for i, arg := range this.Args {
+			s.WriteString(fmt.Sprintf(" %s:%s", this.Targets[i].Name(), arg))
+		}
+		return s.String()
+	}
+	if this.Name != "" {
+		s.WriteString(" " + this.Name)
+	}
+	for _, arg := range this.Args {
+		s.WriteString(" " + arg.String())
+	}
+	for _, target := range this.Targets {
+		s.WriteString(" " + target.Name())
+	}
+	return s.String()
+}
+
+// Vars 读到的变量
+func (this *Instruction) Vars() []*Var {
+	var vars []*Var
+	for _, arg := range this.Args {
+		if v, ok := arg.(*Var); ok {
+			vars = append(vars, v)
+		}
+	}
+	return vars
+}
+
+type Block struct {
+	// 在函数里的编号，打印成 b<ID>
+	ID           int
+	Instructions []*Instruction
+	// ComputeCFG 根据结尾的指令算出来
+	Preds []*Block
+	Succs []*Block
+}
+
+func (this *Block) Name() string {
+	return fmt.Sprintf("b%d", this.ID)
+}
+
+// Terminator 结尾的跳转或者返回，还没结束的块返回 nil
+func (this *Block) Terminator() *Instruction {
+	if len(this.Instructions) == 0 {
+		return nil
+	}
+	last := this.Instructions[len(this.Instructions)-1]
+	if !last.Op.IsTerminator() {
+		return nil
+	}
+	return last
+}
+
+type Function struct {
+	Name   string
+	Params []*Var
+	// Blocks[0] 是入口
+	Blocks []*Block
+	// 函数里所有的变量，参数在最前面
+	Vars []*Var
+}
+
+// NewVar 新建一个变量，name 是空的时候用没用过的编号
+func (this *Function) NewVar(name string) *Var {
+	for i := len(this.Vars); name == ""; i++ {
+		if this.lookupVar(strconv.Itoa(i)) == nil {
+			name = strconv.Itoa(i)
+		}
+	}
+	// 同一个函数里名字重复的（里层块重新 var 一次）加上编号
+	unique := name
+	for i := 1; this.lookupVar(unique) != nil; i++ {
+		unique = fmt.Sprintf("%s.%d", name, i)
+	}
+	v := &Var{Name: unique}
+	this.Vars = append(this.Vars, v)
+	return v
+}
+
+func (this *Function) lookupVar(name string) *Var {
+	for _, v := range this.Vars {
+		if v.Name == name {
+			return v
+		}
+	}
+	return nil
+}
+
+// NewBlock 在最后加一个空的块
+func (this *Function) NewBlock() *Block {
+	block := &Block{ID: len(this.Blocks)}
+	this.Blocks = append(this.Blocks, block)
+	return block
+}
+
+func (this *Function) String() string {
+	var s strings.Builder
+	params := make([]string, 0, len(this.Params))
+	for _, p := range this.Params {
+		params = append(params, p.String())
+	}
+	fmt.Fprintf(&s, "function %s(%s) {\n", this.Name, strings.Join(params, ", "))
+	for _, block := range this.Blocks {
+		s.WriteString(block.Name() + ":\n")
+		for _, ins := range block.Instructions {
+			s.WriteString("    " + ins.String() + "\n")
+		}
+	}
+	s.WriteString("}\n")
+	return s.String()
+}
+
+type Program struct {
+	// 全局变量的名字，下标就是全局变量的编号
+	Globals []string
+	// 顶层的代码，它的变量都是临时变量，源码里的变量是全局变量
+	Main *Function
+	// 用户定义的函数，按定义的顺序
+	Functions []*Function
+}
+
+// Global 全局变量的编号，没有的时候返回 -1
+func (this *Program) Global(name string) int {
+	for i, global := range this.Globals {
+		if global == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Function 按名字找函数
+func (this *Program) Function(name string) *Function {
+	for _, fn := range this.Functions {
+		if fn.Name == name {
+			return fn
+		}
+	}
+	return nil
+}
+
+func (this *Program) String() string {
+	var s strings.Builder
+	if len(this.Globals) > 0 {
+		fmt.Fprintf(&s, "globals %s\n\n", strings.Join(this.Globals, " "))
+	}
+	s.WriteString(this.Main.String())
+	for _, fn := range this.Functions {
+		s.WriteString("\n" + fn.String())
+	}
+	return s.String()
+}
@@ -0,0 +1,267 @@
+package ir
+
+import (
+	"sort"
+)
+
+// 自然循环：回边 latch -> header，header 支配 latch，
+// 循环里的块是不经过 header 能走到 latch 的块
+type naturalLoop struct {
+	header  *Block
+	blocks  map[*Block]bool
+	latches []*Block
+}
+
+// 找出函数里的循环，同一个 header 的回边合成一个循环，里层的排在前面
+func (this *Function) loops(tree *DomTree) []*naturalLoop {
+	byHeader := make(map[*Block]*naturalLoop)
+	var loops []*naturalLoop
+	for _, block := range this.Blocks {
+		for _, succ := range block.Succs {
+			if !tree.Dominates(succ, block) {
+				continue
+			}
+			l, ok := byHeader[succ]
+			if !ok {
+				l = &naturalLoop{header: succ, blocks: map[*Block]bool{succ: true}}
+				byHeader[succ] = l
+				loops = append(loops, l)
+			}
+			l.latches = append(l.latches, block)
+			worklist := []*Block{block}
+			for len(worklist) > 0 {
+				b := worklist[len(worklist)-1]
+				worklist = worklist[:len(worklist)-1]
+				if l.blocks[b] {
+					continue
+				}
+				l.blocks[b] = true
+				worklist = append(worklist, b.Preds...)
+			}
+		}
+	}
+	sort.SliceStable(loops, func(i, j int) bool {
+		return len(loops[i].blocks) < len(loops[j].blocks)
+	})
+	return loops
+}
+
+// 每次进循环都会执行的块：支配所有离开循环的块（跳出去的、return 的）和所有回边
+// 进了循环要么出来要么再转一圈，这些块里的指令至少执行一次
+func (this *naturalLoop) alwaysExecuted(tree *DomTree, block *Block) bool {
+	for b := range this.blocks {
+		leaves := b.Terminator().Op == OpReturn
+		for _, succ := range b.Succs {
+			if !this.blocks[succ] {
+				leaves = true
+			}
+		}
+		if (leaves || containsBlock(this.latches, b)) && !tree.Dominates(block, b) {
+			return false
+		}
+	}
+	return true
+}
+
+// LoopInvariantCodeMotion 操作数都在循环外面定义的纯运算挪到循环前面
+//
+// 只挪每次进循环都会执行的块里的指令，循环一次都不执行的时候不会多算出一个错误
+// （除以 0、字符串乘数字这些都会出错）
+// while 和 for 的 header 是判断条件的块，循环体不支配从 header 出去的边，
+// 所以 Optimize 在变成 SSA 之前先用 rotateLoops 把循环转成 do-while，循环体就能挪了
+// 一次挪一个循环，挪完重新算支配树，里层挪到外层的指令下一次还可以接着往外挪
+func LoopInvariantCodeMotion(fn *Function) bool {
+	changed := false
+	for fn.hoistOneLoop() {
+		changed = true
+	}
+	return changed
+}
+
+func (this *Function) hoistOneLoop() bool {
+	tree := this.DomTree()
+	for _, l := range this.loops(tree) {
+		// 循环里定义的变量
+		defined := make(map[*Var]bool)
+		for block := range l.blocks {
+			for _, ins := range block.Instructions {
+				if ins.Dest != nil {
+					defined[ins.Dest] = true
+				}
+			}
+		}
+
+		var hoisted []*Instruction
+		remove := make(map[*Instruction]bool)
+		// 按逆后序，前面挪出去的结果后面的指令可以用
+		for _, block := range this.ReversePostorder() {
+			if !l.blocks[block] || !l.alwaysExecuted(tree, block) {
+				continue
+			}
+			for _, ins := range block.Instructions {
+				if !ins.Op.IsPure() || !invariant(ins, defined) {
+					continue
+				}
+				hoisted = append(hoisted, ins)
+				remove[ins] = true
+				delete(defined, ins.Dest)
+			}
+		}
+		if len(hoisted) == 0 {
+			continue
+		}
+		this.removeInstructions(remove)
+		preheader := this.preheader(l)
+		for _, ins := range hoisted {
+			preheader.insertBeforeTerminator(ins)
+		}
+		return true
+	}
+	return false
+}
+
+// rotateLoops 把 header 判断条件的循环转成 do-while，在 SSA 之前用
+//
+//	b0: jump b1                  b0: jump b1'
+//	b1: branch %c b2 b3    =>    b1': branch %c b2 b3      条件先判断一次，是 b1 复制出来的
+//	b2: … jump b1                b2: … jump b1
+//	                             b1: branch %c b2 b3       放到循环的最后
+//
+// 循环体的开头变成了 header，支配所有出口，LoopInvariantCodeMotion 可以挪循环体里的指令，
+// 挪到 b1' 和 b2 之间，还是只有进了循环才算
+func (this *Function) rotateLoops() {
+	rotated := make(map[*Block]bool)
+	for {
+		changed := false
+		for _, l := range this.loops(this.DomTree()) {
+			if rotated[l.header] {
+				continue
+			}
+			rotated[l.header] = true
+			if body := this.rotateLoop(l); body != nil {
+				// 转过的循环 header 换成了循环体的开头，不再转
+				rotated[body] = true
+				changed = true
+				break
+			}
+		}
+		if !changed {
+			return
+		}
+	}
+}
+
+// 转不了的时候返回 nil，转了返回新的 header
+func (this *Function) rotateLoop(l *naturalLoop) *Block {
+	header := l.header
+	t := header.Terminator()
+	if t.Op != OpBranch || len(header.Phis()) > 0 {
+		return nil
+	}
+	body, exit := t.Targets[0], t.Targets[1]
+	if !l.blocks[body] {
+		body, exit = exit, body
+	}
+	if !l.blocks[body] || l.blocks[exit] || body == header || len(body.Preds) != 1 {
+		return nil
+	}
+
+	guard := &Block{}
+	for _, ins := range header.Instructions {
+		c := *ins
+		c.Args = append([]Value(nil), ins.Args...)
+		c.Targets = append([]*Block(nil), ins.Targets...)
+		guard.Instructions = append(guard.Instructions, &c)
+	}
+	for _, pred := range header.Preds {
+		if l.blocks[pred] {
+			continue
+		}
+		for i, target := range pred.Terminator().Targets {
+			if target == header {
+				pred.Terminator().Targets[i] = guard
+			}
+		}
+	}
+
+	// guard 放在原来 header 的位置，header 放到循环的最后一个块后面
+	last := -1
+	for i, block := range this.Blocks {
+		if l.blocks[block] {
+			last = i
+		}
+	}
+	blocks := []*Block{}
+	for i, block := range this.Blocks {
+		if block == header {
+			blocks = append(blocks, guard)
+		} else {
+			blocks = append(blocks, block)
+		}
+		if i == last {
+			blocks = append(blocks, header)
+		}
+	}
+	this.Blocks = blocks
+	this.ComputeCFG()
+	return body
+}
+
+func invariant(ins *Instruction, defined map[*Var]bool) bool {
+	for _, v := range ins.Vars() {
+		if defined[v] {
+			return false
+		}
+	}
+	return true
+}
+
+// 循环前面只跳到 header 的块，没有的时候在 header 前面加一个
+// 从循环外面进来的 phi 操作数挪到新的块里
+func (this *Function) preheader(l *naturalLoop) *Block {
+	var outside []*Block
+	for _, pred := range l.header.Preds {
+		if !l.blocks[pred] {
+			outside = append(outside, pred)
+		}
+	}
+	if len(outside) == 1 && len(outside[0].Succs) == 1 {
+		return outside[0]
+	}
+
+	preheader := &Block{Instructions: []*Instruction{{Op: OpJump, Targets: []*Block{l.header}}}}
+	for _, pred := range outside {
+		for i, target := range pred.Terminator().Targets {
+			if target == l.header {
+				pred.Terminator().Targets[i] = preheader
+			}
+		}
+	}
+	var phis []*Instruction
+	for _, phi := range l.header.Phis() {
+		inner := &Instruction{Op: OpPhi, Dest: this.NewVar(phi.Dest.Name)}
+		args, targets := []Value{}, []*Block{}
+		for i, target := range phi.Targets {
+			if l.blocks[target] {
+				args, targets = append(args, phi.Args[i]), append(targets, target)
+			} else {
+				inner.Args, inner.Targets = append(inner.Args, phi.Args[i]), append(inner.Targets, target)
+			}
+		}
+		phi.Args, phi.Targets = append(args, inner.Dest), append(targets, preheader)
+		phis = append(phis, inner)
+	}
+	preheader.Instructions = append(phis, preheader.Instructions...)
+
+	// 放在 header 前面，生成代码的时候少一个跳转
+	blocks := []*Block{}
+	for _, block := range this.Blocks {
+		if block == l.header {
+			blocks = append(blocks, preheader)
+		}
+		blocks = append(blocks, block)
+	}
+	this.Blocks = blocks
+	this.ComputeCFG()
+	return preheader
+}
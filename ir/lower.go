@@ -0,0 +1,546 @@
+package ir
+
+import (
+	"errors"
+	"fmt"
+	"go-compiler/parser"
+	"go-compiler/utils"
+	"strconv"
+)
+
+// Lower 把 AST 降低成 IR，不支持的写法返回 error
+//
+// 支持的是两个后端都有的部分：整数、小数、字符串、布尔、null、数组、a[i]，
+// 顶层的 var 是全局变量，var f = function(…) {…} 定义函数，函数里的 var 是局部变量，
+// 函数只能看到自己的变量和全局变量（没有闭包），只能按名字调用
+// 内置函数 len push log 没有同名的函数的时候才用
+//
+// 字典、闭包、默认参数和 ...rest、模板字符串、大整数只有栈虚拟机的 AST 编译器支持（类两边都没有），
+// sans run 降低失败的时候退回到 AST 编译器
+//
+// 降低的时候不做优化，每个表达式的结果放进一个新的临时变量
+func Lower(program parser.Program) (result *Program, err error) {
+	// 出错的地方层次很深，用 panic 一路退出来，别的 panic 照旧往外抛
+	defer func() {
+		if r := recover(); r != nil {
+			e, ok := r.(lowerError)
+			if !ok {
+				panic(r)
+			}
+			result, err = nil, errors.New(string(e))
+		}
+	}()
+	this := &lowerer{program: &Program{}}
+	this.program.Main = &Function{Name: "main"}
+	this.scope = &scope{fn: this.program.Main, vars: map[string]*Var{}, functions: map[string]*Function{}}
+	this.lowerFunctionBody(this.program.Main, program.Body)
+	return this.program, nil
+}
+
+// 降低不了的写法，Lower 里 recover 成 error
+type lowerError string
+
+func (this *lowerer) errorf(format string, args ...interface{}) {
+	panic(lowerError(fmt.Sprintf(format, args...)))
+}
+
+var builtinNames = []string{"len", "push", "log"}
+
+type lowerer struct {
+	program *Program
+	fn      *Function
+	block   *Block
+	scope   *scope
+	// break 和 continue 跳去哪里，里层的循环在后面
+	loops []loop
+}
+
+type loop struct {
+	breakTarget    *Block
+	continueTarget *Block
+}
+
+// 一个函数一个作用域，if while 的块不单独算作用域
+type scope struct {
+	fn        *Function
+	vars      map[string]*Var
+	functions map[string]*Function
+	parent    *scope
+}
+
+func (this *lowerer) lowerFunctionBody(fn *Function, body []parser.Node) {
+	outerFn, outerBlock, outerLoops := this.fn, this.block, this.loops
+	defer func() {
+		this.fn, this.block, this.loops = outerFn, outerBlock, outerLoops
+	}()
+	this.fn, this.loops = fn, nil
+	this.startBlock(this.newBlock())
+	for _, statement := range body {
+		this.lowerStatement(statement)
+	}
+	// 走到结尾没有 return 的返回 null
+	if this.block.Terminator() == nil {
+		this.emit(&Instruction{Op: OpReturn})
+	}
+	fn.ComputeCFG()
+	if err := fn.Verify(); err != nil {
+		utils.LogError("Lower invalid ir", err.Error())
+	}
+}
+
+// 新的块先不放进函数，开始往里面写的时候再放，这样块的顺序和源码的顺序一样
+func (this *lowerer) newBlock() *Block {
+	return &Block{}
+}
+
+func (this *lowerer) startBlock(block *Block) {
+	block.ID = len(this.fn.Blocks)
+	this.fn.Blocks = append(this.fn.Blocks, block)
+	this.block = block
+}
+
+// 当前块已经结束的时候（return break 后面的代码）放进一个新的块，ComputeCFG 会把它删掉
+func (this *lowerer) emit(ins *Instruction) *Instruction {
+	if this.block.Terminator() != nil {
+		this.startBlock(this.newBlock())
+	}
+	this.block.Instructions = append(this.block.Instructions, ins)
+	return ins
+}
+
+// 算出一个值放进新的临时变量
+func (this *lowerer) emitValue(op Op, name string, args ...Value) *Var {
+	dest := this.fn.NewVar("")
+	this.emit(&Instruction{Op: op, Dest: dest, Name: name, Args: args})
+	return dest
+}
+
+func (this *lowerer) jump(target *Block) {
+	this.emit(&Instruction{Op: OpJump, Targets: []*Block{target}})
+}
+
+func (this *lowerer) branch(condition Value, ifTrue *Block, ifFalse *Block) {
+	this.emit(&Instruction{Op: OpBranch, Args: []Value{condition}, Targets: []*Block{ifTrue, ifFalse}})
+}
+
+func (this *lowerer) lowerStatement(node parser.Node) {
+	switch node.Type() {
+	case parser.AstTypeBlockStatement:
+		for _, item := range node.(parser.BlockStatement).Body {
+			this.lowerStatement(item)
+		}
+	case parser.AstTypeExpressionStatement:
+		if e := node.(parser.ExpressionStatement).Exp; e != nil {
+			this.lowerExpression(e)
+		}
+	case parser.AstTypeVariableDeclaration:
+		this.lowerVariableDeclaration(node.(parser.VariableDeclaration))
+	case parser.AstTypeIfStatement:
+		this.lowerIf(node.(parser.IfStatement))
+	case parser.AstTypeWhileStatement:
+		this.lowerWhile(node.(parser.WhileStatement))
+	case parser.AstTypeForStatement:
+		this.lowerFor(node.(parser.ForStatement))
+	case parser.AstTypeBreakStatement, parser.AstTypeContinueStatement:
+		if len(this.loops) == 0 {
+			this.errorf("%v outside loop", node.Type())
+		}
+		l := this.loops[len(this.loops)-1]
+		if node.Type() == parser.AstTypeBreakStatement {
+			this.jump(l.breakTarget)
+		} else {
+			this.jump(l.continueTarget)
+		}
+	case parser.AstTypeReturnStatement:
+		if this.fn == this.program.Main {
+			this.errorf("return outside function")
+		}
+		ins := &Instruction{Op: OpReturn}
+		if v := node.(parser.ReturnStatement).Value; v != nil {
+			ins.Args = []Value{this.lowerExpression(v)}
+		}
+		this.emit(ins)
+	default:
+		// for 的 init 和 update 直接是表达式
+		this.lowerExpression(node)
+	}
+}
+
+func (this *lowerer) lowerVariableDeclaration(node parser.VariableDeclaration) {
+	if node.Name.Type() != parser.AstTypeIdentifier {
+		this.errorf("invalid variable name %v", node.Name.Type())
+	}
+	name := node.Name.(parser.Identifier).Value
+	if node.Value != nil && node.Value.Type() == parser.AstTypeFunctionExpression {
+		this.lowerFunction(name, node.Value.(parser.FunctionExpression))
+		return
+	}
+
+	var value Value = NullConst()
+	if node.Value != nil {
+		value = this.lowerExpression(node.Value)
+	}
+	// 右边算完再登记，var a = a 里右边的 a 还是外面的
+	if this.fn == this.program.Main {
+		if this.program.Global(name) < 0 {
+			this.program.Globals = append(this.program.Globals, name)
+		}
+		delete(this.scope.functions, name)
+		this.emit(&Instruction{Op: OpStoreGlobal, Name: name, Args: []Value{value}})
+		return
+	}
+	// 同一个函数里再 var 一次还是同一个变量
+	v, ok := this.scope.vars[name]
+	if !ok {
+		v = this.fn.NewVar(name)
+		this.scope.vars[name] = v
+	}
+	delete(this.scope.functions, name)
+	this.emit(&Instruction{Op: OpCopy, Dest: v, Args: []Value{value}})
+}
+
+func (this *lowerer) lowerFunction(name string, node parser.FunctionExpression) {
+	// 里层的函数和外面的函数重名的时候换个名字，也不能叫 main
+	unique := name
+	for i := 1; this.program.Function(unique) != nil || unique == this.program.Main.Name; i++ {
+		unique = name + "." + strconv.Itoa(i)
+	}
+	fn := &Function{Name: unique}
+	// 先登记，函数体里可以递归调用自己
+	this.program.Functions = append(this.program.Functions, fn)
+	this.scope.functions[name] = fn
+	delete(this.scope.vars, name)
+
+	outerScope := this.scope
+	defer func() { this.scope = outerScope }()
+	this.scope = &scope{fn: fn, vars: map[string]*Var{}, functions: map[string]*Function{}, parent: outerScope}
+	for _, p := range node.Params {
+		// 默认参数和 ...rest 只有栈虚拟机支持
+		if p.Type() != parser.AstTypeIdentifier {
+			this.errorf("ir does not support %v", p.Type())
+		}
+		param := fn.NewVar(p.(parser.Identifier).Value)
+		fn.Params = append(fn.Params, param)
+		this.scope.vars[param.Name] = param
+	}
+	body := []parser.Node{node.Body}
+	if node.Body.Type() == parser.AstTypeBlockStatement {
+		body = node.Body.(parser.BlockStatement).Body
+	}
+	this.lowerFunctionBody(fn, body)
+}
+
+func (this *lowerer) lowerIf(node parser.IfStatement) {
+	condition := this.lowerExpression(node.Condition)
+	then, end := this.newBlock(), this.newBlock()
+	otherwise := end
+	if node.Alternate != nil {
+		otherwise = this.newBlock()
+	}
+	this.branch(condition, then, otherwise)
+
+	this.startBlock(then)
+	this.lowerStatement(node.Consequent)
+	this.jump(end)
+	if node.Alternate != nil {
+		this.startBlock(otherwise)
+		this.lowerStatement(node.Alternate)
+		this.jump(end)
+	}
+	this.startBlock(end)
+}
+
+func (this *lowerer) lowerWhile(node parser.WhileStatement) {
+	header, body, end := this.newBlock(), this.newBlock(), this.newBlock()
+	this.jump(header)
+	this.startBlock(header)
+	this.branch(this.lowerExpression(node.Condition), body, end)
+
+	this.startBlock(body)
+	this.loops = append(this.loops, loop{breakTarget: end, continueTarget: header})
+	this.lowerStatement(node.Body)
+	this.loops = this.loops[:len(this.loops)-1]
+	this.jump(header)
+	this.startBlock(end)
+}
+
+// for (init; test; update) body
+//
+//	init; jump header
+//	header: branch test body end
+//	body:   …; jump update        continue 去 update
+//	update: …; jump header
+//	end:
+func (this *lowerer) lowerFor(node parser.ForStatement) {
+	if node.Init != nil {
+		this.lowerStatement(node.Init)
+	}
+	header, body, update, end := this.newBlock(), this.newBlock(), this.newBlock(), this.newBlock()
+	this.jump(header)
+	this.startBlock(header)
+	var test Value = BoolConst(true)
+	if node.Test != nil {
+		test = this.lowerExpression(node.Test)
+	}
+	this.branch(test, body, end)
+
+	this.startBlock(body)
+	this.loops = append(this.loops, loop{breakTarget: end, continueTarget: update})
+	this.lowerStatement(node.Body)
+	this.loops = this.loops[:len(this.loops)-1]
+	this.jump(update)
+
+	this.startBlock(update)
+	if node.Update != nil {
+		this.lowerExpression(node.Update)
+	}
+	this.jump(header)
+	this.startBlock(end)
+}
+
+var binaryOps = map[string]Op{
+	"+":  OpAdd,
+	"-":  OpSub,
+	"*":  OpMul,
+	"/":  OpDiv,
+	"%":  OpMod,
+	"==": OpEq,
+	"!=": OpNe,
+	"<":  OpLt,
+	"<=": OpLe,
+	">":  OpGt,
+	">=": OpGe,
+}
+
+var compoundOps = map[string]Op{
+	"+=": OpAdd,
+	"-=": OpSub,
+	"*=": OpMul,
+	"/=": OpDiv,
+}
+
+func (this *lowerer) lowerExpression(node parser.Node) Value {
+	switch node.Type() {
+	case parser.AstTypeNumberLiteral:
+		n := node.(parser.NumberLiteral)
+		if v, ok := n.IntValue(); ok && !n.IsBigInt() {
+			return IntConst(v)
+		}
+		if _, ok := n.BigValue(); ok {
+			this.errorf("ir only supports int64 integers, got %s", n.Raw)
+		}
+		return FloatConst(n.Value)
+	case parser.AstTypeStringLiteral:
+		return StringConst(node.(parser.StringLiteral).Value)
+	case parser.AstTypeBooleanLiteral:
+		return BoolConst(node.(parser.BooleanLiteral).Value)
+	case parser.AstTypeNullLiteral:
+		return NullConst()
+	case parser.AstTypeIdentifier:
+		return this.load(node.(parser.Identifier).Value)
+	case parser.AstTypeUnaryExpression:
+		n := node.(parser.UnaryExpression)
+		switch n.Operator {
+		case "-":
+			return this.emitValue(OpNeg, "", this.lowerExpression(n.Value))
+		case "not":
+			return this.emitValue(OpNot, "", this.lowerExpression(n.Value))
+		}
+		this.errorf("unknown unary operator %s", n.Operator)
+	case parser.AstTypeBinaryExpression:
+		n := node.(parser.BinaryExpression)
+		if op, ok := compoundOps[n.Operator]; ok {
+			return this.lowerAssignment(n.Left, op, n.Right)
+		}
+		if n.Operator == "and" || n.Operator == "or" {
+			return this.lowerLogical(n)
+		}
+		op, ok := binaryOps[n.Operator]
+		if !ok {
+			this.errorf("unknown binary operator %s", n.Operator)
+		}
+		operands := this.lowerOperands([]parser.Node{n.Left, n.Right})
+		return this.emitValue(op, "", operands...)
+	case parser.AstTypeAssignmentExpression:
+		n := node.(parser.AssignmentExpression)
+		if n.Operator == "=" {
+			return this.lowerAssignment(n.Left, Op{}, n.Right)
+		}
+		op, ok := compoundOps[n.Operator]
+		if !ok {
+			this.errorf("unknown assignment operator %s", n.Operator)
+		}
+		return this.lowerAssignment(n.Left, op, n.Right)
+	case parser.AstTypeArrayLiteral:
+		return this.emitValue(OpArray, "", this.lowerOperands(node.(parser.ArrayLiteral).Values)...)
+	case parser.AstTypeMemberExpression:
+		n := node.(parser.MemberExpression)
+		if n.ElementType != "array_dict" {
+			this.errorf("ir only supports a[i], got %s member", n.ElementType)
+		}
+		return this.emitValue(OpIndex, "", this.lowerOperands([]parser.Node{n.Object, n.Property})...)
+	case parser.AstTypeCallExpression:
+		return this.lowerCall(node.(parser.CallExpression))
+	}
+	this.errorf("ir does not support %v", node.Type())
+	return nil
+}
+
+// 从左到右算几个操作数
+// 后面的操作数里有赋值的时候，前面读到的变量要先复制一份，f(a, a = 2) 的第一个参数是原来的 a
+func (this *lowerer) lowerOperands(nodes []parser.Node) []Value {
+	values := make([]Value, 0, len(nodes))
+	for i, node := range nodes {
+		value := this.lowerExpression(node)
+		if v, ok := value.(*Var); ok && assigns(nodes[i+1:]) {
+			value = this.emitValue(OpCopy, "", v)
+		}
+		values = append(values, value)
+	}
+	return values
+}
+
+// 节点里有没有给变量赋值
+func assigns(nodes []parser.Node) bool {
+	found := false
+	visitor := &parser.Visitor{
+		AssignmentExpression: func(node parser.AssignmentExpression) bool {
+			found = true
+			return false
+		},
+		BinaryExpression: func(node parser.BinaryExpression) bool {
+			if _, ok := compoundOps[node.Operator]; ok {
+				found = true
+			}
+			return !found
+		},
+	}
+	for _, node := range nodes {
+		parser.Walk(node, visitor)
+	}
+	return found
+}
+
+// a and b 先算 a，a 是真的才算 b，结果是最后算的那个值
+func (this *lowerer) lowerLogical(node parser.BinaryExpression) Value {
+	left := this.lowerExpression(node.Left)
+	result := this.fn.NewVar("")
+	this.emit(&Instruction{Op: OpCopy, Dest: result, Args: []Value{left}})
+	right, end := this.newBlock(), this.newBlock()
+	if node.Operator == "and" {
+		this.branch(left, right, end)
+	} else {
+		this.branch(left, end, right)
+	}
+	this.startBlock(right)
+	this.emit(&Instruction{Op: OpCopy, Dest: result, Args: []Value{this.lowerExpression(node.Right)}})
+	this.jump(end)
+	this.startBlock(end)
+	return result
+}
+
+// left = right，op 不是空的时候是 left op= right，表达式的值是存进去的值
+func (this *lowerer) lowerAssignment(left parser.Node, op Op, right parser.Node) Value {
+	switch left.Type() {
+	case parser.AstTypeIdentifier:
+		name := left.(parser.Identifier).Value
+		var value Value
+		if op == (Op{}) {
+			value = this.lowerExpression(right)
+		} else {
+			operands := this.lowerOperands([]parser.Node{left, right})
+			value = this.emitValue(op, "", operands...)
+		}
+		return this.store(name, value)
+	case parser.AstTypeMemberExpression:
+		member := left.(parser.MemberExpression)
+		if member.ElementType != "array_dict" {
+			this.errorf("ir only supports a[i] =, got %s member", member.ElementType)
+		}
+		// a 和 i 只算一次
+		operands := this.lowerOperands([]parser.Node{member.Object, member.Property, right})
+		value := operands[2]
+		if op != (Op{}) {
+			current := this.emitValue(OpIndex, "", operands[0], operands[1])
+			value = this.emitValue(op, "", current, value)
+		}
+		this.emit(&Instruction{Op: OpSetIndex, Args: []Value{operands[0], operands[1], value}})
+		return value
+	}
+	this.errorf("invalid left of assignment %v", left.Type())
+	return nil
+}
+
+func (this *lowerer) lowerCall(node parser.CallExpression) Value {
+	if node.Object.Type() != parser.AstTypeIdentifier {
+		this.errorf("ir only supports calling functions by name, got %v", node.Object.Type())
+	}
+	name := node.Object.(parser.Identifier).Value
+	fn := this.resolveFunction(name)
+	if fn == nil && !utils.InStringSlice(builtinNames, name) {
+		this.errorf("undefined function %s", name)
+	}
+	if fn != nil && len(fn.Params) != len(node.Args) {
+		this.errorf("%s needs %d arguments, got %d", name, len(fn.Params), len(node.Args))
+	}
+	args := this.lowerOperands(node.Args)
+	if fn == nil {
+		return this.emitValue(OpBuiltin, name, args...)
+	}
+	return this.emitValue(OpCall, fn.Name, args...)
+}
+
+// 变量先在当前函数里找，再找全局变量
+func (this *lowerer) resolveVar(name string) (*Var, bool) {
+	for s := this.scope; s != nil; s = s.parent {
+		if v, ok := s.vars[name]; ok {
+			if s.fn != this.fn {
+				this.errorf("ir does not support closures, %s is in an outer function", name)
+			}
+			return v, true
+		}
+		if _, ok := s.functions[name]; ok {
+			return nil, false
+		}
+	}
+	return nil, this.program.Global(name) >= 0
+}
+
+func (this *lowerer) resolveFunction(name string) *Function {
+	for s := this.scope; s != nil; s = s.parent {
+		if fn, ok := s.functions[name]; ok {
+			return fn
+		}
+		if _, ok := s.vars[name]; ok {
+			return nil
+		}
+	}
+	return nil
+}
+
+func (this *lowerer) load(name string) Value {
+	v, ok := this.resolveVar(name)
+	if !ok {
+		if this.resolveFunction(name) != nil {
+			this.errorf("function %s can only be called", name)
+		}
+		this.errorf("undefined variable %s", name)
+	}
+	if v != nil {
+		return v
+	}
+	return this.emitValue(OpLoadGlobal, name)
+}
+
+func (this *lowerer) store(name string, value Value) Value {
+	v, ok := this.resolveVar(name)
+	if !ok {
+		this.errorf("undefined variable %s", name)
+	}
+	if v != nil {
+		this.emit(&Instruction{Op: OpCopy, Dest: v, Args: []Value{value}})
+		return v
+	}
+	this.emit(&Instruction{Op: OpStoreGlobal, Name: name, Args: []Value{value}})
+	return value
+}
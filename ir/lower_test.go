@@ -0,0 +1,245 @@
+package ir
+
+import (
+	sansLexer "go-compiler/lexer"
+	sansParser "go-compiler/parser"
+	"testing"
+)
+
+func parse(t *testing.T, code string) sansParser.Program {
+	t.Helper()
+	lexer := sansLexer.NewSansLangLexer(code)
+	tokens := sansLexer.TokenList{Tokens: lexer.TokenList()}
+	if len(lexer.Errors) > 0 {
+		t.Fatalf("lexer error: %v", lexer.Errors[0])
+	}
+	program, err := sansParser.NewSansLangParser(&tokens).ParseProgram()
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	return program
+}
+
+func lower(t *testing.T, code string) *Program {
+	t.Helper()
+	program, err := Lower(parse(t, code))
+	if err != nil {
+		t.Fatalf("lower error: %v", err)
+	}
+	return program
+}
+
+func TestLower(t *testing.T) {
+	tests := []struct {
+		code     string
+		expected string
+	}{
+		{
+			"var a = 1 + 2 * 3\nlog(a, -a, not true, null, \"s\", 1.5)",
+			`globals a
+
+function main() {
+b0:
+    %0 = mul 2 3
+    %1 = add 1 %0
+    store_global a %1
+    %2 = load_global a
+    %3 = load_global a
+    %4 = neg %3
+    %5 = not true
+    %6 = builtin log %2 %4 %5 null "s" 1.5
+    return
+}
+`,
+		},
+		// 没有 else 的 if 直接跳到后面
+		{
+			"var a = 1\nif (a > 0) { a = 2 } else { a = 3 }\nif (a) { a = 4 }",
+			`globals a
+
+function main() {
+b0:
+    store_global a 1
+    %0 = load_global a
+    %1 = gt %0 0
+    branch %1 b1 b2
+b1:
+    store_global a 2
+    jump b3
+b2:
+    store_global a 3
+    jump b3
+b3:
+    %2 = load_global a
+    branch %2 b4 b5
+b4:
+    store_global a 4
+    jump b5
+b5:
+    return
+}
+`,
+		},
+		// break 去循环后面，continue 去条件，同一个循环里可以有好几个
+		{
+			"var i = 0\nwhile (true) {\n  i += 1\n  if (i < 3) { continue }\n  if (i > 5) { break }\n  break\n}",
+			`globals i
+
+function main() {
+b0:
+    store_global i 0
+    jump b1
+b1:
+    branch true b2 b7
+b2:
+    %0 = load_global i
+    %1 = add %0 1
+    store_global i %1
+    %2 = load_global i
+    %3 = lt %2 3
+    branch %3 b3 b4
+b3:
+    jump b1
+b4:
+    %4 = load_global i
+    %5 = gt %4 5
+    branch %5 b5 b6
+b5:
+    jump b7
+b6:
+    jump b7
+b7:
+    return
+}
+`,
+		},
+		// continue 去 update，函数里的 var 是局部变量
+		{
+			"var f = function(n) {\n  var s = 0\n  for (var i = 0; i < n; i += 1) {\n    if (i == 1) { continue }\n    s += i\n  }\n  return s\n}\nvar r = f(4)",
+			`globals r
+
+function main() {
+b0:
+    %0 = call f 4
+    store_global r %0
+    return
+}
+
+function f(%n) {
+b0:
+    %s = copy 0
+    %i = copy 0
+    jump b1
+b1:
+    %3 = lt %i %n
+    branch %3 b2 b6
+b2:
+    %4 = eq %i 1
+    branch %4 b3 b4
+b3:
+    jump b5
+b4:
+    %5 = add %s %i
+    %s = copy %5
+    jump b5
+b5:
+    %6 = add %i 1
+    %i = copy %6
+    jump b1
+b6:
+    return %s
+}
+`,
+		},
+		// and or 只在需要的时候算右边
+		{
+			"var f = function(a, b) {\n  return a and b or not a\n}",
+			`function main() {
+b0:
+    return
+}
+
+function f(%a, %b) {
+b0:
+    %2 = copy %a
+    branch %a b1 b2
+b1:
+    %2 = copy %b
+    jump b2
+b2:
+    %3 = copy %2
+    branch %2 b4 b3
+b3:
+    %4 = not %a
+    %3 = copy %4
+    jump b4
+b4:
+    return %3
+}
+`,
+		},
+		// 后面的操作数里改了 x，前面读到的变量先复制一份，a[x] 用的是原来的 x，a 和 x 只算一次
+		{
+			"var f = function(a, x) {\n  var g = function(p, q) {\n    return p\n  }\n  a[x] += g(x, x = 2)\n  return a\n}",
+			`function main() {
+b0:
+    return
+}
+
+function f(%a, %x) {
+b0:
+    %2 = copy %a
+    %3 = copy %x
+    %4 = copy %x
+    %x = copy 2
+    %5 = call g %4 %x
+    %6 = index %2 %3
+    %7 = add %6 %5
+    set_index %2 %3 %7
+    return %a
+}
+
+function g(%p, %q) {
+b0:
+    return %p
+}
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		program := lower(t, tt.code)
+		if got := program.String(); got != tt.expected {
+			t.Errorf("ir wrong.\ncode=%s\ngot=\n%s\nwant=\n%s", tt.code, got, tt.expected)
+		}
+	}
+}
+
+func TestLowerErrors(t *testing.T) {
+	tests := []struct {
+		code     string
+		expected string
+	}{
+		{"var a = b", "undefined variable b"},
+		{"return 1", "return outside function"},
+		{"break", "BreakStatement outside loop"},
+		{"var a = {1: 2}", "ir does not support DictLiteral"},
+		{"var f = function(a = 1) { return a }", "ir does not support DefaultParameter"},
+		{"var f = function(...a) { return a }", "ir does not support RestParameter"},
+		{"var a = 1\nvar s = `${a}`", "ir does not support TemplateLiteral"},
+		{"class A {\nconst new = function() {}\n}", "ir does not support ClassExpression"},
+		{"var f = function(a) { return a }\nvar b = f", "function f can only be called"},
+		{"var f = function(a) { return a }\nf(1, 2)", "f needs 1 arguments, got 2"},
+		{"var a = 1\na(1)", "undefined function a"},
+		{"var f = function(a) {\n  var g = function() { return a }\n  return g()\n}", "ir does not support closures, a is in an outer function"},
+		{"var a = 12345678901234567890", "ir only supports int64 integers, got 12345678901234567890"},
+		{"var a = 5n", "ir only supports int64 integers, got 5n"},
+	}
+
+	for _, tt := range tests {
+		program, err := Lower(parse(t, tt.code))
+		if err == nil || err.Error() != tt.expected || program != nil {
+			t.Errorf("%q: error wrong. got=%v, want=%s", tt.code, err, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,310 @@
+package ir
+
+import (
+	"fmt"
+	"go-compiler/utils"
+	"strings"
+)
+
+// 优化：每个函数先变成 SSA，按顺序一遍一遍跑选中的 pass，直到都不再改，最后 FromSSA
+//
+// 优化不会让本来不出错的程序出错（除以 0 之类的不折叠，每次进循环都会执行的指令才挪出循环），
+// 本来会出错的程序可能出错的地方不一样，结果没人用的除法删掉以后就不出错了
+//
+//	-O0  不优化
+//	-O1  constprop copyprop dce
+//	-O2  再加上 cse licm
+type Pass struct {
+	Name string
+	// 改了函数返回 true
+	Run func(fn *Function) bool
+}
+
+// Passes 所有的 pass，也是一遍里跑的顺序
+var Passes = []Pass{
+	{"constprop", ConstantPropagation},
+	{"copyprop", CopyPropagation},
+	{"cse", CommonSubexpressionElimination},
+	{"licm", LoopInvariantCodeMotion},
+	{"dce", DeadCodeElimination},
+}
+
+// PassesForLevel -O 的级别对应的 pass
+func PassesForLevel(level int) []string {
+	switch {
+	case level <= 0:
+		return nil
+	case level == 1:
+		return []string{"constprop", "copyprop", "dce"}
+	}
+	return []string{"constprop", "copyprop", "cse", "licm", "dce"}
+}
+
+// ParsePasses 逗号分开的 pass 的名字，检查名字对不对
+func ParsePasses(names string) ([]string, error) {
+	var passes []string
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if lookupPass(name) == nil {
+			return nil, fmt.Errorf("unknown pass %q", name)
+		}
+		passes = append(passes, name)
+	}
+	return passes, nil
+}
+
+func lookupPass(name string) *Pass {
+	for i := range Passes {
+		if Passes[i].Name == name {
+			return &Passes[i]
+		}
+	}
+	return nil
+}
+
+// Optimize 在程序的每个函数上跑 passes，没有 pass 的时候什么都不做
+func Optimize(program *Program, passes []string) {
+	if len(passes) == 0 {
+		return
+	}
+	selected := selectPasses(passes)
+	functions := append([]*Function{program.Main}, program.Functions...)
+	for _, fn := range functions {
+		toSSA(fn, selected)
+		runPasses(fn, selected)
+		fn.FromSSA()
+		fn.collectVars()
+		verify(fn, "out of ssa")
+	}
+}
+
+// 不管给的顺序，按 Passes 的顺序跑
+func selectPasses(passes []string) []*Pass {
+	for _, name := range passes {
+		if lookupPass(name) == nil {
+			utils.LogError("Optimize unknown pass", name)
+		}
+	}
+	var selected []*Pass
+	for i := range Passes {
+		if utils.InStringSlice(passes, Passes[i].Name) {
+			selected = append(selected, &Passes[i])
+		}
+	}
+	return selected
+}
+
+// 变成 SSA，要跑 licm 的时候先把循环转成 do-while，循环体里的指令才挪得动
+func toSSA(fn *Function, selected []*Pass) {
+	for _, pass := range selected {
+		if pass.Name == "licm" {
+			fn.rotateLoops()
+			verify(fn, "rotate loops")
+		}
+	}
+	fn.ToSSA()
+	verify(fn, "ssa")
+}
+
+// 在 SSA 上一遍一遍地跑，直到都不再改
+func runPasses(fn *Function, selected []*Pass) {
+	for changed := true; changed; {
+		changed = false
+		for _, pass := range selected {
+			if pass.Run(fn) {
+				changed = true
+				verify(fn, pass.Name)
+			}
+		}
+	}
+}
+
+func verify(fn *Function, after string) {
+	if err := fn.Verify(); err != nil {
+		utils.LogError("Optimize broke the ir after", after, err.Error(), "\n"+fn.String())
+	}
+}
+
+// 按 subst 换掉所有的操作数，换过去的还在 subst 里的接着换
+func (this *Function) substitute(subst map[*Var]Value) {
+	if len(subst) == 0 {
+		return
+	}
+	resolve := func(value Value) Value {
+		for {
+			v, ok := value.(*Var)
+			if !ok {
+				return value
+			}
+			next, ok := subst[v]
+			if !ok {
+				return value
+			}
+			value = next
+		}
+	}
+	for _, block := range this.Blocks {
+		for _, ins := range block.Instructions {
+			for i, arg := range ins.Args {
+				ins.Args[i] = resolve(arg)
+			}
+		}
+	}
+}
+
+// 删掉 remove 里的指令
+func (this *Function) removeInstructions(remove map[*Instruction]bool) {
+	if len(remove) == 0 {
+		return
+	}
+	for _, block := range this.Blocks {
+		kept := block.Instructions[:0]
+		for _, ins := range block.Instructions {
+			if !remove[ins] {
+				kept = append(kept, ins)
+			}
+		}
+		block.Instructions = kept
+	}
+}
+
+// phi 的操作数除了自己以外都是同一个值的时候返回这个值
+func phiValue(phi *Instruction) Value {
+	var value Value
+	for _, arg := range phi.Args {
+		if arg == phi.Dest {
+			continue
+		}
+		if value == nil {
+			value = arg
+			continue
+		}
+		a, aConst := arg.(*Const)
+		b, bConst := value.(*Const)
+		if arg != value && !(aConst && bConst && a.Equal(b)) {
+			return nil
+		}
+	}
+	return value
+}
+
+// CopyPropagation 用到 %a = copy %b 的 %a 的地方直接用 %b，
+// 操作数都是同一个变量的 phi 也一样
+func CopyPropagation(fn *Function) bool {
+	subst := make(map[*Var]Value)
+	remove := make(map[*Instruction]bool)
+	for _, block := range fn.Blocks {
+		for _, ins := range block.Instructions {
+			var value Value
+			switch ins.Op {
+			case OpCopy:
+				value = ins.Args[0]
+			case OpPhi:
+				value = phiValue(ins)
+			}
+			if v, ok := value.(*Var); ok {
+				subst[ins.Dest] = v
+				remove[ins] = true
+			}
+		}
+	}
+	fn.substitute(subst)
+	fn.removeInstructions(remove)
+	return len(remove) > 0
+}
+
+// DeadCodeElimination 删掉结果没人用的指令
+// 从有副作用的指令开始标记用到的变量的定义，没标记到的都删掉，互相用的死 phi 也删得掉
+func DeadCodeElimination(fn *Function) bool {
+	defs := make(map[*Var][]*Instruction)
+	live := make(map[*Instruction]bool)
+	var worklist []*Instruction
+	for _, block := range fn.Blocks {
+		for _, ins := range block.Instructions {
+			if ins.Dest != nil {
+				defs[ins.Dest] = append(defs[ins.Dest], ins)
+			}
+			if ins.Op.HasSideEffect() {
+				live[ins] = true
+				worklist = append(worklist, ins)
+			}
+		}
+	}
+	for len(worklist) > 0 {
+		ins := worklist[len(worklist)-1]
+		worklist = worklist[:len(worklist)-1]
+		for _, v := range ins.Vars() {
+			for _, def := range defs[v] {
+				if !live[def] {
+					live[def] = true
+					worklist = append(worklist, def)
+				}
+			}
+		}
+	}
+
+	remove := make(map[*Instruction]bool)
+	for _, block := range fn.Blocks {
+		for _, ins := range block.Instructions {
+			if !live[ins] {
+				remove[ins] = true
+			}
+		}
+	}
+	fn.removeInstructions(remove)
+	if len(remove) > 0 {
+		fn.collectVars()
+	}
+	return len(remove) > 0
+}
+
+// CommonSubexpressionElimination 支配树上面已经算过的同样的纯运算不再算
+func CommonSubexpressionElimination(fn *Function) bool {
+	tree := fn.DomTree()
+	subst := make(map[*Var]Value)
+	remove := make(map[*Instruction]bool)
+	var walk func(block *Block, available map[string]*Var)
+	walk = func(block *Block, available map[string]*Var) {
+		// 支配的块能用这个块算过的，兄弟之间不能
+		scope := make(map[string]*Var, len(available))
+		for key, v := range available {
+			scope[key] = v
+		}
+		for _, ins := range block.Instructions {
+			if !ins.Op.IsPure() {
+				continue
+			}
+			key := expressionKey(ins, subst)
+			if v, ok := scope[key]; ok {
+				subst[ins.Dest] = v
+				remove[ins] = true
+			} else {
+				scope[key] = ins.Dest
+			}
+		}
+		for _, child := range tree.Children(block) {
+			walk(child, scope)
+		}
+	}
+	walk(fn.Blocks[0], nil)
+	fn.substitute(subst)
+	fn.removeInstructions(remove)
+	return len(remove) > 0
+}
+
+// 运算和操作数，被换掉的操作数用换成的值
+func expressionKey(ins *Instruction, subst map[*Var]Value) string {
+	parts := []string{ins.Op.Name()}
+	for _, arg := range ins.Args {
+		if v, ok := arg.(*Var); ok {
+			if to, ok := subst[v]; ok {
+				arg = to
+			}
+		}
+		parts = append(parts, arg.String())
+	}
+	return strings.Join(parts, " ")
+}
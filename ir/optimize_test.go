@@ -0,0 +1,232 @@
+package ir
+
+import (
+	"testing"
+)
+
+// 每个 pass 在 SSA 上跑完的样子
+func TestPasses(t *testing.T) {
+	tests := []struct {
+		passes   []string
+		code     string
+		expected string
+	}{
+		// 条件是常量的 branch 变成 jump，走不到的块删掉
+		{
+			[]string{"constprop"},
+			"var f = function(n) {\n  var a = 2 * 3\n  var b = not (a > 5)\n  if (b) {\n    return n\n  }\n  return a + 1 - n\n}",
+			`function f(%n) {
+b0:
+    jump b1
+b1:
+    %7 = sub 7 %n
+    return %7
+}
+`,
+		},
+		{
+			[]string{"copyprop"},
+			"var f = function(a) {\n  var b = a\n  var c = b\n  return c + b\n}",
+			`function f(%a) {
+b0:
+    %3 = add %a %a
+    return %3
+}
+`,
+		},
+		// y 在循环里互相用，也删得掉
+		{
+			[]string{"dce"},
+			"var f = function(a) {\n  var x = a * 2\n  var y = x + 1\n  var i = 0\n  while (i < a) {\n    i = i + 1\n    y = y + i\n  }\n  log(i)\n  return a\n}",
+			`function f(%a) {
+b0:
+    %i = copy 0
+    jump b1
+b1:
+    %i.1 = phi b0:%i b2:%i.2
+    %6 = lt %i.1 %a
+    branch %6 b2 b3
+b2:
+    %7 = add %i.1 1
+    %i.2 = copy %7
+    jump b1
+b3:
+    %9 = builtin log %i.1
+    return %a
+}
+`,
+		},
+		// b1 不支配 b3，b3 里的 a * b + 2 还要算
+		{
+			[]string{"cse"},
+			"var f = function(a, b) {\n  var x = a * b + 1\n  if (a > 0) {\n    x = a * b + 2\n  } else {\n    x = a * b + 1\n  }\n  return x - (a * b + 2)\n}",
+			`function f(%a, %b) {
+b0:
+    %2 = mul %a %b
+    %3 = add %2 1
+    %x = copy %3
+    %5 = gt %a 0
+    branch %5 b1 b2
+b1:
+    %7 = add %2 2
+    %x.1 = copy %7
+    jump b3
+b2:
+    %x.2 = copy %3
+    jump b3
+b3:
+    %x.3 = phi b1:%x.1 b2:%x.2
+    %11 = add %2 2
+    %12 = sub %x.3 %11
+    return %12
+}
+`,
+		},
+		// while 先转成 do-while，循环体里的 k * 3 挪到只有进了循环才走的块
+		{
+			[]string{"licm", "copyprop"},
+			"var f = function(n, k) {\n  var i = 0\n  while (i < n * 2) {\n    i = i + k * 3\n  }\n  return i\n}",
+			`function f(%n, %k) {
+b0:
+    %i = copy 0
+    jump b1
+b1:
+    %3 = mul %n 2
+    %4 = lt %i %3
+    branch %4 b2 b5
+b2:
+    %5 = mul %k 3
+    %3.1 = mul %n 2
+    jump b3
+b3:
+    %i.1 = phi b4:%6 b2:%i
+    %6 = add %i.1 %5
+    jump b4
+b4:
+    %4.1 = lt %6 %3.1
+    branch %4.1 b3 b5
+b5:
+    %i.3 = phi b1:%i b4:%6
+    return %i.3
+}
+`,
+		},
+		// while (true) 的条件折叠掉以后，循环体的开头每次都执行
+		{
+			[]string{"constprop", "licm"},
+			"var f = function(n, k) {\n  var i = 0\n  while (true) {\n    var step = k * 3\n    i = i + step\n    if (i > n) {\n      break\n    }\n  }\n  return i\n}",
+			`function f(%n, %k) {
+b0:
+    jump b1
+b1:
+    %3 = mul %k 3
+    jump b2
+b2:
+    %i.1 = phi b1:0 b5:%i.2
+    %step = copy %3
+    %5 = add %i.1 %step
+    %i.2 = copy %5
+    %6 = gt %i.2 %n
+    branch %6 b3 b4
+b3:
+    jump b6
+b4:
+    jump b5
+b5:
+    jump b2
+b6:
+    %i.3 = phi b3:%i.2
+    return %i.3
+}
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		fn := lower(t, tt.code).Function("f")
+		selected := selectPasses(tt.passes)
+		toSSA(fn, selected)
+		runPasses(fn, selected)
+		if got := fn.String(); got != tt.expected {
+			t.Errorf("%v wrong.\ncode=%s\ngot=\n%s\nwant=\n%s", tt.passes, tt.code, got, tt.expected)
+		}
+	}
+}
+
+// 两个虚拟机结果不一样的、运行的时候才出错的不折叠
+func TestConstantPropagationKeeps(t *testing.T) {
+	tests := []string{
+		"1 / 0",
+		"1 % 0",
+		"9223372036854775807 + 1",
+		"0 - 9223372036854775807 - 2",
+		"4294967296 * 4294967296",
+		`"a" + "b"`,
+		`"a" == "a"`,
+		"1 == true",
+		"1.5 + 1",
+	}
+
+	for _, code := range tests {
+		fn := lower(t, "var f = function() {\n  return "+code+"\n}").Function("f")
+		fn.ToSSA()
+		runPasses(fn, selectPasses([]string{"constprop"}))
+		if _, ok := fn.Blocks[0].Terminator().Args[0].(*Const); ok {
+			t.Errorf("%s should not be folded\n%s", code, fn)
+		}
+	}
+}
+
+func TestOptimize(t *testing.T) {
+	program := lower(t, "var a = 2 * 3 + 1\nvar f = function(n) {\n  var s = 0\n  while (s < n) {\n    s = s + a * 2\n  }\n  return s\n}\nlog(f(a))")
+	Optimize(program, PassesForLevel(2))
+	// 全局变量别的函数会改，load_global 不挪出循环
+	expected := `globals a
+
+function main() {
+b0:
+    store_global a 7
+    %2 = load_global a
+    %3 = call f %2
+    %4 = builtin log %3
+    return
+}
+
+function f(%n) {
+b0:
+    jump b1
+b1:
+    %2 = lt 0 %n
+    %10 = copy 0
+    %11 = copy 0
+    branch %2 b2 b4
+b2:
+    %s.1 = copy %10
+    %3 = load_global a
+    %4 = mul %3 2
+    %5 = add %s.1 %4
+    jump b3
+b3:
+    %2.1 = lt %5 %n
+    %10 = copy %5
+    %11 = copy %5
+    branch %2.1 b2 b4
+b4:
+    %s.3 = copy %11
+    return %s.3
+}
+`
+	if got := program.String(); got != expected {
+		t.Errorf("optimized program wrong.\ngot=\n%s\nwant=\n%s", got, expected)
+	}
+}
+
+func TestParsePasses(t *testing.T) {
+	passes, err := ParsePasses("dce, constprop")
+	if err != nil || len(passes) != 2 || passes[0] != "dce" || passes[1] != "constprop" {
+		t.Errorf("passes wrong. got=%v err=%v", passes, err)
+	}
+	if _, err := ParsePasses("constprop,inline"); err == nil || err.Error() != `unknown pass "inline"` {
+		t.Errorf("error wrong. got=%v", err)
+	}
+}
@@ -0,0 +1,281 @@
+package ir
+
+// SSA：每个变量只赋值一次，几条路汇合的地方用 phi 选从哪条路来的值
+// 优化都在 SSA 上做，做完用 FromSSA 变回普通的 IR 再交给后端
+//
+// 构造用 Cytron 的方法：在支配边界上放 phi，再沿着支配树给变量改名
+// 只给在某个块里先用后定义的变量放 phi（semi-pruned），只在一个块里用的临时变量不用
+
+// DomTree 支配树，调之前要先 ComputeCFG
+type DomTree struct {
+	idom     map[*Block]*Block
+	children map[*Block][]*Block
+	// 逆后序里的位置
+	order map[*Block]int
+}
+
+// DomTree 用 Cooper、Harvey、Kennedy 的迭代算法算直接支配者
+func (this *Function) DomTree() *DomTree {
+	blocks := this.ReversePostorder()
+	tree := &DomTree{
+		idom:     make(map[*Block]*Block),
+		children: make(map[*Block][]*Block),
+		order:    make(map[*Block]int),
+	}
+	for i, block := range blocks {
+		tree.order[block] = i
+	}
+	entry := this.Blocks[0]
+	// 算的时候入口的直接支配者是自己，算完改回 nil
+	tree.idom[entry] = entry
+	for changed := true; changed; {
+		changed = false
+		for _, block := range blocks[1:] {
+			var idom *Block
+			for _, pred := range block.Preds {
+				if tree.idom[pred] == nil {
+					continue
+				}
+				if idom == nil {
+					idom = pred
+				} else {
+					idom = tree.intersect(pred, idom)
+				}
+			}
+			if tree.idom[block] != idom {
+				tree.idom[block] = idom
+				changed = true
+			}
+		}
+	}
+	delete(tree.idom, entry)
+
+	// 子节点按块的顺序，改名和打印的结果是确定的
+	for _, block := range this.Blocks {
+		if idom, ok := tree.idom[block]; ok {
+			tree.children[idom] = append(tree.children[idom], block)
+		}
+	}
+	return tree
+}
+
+func (this *DomTree) intersect(a *Block, b *Block) *Block {
+	for a != b {
+		for this.order[a] > this.order[b] {
+			a = this.idom[a]
+		}
+		for this.order[b] > this.order[a] {
+			b = this.idom[b]
+		}
+	}
+	return a
+}
+
+// Idom 直接支配者，入口是 nil
+func (this *DomTree) Idom(block *Block) *Block {
+	return this.idom[block]
+}
+
+// Children 直接支配的块
+func (this *DomTree) Children(block *Block) []*Block {
+	return this.children[block]
+}
+
+// Dominates 从入口到 b 都要经过 a，a 支配自己
+func (this *DomTree) Dominates(a *Block, b *Block) bool {
+	for ; b != nil; b = this.idom[b] {
+		if a == b {
+			return true
+		}
+	}
+	return false
+}
+
+// Frontiers 支配边界：a 支配 b 的一个前驱，但是不严格支配 b
+func (this *DomTree) Frontiers(fn *Function) map[*Block][]*Block {
+	frontiers := make(map[*Block][]*Block)
+	for _, block := range fn.Blocks {
+		if len(block.Preds) < 2 {
+			continue
+		}
+		for _, pred := range block.Preds {
+			for runner := pred; runner != this.idom[block]; runner = this.idom[runner] {
+				if !containsBlock(frontiers[runner], block) {
+					frontiers[runner] = append(frontiers[runner], block)
+				}
+			}
+		}
+	}
+	return frontiers
+}
+
+// ToSSA 把函数变成 SSA，调之前要先 ComputeCFG
+//
+// 第一次定义用原来的变量，后面的定义是 x.1 x.2 …，参数在入口定义
+// 有的路上没定义过的变量当成 null
+func (this *Function) ToSSA() {
+	tree := this.DomTree()
+	frontiers := tree.Frontiers(this)
+
+	// 在哪些块里定义，哪些变量在块里先用后定义（要跨块）
+	defs := make(map[*Var][]*Block)
+	shared := make(map[*Var]bool)
+	for _, p := range this.Params {
+		defs[p] = []*Block{this.Blocks[0]}
+	}
+	for _, block := range this.Blocks {
+		defined := make(map[*Var]bool)
+		for _, ins := range block.Instructions {
+			for _, v := range ins.Vars() {
+				if !defined[v] {
+					shared[v] = true
+				}
+			}
+			if ins.Dest != nil {
+				if !defined[ins.Dest] {
+					defs[ins.Dest] = append(defs[ins.Dest], block)
+				}
+				defined[ins.Dest] = true
+			}
+		}
+	}
+
+	// 放 phi，phi 的操作数先都是原来的变量，改名的时候换掉
+	origin := make(map[*Instruction]*Var)
+	for _, v := range this.Vars {
+		if !shared[v] {
+			continue
+		}
+		hasPhi := make(map[*Block]bool)
+		worklist := append([]*Block{}, defs[v]...)
+		for len(worklist) > 0 {
+			block := worklist[len(worklist)-1]
+			worklist = worklist[:len(worklist)-1]
+			for _, frontier := range frontiers[block] {
+				if hasPhi[frontier] {
+					continue
+				}
+				hasPhi[frontier] = true
+				phi := &Instruction{Op: OpPhi, Dest: v, Targets: append([]*Block{}, frontier.Preds...)}
+				for range frontier.Preds {
+					phi.Args = append(phi.Args, v)
+				}
+				origin[phi] = v
+				frontier.Instructions = append([]*Instruction{phi}, frontier.Instructions...)
+				if !containsBlock(defs[v], frontier) {
+					worklist = append(worklist, frontier)
+				}
+			}
+		}
+	}
+
+	// 沿着支配树改名，stacks 是每个变量现在的版本
+	stacks := make(map[*Var][]*Var)
+	used := make(map[*Var]bool)
+	for _, p := range this.Params {
+		stacks[p] = []*Var{p}
+		used[p] = true
+	}
+	current := func(v *Var) Value {
+		if len(stacks[v]) == 0 {
+			return NullConst()
+		}
+		return stacks[v][len(stacks[v])-1]
+	}
+	var rename func(block *Block)
+	rename = func(block *Block) {
+		var pushed []*Var
+		for _, ins := range block.Instructions {
+			if ins.Op != OpPhi {
+				for i, arg := range ins.Args {
+					if v, ok := arg.(*Var); ok {
+						ins.Args[i] = current(v)
+					}
+				}
+			}
+			if ins.Dest == nil {
+				continue
+			}
+			v := ins.Dest
+			if o, ok := origin[ins]; ok {
+				v = o
+			}
+			version := v
+			if used[v] {
+				version = this.NewVar(v.Name)
+			}
+			used[v] = true
+			ins.Dest = version
+			stacks[v] = append(stacks[v], version)
+			pushed = append(pushed, v)
+		}
+		for _, succ := range block.Succs {
+			for _, phi := range succ.Phis() {
+				for i, target := range phi.Targets {
+					if target == block {
+						phi.Args[i] = current(origin[phi])
+					}
+				}
+			}
+		}
+		for _, child := range tree.Children(block) {
+			rename(child)
+		}
+		for _, v := range pushed {
+			stacks[v] = stacks[v][:len(stacks[v])-1]
+		}
+	}
+	rename(this.Blocks[0])
+	this.collectVars()
+}
+
+// FromSSA 把 phi 换成复制，变回后端能用的 IR
+//
+// 每个 phi 用一个新的变量 t：前驱在跳过来之前 t = 操作数，块开头 x = t
+// 这样几个 phi 之间互相用的时候（交换两个变量）也不会读到改过的值，
+// 关键边也不用拆：另一条路上多赋值的 t 到不了这个块就会被覆盖
+func (this *Function) FromSSA() {
+	for _, block := range this.Blocks {
+		phis := block.Phis()
+		var copies []*Instruction
+		for _, phi := range phis {
+			t := this.NewVar("")
+			for i, pred := range phi.Targets {
+				pred.insertBeforeTerminator(&Instruction{Op: OpCopy, Dest: t, Args: []Value{phi.Args[i]}})
+			}
+			copies = append(copies, &Instruction{Op: OpCopy, Dest: phi.Dest, Args: []Value{t}})
+		}
+		block.Instructions = append(copies, block.Instructions[len(phis):]...)
+	}
+}
+
+func (this *Block) insertBeforeTerminator(ins *Instruction) {
+	n := len(this.Instructions) - 1
+	this.Instructions = append(this.Instructions[:n], ins, this.Instructions[n])
+}
+
+// 按指令重新收集 Vars，参数在最前面，改完以后没用的变量就没了
+func (this *Function) collectVars() {
+	seen := make(map[*Var]bool)
+	vars := []*Var{}
+	add := func(v *Var) {
+		if !seen[v] {
+			seen[v] = true
+			vars = append(vars, v)
+		}
+	}
+	for _, p := range this.Params {
+		add(p)
+	}
+	for _, block := range this.Blocks {
+		for _, ins := range block.Instructions {
+			if ins.Dest != nil {
+				add(ins.Dest)
+			}
+			for _, v := range ins.Vars() {
+				add(v)
+			}
+		}
+	}
+	this.Vars = vars
+}
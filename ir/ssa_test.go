@@ -0,0 +1,152 @@
+package ir
+
+import (
+	"testing"
+)
+
+func TestDomTree(t *testing.T) {
+	program := lower(t, `
+		var f = function(n) {
+			while (n > 0) {
+				if (n == 5) {
+					return n
+				}
+				n -= 1
+			}
+			return 0
+		}
+	`)
+	fn := program.Function("f")
+	tree := fn.DomTree()
+	frontiers := tree.Frontiers(fn)
+	tests := []struct {
+		block     string
+		idom      string
+		frontiers string
+	}{
+		{"b0", "", ""},
+		{"b1", "b0", "b1"},
+		{"b2", "b1", "b1"},
+		{"b3", "b2", ""},
+		{"b4", "b2", "b1"},
+		{"b5", "b1", ""},
+	}
+	if len(fn.Blocks) != len(tests) {
+		t.Fatalf("wrong number of blocks. got=%d, want=%d\n%s", len(fn.Blocks), len(tests), fn)
+	}
+	for i, tt := range tests {
+		block := fn.Blocks[i]
+		idom := ""
+		if tree.Idom(block) != nil {
+			idom = tree.Idom(block).Name()
+		}
+		if idom != tt.idom || blockNames(frontiers[block]) != tt.frontiers {
+			t.Errorf("%s: idom=%q frontiers=%q, want idom=%q frontiers=%q\n%s",
+				block.Name(), idom, blockNames(frontiers[block]), tt.idom, tt.frontiers, fn)
+		}
+	}
+	if !tree.Dominates(fn.Blocks[1], fn.Blocks[4]) || tree.Dominates(fn.Blocks[4], fn.Blocks[1]) {
+		t.Errorf("b1 should dominate b4 and not the other way round")
+	}
+}
+
+func TestSSA(t *testing.T) {
+	tests := []struct {
+		code     string
+		ssa      string
+		expected string
+	}{
+		// 第一次定义用原来的名字，参数在入口定义
+		{
+			"var f = function(n) {\n  var s = 0\n  while (n > 0) {\n    s = s + n\n    n = n - 1\n  }\n  return s\n}",
+			`function f(%n) {
+b0:
+    %s = copy 0
+    jump b1
+b1:
+    %s.1 = phi b0:%s b2:%s.2
+    %n.1 = phi b0:%n b2:%n.2
+    %2 = gt %n.1 0
+    branch %2 b2 b3
+b2:
+    %3 = add %s.1 %n.1
+    %s.2 = copy %3
+    %4 = sub %n.1 1
+    %n.2 = copy %4
+    jump b1
+b3:
+    return %s.1
+}
+`,
+			`function f(%n) {
+b0:
+    %s = copy 0
+    %9 = copy %s
+    %10 = copy %n
+    jump b1
+b1:
+    %s.1 = copy %9
+    %n.1 = copy %10
+    %2 = gt %n.1 0
+    branch %2 b2 b3
+b2:
+    %3 = add %s.1 %n.1
+    %s.2 = copy %3
+    %4 = sub %n.1 1
+    %n.2 = copy %4
+    %9 = copy %s.2
+    %10 = copy %n.2
+    jump b1
+b3:
+    return %s.1
+}
+`,
+		},
+		// 只在一条路上定义的变量，另一条路来的是 null
+		{
+			"var f = function(c) {\n  if (c) {\n    var x = 1\n  }\n  return x\n}",
+			`function f(%c) {
+b0:
+    branch %c b1 b2
+b1:
+    %x = copy 1
+    jump b2
+b2:
+    %x.1 = phi b0:null b1:%x
+    return %x.1
+}
+`,
+			`function f(%c) {
+b0:
+    %3 = copy null
+    branch %c b1 b2
+b1:
+    %x = copy 1
+    %3 = copy %x
+    jump b2
+b2:
+    %x.1 = copy %3
+    return %x.1
+}
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		fn := lower(t, tt.code).Function("f")
+		fn.ToSSA()
+		if got := fn.String(); got != tt.ssa {
+			t.Errorf("ssa wrong.\ncode=%s\ngot=\n%s\nwant=\n%s", tt.code, got, tt.ssa)
+		}
+		if err := fn.Verify(); err != nil {
+			t.Errorf("ssa does not verify: %v", err)
+		}
+		fn.FromSSA()
+		if got := fn.String(); got != tt.expected {
+			t.Errorf("out of ssa wrong.\ncode=%s\ngot=\n%s\nwant=\n%s", tt.code, got, tt.expected)
+		}
+		if err := fn.Verify(); err != nil {
+			t.Errorf("out of ssa does not verify: %v", err)
+		}
+	}
+}
@@ -2,7 +2,10 @@ package lexer
 
 import (
 	"fmt"
+	"io"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
 var EscapeCharacterDict = map[string]string{
@@ -17,9 +20,45 @@ var EscapeCharacterDict = map[string]string{
 	"v":  "\v",
 }
 
+// BaseLexer 按 UTF-8 解码，一次走一个字符（rune）
+//
+// 源码可以一次给全（Code），也可以从 io.Reader 边读边解析
+// 从 Reader 读的时候 Code 只是一个缓冲区，里面是还没丢掉的那一段源码：
+// 需要往后看的时候才去读，每读完一个 token 就把前面用完的部分丢掉，
+// 所以占的内存只和最长的那个 token 有关，和源码有多大无关
+//
+// Position 是 Code 里的字节下标，可以直接拿来切 Code
+// offset 是 Code[0] 在整个源码里的字节偏移，对外报告的位置都加上它
 type BaseLexer struct {
 	Code     string
 	Position int
+	offset   int
+	reader   io.Reader
+	// 从 Reader 读的，用完的源码要丢掉
+	streaming bool
+	// 都从 0 开始，对外报告的时候行号列号加 1
+	charIndex int
+	line      int
+	column    int
+	// Code[0] 处的字符偏移、行号、列号，Reset 的时候从这里重新数
+	startCharIndex int
+	startLine      int
+	startColumn    int
+	// 词法错误，读完以后可以统一看
+	Errors []*LexError
+}
+
+// 每次从 Reader 读多少字节
+const readChunkSize = 4096
+
+// LexError 词法错误，带上出错的位置
+type LexError struct {
+	Pos Position
+	Msg string
+}
+
+func (e *LexError) Error() string {
+	return fmt.Sprintf("%d:%d: %s", e.Pos.Line, e.Pos.Column, e.Msg)
 }
 
 func NewBaseLexer(code string) *BaseLexer {
@@ -29,25 +68,85 @@ func NewBaseLexer(code string) *BaseLexer {
 	}
 }
 
+// NewBaseLexerFromReader 从 reader 边读边解析，读出错当成源码结束，错误记到 Errors 里
+func NewBaseLexerFromReader(reader io.Reader) *BaseLexer {
+	return &BaseLexer{
+		reader:    reader,
+		streaming: true,
+	}
+}
+
+// fill 保证 Position 后面至少有 n 个字节，源码不够长的时候返回 false
+func (l *BaseLexer) fill(n int) bool {
+	for l.reader != nil && len(l.Code)-l.Position < n {
+		buf := make([]byte, readChunkSize)
+		size, err := l.reader.Read(buf)
+		l.Code += string(buf[:size])
+		if err != nil {
+			if err != io.EOF {
+				l.errorAt(l.Pos(), fmt.Sprintf("读取源码出错：%v", err))
+			}
+			l.reader = nil
+		}
+	}
+	return len(l.Code)-l.Position >= n
+}
+
+// discard 丢掉 Position 前面的部分，之前的 Mark 就不能用了
+func (l *BaseLexer) discard() {
+	if !l.streaming {
+		// 源码是一次给全的，不用丢，Mark 也一直能用
+		return
+	}
+	l.Code = l.Code[l.Position:]
+	l.offset += l.Position
+	l.Position = 0
+	l.startCharIndex, l.startLine, l.startColumn = l.charIndex, l.line, l.column
+}
+
+// atEnd 源码读完了
+func (l *BaseLexer) atEnd() bool {
+	return !l.fill(1)
+}
+
+// Current 当前字符，到结尾了返回 ""
 func (l *BaseLexer) Current() string {
 	//fmt.Printf("Current: %d\n", l.Position)
-	return string(l.Code[l.Position])
+	return l.Peek(0)
 }
 
+// Peek 往后看 offset 个字符，不是字节
 func (l *BaseLexer) Peek(offset int) string {
 	// - 1 为默认值
 	if offset == -1 {
 		offset = 1
 	}
-	return string(l.Code[l.Position+offset])
+	pos := l.Position
+	for ; offset > 0 && l.fill(pos-l.Position+1); offset-- {
+		l.fill(pos - l.Position + utf8.UTFMax)
+		_, size := utf8.DecodeRuneInString(l.Code[pos:])
+		pos += size
+	}
+	l.fill(pos - l.Position + utf8.UTFMax)
+	if pos >= len(l.Code) {
+		return ""
+	}
+	_, size := utf8.DecodeRuneInString(l.Code[pos:])
+	return l.Code[pos : pos+size]
 }
 
+// Mark 记下当前位置，Code[mark:Position] 就是这之后读过的源码
+// 只在一个 token 里面用，读下一个 token 的时候前面的源码可能已经丢掉了
 func (l *BaseLexer) Mark() int {
 	return l.Position
 }
 
 func (l *BaseLexer) Reset(pos int) {
-	l.Position = pos
+	// 字符数和行列号没有存，从缓冲区开头重新数一遍，只有回退的时候才会用到
+	l.Position, l.charIndex, l.line, l.column = 0, l.startCharIndex, l.startLine, l.startColumn
+	for l.Position < pos {
+		l.Advance(-1)
+	}
 }
 
 func (l *BaseLexer) Expect(char string, offset int) bool {
@@ -66,24 +165,55 @@ func (l *BaseLexer) Match(char string) bool {
 	}
 }
 
+// Advance 往后走 offset 个字符
 func (l *BaseLexer) Advance(offset int) (end bool) {
 	if offset == -1 {
 		offset = 1
 	}
-	l.Position += offset
-	if l.Position >= len(l.Code) {
-		l.Position = len(l.Code)
-		end = true
+	for ; offset > 0 && !l.atEnd(); offset-- {
+		l.fill(utf8.UTFMax)
+		r, size := utf8.DecodeRuneInString(l.Code[l.Position:])
+		l.Position += size
+		l.charIndex += 1
+		if r == '\n' {
+			l.line += 1
+			l.column = 0
+		} else {
+			l.column += 1
+		}
+	}
+	return l.atEnd()
+}
+
+// Pos 当前所在的位置
+func (l *BaseLexer) Pos() Position {
+	return Position{
+		Offset: l.offset + l.Position,
+		Char:   l.charIndex,
+		Line:   l.line + 1,
+		Column: l.column + 1,
 	}
-	return end
 }
 
 func (l *BaseLexer) Error(args ...string) {
 	fmt.Printf("error: %s\n", strings.Join(args, " "))
 }
 
+// errorAt 打印错误并记到 Errors 里
+func (l *BaseLexer) errorAt(pos Position, msg string) {
+	l.Error(fmt.Sprintf("%v %s", pos, msg))
+	l.Errors = append(l.Errors, &LexError{Pos: pos, Msg: msg})
+}
+
 type SansLangLexer struct {
 	BaseLexer
+	// 正在读的 token 的起始位置
+	start Position
+	// 每个还没结束的 ${ 里面有几层没关上的 {
+	// 遇到 } 的时候栈顶是 0，说明 ${} 结束了，接着读模板字符串
+	templates []int
+	// 读到了但还没挂到 token 上的注释
+	comments []Comment
 }
 
 func NewSansLangLexer(code string) *SansLangLexer {
@@ -92,8 +222,15 @@ func NewSansLangLexer(code string) *SansLangLexer {
 	}
 }
 
+// NewSansLangLexerFromReader 从 reader 边读边出 token，配合 NextToken 用，不要调 TokenList
+func NewSansLangLexerFromReader(reader io.Reader) *SansLangLexer {
+	return &SansLangLexer{
+		BaseLexer: *NewBaseLexerFromReader(reader),
+	}
+}
+
 func (this *SansLangLexer) isSpace(char string) bool {
-	return strings.Contains(" \t\r\n", char)
+	return char != "" && strings.Contains(" \t\r\n", char)
 }
 
 func (this *SansLangLexer) skipSpace() {
@@ -105,29 +242,71 @@ func (this *SansLangLexer) skipSpace() {
 	}
 }
 
+// 注释：
+//
+//	// 行注释
+//	/// 文档注释，挂到后面的 token 上，sans doc 会用到
+//	/* 块注释，可以 /* 嵌套 */ */
 func (this *SansLangLexer) isComment() bool {
-	return this.Expect("/", -1) && this.Expect("/", 1)
+	return this.Expect("/", -1) && (this.Expect("/", 1) || this.Expect("*", 1))
 }
 
-func (this *SansLangLexer) skipComment() {
-	for !this.Expect("\n", -1) && (this.Position < len(this.Code)) {
-		end := this.Advance(-1)
-		if end {
-			return
+// comment 读一条注释，先存起来，等下一个 token 出来的时候挂上去
+func (this *SansLangLexer) comment() {
+	start := this.Pos()
+	mark := this.Mark()
+	if this.Expect("*", 1) {
+		this.skipBlockComment()
+	} else {
+		for !this.Expect("\n", -1) && !this.atEnd() {
+			this.Advance(-1)
 		}
 	}
+	text := this.Code[mark:this.Position]
+	// //// 不算文档注释
+	doc := strings.HasPrefix(text, "///") && !strings.HasPrefix(text, "////")
+	this.comments = append(this.comments, Comment{Text: text, Pos: start, Doc: doc})
+}
+
+// skipBlockComment 跳过 /* */，里面的 /* 要有对应的 */
+func (this *SansLangLexer) skipBlockComment() {
+	start := this.Pos()
+	depth := 0
+	for !this.atEnd() {
+		if this.Expect("/", -1) && this.Expect("*", 1) {
+			depth += 1
+			this.Advance(2)
+		} else if this.Expect("*", -1) && this.Expect("/", 1) {
+			depth -= 1
+			this.Advance(2)
+			if depth == 0 {
+				return
+			}
+		} else {
+			this.Advance(-1)
+		}
+	}
+	this.errorAt(start, "块注释没有结束")
 }
 
 func (this *SansLangLexer) isDigit(char string) bool {
-	return strings.Contains("0123456789", char)
+	return char != "" && strings.Contains("0123456789", char)
 }
 
 func (this *SansLangLexer) isString(char string) bool {
-	return strings.Contains("`", char) || strings.Contains("\"", char) || strings.Contains("'", char)
+	return char == "`" || char == "\"" || char == "'"
 }
 
+// 标识符的规则：
+// 第一个字符是 Unicode 字母（unicode.IsLetter，包括中文、日文、带声调的拉丁字母等）或者 _
+// 后面的字符还可以是 0-9
+// emoji、标点、全角符号都不算字母，不能出现在标识符里
 func (this *SansLangLexer) isId(char string) bool {
-	return strings.Contains("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ_", char)
+	if char == "_" {
+		return true
+	}
+	r, size := utf8.DecodeRuneInString(char)
+	return size > 0 && size == len(char) && r != utf8.RuneError && unicode.IsLetter(r)
 }
 
 func (this *SansLangLexer) getId() string {
@@ -153,13 +332,14 @@ func (this *SansLangLexer) guessType(char string) (tt string) {
 }
 
 func (this *SansLangLexer) string() string {
-	// string: '"' [^\n]* '"' | '\'' [^\n]* '\'' | '`' .* '`'
+	// string: '"' [^\n]* '"' | '\'' [^\n]* '\''
+	// ` 开头的模板字符串见 template
 	str := ""
 	prefix := this.Current()
 	this.Advance(-1)
-	for !this.Expect(prefix, -1) && this.Position < len(this.Code) {
-		if prefix != "`" && this.Expect("\n", -1) {
-			this.Error("字符串解析错误")
+	for !this.Expect(prefix, -1) && !this.atEnd() {
+		if this.Expect("\n", -1) {
+			this.errorAt(this.Pos(), "字符串解析错误")
 		}
 		if this.Match("\\") {
 			v, ok := EscapeCharacterDict[this.Current()]
@@ -176,132 +356,270 @@ func (this *SansLangLexer) string() string {
 	this.Advance(-1)
 	return str
 }
-func (this *SansLangLexer) number() string {
-	//fmt.Printf("in number?")
+
+// template 读模板字符串从 ` 或者 } 开始的一段，到 ${ 或者 ` 为止
+// 转义和普通字符串一样，\` 和 \$ 就是字符本身
+func (this *SansLangLexer) template(head bool) Token {
+	str := ""
+	for !this.atEnd() {
+		if this.Match("`") {
+			if head {
+				return this.newToken(TokenTypeString, str)
+			}
+			return this.newToken(TokenTypeTemplateTail, str)
+		}
+		if this.Expect("$", -1) && this.Expect("{", 1) {
+			this.Advance(2)
+			this.templates = append(this.templates, 0)
+			if head {
+				return this.newToken(TokenTypeTemplateHead, str)
+			}
+			return this.newToken(TokenTypeTemplateMiddle, str)
+		}
+		if this.Match("\\") {
+			v, ok := EscapeCharacterDict[this.Current()]
+			if ok {
+				str += v
+			} else {
+				str += this.Current()
+			}
+		} else {
+			str += this.Current()
+		}
+		this.Advance(-1)
+	}
+	this.errorAt(this.start, "模板字符串没有结束")
+	return this.newToken(TokenTypeError, str)
+}
+
+// number 数字字面量
+//
+//	十进制   123  1_000_000  1.5  1.5e-3  2E10
+//	十六进制 0xFF  八进制 0o17  二进制 0b1010
+//
+// _ 只能夹在两个数字中间，十进制整数不能以 0 开头
+// 格式不对的时候记一个错误，返回 error token
+func (this *SansLangLexer) number() Token {
 	mark := this.Mark()
-	if this.Current() == "0" {
-		end := this.Advance(-1)
-		if end {
-			return this.Code[mark:this.Position]
+	var err string
+	isFloat := false
+
+	prefix := strings.ToLower(this.Peek(1))
+	if this.Current() == "0" && prefix != "" && strings.Contains("xob", prefix) {
+		valid := map[string]string{
+			"x": "0123456789abcdefABCDEF",
+			"o": "01234567",
+			"b": "01",
+		}[prefix]
+		this.Advance(2)
+		err = this.digits(valid)
+		if err == "" && this.Position == mark+2 {
+			err = fmt.Sprintf("0%s 后面没有数字", prefix)
 		}
-	} else if strings.Contains("123456789", this.Current()) {
-		end := this.Advance(-1)
-		if end {
-			return this.Code[mark:this.Position]
+	} else {
+		err = this.digits("0123456789")
+		intPart := this.Code[mark:this.Position]
+		if err == "" && len(intPart) > 1 && intPart[0] == '0' {
+			err = "十进制数不能以 0 开头"
 		}
-		for this.isDigit(this.Current()) {
-			end = this.Advance(-1)
-			if end {
-				return this.Code[mark:this.Position]
+		// 小数部分
+		if err == "" && this.Current() == "." {
+			this.Advance(-1)
+			isFloat = true
+			if this.isDigit(this.Current()) {
+				err = this.digits("0123456789")
+			} else {
+				err = "小数点后面要有数字"
+			}
+		}
+		// 指数部分
+		if err == "" && (this.Current() == "e" || this.Current() == "E") {
+			this.Advance(-1)
+			isFloat = true
+			if this.Current() == "+" || this.Current() == "-" {
+				this.Advance(-1)
+			}
+			if this.isDigit(this.Current()) {
+				err = this.digits("0123456789")
+			} else {
+				err = "指数后面要有数字"
 			}
 		}
 	}
-	if mark != this.Mark() {
-		// 前面有匹配到
-		if this.Current() == "." {
+	// 整数后面可以跟 n 表示大整数，比如 123n、0xFFn
+	if err == "" && this.Current() == "n" {
+		if isFloat {
+			err = "小数不能带 n 后缀"
+		} else {
 			this.Advance(-1)
-			for this.isDigit(this.Current()) {
-				end := this.Advance(-1)
-				if end {
-					return this.Code[mark:this.Position]
-				}
+		}
+	}
+	// 数字后面直接跟着字母、数字或者点也不对，比如 0xFG、0b102、1..2、12abc
+	if err == "" && this.numberTail() {
+		err = "数字后面有多余的字符"
+	}
+
+	if err != "" {
+		// 连着的部分一起吃掉，免得后面再报一堆错
+		for this.numberTail() {
+			this.Advance(-1)
+		}
+		text := this.Code[mark:this.Position]
+		this.errorAt(this.start, fmt.Sprintf("数字格式错误 %s：%s", text, err))
+		return this.newToken(TokenTypeError, text)
+	}
+	return this.newToken(TokenTypeNumeric, this.Code[mark:this.Position])
+}
+
+// digits 读一串 valid 里面的数字，_ 只能夹在两个数字中间
+func (this *SansLangLexer) digits(valid string) string {
+	prevDigit := false
+	for c := this.Current(); c != ""; c = this.Current() {
+		if c == "_" {
+			next := this.Peek(1)
+			if !prevDigit || next == "" || !strings.Contains(valid, next) {
+				return "_ 只能放在两个数字中间"
 			}
+			prevDigit = false
+		} else if strings.Contains(valid, c) {
+			prevDigit = true
+		} else {
+			break
 		}
-		return this.Code[mark:this.Mark()]
+		this.Advance(-1)
 	}
-	this.Reset(mark)
 	return ""
 }
 
+func (this *SansLangLexer) numberTail() bool {
+	c := this.Current()
+	return this.isId(c) || this.isDigit(c) || c == "."
+}
+
 func (this *SansLangLexer) nextToken() Token {
-	for this.Position < len(this.Code) {
+	for !this.atEnd() {
+		this.discard()
+		this.start = this.Pos()
 		switch {
 		case this.isSpace(this.Current()):
 			this.skipSpace()
 		case this.isComment():
-			this.skipComment()
+			this.comment()
 		case this.isDigit(this.Current()):
-			return NewToken(TokenTypeNumeric, this.number())
+			return this.number()
+		case this.Match("`"):
+			return this.template(true)
 		case this.isString(this.Current()):
-			return NewToken(TokenTypeString, this.string())
+			return this.newToken(TokenTypeString, this.string())
 		case this.Match("!"):
 			if this.Match("=") {
-				return NewToken(TokenTypeNotEquals, "!=")
+				return this.newToken(TokenTypeNotEquals, "!=")
 			}
 		case this.Match("+"):
 			if this.Match("=") {
-				return NewToken(TokenTypePlusAssign, "+=")
+				return this.newToken(TokenTypePlusAssign, "+=")
 			}
-			return NewToken(TokenTypePlus, "+")
+			return this.newToken(TokenTypePlus, "+")
 		case this.Match("-"):
 			if this.Match("=") {
-				return NewToken(TokenTypeMinusAssign, "-=")
+				return this.newToken(TokenTypeMinusAssign, "-=")
 			}
-			return NewToken(TokenTypeMinus, "-")
+			return this.newToken(TokenTypeMinus, "-")
 		case this.Match("*"):
 			if this.Match("=") {
-				return NewToken(TokenTypeMulAssign, "*=")
+				return this.newToken(TokenTypeMulAssign, "*=")
 			}
-			return NewToken(TokenTypeMul, "*")
+			return this.newToken(TokenTypeMul, "*")
 		case this.Match("%"):
-			return NewToken(TokenTypeMod, "%")
+			return this.newToken(TokenTypeMod, "%")
 		case this.Match("/"):
 			if this.Match("=") {
-				return NewToken(TokenTypeDivAssign, "/=")
+				return this.newToken(TokenTypeDivAssign, "/=")
 			}
-			return NewToken(TokenTypeDiv, "/")
+			return this.newToken(TokenTypeDiv, "/")
 		case this.Match("("):
-			return NewToken(TokenTypeLParen, "(")
+			return this.newToken(TokenTypeLParen, "(")
 		case this.Match(")"):
-			return NewToken(TokenTypeRParen, ")")
+			return this.newToken(TokenTypeRParen, ")")
 		case this.Match("{"):
-			return NewToken(TokenTypeLBrace, "{")
+			if n := len(this.templates); n > 0 {
+				this.templates[n-1] += 1
+			}
+			return this.newToken(TokenTypeLBrace, "{")
 		case this.Match("}"):
-			return NewToken(TokenTypeRBrace, "}")
+			if n := len(this.templates); n > 0 {
+				if this.templates[n-1] == 0 {
+					// ${} 结束，接着读模板字符串
+					this.templates = this.templates[:n-1]
+					return this.template(false)
+				}
+				this.templates[n-1] -= 1
+			}
+			return this.newToken(TokenTypeRBrace, "}")
 		case this.Match("["):
-			return NewToken(TokenTypeLBracket, "[")
+			return this.newToken(TokenTypeLBracket, "[")
 		case this.Match("]"):
-			return NewToken(TokenTypeRBracket, "]")
+			return this.newToken(TokenTypeRBracket, "]")
 		case this.Match("<"):
 			if this.Match("=") {
-				return NewToken(TokenTypeLessThanEquals, "<=")
+				return this.newToken(TokenTypeLessThanEquals, "<=")
 			}
-			return NewToken(TokenTypeLessThan, "<")
+			return this.newToken(TokenTypeLessThan, "<")
 		case this.Match(">"):
 			if this.Match("=") {
-				return NewToken(TokenTypeGreaterThanEquals, ">=")
+				return this.newToken(TokenTypeGreaterThanEquals, ">=")
 			}
-			return NewToken(TokenTypeGreaterThan, ">")
+			return this.newToken(TokenTypeGreaterThan, ">")
 		case this.Match("="):
 			if this.Match("=") {
-				return NewToken(TokenTypeEquals, "==")
+				return this.newToken(TokenTypeEquals, "==")
 			}
-			return NewToken(TokenTypeAssign, "=")
+			return this.newToken(TokenTypeAssign, "=")
 		case this.Match("."):
-			return NewToken(TokenTypeDot, ".")
+			if this.Expect(".", 0) && this.Expect(".", 1) {
+				this.Advance(2)
+				return this.newToken(TokenTypeEllipsis, "...")
+			}
+			return this.newToken(TokenTypeDot, ".")
 		case this.Match(";"):
-			return NewToken(TokenTypeSemi, ";")
+			return this.newToken(TokenTypeSemi, ";")
 		case this.Match(":"):
-			return NewToken(TokenTypeColon, ":")
+			return this.newToken(TokenTypeColon, ":")
 		case this.Match(","):
-			return NewToken(TokenTypeComma, ",")
+			return this.newToken(TokenTypeComma, ",")
 		case this.isId(this.Current()):
 			id := this.getId()
 			idType := this.guessType(id)
 			if idType == TokenTypeBoolean.Name() {
-				return NewToken(TokenTypeBoolean, id)
+				return this.newToken(TokenTypeBoolean, id)
 			} else {
-				return NewToken(GetTokenTypeFromName(idType), id)
+				return this.newToken(GetTokenTypeFromName(idType), id)
 			}
 		default:
 			// 如果都不是，则证明遇到未知的字符，需要报错
-			this.Error(fmt.Sprintf("无法识别的字符 char：%s, pos:%d", this.Current(), this.Position))
-			return NewToken(TokenTypeEof, TokenTypeEof.name)
+			this.errorAt(this.Pos(), fmt.Sprintf("无法识别的字符 char：%s", this.Current()))
+			return this.newToken(TokenTypeEof, TokenTypeEof.name)
 		}
 	}
-	return NewToken(TokenTypeEof, TokenTypeEof.name)
+	this.start = this.Pos()
+	return this.newToken(TokenTypeEof, TokenTypeEof.name)
 }
 
+// newToken 带上 token 的起始位置
+func (this *SansLangLexer) newToken(tokenType TokenType, value string) Token {
+	t := NewToken(tokenType, value)
+	t.Pos = this.start
+	t.Comments = this.comments
+	this.comments = nil
+	return t
+}
+
+// NextToken 读下一个 token，读完以后一直返回 eof
+func (this *SansLangLexer) NextToken() Token {
+	return this.nextToken()
+}
+
+// TokenList 一次把所有 token 读出来
 func (this *SansLangLexer) TokenList() []Token {
 	token := this.nextToken()
 	ret := []Token{}
@@ -314,6 +632,12 @@ func (this *SansLangLexer) TokenList() []Token {
 
 }
 
+// TokenStream parser 从这里一个一个地拿 token，最后一个是 eof
+// SansLangLexer 边读边出，TokenList 是已经读好的
+type TokenStream interface {
+	NextToken() Token
+}
+
 type TokenList struct {
 	Tokens []Token
 	index  int
@@ -1,8 +1,13 @@
 package lexer
 
 import (
+	"errors"
 	"fmt"
+	"io"
+	"reflect"
+	"strings"
 	"testing"
+	"testing/iotest"
 )
 
 func TestNewBaseLexer(t *testing.T) {
@@ -141,3 +146,340 @@ func testLexer5() {
 	}
 	fmt.Println("====================== token end =======================")
 }
+
+func TestLexerUnicode(t *testing.T) {
+	lexer := NewSansLangLexer("var 名字 = \"你好😀\"\nvar café_1 = 名字")
+	tokens := lexer.TokenList()
+
+	expected := []struct {
+		tokenType TokenType
+		value     string
+		pos       Position
+	}{
+		{TokenTypeVar, "var", Position{Offset: 0, Char: 0, Line: 1, Column: 1}},
+		{TokenTypeId, "名字", Position{Offset: 4, Char: 4, Line: 1, Column: 5}},
+		{TokenTypeAssign, "=", Position{Offset: 11, Char: 7, Line: 1, Column: 8}},
+		{TokenTypeString, "你好😀", Position{Offset: 13, Char: 9, Line: 1, Column: 10}},
+		{TokenTypeVar, "var", Position{Offset: 26, Char: 15, Line: 2, Column: 1}},
+		{TokenTypeId, "café_1", Position{Offset: 30, Char: 19, Line: 2, Column: 5}},
+		{TokenTypeAssign, "=", Position{Offset: 38, Char: 26, Line: 2, Column: 12}},
+		{TokenTypeId, "名字", Position{Offset: 40, Char: 28, Line: 2, Column: 14}},
+		{TokenTypeEof, "eof", Position{Offset: 46, Char: 30, Line: 2, Column: 16}},
+	}
+	if len(tokens) != len(expected) {
+		t.Fatalf("token count wrong. got=%d, want=%d: %+v", len(tokens), len(expected), tokens)
+	}
+	for i, e := range expected {
+		got := tokens[i]
+		if got.Type != e.tokenType || got.Value != e.value || got.Pos != e.pos {
+			t.Errorf("tokens[%d] wrong. got=%s %q %v, want=%s %q %v",
+				i, got.Type.Name(), got.Value, got.Pos, e.tokenType.Name(), e.value, e.pos)
+		}
+	}
+}
+
+func TestLexerIdentifierRule(t *testing.T) {
+	tests := []struct {
+		char string
+		isId bool
+	}{
+		{"a", true},
+		{"_", true},
+		{"名", true},
+		{"é", true},
+		{"ひ", true},
+		{"1", false},
+		{"😀", false},
+		{"，", false},
+		{"", false},
+	}
+
+	lexer := SansLangLexer{}
+	for _, tt := range tests {
+		if got := lexer.isId(tt.char); got != tt.isId {
+			t.Errorf("isId(%q) = %v, want %v", tt.char, got, tt.isId)
+		}
+	}
+}
+
+func TestLexerNumbers(t *testing.T) {
+	tests := []struct {
+		input     string
+		tokenType TokenType
+		value     string
+	}{
+		{"0", TokenTypeNumeric, "0"},
+		{"123", TokenTypeNumeric, "123"},
+		{"1_000_000", TokenTypeNumeric, "1_000_000"},
+		{"3.14", TokenTypeNumeric, "3.14"},
+		{"1.5e-3", TokenTypeNumeric, "1.5e-3"},
+		{"2E+10", TokenTypeNumeric, "2E+10"},
+		{"0.5", TokenTypeNumeric, "0.5"},
+		{"0xFF", TokenTypeNumeric, "0xFF"},
+		{"0Xdead_beef", TokenTypeNumeric, "0Xdead_beef"},
+		{"0o17", TokenTypeNumeric, "0o17"},
+		{"0b1010", TokenTypeNumeric, "0b1010"},
+		{"0x", TokenTypeError, "0x"},
+		{"0b102", TokenTypeError, "0b102"},
+		{"0xFG", TokenTypeError, "0xFG"},
+		{"1..2", TokenTypeError, "1..2"},
+		{"1.", TokenTypeError, "1."},
+		{"1e", TokenTypeError, "1e"},
+		{"1__0", TokenTypeError, "1__0"},
+		{"1_", TokenTypeError, "1_"},
+		{"0x_1", TokenTypeError, "0x_1"},
+		{"012", TokenTypeError, "012"},
+		{"12abc", TokenTypeError, "12abc"},
+		{"123n", TokenTypeNumeric, "123n"},
+		{"0xFFn", TokenTypeNumeric, "0xFFn"},
+		{"1.5n", TokenTypeError, "1.5n"},
+		{"1e3n", TokenTypeError, "1e3n"},
+		{"1nn", TokenTypeError, "1nn"},
+	}
+
+	for _, tt := range tests {
+		lexer := NewSansLangLexer(tt.input)
+		tokens := lexer.TokenList()
+		if len(tokens) != 2 {
+			t.Errorf("%s: want 1 token, got %+v", tt.input, tokens)
+			continue
+		}
+		if tokens[0].Type != tt.tokenType || tokens[0].Value != tt.value {
+			t.Errorf("%s: got=%s %q, want=%s %q", tt.input, tokens[0].Type.Name(), tokens[0].Value, tt.tokenType.Name(), tt.value)
+		}
+		wantErrors := 0
+		if tt.tokenType == TokenTypeError {
+			wantErrors = 1
+		}
+		if len(lexer.Errors) != wantErrors {
+			t.Errorf("%s: want %d errors, got %v", tt.input, wantErrors, lexer.Errors)
+		}
+	}
+
+	// 错误带位置
+	lexer := NewSansLangLexer("var a = 1\nvar b = 0x")
+	lexer.TokenList()
+	if len(lexer.Errors) != 1 || lexer.Errors[0].Pos.Line != 2 || lexer.Errors[0].Pos.Column != 9 {
+		t.Errorf("error position wrong. got=%v", lexer.Errors)
+	}
+}
+
+func TestLexerTemplate(t *testing.T) {
+	type token struct {
+		tokenType TokenType
+		value     string
+	}
+	tests := []struct {
+		input    string
+		expected []token
+	}{
+		{"`a\nb`", []token{{TokenTypeString, "a\nb"}}},
+		{"`a${x}b`", []token{
+			{TokenTypeTemplateHead, "a"},
+			{TokenTypeId, "x"},
+			{TokenTypeTemplateTail, "b"},
+		}},
+		{"`${x}${y}`", []token{
+			{TokenTypeTemplateHead, ""},
+			{TokenTypeId, "x"},
+			{TokenTypeTemplateMiddle, ""},
+			{TokenTypeId, "y"},
+			{TokenTypeTemplateTail, ""},
+		}},
+		// ${} 里面的 {} 和嵌套的模板字符串
+		{"`${ {1: `${a}`}[1] }!`", []token{
+			{TokenTypeTemplateHead, ""},
+			{TokenTypeLBrace, "{"},
+			{TokenTypeNumeric, "1"},
+			{TokenTypeColon, ":"},
+			{TokenTypeTemplateHead, ""},
+			{TokenTypeId, "a"},
+			{TokenTypeTemplateTail, ""},
+			{TokenTypeRBrace, "}"},
+			{TokenTypeLBracket, "["},
+			{TokenTypeNumeric, "1"},
+			{TokenTypeRBracket, "]"},
+			{TokenTypeTemplateTail, "!"},
+		}},
+		{"`\\${x} \\` $ {`", []token{{TokenTypeString, "${x} ` $ {"}}},
+		{"`a${x}b", []token{
+			{TokenTypeTemplateHead, "a"},
+			{TokenTypeId, "x"},
+			{TokenTypeError, "b"},
+		}},
+	}
+
+	for _, tt := range tests {
+		lexer := NewSansLangLexer(tt.input)
+		tokens := lexer.TokenList()
+		if len(tokens) != len(tt.expected)+1 {
+			t.Errorf("%q: token count wrong. got=%+v", tt.input, tokens)
+			continue
+		}
+		for i, e := range tt.expected {
+			if tokens[i].Type != e.tokenType || tokens[i].Value != e.value {
+				t.Errorf("%q: tokens[%d] got=%s %q, want=%s %q",
+					tt.input, i, tokens[i].Type.Name(), tokens[i].Value, e.tokenType.Name(), e.value)
+			}
+		}
+	}
+}
+
+func TestLexerComments(t *testing.T) {
+	code := "// line\n" +
+		"/// 加法\n" +
+		"///   返回 a + b  \n" +
+		"var add /* 块 /* 嵌套 */ 注释 */ = 1\n" +
+		"//// 不是文档\n" +
+		"a / b // 除法\n" +
+		"/* 结尾 */"
+	lexer := NewSansLangLexer(code)
+	tokens := lexer.TokenList()
+
+	expected := []struct {
+		tokenType TokenType
+		comments  []string
+		doc       string
+	}{
+		{TokenTypeVar, []string{"// line", "/// 加法", "///   返回 a + b  "}, "加法\n  返回 a + b"},
+		{TokenTypeId, nil, ""},
+		{TokenTypeAssign, []string{"/* 块 /* 嵌套 */ 注释 */"}, ""},
+		{TokenTypeNumeric, nil, ""},
+		{TokenTypeId, []string{"//// 不是文档"}, ""},
+		{TokenTypeDiv, nil, ""},
+		{TokenTypeId, nil, ""},
+		{TokenTypeEof, []string{"// 除法", "/* 结尾 */"}, ""},
+	}
+	if len(tokens) != len(expected) {
+		t.Fatalf("token count wrong. got=%+v", tokens)
+	}
+	for i, e := range expected {
+		got := tokens[i]
+		texts := []string{}
+		for _, c := range got.Comments {
+			texts = append(texts, c.Text)
+		}
+		if got.Type != e.tokenType || strings.Join(texts, "|") != strings.Join(e.comments, "|") || got.Doc() != e.doc {
+			t.Errorf("tokens[%d] got=%s %q doc=%q, want=%s %q doc=%q",
+				i, got.Type.Name(), texts, got.Doc(), e.tokenType.Name(), e.comments, e.doc)
+		}
+	}
+	if len(lexer.Errors) != 0 {
+		t.Errorf("unexpected errors: %v", lexer.Errors)
+	}
+	if pos := tokens[2].Comments[0].Pos; pos.Line != 4 || pos.Column != 9 {
+		t.Errorf("comment position wrong. got=%v", pos)
+	}
+
+	lexer = NewSansLangLexer("var a /* /* */ = 1")
+	lexer.TokenList()
+	if len(lexer.Errors) != 1 {
+		t.Errorf("unterminated block comment should be an error. got=%v", lexer.Errors)
+	}
+}
+
+func TestLexerReader(t *testing.T) {
+	code := "/// 文档\nvar 名字 = `你好${1_000 + 0x1F}😀`\n/* 块 */ f(...a, 1.5e3)\n"
+	want := NewSansLangLexer(code).TokenList()
+
+	// 一次只给一个字节，UTF-8 的字符会被拆开
+	lexer := NewSansLangLexerFromReader(iotest.OneByteReader(strings.NewReader(code)))
+	got := []Token{}
+	for {
+		token := lexer.NextToken()
+		got = append(got, token)
+		if token.Type == TokenTypeEof {
+			break
+		}
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("reader lexer differs from string lexer.\ngot=%+v\nwant=%+v", got, want)
+	}
+	if len(lexer.Errors) != 0 {
+		t.Errorf("unexpected errors: %v", lexer.Errors)
+	}
+}
+
+// 一直重复同一段源码，不占内存
+type repeatReader struct {
+	line  string
+	count int
+	pos   int
+}
+
+func (r *repeatReader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) && r.count > 0 {
+		c := copy(p[n:], r.line[r.pos:])
+		n += c
+		r.pos += c
+		if r.pos == len(r.line) {
+			r.pos = 0
+			r.count -= 1
+		}
+	}
+	if n == 0 {
+		return 0, io.EOF
+	}
+	return n, nil
+}
+
+func TestLexerReaderBoundedBuffer(t *testing.T) {
+	lines := 100000
+	lexer := NewSansLangLexerFromReader(&repeatReader{line: "var a = b + 1 // 注释\n", count: lines})
+	count := 0
+	maxBuffer := 0
+	var last Token
+	for {
+		token := lexer.NextToken()
+		if len(lexer.Code) > maxBuffer {
+			maxBuffer = len(lexer.Code)
+		}
+		if token.Type == TokenTypeEof {
+			break
+		}
+		count += 1
+		last = token
+	}
+	if count != lines*6 {
+		t.Errorf("token count wrong. got=%d, want=%d", count, lines*6)
+	}
+	if maxBuffer > 2*readChunkSize {
+		t.Errorf("buffer not bounded. max=%d", maxBuffer)
+	}
+	if last.Pos.Line != lines || last.Pos.Offset != (lines-1)*len("var a = b + 1 // 注释\n")+12 {
+		t.Errorf("position wrong. got=%v", last.Pos)
+	}
+}
+
+func TestLexerReaderError(t *testing.T) {
+	reader := io.MultiReader(strings.NewReader("var a = 1"), iotest.ErrReader(errors.New("boom")))
+	lexer := NewSansLangLexerFromReader(reader)
+	tokens := lexer.TokenList()
+	if len(tokens) != 5 {
+		t.Errorf("token count wrong. got=%+v", tokens)
+	}
+	if len(lexer.Errors) != 1 || !strings.Contains(lexer.Errors[0].Msg, "boom") {
+		t.Errorf("read error should be reported. got=%v", lexer.Errors)
+	}
+}
+
+func BenchmarkLexer(b *testing.B) {
+	var sb strings.Builder
+	for i := 0; i < 1000; i++ {
+		fmt.Fprintf(&sb, "var a%d = function(x, y) { if (x > y and not false) { return x } else { return y + %d } }\n", i, i)
+	}
+	code := sb.String()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		NewSansLangLexer(code).TokenList()
+	}
+}
+
+func BenchmarkTokenTypeName(b *testing.B) {
+	all := TokenTypeAll()
+	for i := 0; i < b.N; i++ {
+		all[i%len(all)].Name()
+	}
+}
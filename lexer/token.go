@@ -1,8 +1,51 @@
 package lexer
 
+import (
+	"fmt"
+	"strings"
+)
+
 type Token struct {
 	Type  TokenType
 	Value string
+	Pos   Position // token 第一个字符的位置
+	// token 前面的注释（leading trivia），按出现的顺序
+	// 文件末尾的注释挂在 eof 上
+	Comments []Comment
+}
+
+// Comment 一条注释，Text 是原文，包括 // /* */
+type Comment struct {
+	Text string
+	Pos  Position
+	// /// 开头的文档注释
+	Doc bool
+}
+
+// Doc 把 token 前面的 /// 文档注释拼起来，每行去掉 /// 和后面的一个空格
+func (t *Token) Doc() string {
+	lines := []string{}
+	for _, c := range t.Comments {
+		if !c.Doc {
+			continue
+		}
+		line := strings.TrimPrefix(c.Text, "///")
+		line = strings.TrimPrefix(line, " ")
+		lines = append(lines, strings.TrimRight(line, " \t\r"))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Position 源码里的位置，Offset 按字节算，Char、Column 按字符（rune）算
+type Position struct {
+	Offset int // 字节偏移，从 0 开始
+	Char   int // 字符偏移，从 0 开始
+	Line   int // 行号，从 1 开始
+	Column int // 列号，从 1 开始
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("%d:%d(byte %d, char %d)", p.Line, p.Column, p.Offset, p.Char)
 }
 
 func (t *Token) String() string {
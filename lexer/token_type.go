@@ -11,6 +11,9 @@ type TokenType struct {
 
 var (
 	validTokenTypes = []TokenType{}
+	// 查表用，在 newTokenType 里填
+	tokenTypeByName  = map[string]TokenType{}
+	tokenTypeByValue = map[int64]TokenType{}
 
 	// KeywordType
 	TokenTypeOr       = newTokenType("or", 0)
@@ -85,11 +88,25 @@ var (
 	TokenTypeThis = newTokenType("this", 56)
 	// new
 	TokenTypeNew = newTokenType("new", 56)
+	// 剩余参数 ...
+	TokenTypeEllipsis = newTokenType("ellipsis", 57)
+
+	// 模板字符串 `a${x}b${y}c` 拆成
+	// templateHead "a"、x 的 token、templateMiddle "b"、y 的 token、templateTail "c"
+	// 没有 ${} 的模板字符串还是普通的 string
+	TokenTypeTemplateHead   = newTokenType("templateHead", 58)
+	TokenTypeTemplateMiddle = newTokenType("templateMiddle", 59)
+	TokenTypeTemplateTail   = newTokenType("templateTail", 60)
 )
 
 func newTokenType(name string, value int64) TokenType {
 	o := TokenType{name: name, value: value}
 	validTokenTypes = append(validTokenTypes, o)
+	tokenTypeByName[name] = o
+	// 有几个 value 是重复的（string 和 comment、cls this new），按 value 找的时候取先注册的那个
+	if _, ok := tokenTypeByValue[value]; !ok {
+		tokenTypeByValue[value] = o
+	}
 	return o
 }
 
@@ -121,70 +138,42 @@ func (t TokenType) NamePtr() *string {
 	return &n
 }
 
+// 名字是唯一的，按名字查一下就知道是不是注册过的
 func (t TokenType) valid() bool {
-	for _, v := range TokenTypeAll() {
-		if v == t {
-			return true
-		}
-	}
-	return false
+	v, ok := tokenTypeByName[t.name]
+	return ok && v == t
 }
 
 func NewTokenTypeFromValue(i int64) TokenType {
-	for _, v := range TokenTypeAll() {
-		if v.value == i {
-			return v
-		}
+	if v, ok := tokenTypeByValue[i]; ok {
+		return v
 	}
 	panic(fmt.Errorf("invalid TokenType value: (%+v)", i))
 }
 
 func GetTokenTypeFromName(s string) TokenType {
-	for _, v := range TokenTypeAll() {
-		if v.name == s {
-			return v
-		}
+	if v, ok := tokenTypeByName[s]; ok {
+		return v
 	}
 	panic(fmt.Errorf("invalid TokenType name: (%+v)", s))
 }
 
 func ValidateTokenTypeValue(i int64) bool {
-	for _, v := range TokenTypeAll() {
-		if v.value == i {
-			return true
-		}
-	}
-	return false
+	_, ok := tokenTypeByValue[i]
+	return ok
 }
 
 func ValidateTokenTypeName(s string) bool {
-	for _, v := range TokenTypeAll() {
-		if v.name == s {
-			return true
-		}
-	}
-	return false
+	_, ok := tokenTypeByName[s]
+	return ok
 }
 
 func ValidateTokenTypeInKeyWordType(s string) bool {
-	for _, v := range TokenTypeAll() {
-		if s == v.name {
-			if v.value >= TokenTypeOr.Value() && v.value <= TokenTypeSuper.Value() {
-				return true
-			}
-		}
-
-	}
-	return false
+	v, ok := tokenTypeByName[s]
+	return ok && v.value >= TokenTypeOr.value && v.value <= TokenTypeSuper.value
 }
 
 func ValidateTokenTypeInBool(s string) bool {
-	for _, v := range TokenTypeAll() {
-		if s == v.name {
-			if v.value == TokenTypeTrue.Value() || v.value == TokenTypeFalse.Value() {
-				return true
-			}
-		}
-	}
-	return false
+	v, ok := tokenTypeByName[s]
+	return ok && (v == TokenTypeTrue || v == TokenTypeFalse)
 }
@@ -1,13 +1,61 @@
 package main
 
 import (
+	"encoding/json"
+	"flag"
 	"fmt"
+	"go-compiler/asm_vm_stack_base"
+	"go-compiler/ir"
+	sansLexer "go-compiler/lexer"
+	sansParser "go-compiler/parser"
 	"go-compiler/repl"
+	"io"
 	"os"
 	"os/user"
+	"path/filepath"
+	"strings"
 )
 
+const usage = `usage:
+	sans                     启动 repl
+	sans ast --json <file>   输出 <file> 的 AST（JSON）
+	sans run [--ast] <file>  编译并运行 <file>，.json 文件按 JSON AST 读入
+	                         先降低成 IR 再编译，--ast 直接从 AST 编译
+	                         IR 不支持的程序（闭包、字典、类、默认参数、模板字符串、大整数）自动改用 --ast
+	                         只有 --ast 会打印最后一个表达式的值
+	sans ir <file>           输出 <file> 降低以后的 IR
+	  run 和 ir 可以加 -O1 -O2 优化 IR，或者 --passes constprop,dce 只跑这几个 pass
+	sans doc <file>          输出 <file> 里函数和类的文档（/// 注释），markdown 格式
+	<file> 是 - 的时候从标准输入读
+`
+
 func main() {
+	if len(os.Args) < 2 {
+		startRepl()
+		return
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "ast":
+		err = astCommand(os.Args[2:])
+	case "run":
+		err = runCommand(os.Args[2:])
+	case "doc":
+		err = docCommand(os.Args[2:])
+	case "ir":
+		err = irCommand(os.Args[2:])
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "sans: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func startRepl() {
 	// 我这里暂时把 test 文件拆分了
 	// 其实这里应该放整体编译的逻辑
 	// 没关系先这样
@@ -21,3 +69,200 @@ func main() {
 	fmt.Printf("Feel free to type in commands\n")
 	repl.Start(os.Stdin, os.Stdout)
 }
+
+// sans ast --json <file>
+func astCommand(args []string) error {
+	flags := flag.NewFlagSet("ast", flag.ExitOnError)
+	asJson := flags.Bool("json", false, "以 JSON 输出 AST")
+	flags.Parse(args)
+	if !*asJson || flags.NArg() != 1 {
+		return fmt.Errorf("usage: sans ast --json <file>")
+	}
+
+	program, err := parseFile(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(program, "", "    ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(data))
+	return nil
+}
+
+// sans run [--ast] <file>
+func runCommand(args []string) error {
+	flags := flag.NewFlagSet("run", flag.ExitOnError)
+	useAst := flags.Bool("ast", false, "不经过 IR，直接从 AST 编译")
+	passes := optimizeFlags(flags)
+	flags.Parse(expandLevel(args))
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: sans run [--ast | [-O<level>] [--passes <p1,p2>]] <file>")
+	}
+
+	program, err := readProgram(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	if *useAst {
+		return runAst(program)
+	}
+	selected, err := passes()
+	if err != nil {
+		return err
+	}
+	p, err := ir.Lower(program)
+	if err != nil {
+		// IR 还没有的特性只有 AST 编译器有，退回去
+		fmt.Fprintf(os.Stderr, "sans: %v, falling back to --ast\n", err)
+		return runAst(program)
+	}
+	ir.Optimize(p, selected)
+	// 顶层代码当成函数跑，没有最后一个表达式的值
+	vm := asm_vm_stack_base.NewVM(asm_vm_stack_base.CompileIR(p))
+	return vm.Run()
+}
+
+// 栈虚拟机的 Compiler 直接从 AST 编译，跑完打印栈上最后一个值
+// Compiler 遇到不支持的节点（比如类）会 panic，这里当成 error 返回
+func runAst(program sansParser.Program) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	compiler := asm_vm_stack_base.NewCompiler()
+	compiler.Compile(program)
+	vm := asm_vm_stack_base.NewVM(compiler.ReturnBytecode())
+	if err := vm.Run(); err != nil {
+		return err
+	}
+	if result := vm.GetLastStackItem(); result != nil {
+		fmt.Println(result.Inspect())
+	}
+	return nil
+}
+
+// sans ir [-O<level>] [--passes <p1,p2>] <file>
+func irCommand(args []string) error {
+	flags := flag.NewFlagSet("ir", flag.ExitOnError)
+	passes := optimizeFlags(flags)
+	flags.Parse(expandLevel(args))
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: sans ir [-O<level>] [--passes <p1,p2>] <file>")
+	}
+	selected, err := passes()
+	if err != nil {
+		return err
+	}
+
+	program, err := readProgram(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	p, err := ir.Lower(program)
+	if err != nil {
+		return err
+	}
+	ir.Optimize(p, selected)
+	fmt.Print(p)
+	return nil
+}
+
+// -O 和 --passes，返回的函数在 Parse 以后调，给了 --passes 的时候不管 -O
+func optimizeFlags(flags *flag.FlagSet) func() ([]string, error) {
+	level := flags.Int("O", 0, "优化级别 0 1 2")
+	names := flags.String("passes", "", "逗号分开的 pass："+passNames())
+	return func() ([]string, error) {
+		if *names != "" {
+			return ir.ParsePasses(*names)
+		}
+		return ir.PassesForLevel(*level), nil
+	}
+}
+
+func passNames() string {
+	var names []string
+	for _, pass := range ir.Passes {
+		names = append(names, pass.Name)
+	}
+	return strings.Join(names, ",")
+}
+
+// flag 不认 -O2，换成 -O=2
+func expandLevel(args []string) []string {
+	expanded := make([]string, 0, len(args))
+	for _, arg := range args {
+		if len(arg) > 2 && strings.HasPrefix(arg, "-O") && arg[2] >= '0' && arg[2] <= '9' {
+			arg = "-O=" + arg[2:]
+		}
+		expanded = append(expanded, arg)
+	}
+	return expanded
+}
+
+// sans doc <file>
+func docCommand(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: sans doc <file>")
+	}
+
+	program, err := parseFile(args[0])
+	if err != nil {
+		return err
+	}
+	fmt.Printf("# %s\n", filepath.Base(args[0]))
+	for _, item := range sansParser.ExtractDocs(program) {
+		// 类的成员低一级
+		heading := "##"
+		if item.Kind == "method" || item.Kind == "field" {
+			heading = "###"
+		}
+		fmt.Printf("\n%s %s\n", heading, item.Signature)
+		if item.Doc != "" {
+			fmt.Printf("\n%s\n", item.Doc)
+		}
+	}
+	return nil
+}
+
+// parseFile 边读边解析，不用把整个文件读进内存，path 是 - 的时候读标准输入
+func parseFile(path string) (sansParser.Program, error) {
+	var reader io.Reader = os.Stdin
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return sansParser.Program{}, err
+		}
+		defer file.Close()
+		reader = file
+	}
+	lexer := sansLexer.NewSansLangLexerFromReader(reader)
+	parser := sansParser.NewSansLangParser(lexer)
+	program, err := parser.ParseProgram()
+	if len(lexer.Errors) > 0 {
+		return sansParser.Program{}, fmt.Errorf("%s:%v", path, lexer.Errors[0])
+	}
+	if err != nil {
+		return sansParser.Program{}, fmt.Errorf("%s:%v", path, err)
+	}
+	return program, nil
+}
+
+// .json 文件按 JSON AST 读，别的按源码解析
+func readProgram(path string) (sansParser.Program, error) {
+	if strings.HasSuffix(path, ".json") {
+		return readJsonAst(path)
+	}
+	return parseFile(path)
+}
+
+func readJsonAst(path string) (sansParser.Program, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return sansParser.Program{}, err
+	}
+	return sansParser.UnmarshalProgram(data)
+}
@@ -1,8 +1,14 @@
 package parser
 
+import (
+	"math"
+	"math/big"
+	"strings"
+)
+
 // Node接口
 type Node interface {
-	Type() string
+	Type() AstType
 }
 
 // Program节点结构
@@ -11,8 +17,8 @@ type Program struct {
 }
 
 // 实现Node接口的Type方法
-func (p Program) Type() string {
-	return "Program"
+func (p Program) Type() AstType {
+	return AstTypeProgram
 }
 
 // Identifier节点结构
@@ -21,8 +27,8 @@ type Identifier struct {
 }
 
 // 实现Node接口的Type方法
-func (i Identifier) Type() string {
-	return "Identifier"
+func (i Identifier) Type() AstType {
+	return AstTypeIdentifier
 }
 
 // BooleanLiteral节点结构
@@ -31,18 +37,69 @@ type BooleanLiteral struct {
 }
 
 // 实现Node接口的Type方法
-func (bl BooleanLiteral) Type() string {
-	return "BooleanLiteral"
+func (bl BooleanLiteral) Type() AstType {
+	return AstTypeBooleanLiteral
 }
 
 // NumberLiteral节点结构
 type NumberLiteral struct {
-	Value float64 `json:"value"` // value属性
+	Value float64 `json:"value"`         // value属性
+	Raw   string  `json:"raw,omitempty"` // 源码里的写法，用来区分整数和小数、拿到精确的整数值
 }
 
 // 实现Node接口的Type方法
-func (nl NumberLiteral) Type() string {
-	return "NumberLiteral"
+func (nl NumberLiteral) Type() AstType {
+	return AstTypeNumberLiteral
+}
+
+// IntValue 字面量是整数并且放得进 int64 的时候返回精确的整数值
+func (nl NumberLiteral) IntValue() (int64, bool) {
+	v, ok := nl.BigValue()
+	if !ok || !v.IsInt64() {
+		return 0, false
+	}
+	return v.Int64(), true
+}
+
+// BigValue 字面量是整数的时候返回精确的整数值，不限大小
+// 有 Raw 就按源码判断：带小数点或者指数的是小数
+// 没有 Raw（手写或者改写出来的节点）就看 Value 是不是整数
+func (nl NumberLiteral) BigValue() (*big.Int, bool) {
+	if nl.Raw == "" {
+		if nl.Value != math.Trunc(nl.Value) || math.IsInf(nl.Value, 0) {
+			return nil, false
+		}
+		v, _ := big.NewFloat(nl.Value).Int(nil)
+		return v, true
+	}
+	return parseInteger(numberText(nl.Raw))
+}
+
+// IsBigInt 带 n 后缀的整数，比如 123n，不管大小都是大整数
+func (nl NumberLiteral) IsBigInt() bool {
+	return strings.HasSuffix(nl.Raw, "n")
+}
+
+// 去掉分隔符 _ 和大整数后缀 n
+func numberText(raw string) string {
+	return strings.TrimSuffix(strings.ReplaceAll(raw, "_", ""), "n")
+}
+
+// parseInteger 按整数解析去掉 _ 和 n 的字面量，带小数点或者指数的返回 false
+// 0x 0o 0b 按前缀的进制，别的都是十进制，不限大小
+func parseInteger(text string) (*big.Int, bool) {
+	if isPrefixedNumber(text) {
+		return new(big.Int).SetString(text, 0)
+	}
+	if strings.ContainsAny(text, ".eE") {
+		return nil, false
+	}
+	return new(big.Int).SetString(text, 10)
+}
+
+// 0x 0o 0b 开头的整数
+func isPrefixedNumber(text string) bool {
+	return len(text) > 1 && text[0] == '0' && strings.ContainsAny(text[1:2], "xXoObB")
 }
 
 // StringLiteral节点结构
@@ -51,8 +108,8 @@ type StringLiteral struct {
 }
 
 // 实现Node接口的Type方法
-func (sl StringLiteral) Type() string {
-	return "StringLiteral"
+func (sl StringLiteral) Type() AstType {
+	return AstTypeStringLiteral
 }
 
 // NullLiteral节点结构
@@ -60,32 +117,34 @@ type NullLiteral struct {
 }
 
 // 实现Node接口的Type方法
-func (nl NullLiteral) Type() string {
-	return "NullLiteral"
+func (nl NullLiteral) Type() AstType {
+	return AstTypeNullLiteral
 }
 
 // VariableDeclaration节点结构
 type VariableDeclaration struct {
-	Kind  string `json:"kind"`  // kind属性
-	Name  Node   `json:"name"`  // name属性
-	Value Node   `json:"value"` // value属性
+	Kind  string `json:"kind"`          // kind属性
+	Name  Node   `json:"name"`          // name属性
+	Value Node   `json:"value"`         // value属性
+	Doc   string `json:"doc,omitempty"` // 前面的 /// 文档注释
 }
 
 // 实现Node接口的Type方法
-func (vd VariableDeclaration) Type() string {
-	return "VariableDeclaration"
+func (vd VariableDeclaration) Type() AstType {
+	return AstTypeVariableDeclaration
 }
 
 // ClassDeclaration节点结构
 type ClassVariableDeclaration struct {
-	Kind  string `json:"kind"`  // kind属性
-	Name  Node   `json:"name"`  // name属性
-	Value Node   `json:"value"` // value属性
+	Kind  string `json:"kind"`          // kind属性
+	Name  Node   `json:"name"`          // name属性
+	Value Node   `json:"value"`         // value属性
+	Doc   string `json:"doc,omitempty"` // 前面的 /// 文档注释
 }
 
 // 实现Node接口的Type方法
-func (vd ClassVariableDeclaration) Type() string {
-	return "ClassVariableDeclaration"
+func (vd ClassVariableDeclaration) Type() AstType {
+	return AstTypeClassVariableDeclaration
 }
 
 // AssignmentExpression节点结构
@@ -96,8 +155,8 @@ type AssignmentExpression struct {
 }
 
 // 实现Node接口的Type方法
-func (ae AssignmentExpression) Type() string {
-	return "AssignmentExpression"
+func (ae AssignmentExpression) Type() AstType {
+	return AstTypeAssignmentExpression
 }
 
 // BinaryExpression节点结构
@@ -108,16 +167,16 @@ type BinaryExpression struct {
 }
 
 // 实现Node接口的Type方法
-func (be BinaryExpression) Type() string {
-	return "BinaryExpression"
+func (be BinaryExpression) Type() AstType {
+	return AstTypeBinaryExpression
 }
 
 type BlockStatement struct {
 	Body []Node `json:"body"` // body属性
 }
 
-func (bs BlockStatement) Type() string {
-	return "BlockStatement"
+func (bs BlockStatement) Type() AstType {
+	return AstTypeBlockStatement
 }
 
 type FunctionExpression struct {
@@ -125,30 +184,49 @@ type FunctionExpression struct {
 	Body   Node   `json:"body"`   // body 属性
 }
 
-func (bs FunctionExpression) Type() string {
-	return "FunctionExpression"
+func (bs FunctionExpression) Type() AstType {
+	return AstTypeFunctionExpression
+}
+
+// 带默认值的参数 b = 2
+type DefaultParameter struct {
+	Name  Node `json:"name"`  // name 属性
+	Value Node `json:"value"` // value 属性
+}
+
+func (dp DefaultParameter) Type() AstType {
+	return AstTypeDefaultParameter
+}
+
+// 剩余参数 ...rest，只能是最后一个参数
+type RestParameter struct {
+	Name Node `json:"name"` // name 属性
+}
+
+func (rp RestParameter) Type() AstType {
+	return AstTypeRestParameter
 }
 
 type ReturnStatement struct {
 	Value Node `json:"value"`
 }
 
-func (bs ReturnStatement) Type() string {
-	return "ReturnStatement"
+func (bs ReturnStatement) Type() AstType {
+	return AstTypeReturnStatement
 }
 
 type ContinueStatement struct {
 }
 
-func (bs ContinueStatement) Type() string {
-	return "ContinueStatement"
+func (bs ContinueStatement) Type() AstType {
+	return AstTypeContinueStatement
 }
 
 type BreakStatement struct {
 }
 
-func (bs BreakStatement) Type() string {
-	return "BreakStatement"
+func (bs BreakStatement) Type() AstType {
+	return AstTypeBreakStatement
 }
 
 type UnaryExpression struct {
@@ -156,8 +234,8 @@ type UnaryExpression struct {
 	Value    Node   `json:"value"`    // value 属性
 }
 
-func (ue UnaryExpression) Type() string {
-	return "UnaryExpression"
+func (ue UnaryExpression) Type() AstType {
+	return AstTypeUnaryExpression
 }
 
 // 调用的结点
@@ -166,8 +244,8 @@ type CallExpression struct {
 	Object Node   `json:"object"` // object 属性
 }
 
-func (ce CallExpression) Type() string {
-	return "CallExpression"
+func (ce CallExpression) Type() AstType {
+	return AstTypeCallExpression
 }
 
 // 数组的节点
@@ -175,8 +253,20 @@ type ArrayLiteral struct {
 	Values []Node `json:"values"` // values 属性
 }
 
-func (al ArrayLiteral) Type() string {
-	return "ArrayLiteral"
+func (al ArrayLiteral) Type() AstType {
+	return AstTypeArrayLiteral
+}
+
+// 模板字符串 `a${x}b${y}c`
+// Quasis 是字符串部分 ["a", "b", "c"]，Expressions 是 ${} 里的表达式 [x, y]
+// Quasis 总是比 Expressions 多一个
+type TemplateLiteral struct {
+	Quasis      []string `json:"quasis"`
+	Expressions []Node   `json:"expressions"`
+}
+
+func (tl TemplateLiteral) Type() AstType {
+	return AstTypeTemplateLiteral
 }
 
 type PropertyAssignment struct {
@@ -184,16 +274,16 @@ type PropertyAssignment struct {
 	Value Node `json:"value"` // value
 }
 
-func (pa PropertyAssignment) Type() string {
-	return "PropertyAssignment"
+func (pa PropertyAssignment) Type() AstType {
+	return AstTypePropertyAssignment
 }
 
 type DictLiteral struct {
 	Values []Node `json:"values"` // key
 }
 
-func (dl DictLiteral) Type() string {
-	return "DictLiteral"
+func (dl DictLiteral) Type() AstType {
+	return AstTypeDictLiteral
 }
 
 type IfStatement struct {
@@ -202,8 +292,8 @@ type IfStatement struct {
 	Alternate  Node `json:"alternate"`  // alternate属性
 }
 
-func (is IfStatement) Type() string {
-	return "IfStatement"
+func (is IfStatement) Type() AstType {
+	return AstTypeIfStatement
 }
 
 type ForStatement struct {
@@ -213,8 +303,8 @@ type ForStatement struct {
 	Body   Node `json:"body"`   // body属性
 }
 
-func (fs ForStatement) Type() string {
-	return "ForStatement"
+func (fs ForStatement) Type() AstType {
+	return AstTypeForStatement
 }
 
 type WhileStatement struct {
@@ -222,33 +312,34 @@ type WhileStatement struct {
 	Body      Node `json:"body"`      // body属性
 }
 
-func (w WhileStatement) Type() string {
-	return "WhileStatement"
+func (w WhileStatement) Type() AstType {
+	return AstTypeWhileStatement
 }
 
 type ClassBodyStatement struct {
 	Body []Node `json:"body"` // body属性
 }
 
-func (cb ClassBodyStatement) Type() string {
-	return "ClassBodyStatement"
+func (cb ClassBodyStatement) Type() AstType {
+	return AstTypeClassBodyStatement
 }
 
 type ClassExpression struct {
-	Name       Node `json:"name"`       // name属性
-	SuperClass Node `json:"superClass"` // superClass属性
-	Body       Node `json:"body"`       // body属性
+	Name       Node   `json:"name"`          // name属性
+	SuperClass Node   `json:"superClass"`    // superClass属性
+	Body       Node   `json:"body"`          // body属性
+	Doc        string `json:"doc,omitempty"` // 前面的 /// 文档注释
 }
 
-func (cb ClassExpression) Type() string {
-	return "ClassExpression"
+func (cb ClassExpression) Type() AstType {
+	return AstTypeClassExpression
 }
 
 type ClassLiteral struct {
 }
 
-func (cb ClassLiteral) Type() string {
-	return "ClassLiteral"
+func (cb ClassLiteral) Type() AstType {
+	return AstTypeClassLiteral
 }
 
 type MemberExpression struct {
@@ -257,8 +348,8 @@ type MemberExpression struct {
 	ElementType string `json:"elementType"` // elementType属性，用于区分点语法和数组语法
 }
 
-func (cb MemberExpression) Type() string {
-	return "MemberExpression"
+func (cb MemberExpression) Type() AstType {
+	return AstTypeMemberExpression
 }
 
 // 为了做兼容
@@ -266,6 +357,6 @@ type ExpressionStatement struct {
 	Exp Node `json:"exp"` // exp 包一层，方便打印
 }
 
-func (e ExpressionStatement) Type() string {
-	return "ExpressionStatement"
+func (e ExpressionStatement) Type() AstType {
+	return AstTypeExpressionStatement
 }
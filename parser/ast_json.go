@@ -0,0 +1,313 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// AST 的 JSON 格式
+//
+// 每个节点都是一个对象，"type" 是节点种类的名字（AstType.Name()），
+// 其余字段就是节点结构体上 json tag 对应的字段，例如
+//
+//	{"type":"VariableDeclaration","kind":"var",
+//	 "name":{"type":"Identifier","value":"a"},
+//	 "value":{"type":"NumberLiteral","value":1}}
+//
+// 子节点字段是节点对象或 null，子节点列表是节点对象数组
+// 没有字段的节点（break、continue 等）只有 "type"
+// MarshalJSON 输出的字段顺序固定，UnmarshalProgram / UnmarshalNode 可以把它读回来
+
+func marshalNode(t AstType, v interface{}) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	head := fmt.Sprintf(`{"type":%q`, t.Name())
+	if bytes.Equal(data, []byte("{}")) {
+		return []byte(head + "}"), nil
+	}
+	return append([]byte(head+","), data[1:]...), nil
+}
+
+func (p Program) MarshalJSON() ([]byte, error) {
+	type alias Program
+	return marshalNode(p.Type(), alias(p))
+}
+
+func (i Identifier) MarshalJSON() ([]byte, error) {
+	type alias Identifier
+	return marshalNode(i.Type(), alias(i))
+}
+
+func (bl BooleanLiteral) MarshalJSON() ([]byte, error) {
+	type alias BooleanLiteral
+	return marshalNode(bl.Type(), alias(bl))
+}
+
+func (nl NumberLiteral) MarshalJSON() ([]byte, error) {
+	type alias NumberLiteral
+	return marshalNode(nl.Type(), alias(nl))
+}
+
+func (sl StringLiteral) MarshalJSON() ([]byte, error) {
+	type alias StringLiteral
+	return marshalNode(sl.Type(), alias(sl))
+}
+
+func (nl NullLiteral) MarshalJSON() ([]byte, error) {
+	type alias NullLiteral
+	return marshalNode(nl.Type(), alias(nl))
+}
+
+func (vd VariableDeclaration) MarshalJSON() ([]byte, error) {
+	type alias VariableDeclaration
+	return marshalNode(vd.Type(), alias(vd))
+}
+
+func (vd ClassVariableDeclaration) MarshalJSON() ([]byte, error) {
+	type alias ClassVariableDeclaration
+	return marshalNode(vd.Type(), alias(vd))
+}
+
+func (ae AssignmentExpression) MarshalJSON() ([]byte, error) {
+	type alias AssignmentExpression
+	return marshalNode(ae.Type(), alias(ae))
+}
+
+func (be BinaryExpression) MarshalJSON() ([]byte, error) {
+	type alias BinaryExpression
+	return marshalNode(be.Type(), alias(be))
+}
+
+func (bs BlockStatement) MarshalJSON() ([]byte, error) {
+	type alias BlockStatement
+	return marshalNode(bs.Type(), alias(bs))
+}
+
+func (bs FunctionExpression) MarshalJSON() ([]byte, error) {
+	type alias FunctionExpression
+	return marshalNode(bs.Type(), alias(bs))
+}
+
+func (bs ReturnStatement) MarshalJSON() ([]byte, error) {
+	type alias ReturnStatement
+	return marshalNode(bs.Type(), alias(bs))
+}
+
+func (bs ContinueStatement) MarshalJSON() ([]byte, error) {
+	type alias ContinueStatement
+	return marshalNode(bs.Type(), alias(bs))
+}
+
+func (bs BreakStatement) MarshalJSON() ([]byte, error) {
+	type alias BreakStatement
+	return marshalNode(bs.Type(), alias(bs))
+}
+
+func (ue UnaryExpression) MarshalJSON() ([]byte, error) {
+	type alias UnaryExpression
+	return marshalNode(ue.Type(), alias(ue))
+}
+
+func (ce CallExpression) MarshalJSON() ([]byte, error) {
+	type alias CallExpression
+	return marshalNode(ce.Type(), alias(ce))
+}
+
+func (al ArrayLiteral) MarshalJSON() ([]byte, error) {
+	type alias ArrayLiteral
+	return marshalNode(al.Type(), alias(al))
+}
+
+func (tl TemplateLiteral) MarshalJSON() ([]byte, error) {
+	type alias TemplateLiteral
+	return marshalNode(tl.Type(), alias(tl))
+}
+
+func (pa PropertyAssignment) MarshalJSON() ([]byte, error) {
+	type alias PropertyAssignment
+	return marshalNode(pa.Type(), alias(pa))
+}
+
+func (dl DictLiteral) MarshalJSON() ([]byte, error) {
+	type alias DictLiteral
+	return marshalNode(dl.Type(), alias(dl))
+}
+
+func (is IfStatement) MarshalJSON() ([]byte, error) {
+	type alias IfStatement
+	return marshalNode(is.Type(), alias(is))
+}
+
+func (fs ForStatement) MarshalJSON() ([]byte, error) {
+	type alias ForStatement
+	return marshalNode(fs.Type(), alias(fs))
+}
+
+func (w WhileStatement) MarshalJSON() ([]byte, error) {
+	type alias WhileStatement
+	return marshalNode(w.Type(), alias(w))
+}
+
+func (cb ClassBodyStatement) MarshalJSON() ([]byte, error) {
+	type alias ClassBodyStatement
+	return marshalNode(cb.Type(), alias(cb))
+}
+
+func (cb ClassExpression) MarshalJSON() ([]byte, error) {
+	type alias ClassExpression
+	return marshalNode(cb.Type(), alias(cb))
+}
+
+func (cb ClassLiteral) MarshalJSON() ([]byte, error) {
+	type alias ClassLiteral
+	return marshalNode(cb.Type(), alias(cb))
+}
+
+func (dp DefaultParameter) MarshalJSON() ([]byte, error) {
+	type alias DefaultParameter
+	return marshalNode(dp.Type(), alias(dp))
+}
+
+func (rp RestParameter) MarshalJSON() ([]byte, error) {
+	type alias RestParameter
+	return marshalNode(rp.Type(), alias(rp))
+}
+
+func (cb MemberExpression) MarshalJSON() ([]byte, error) {
+	type alias MemberExpression
+	return marshalNode(cb.Type(), alias(cb))
+}
+
+func (e ExpressionStatement) MarshalJSON() ([]byte, error) {
+	type alias ExpressionStatement
+	return marshalNode(e.Type(), alias(e))
+}
+
+// type 的名字 -> 节点的 go 类型
+var nodeGoTypes = map[string]reflect.Type{
+	AstTypeProgram.Name():                  reflect.TypeOf(Program{}),
+	AstTypeBlockStatement.Name():           reflect.TypeOf(BlockStatement{}),
+	AstTypeVariableDeclaration.Name():      reflect.TypeOf(VariableDeclaration{}),
+	AstTypeNumberLiteral.Name():            reflect.TypeOf(NumberLiteral{}),
+	AstTypeNullLiteral.Name():              reflect.TypeOf(NullLiteral{}),
+	AstTypeIdentifier.Name():               reflect.TypeOf(Identifier{}),
+	AstTypeStringLiteral.Name():            reflect.TypeOf(StringLiteral{}),
+	AstTypeBooleanLiteral.Name():           reflect.TypeOf(BooleanLiteral{}),
+	AstTypeAssignmentExpression.Name():     reflect.TypeOf(AssignmentExpression{}),
+	AstTypeBinaryExpression.Name():         reflect.TypeOf(BinaryExpression{}),
+	AstTypeFunctionExpression.Name():       reflect.TypeOf(FunctionExpression{}),
+	AstTypeArrayLiteral.Name():             reflect.TypeOf(ArrayLiteral{}),
+	AstTypeDictLiteral.Name():              reflect.TypeOf(DictLiteral{}),
+	AstTypePropertyAssignment.Name():       reflect.TypeOf(PropertyAssignment{}),
+	AstTypeUnaryExpression.Name():          reflect.TypeOf(UnaryExpression{}),
+	AstTypeMemberExpression.Name():         reflect.TypeOf(MemberExpression{}),
+	AstTypeIfStatement.Name():              reflect.TypeOf(IfStatement{}),
+	AstTypeWhileStatement.Name():           reflect.TypeOf(WhileStatement{}),
+	AstTypeForStatement.Name():             reflect.TypeOf(ForStatement{}),
+	AstTypeClassExpression.Name():          reflect.TypeOf(ClassExpression{}),
+	AstTypeClassBodyStatement.Name():       reflect.TypeOf(ClassBodyStatement{}),
+	AstTypeClassVariableDeclaration.Name(): reflect.TypeOf(ClassVariableDeclaration{}),
+	AstTypeReturnStatement.Name():          reflect.TypeOf(ReturnStatement{}),
+	AstTypeBreakStatement.Name():           reflect.TypeOf(BreakStatement{}),
+	AstTypeContinueStatement.Name():        reflect.TypeOf(ContinueStatement{}),
+	AstTypeCallExpression.Name():           reflect.TypeOf(CallExpression{}),
+	AstTypeClassLiteral.Name():             reflect.TypeOf(ClassLiteral{}),
+	AstTypeDefaultParameter.Name():         reflect.TypeOf(DefaultParameter{}),
+	AstTypeRestParameter.Name():            reflect.TypeOf(RestParameter{}),
+	AstTypeExpressionStatement.Name():      reflect.TypeOf(ExpressionStatement{}),
+	AstTypeTemplateLiteral.Name():          reflect.TypeOf(TemplateLiteral{}),
+}
+
+var (
+	nodeInterfaceType = reflect.TypeOf((*Node)(nil)).Elem()
+	nodeSliceType     = reflect.TypeOf([]Node{})
+)
+
+// UnmarshalProgram 把 MarshalJSON 输出的 JSON 读回成 Program
+func UnmarshalProgram(data []byte) (Program, error) {
+	node, err := UnmarshalNode(data)
+	if err != nil {
+		return Program{}, err
+	}
+	program, ok := node.(Program)
+	if !ok {
+		return Program{}, fmt.Errorf("want Program, got %v", node.Type())
+	}
+	return program, nil
+}
+
+// UnmarshalNode 根据 "type" 把 JSON 读回成对应的节点，null 返回 nil
+func UnmarshalNode(data []byte) (Node, error) {
+	if bytes.Equal(bytes.TrimSpace(data), []byte("null")) {
+		return nil, nil
+	}
+
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	rawType, ok := fields["type"]
+	if !ok {
+		return nil, fmt.Errorf("node has no type: %s", data)
+	}
+	var name string
+	if err := json.Unmarshal(rawType, &name); err != nil {
+		return nil, fmt.Errorf("invalid node type %s", rawType)
+	}
+	goType, ok := nodeGoTypes[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown node type %q", name)
+	}
+
+	node := reflect.New(goType).Elem()
+	for i := 0; i < goType.NumField(); i++ {
+		field := goType.Field(i)
+		key, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		raw, ok := fields[key]
+		if !ok {
+			continue
+		}
+		if err := unmarshalField(node.Field(i), raw); err != nil {
+			return nil, fmt.Errorf("%s.%s: %v", name, field.Name, err)
+		}
+	}
+	return node.Interface().(Node), nil
+}
+
+func unmarshalField(field reflect.Value, raw json.RawMessage) error {
+	switch field.Type() {
+	case nodeInterfaceType:
+		child, err := UnmarshalNode(raw)
+		if err != nil {
+			return err
+		}
+		if child != nil {
+			field.Set(reflect.ValueOf(child))
+		}
+	case nodeSliceType:
+		items := []json.RawMessage{}
+		if err := json.Unmarshal(raw, &items); err != nil {
+			return err
+		}
+		if items == nil {
+			return nil
+		}
+		children := make([]Node, 0, len(items))
+		for _, item := range items {
+			child, err := UnmarshalNode(item)
+			if err != nil {
+				return err
+			}
+			children = append(children, child)
+		}
+		field.Set(reflect.ValueOf(children))
+	default:
+		return json.Unmarshal(raw, field.Addr().Interface())
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package parser
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestJsonRoundTrip(t *testing.T) {
+	ast := parseCode(`
+		var a = 1
+		const b = "s"
+		var c = [true, null, -a]
+		var d = {"k": 1}
+		var e = {}
+		var f = function(x) {
+			for(var i = 1; i <= 10; i += 1) {
+				if(i == 1){
+					continue
+				} else {
+					break
+				}
+			}
+			while(not true){
+				x = x + 1
+			}
+			return x
+		}
+		/// 文档注释
+		var g = function(x, y = 2, ...z) { return z }
+		` + "var h = `a${b}c${-a}`" + `
+		f(a)
+		class A super B {
+			const cls.age = 1
+			const new = function() {
+				this.name = d["k"]
+			}
+		}
+	`)
+
+	data, err := json.Marshal(ast)
+	if err != nil {
+		t.Fatalf("marshal failed: %v", err)
+	}
+	if !strings.HasPrefix(string(data), `{"type":"Program","body":[{"type":"VariableDeclaration"`) {
+		t.Errorf("missing type discriminator: %s", data[:80])
+	}
+
+	program, err := UnmarshalProgram(data)
+	if err != nil {
+		t.Fatalf("UnmarshalProgram failed: %v", err)
+	}
+	if !reflect.DeepEqual(ast, program) {
+		t.Errorf("round trip changed the ast.\nwant=%+v\ngot=%+v", ast, program)
+	}
+
+	again, _ := json.Marshal(program)
+	if string(again) != string(data) {
+		t.Errorf("json not stable.\nwant=%s\ngot=%s", data, again)
+	}
+}
+
+func TestJsonLeafNodes(t *testing.T) {
+	data, _ := json.Marshal(BreakStatement{})
+	if string(data) != `{"type":"BreakStatement"}` {
+		t.Errorf("wrong json for BreakStatement: %s", data)
+	}
+
+	node, err := UnmarshalNode([]byte(`{"type":"Identifier","value":"a"}`))
+	if err != nil || node != (Identifier{Value: "a"}) {
+		t.Errorf("wrong node %+v err %v", node, err)
+	}
+}
+
+func TestJsonErrors(t *testing.T) {
+	tests := []string{
+		`{"value":"a"}`,
+		`{"type":"Nope"}`,
+		`{"type":"Program","body":[{"type":"Nope"}]}`,
+		`[]`,
+	}
+	for _, tt := range tests {
+		if _, err := UnmarshalNode([]byte(tt)); err == nil {
+			t.Errorf("expected error for %s", tt)
+		}
+	}
+
+	if _, err := UnmarshalProgram([]byte(`{"type":"Identifier","value":"a"}`)); err == nil {
+		t.Errorf("expected error for non Program root")
+	}
+}
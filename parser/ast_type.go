@@ -9,6 +9,8 @@ type AstType struct {
 
 var (
 	AstTypes = []AstType{}
+	// value -> AstType，校验的时候不用每次线性扫描
+	astTypeByValue = map[int64]AstType{}
 
 	// AstType
 	AstTypeProgram        = newAstType("Program", 1)
@@ -56,14 +58,23 @@ var (
 	AstTypeContinueStatement = newAstType("ContinueStatement", 25)
 	// CallExpression
 	AstTypeCallExpression = newAstType("CallExpression", 26)
+	// ClassLiteral
+	AstTypeClassLiteral = newAstType("ClassLiteral", 27)
+	// 默认参数 b = 2
+	AstTypeDefaultParameter = newAstType("DefaultParameter", 28)
+	// 剩余参数 ...rest
+	AstTypeRestParameter = newAstType("RestParameter", 29)
 
 	// ExpressionStatement
 	AstTypeExpressionStatement = newAstType("ExpressionStatement", 30)
+	// 模板字符串 `a${x}b`
+	AstTypeTemplateLiteral = newAstType("TemplateLiteral", 31)
 )
 
 func newAstType(name string, value int64) AstType {
 	o := AstType{name: name, value: value}
 	AstTypes = append(AstTypes, o)
+	astTypeByValue[value] = o
 	return o
 }
 
@@ -72,12 +83,8 @@ func AstTypeAll() []AstType {
 }
 
 func (t AstType) valid() bool {
-	for _, v := range AstTypeAll() {
-		if v == t {
-			return true
-		}
-	}
-	return false
+	v, ok := astTypeByValue[t.value]
+	return ok && v == t
 }
 
 func (t AstType) Value() int64 {
@@ -103,3 +110,8 @@ func (t AstType) NamePtr() *string {
 	n := t.Name()
 	return &n
 }
+
+// String 让 AstType 打印出来的是名字，日志和 %v 都能直接用
+func (t AstType) String() string {
+	return t.name
+}
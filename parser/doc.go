@@ -0,0 +1,134 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DocItem sans doc 输出的一项
+type DocItem struct {
+	Kind      string // function、class、method、field
+	Name      string // 类的成员带上类名，比如 A.new
+	Signature string // add(a, b = 1, ...rest)、class A super(B)、static A.age
+	Doc       string // /// 文档注释，没有就是空的
+}
+
+// ExtractDocs 找出顶层的函数和类，类的成员跟在类后面，按源码的顺序
+// 没写文档注释的也会列出来
+func ExtractDocs(program Program) []DocItem {
+	items := []DocItem{}
+	for _, statement := range program.Body {
+		switch n := statement.(type) {
+		case VariableDeclaration:
+			fn, ok := n.Value.(FunctionExpression)
+			name, ok2 := n.Name.(Identifier)
+			if ok && ok2 {
+				items = append(items, DocItem{
+					Kind:      "function",
+					Name:      name.Value,
+					Signature: name.Value + docParams(fn.Params),
+					Doc:       n.Doc,
+				})
+			}
+		case ExpressionStatement:
+			if class, ok := n.Exp.(ClassExpression); ok {
+				items = append(items, classDocs(class)...)
+			}
+		}
+	}
+	return items
+}
+
+func classDocs(class ClassExpression) []DocItem {
+	name, ok := class.Name.(Identifier)
+	if !ok {
+		return nil
+	}
+	signature := "class " + name.Value
+	if super, ok := class.SuperClass.(Identifier); ok {
+		signature += fmt.Sprintf(" super(%s)", super.Value)
+	}
+	items := []DocItem{{Kind: "class", Name: name.Value, Signature: signature, Doc: class.Doc}}
+
+	body, ok := class.Body.(ClassBodyStatement)
+	if !ok {
+		return items
+	}
+	for _, statement := range body.Body {
+		member, ok := statement.(ClassVariableDeclaration)
+		if !ok {
+			continue
+		}
+		// const new = ...、var this.x = ...、const cls.x = ...
+		memberName := ""
+		static := false
+		switch n := member.Name.(type) {
+		case Identifier:
+			memberName = n.Value
+		case MemberExpression:
+			object, ok1 := n.Object.(Identifier)
+			property, ok2 := n.Property.(Identifier)
+			if !ok1 || !ok2 {
+				continue
+			}
+			memberName = property.Value
+			static = object.Value == "cls"
+		default:
+			continue
+		}
+
+		item := DocItem{Kind: "field", Name: name.Value + "." + memberName, Doc: member.Doc}
+		item.Signature = item.Name
+		if fn, ok := member.Value.(FunctionExpression); ok {
+			item.Kind = "method"
+			item.Signature += docParams(fn.Params)
+		}
+		if static {
+			item.Signature = "static " + item.Signature
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+// (a, b = 1, ...rest)，默认值不是简单的字面量就写成 ...
+func docParams(params []Node) string {
+	ss := []string{}
+	for _, param := range params {
+		switch p := param.(type) {
+		case Identifier:
+			ss = append(ss, p.Value)
+		case DefaultParameter:
+			ss = append(ss, fmt.Sprintf("%s = %s", docParamName(p.Name), docDefaultValue(p.Value)))
+		case RestParameter:
+			ss = append(ss, "..."+docParamName(p.Name))
+		}
+	}
+	return "(" + strings.Join(ss, ", ") + ")"
+}
+
+func docParamName(node Node) string {
+	if id, ok := node.(Identifier); ok {
+		return id.Value
+	}
+	return "?"
+}
+
+func docDefaultValue(node Node) string {
+	switch n := node.(type) {
+	case NumberLiteral:
+		if n.Raw != "" {
+			return n.Raw
+		}
+		return fmt.Sprintf("%v", n.Value)
+	case StringLiteral:
+		return fmt.Sprintf("%q", n.Value)
+	case BooleanLiteral:
+		return fmt.Sprintf("%v", n.Value)
+	case NullLiteral:
+		return "null"
+	case Identifier:
+		return n.Value
+	}
+	return "..."
+}
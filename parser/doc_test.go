@@ -0,0 +1,46 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExtractDocs(t *testing.T) {
+	ast := parseCode(`
+		/// 两个数相加
+		///
+		/// 返回 a + b
+		var add = function(a, b = 1, ...rest) {
+			return a + b
+		}
+
+		// 普通注释不算
+		var sub = function(a, b) { return a - b }
+
+		var notFunction = 1
+
+		/// 动物
+		class Animal super(Base) {
+			/// 腿的数量
+			const cls.legs = 4
+			/// 构造函数
+			const new = function(name, sound = "...") {
+				this.name = name
+			}
+			var this.speak = function() {}
+		}
+	`)
+
+	expected := []DocItem{
+		{"function", "add", "add(a, b = 1, ...rest)", "两个数相加\n\n返回 a + b"},
+		{"function", "sub", "sub(a, b)", ""},
+		{"class", "Animal", "class Animal super(Base)", "动物"},
+		{"field", "Animal.legs", "static Animal.legs", "腿的数量"},
+		{"method", "Animal.new", `Animal.new(name, sound = "...")`, "构造函数"},
+		{"method", "Animal.speak", "Animal.speak()", ""},
+	}
+	got := ExtractDocs(ast)
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("ExtractDocs wrong.\ngot=%+v\nwant=%+v", got, expected)
+	}
+}
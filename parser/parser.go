@@ -5,16 +5,33 @@ import (
 	"fmt"
 	sansLexer "go-compiler/lexer"
 	"go-compiler/utils"
+	"math"
+	"math/big"
 	"strconv"
+	"strings"
 )
 
 type BaseParser struct {
-	lexer    *sansLexer.TokenList
+	lexer sansLexer.TokenStream
+	// 已经用掉的 token 个数
 	Position int
-	Cache    []sansLexer.Token
+	// 读了还没用掉的 token，parser 不回溯，用掉的就不留了
+	Cache []sansLexer.Token
+	// 语法错误，解析完以后可以统一看
+	Errors []*ParseError
 }
 
-func NewBaseParser(lexer *sansLexer.TokenList) *BaseParser {
+// ParseError 语法错误，带上出错的位置
+type ParseError struct {
+	Pos sansLexer.Position
+	Msg string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%d:%d: %s", e.Pos.Line, e.Pos.Column, e.Msg)
+}
+
+func NewBaseParser(lexer sansLexer.TokenStream) *BaseParser {
 	return &BaseParser{
 		lexer:    lexer,
 		Position: 0,
@@ -23,26 +40,19 @@ func NewBaseParser(lexer *sansLexer.TokenList) *BaseParser {
 }
 
 func (this *BaseParser) Current() sansLexer.Token {
-	if len(this.Cache) == this.Position {
+	if len(this.Cache) == 0 {
 		this.Cache = append(this.Cache, this.lexer.NextToken())
 	}
-	return this.Cache[this.Position]
+	return this.Cache[0]
 }
 
 func (this *BaseParser) Next() sansLexer.Token {
 	c := this.Current()
+	this.Cache = this.Cache[1:]
 	this.Position += 1
 	return c
 }
 
-func (this *BaseParser) Mark() int {
-	return this.Position
-}
-
-func (this *BaseParser) Reset(pos int) {
-	this.Position = pos
-}
-
 func (this *BaseParser) Expect(TokenType sansLexer.TokenType) bool {
 	c := this.Current()
 	return c.Type == TokenType
@@ -57,28 +67,59 @@ func (this *BaseParser) Match(TokenType sansLexer.TokenType) sansLexer.Token {
 	}
 }
 
+// errorAt 记一条语法错误
+func (this *BaseParser) errorAt(pos sansLexer.Position, msg string) {
+	this.Errors = append(this.Errors, &ParseError{Pos: pos, Msg: msg})
+}
+
+// unexpected 当前 token 解析不下去了
+func (this *BaseParser) unexpected() {
+	c := this.Current()
+	if c.Type == sansLexer.TokenTypeEof {
+		this.errorAt(c.Pos, "unexpected end of input")
+		return
+	}
+	this.errorAt(c.Pos, fmt.Sprintf("unexpected token %q", c.Value))
+}
+
+// debugf 解析过程的调试输出，utils.Verbose 关掉时不打印
+func debugf(format string, args ...interface{}) {
+	if utils.Verbose {
+		fmt.Printf(format, args...)
+	}
+}
+
 type SansLangParser struct {
 	BaseParser
 }
 
-func NewSansLangParser(lexer *sansLexer.TokenList) *SansLangParser {
+func NewSansLangParser(lexer sansLexer.TokenStream) *SansLangParser {
 	return &SansLangParser{BaseParser: *NewBaseParser(lexer)}
 }
 
+// Parse 不管语法错误，出错的地方后面的语句会丢掉，错误留在 Errors 里
+// 要知道有没有出错用 ParseProgram
 func (this *SansLangParser) Parse() Program {
+	programAst, _ := this.ParseProgram()
+	return programAst
+}
+
+// ParseProgram 解析整个程序，有语法错误的时候返回第一个
+func (this *SansLangParser) ParseProgram() (Program, error) {
 	programAst := this.astParseProgram()
-	fmt.Printf("programAst %+v\n", programAst)
-	eofToken := this.Match(sansLexer.TokenTypeEof)
-	if !eofToken.Nil() {
-		fmt.Errorf("Parse error current:%v pos:%v", this.Current(), this.Position)
+	debugf("programAst %+v\n", programAst)
+	if utils.Verbose {
+		// 将节点转换为JSON字符串
+		jsonData, err := json.MarshalIndent(programAst, "", "    ")
+		if err != nil {
+			fmt.Println("转换为JSON时出错:", err)
+		}
+		utils.LogInfo("jsonData", string(jsonData))
 	}
-	// 将节点转换为JSON字符串
-	jsonData, err := json.MarshalIndent(programAst, "", "    ")
-	if err != nil {
-		fmt.Println("转换为JSON时出错:", err)
+	if len(this.Errors) > 0 {
+		return programAst, this.Errors[0]
 	}
-	utils.LogInfo("jsonData", string(jsonData))
-	return programAst
+	return programAst, nil
 }
 
 func (this *SansLangParser) astParseProgram() Program {
@@ -92,13 +133,14 @@ func (this *SansLangParser) astParseProgram() Program {
 
 func (this *SansLangParser) astParseStatements() []Node {
 	body := []Node{}
-	fmt.Printf("astParseStatements %v\n", this.Current())
+	debugf("astParseStatements %v\n", this.Current())
 	for this.Current().Type != sansLexer.TokenTypeEof {
 		subAst := this.astParseStatement()
-		fmt.Printf("astParseStatements subAst %+v this.Current():%v\n", subAst, this.Current())
+		debugf("astParseStatements subAst %+v this.Current():%v\n", subAst, this.Current())
 		if subAst != nil {
 			body = append(body, subAst)
 		} else {
+			this.unexpected()
 			break
 		}
 	}
@@ -106,7 +148,7 @@ func (this *SansLangParser) astParseStatements() []Node {
 }
 
 func (this *SansLangParser) astParseVariableDeclaration() Node {
-	fmt.Printf("astParseVariableDeclaration %v \n", this.Current())
+	debugf("astParseVariableDeclaration %v \n", this.Current())
 	if this.Expect(sansLexer.TokenTypeVar) || this.Expect(sansLexer.TokenTypeConst) {
 		op := this.Next()
 		id := this.astParseCallMemberExpression()
@@ -115,7 +157,7 @@ func (this *SansLangParser) astParseVariableDeclaration() Node {
 			if !assign.Error() {
 				exp := this.astParseExpression()
 				if exp != nil {
-					return VariableDeclaration{Kind: op.Value, Name: id, Value: exp}
+					return VariableDeclaration{Kind: op.Value, Name: id, Value: exp, Doc: op.Doc()}
 				}
 			}
 		}
@@ -126,7 +168,6 @@ func (this *SansLangParser) astParseVariableDeclaration() Node {
 func (this *SansLangParser) astParseStatement() Node {
 	// statement ->
 	//              | variableDeclaration
-	//              | blockStatement
 	//              | expressionStatement
 	//              | returnStatement
 	//              | ifStatement
@@ -134,56 +175,25 @@ func (this *SansLangParser) astParseStatement() Node {
 	//              | forStatement
 	//              | breakStatement
 	//              | continueStatement
-	mark := this.Mark()
-	ast := this.astParseVariableDeclaration()
-	if ast != nil {
-		return ast
-	}
-	this.Reset(mark)
-
-	ast = this.astParseExpressionStatement()
-	if ast != nil {
-		return ast
-	}
-	this.Reset(mark)
-
-	ast = this.astParseReturnStatement()
-	if ast != nil {
-		return ast
-	}
-	this.Reset(mark)
-
-	ast = this.astParseIfStatement()
-	if ast != nil {
-		return ast
-	}
-	this.Reset(mark)
-
-	ast = this.astParseWhileStatement()
-	if ast != nil {
-		return ast
-	}
-	this.Reset(mark)
-
-	ast = this.astParseForStatement()
-	if ast != nil {
-		return ast
-	}
-	this.Reset(mark)
-
-	ast = this.astParseBreakStatement()
-	if ast != nil {
-		return ast
+	// 只看当前 token 决定走哪条规则，不回溯
+	switch this.Current().Type {
+	case sansLexer.TokenTypeVar, sansLexer.TokenTypeConst:
+		return this.astParseVariableDeclaration()
+	case sansLexer.TokenTypeReturn:
+		return this.astParseReturnStatement()
+	case sansLexer.TokenTypeIf:
+		return this.astParseIfStatement()
+	case sansLexer.TokenTypeWhile:
+		return this.astParseWhileStatement()
+	case sansLexer.TokenTypeFor:
+		return this.astParseForStatement()
+	case sansLexer.TokenTypeBreak:
+		return this.astParseBreakStatement()
+	case sansLexer.TokenTypeContinue:
+		return this.astParseContinueStatement()
+	default:
+		return this.astParseExpressionStatement()
 	}
-	this.Reset(mark)
-
-	ast = this.astParseContinueStatement()
-	if ast != nil {
-		return ast
-	}
-	this.Reset(mark)
-
-	return nil
 }
 
 func (this *SansLangParser) astParseDictKey() Node {
@@ -220,30 +230,31 @@ func (this *SansLangParser) astParseAssignment() Node {
 
 func (this *SansLangParser) astParseClassExpression() Node {
 	// classExpression: 'class' identifier super ('(' identifier? ')') classBodyStatement
-	mark := this.Mark()
+	// 'class' 后面不是 identifier 的时候是 ClassLiteral，见 astParseFactor
 	classToken := this.Match(sansLexer.TokenTypeClass)
-	if !classToken.Error() {
-		id := this.astParseIdentifier()
-		if id != nil {
-			var superClass Node
-			if this.Expect(sansLexer.TokenTypeSuper) {
-				superToken := this.Match(sansLexer.TokenTypeSuper)
-				if !superToken.Error() {
-					this.Match(sansLexer.TokenTypeLParen)
-					superClass = this.astParseIdentifier()
-					this.Match(sansLexer.TokenTypeRParen)
-				}
-			}
-			body := this.astParseClassBody()
-			return ClassExpression{
-				Name:       id,
-				SuperClass: superClass,
-				Body:       body,
-			}
+	if classToken.Error() {
+		return nil
+	}
+	id := this.astParseIdentifier()
+	if id == nil {
+		return ClassLiteral{}
+	}
+	var superClass Node
+	if this.Expect(sansLexer.TokenTypeSuper) {
+		superToken := this.Match(sansLexer.TokenTypeSuper)
+		if !superToken.Error() {
+			this.Match(sansLexer.TokenTypeLParen)
+			superClass = this.astParseIdentifier()
+			this.Match(sansLexer.TokenTypeRParen)
 		}
 	}
-	this.Reset(mark)
-	return nil
+	body := this.astParseClassBody()
+	return ClassExpression{
+		Name:       id,
+		SuperClass: superClass,
+		Body:       body,
+		Doc:        classToken.Doc(),
+	}
 }
 
 func (this *SansLangParser) astParseClassBody() Node {
@@ -260,13 +271,14 @@ func (this *SansLangParser) astParseClassBody() Node {
 func (this *SansLangParser) astParseClassBodyStatements() []Node {
 	// 处理不同的函数定义
 	body := []Node{}
-	fmt.Printf("astParseClassBodyStatements %v\n", this.Current())
+	debugf("astParseClassBodyStatements %v\n", this.Current())
 	for this.Current().Type != sansLexer.TokenTypeRBrace {
 		subAst := this.astParseClassBodyStatement()
-		fmt.Printf("astParseClassBodyStatements subAst %+v this.Current():%v\n", subAst, this.Current())
+		debugf("astParseClassBodyStatements subAst %+v this.Current():%v\n", subAst, this.Current())
 		if subAst != nil {
 			body = append(body, subAst)
 		} else {
+			this.unexpected()
 			break
 		}
 	}
@@ -277,36 +289,27 @@ func (this *SansLangParser) astParseClassBodyStatements() []Node {
 }
 
 func (this *SansLangParser) astParseClassBodyStatement() Node {
-	mark := this.Mark()
-	ast := this.astParseClassVariableDeclaration()
-	if ast != nil {
-		return ast
-	}
-	this.Reset(mark)
-
-	ast = this.astParseClassExpressionStatement()
-	if ast != nil {
-		return ast
+	if this.Expect(sansLexer.TokenTypeConst) || this.Expect(sansLexer.TokenTypeVar) {
+		return this.astParseClassVariableDeclaration()
 	}
-	this.Reset(mark)
-	return nil
+	return this.astParseClassExpressionStatement()
 }
 
 func (this *SansLangParser) astParseClassVariableDeclaration() Node {
-	fmt.Printf("astParseClassVariableDeclaration %v \n", this.Current())
+	debugf("astParseClassVariableDeclaration %v \n", this.Current())
 	// const this.age = 1
 	// const cls.age = 1
 	// const cls.new = function(){}
 	// const new = function() {}
 	if this.Expect(sansLexer.TokenTypeConst) || this.Expect(sansLexer.TokenTypeVar) {
 		op := this.Next()
-		id := this.astParseCallClassMemberExpression()
+		id := this.astParseCallMemberExpression()
 		if id != nil {
 			assign := this.Match(sansLexer.TokenTypeAssign)
 			if !assign.Error() {
 				exp := this.astParseExpression()
 				if exp != nil {
-					return ClassVariableDeclaration{Kind: op.Value, Name: id, Value: exp}
+					return ClassVariableDeclaration{Kind: op.Value, Name: id, Value: exp, Doc: op.Doc()}
 				}
 			}
 		}
@@ -315,10 +318,10 @@ func (this *SansLangParser) astParseClassVariableDeclaration() Node {
 }
 
 func (this *SansLangParser) astParseClassExpressionStatement() Node {
-	fmt.Printf("astParseClassExpressionStatement %v \n", this.Current())
+	debugf("astParseClassExpressionStatement %v \n", this.Current())
 	exp := this.astParseExpression()
 	if exp != nil {
-		fmt.Printf("astParseExpressionStatement %v\n", exp)
+		debugf("astParseExpressionStatement %v\n", exp)
 		return exp
 	}
 	return nil
@@ -330,10 +333,11 @@ func (this *SansLangParser) astParseForBlockStatement() Node {
 		body := []Node{}
 		for this.Current().Type != sansLexer.TokenTypeRBrace {
 			subAst := this.astParseStatement()
-			fmt.Printf("astParseBlockStatement subAst %+v this.Current:%v\n", subAst, this.Current())
+			debugf("astParseBlockStatement subAst %+v this.Current:%v\n", subAst, this.Current())
 			if subAst != nil {
 				body = append(body, subAst)
 			} else {
+				this.unexpected()
 				break
 			}
 		}
@@ -349,10 +353,11 @@ func (this *SansLangParser) astParseBlockStatement() Node {
 		body := []Node{}
 		for this.Current().Type != sansLexer.TokenTypeRBrace {
 			subAst := this.astParseStatement()
-			fmt.Printf("astParseBlockStatement subAst %+v this.Current:%v\n", subAst, this.Current())
+			debugf("astParseBlockStatement subAst %+v this.Current:%v\n", subAst, this.Current())
 			if subAst != nil {
 				body = append(body, subAst)
 			} else {
+				this.unexpected()
 				break
 			}
 		}
@@ -363,7 +368,7 @@ func (this *SansLangParser) astParseBlockStatement() Node {
 }
 
 func (this *SansLangParser) astParseContinueStatement() Node {
-	fmt.Printf("astParseContinueStatement %v\n", this.Current())
+	debugf("astParseContinueStatement %v\n", this.Current())
 	continueToken := this.Match(sansLexer.TokenTypeContinue)
 	if !continueToken.Error() {
 		return ContinueStatement{}
@@ -372,7 +377,7 @@ func (this *SansLangParser) astParseContinueStatement() Node {
 }
 
 func (this *SansLangParser) astParseBreakStatement() Node {
-	fmt.Printf("astParseBreakStatement %v\n", this.Current())
+	debugf("astParseBreakStatement %v\n", this.Current())
 	breakToken := this.Match(sansLexer.TokenTypeBreak)
 	if !breakToken.Error() {
 		return BreakStatement{}
@@ -381,7 +386,7 @@ func (this *SansLangParser) astParseBreakStatement() Node {
 }
 
 func (this *SansLangParser) astParseReturnStatement() Node {
-	fmt.Printf("astParseReturnStatement %v\n", this.Current())
+	debugf("astParseReturnStatement %v\n", this.Current())
 	returnToken := this.Match(sansLexer.TokenTypeReturn)
 	if !returnToken.Error() {
 		if this.Expect(sansLexer.TokenTypeRBrace) {
@@ -448,9 +453,11 @@ func (this *SansLangParser) astParseForStatement() Node {
 	if this.Expect(sansLexer.TokenTypeFor) {
 		this.Match(sansLexer.TokenTypeFor)
 		this.Match(sansLexer.TokenTypeLParen)
-		init := this.astParseExpressionStatement()
-		if init == nil {
+		var init Node
+		if this.Expect(sansLexer.TokenTypeVar) || this.Expect(sansLexer.TokenTypeConst) {
 			init = this.astParseVariableDeclaration()
+		} else if !this.Expect(sansLexer.TokenTypeSemi) {
+			init = this.astParseExpressionStatement()
 		}
 		semi := this.Match(sansLexer.TokenTypeSemi)
 		if !semi.Error() {
@@ -482,7 +489,7 @@ func (this *SansLangParser) astParseFunctionExpression() Node {
 		if !lparenToken.Error() {
 			params = this.astParseFormalParameterList()
 			rparenToken := this.Match(sansLexer.TokenTypeRParen)
-			if !rparenToken.Error() {
+			if params != nil && !rparenToken.Error() {
 				body := this.astParseBlockStatement()
 				if body != nil {
 					return FunctionExpression{Params: params, Body: body}
@@ -494,417 +501,263 @@ func (this *SansLangParser) astParseFunctionExpression() Node {
 }
 
 func (this *SansLangParser) astParseFormalParameterList() []Node {
-	// formalParameterList -> (id ',')*
-	// TODO: 默认参数
+	// formalParameterList -> (id ('=' expression)? ',')* ('...' id)?
 	params := []Node{}
 	for this.Expect(sansLexer.TokenTypeId) {
-		id := this.astParseIdentifier()
-		params = append(params, id)
-		if this.Expect(sansLexer.TokenTypeComma) {
-			this.Match(sansLexer.TokenTypeComma)
-		} else {
-			break
+		var param Node = this.astParseIdentifier()
+		if this.Expect(sansLexer.TokenTypeAssign) {
+			this.Match(sansLexer.TokenTypeAssign)
+			value := this.astParseExpression()
+			if value == nil {
+				return nil
+			}
+			param = DefaultParameter{Name: param, Value: value}
+		}
+		params = append(params, param)
+		if !this.Expect(sansLexer.TokenTypeComma) {
+			return params
 		}
+		this.Match(sansLexer.TokenTypeComma)
+	}
+	// 剩余参数只能放在最后，后面再有参数的话右括号会匹配失败
+	if this.Expect(sansLexer.TokenTypeEllipsis) {
+		this.Match(sansLexer.TokenTypeEllipsis)
+		if !this.Expect(sansLexer.TokenTypeId) {
+			return nil
+		}
+		params = append(params, RestParameter{Name: this.astParseIdentifier()})
 	}
 	return params
 }
 
 func (this *SansLangParser) astParseArgsWithParen() []Node {
-	// todo 支持默认参数
-	// ()
+	// '(' (expression (',' expression)* ','?)? ')'
 	args := []Node{}
-	if this.Expect(sansLexer.TokenTypeLParen) {
-		this.Match(sansLexer.TokenTypeLParen)
-		// 只支持 number , string , 变量
-		for this.Expect(sansLexer.TokenTypeNumeric) || this.Expect(sansLexer.TokenTypeId) || this.Expect(sansLexer.TokenTypeString) || this.Expect(sansLexer.TokenTypeLBracket) || this.Expect(sansLexer.TokenTypeLBrace) || this.Expect(sansLexer.TokenTypeBoolean) || this.Expect(sansLexer.TokenTypeNull) {
-			arg := this.astParseLiteral()
-			// 字面量
-			if arg != nil {
-				args = append(args, arg)
-			}
-
-			utils.LogInfo("in astParseArgsWithParen", arg, this.Current())
-			// ,
-			t := this.Match(sansLexer.TokenTypeComma)
-			if t.Error() {
-				break
-			}
+	if !this.Expect(sansLexer.TokenTypeLParen) {
+		return nil
+	}
+	this.Match(sansLexer.TokenTypeLParen)
+	for !this.Expect(sansLexer.TokenTypeRParen) {
+		// 参数可以是任意表达式，包括函数调用和函数字面量
+		arg := this.astParseExpression()
+		if arg == nil {
+			return nil
 		}
-		t := this.Match(sansLexer.TokenTypeRParen)
-		if !t.Error() {
-			return args
+		args = append(args, arg)
+		// 没有 , 说明参数结束了，允许 f(a, b,) 这样的尾逗号
+		if !this.Expect(sansLexer.TokenTypeComma) {
+			break
 		}
+		this.Match(sansLexer.TokenTypeComma)
 	}
-	return nil
+	t := this.Match(sansLexer.TokenTypeRParen)
+	if t.Error() {
+		return nil
+	}
+	return args
 }
 
 func (this *SansLangParser) astParseCallMemberExpression() Node {
-	// factor arguments callMemberExpressionTail
-	// factor '.' identifier callMemberExpressionTail;
-	// factor '[' expression ']' callMemberExpressionTail
+	// factor callMemberExpressionTail
 	subAst := this.astParseFactor()
-	mark := this.Mark()
 	if subAst != nil {
-		args := this.astParseArgsWithParen()
-		if args != nil {
-			n := CallExpression{Object: subAst, Args: args}
-			node := this.astParseCallMemberExpressionTail(n)
-			return node
-		}
-		// 点语法
-		if this.Expect(sansLexer.TokenTypeDot) {
-			this.Match(sansLexer.TokenTypeDot)
-			prop := this.astParseIdentifier()
-			if prop != nil {
-				node := MemberExpression{
-					Object:      subAst,
-					Property:    prop,
-					ElementType: "dot",
-				}
-				return this.astParseCallMemberExpressionTail(node)
-			}
-		}
-		this.Reset(mark)
-		// 数组
-		if this.Expect(sansLexer.TokenTypeLBracket) {
-			this.Match(sansLexer.TokenTypeLBracket)
-			prop := this.astParseExpression()
-			if prop != nil {
-				this.Match(sansLexer.TokenTypeRBracket)
-				node := MemberExpression{
-					Object:      subAst,
-					Property:    prop,
-					ElementType: "array_dict",
-				}
-				return this.astParseCallMemberExpressionTail(node)
-			}
-		}
+		return this.astParseCallMemberExpressionTail(subAst)
 	}
-	this.Reset(mark)
-	return subAst
+	return nil
 }
 
 func (this *SansLangParser) astParseCallMemberExpressionTail(node Node) Node {
-	// arguments callMemberExpressionTail
-	// （'.' identifier callMemberExpressionTail）*
-	// '[' expression ']' callMemberExpressionTail *
-	// 处理函数调用
-	mark := this.Mark()
-	args := this.astParseArgsWithParen()
-	if args != nil {
-		node = CallExpression{Object: node, Args: args}
-		return this.astParseCallMemberExpressionTail(node)
-	}
-	// 处理点语法
-	if this.Expect(sansLexer.TokenTypeDot) {
-		this.Match(sansLexer.TokenTypeDot)
-		prop := this.astParseIdentifier()
-		if prop != nil {
-			node = MemberExpression{
-				Object:      node,
-				Property:    prop,
-				ElementType: "dot",
-			}
-			return this.astParseCallMemberExpressionTail(node)
-		}
-	}
-	this.Reset(mark)
-	// 处理数组
-	if this.Expect(sansLexer.TokenTypeLBracket) {
-		this.Match(sansLexer.TokenTypeLBracket)
-		prop := this.astParseExpression()
-		if prop != nil {
-			this.Match(sansLexer.TokenTypeRBracket)
-			node = MemberExpression{
-				Object:      node,
-				Property:    prop,
-				ElementType: "array_dict",
-			}
-			return this.astParseCallMemberExpressionTail(node)
+	// （arguments | '.' identifier | '[' expression ']'）*
+	for node != nil {
+		if _, ok := postfixOperators[this.Current().Type]; !ok {
+			break
 		}
+		node = this.astParsePostfixExpression(node)
 	}
-	this.Reset(mark)
-	fmt.Printf("astParseCallMemberTail %v\n", this.Current())
+	debugf("astParseCallMemberTail %v\n", this.Current())
 	return node
 }
 
-// Class
-func (this *SansLangParser) astParseCallClassMemberExpression() Node {
-	// factor arguments callMemberExpressionTail
-	// factor '.' identifier callMemberExpressionTail;
-	// factor '[' expression ']' callMemberExpressionTail
-	subAst := this.astParseFactor()
-	mark := this.Mark()
-	if subAst != nil {
+// 后缀运算：调用、点语法、数组下标，当前 token 必须是后缀运算符，解析失败返回 nil
+func (this *SansLangParser) astParsePostfixExpression(node Node) Node {
+	switch this.Current().Type {
+	// 处理函数调用
+	case sansLexer.TokenTypeLParen:
 		args := this.astParseArgsWithParen()
 		if args != nil {
-			n := CallExpression{Object: subAst, Args: args}
-			node := this.astParseCallClassMemberExpressionTail(n)
-			return node
+			return CallExpression{Object: node, Args: args}
 		}
-		// 点语法
-		if this.Expect(sansLexer.TokenTypeDot) {
-			this.Match(sansLexer.TokenTypeDot)
-			prop := this.astParseIdentifier()
-			if prop != nil {
-				node := MemberExpression{
-					Object:      subAst,
-					Property:    prop,
-					ElementType: "dot",
-				}
-				return this.astParseCallClassMemberExpressionTail(node)
-			}
-		}
-		this.Reset(mark)
-		// 数组
-		if this.Expect(sansLexer.TokenTypeLBracket) {
-			this.Match(sansLexer.TokenTypeLBracket)
-			prop := this.astParseExpression()
-			if prop != nil {
-				this.Match(sansLexer.TokenTypeRBracket)
-				node := MemberExpression{
-					Object:      subAst,
-					Property:    prop,
-					ElementType: "array_dict",
-				}
-				return this.astParseCallClassMemberExpressionTail(node)
-			}
-		}
-	}
-	this.Reset(mark)
-	return subAst
-}
-
-func (this *SansLangParser) astParseCallClassMemberExpressionTail(node Node) Node {
-	// arguments callMemberExpressionTail
-	// （'.' identifier callMemberExpressionTail）*
-	// '[' expression ']' callMemberExpressionTail *
-	// 处理函数调用
-	mark := this.Mark()
-	args := this.astParseArgsWithParen()
-	if args != nil {
-		node = CallExpression{Object: node, Args: args}
-		return this.astParseCallMemberExpressionTail(node)
-	}
 	// 处理点语法
-	if this.Expect(sansLexer.TokenTypeDot) {
+	case sansLexer.TokenTypeDot:
 		this.Match(sansLexer.TokenTypeDot)
 		prop := this.astParseIdentifier()
 		if prop != nil {
-			node = MemberExpression{
+			return MemberExpression{
 				Object:      node,
 				Property:    prop,
 				ElementType: "dot",
 			}
-			return this.astParseCallMemberExpressionTail(node)
 		}
-	}
-	this.Reset(mark)
 	// 处理数组、object 调用
-	if this.Expect(sansLexer.TokenTypeLBracket) {
+	case sansLexer.TokenTypeLBracket:
 		this.Match(sansLexer.TokenTypeLBracket)
 		prop := this.astParseExpression()
 		if prop != nil {
-			this.Match(sansLexer.TokenTypeRBracket)
-			node = MemberExpression{
-				Object:      node,
-				Property:    prop,
-				ElementType: "array_dict",
+			rb := this.Match(sansLexer.TokenTypeRBracket)
+			if !rb.Error() {
+				return MemberExpression{
+					Object:      node,
+					Property:    prop,
+					ElementType: "array_dict",
+				}
 			}
-			return this.astParseCallMemberExpressionTail(node)
 		}
 	}
-	this.Reset(mark)
-	fmt.Printf("astParseCallMemberTail %v\n", this.Current())
-	return node
+	return nil
 }
 
-// not or -
-func (this *SansLangParser) astParseNotExpression() Node {
-	if this.Expect(sansLexer.TokenTypeNot) {
-		notValue := this.Match(sansLexer.TokenTypeNot)
-		if !notValue.Error() {
-			rightAst := this.astParseCallMemberExpression()
-			if rightAst != nil {
-				return UnaryExpression{Value: rightAst, Operator: notValue.Value}
-			}
-		}
-	} else if this.Expect(sansLexer.TokenTypeMinus) {
-		minusValue := this.Match(sansLexer.TokenTypeMinus)
-		if !minusValue.Error() {
-			rightAst := this.astParseCallMemberExpression()
-			if rightAst != nil {
-				return UnaryExpression{Value: rightAst, Operator: minusValue.Value}
-			}
-		}
-	}
-	leftAst := this.astParseCallMemberExpression()
-	return leftAst
-}
+// 运算符的绑定力，越大结合得越紧
+const (
+	powerLowest  = 0
+	powerAssign  = 10 // = += -= *= /=，右结合
+	powerOr      = 20 // or
+	powerAnd     = 30 // and
+	powerEquals  = 40 // == !=
+	powerCompare = 50 // < <= > >=
+	powerAddSub  = 60 // + -
+	powerMulDiv  = 70 // * / %
+	powerPrefix  = 80 // not -
+	powerPostfix = 90 // 调用 . []
+)
 
-// * /
-func (this *SansLangParser) astParseMulDivExpression() Node {
-	leftAst := this.astParseNotExpression()
-	if leftAst != nil {
-		for this.Expect(sansLexer.TokenTypeMul) || this.Expect(sansLexer.TokenTypeDiv) || this.Expect(sansLexer.TokenTypeMod) {
-			op := this.Current()
-			this.Next()
-			rightAst := this.astParseNotExpression()
-			if rightAst != nil {
-				leftAst = BinaryExpression{Left: leftAst, Operator: op.Value, Right: rightAst}
-			} else {
-				break
-			}
-		}
+type infixOperator struct {
+	power      int
+	rightAssoc bool
+	// 用运算符 token 和左右两边生成节点
+	build func(op sansLexer.Token, left Node, right Node) Node
+}
+
+func buildBinaryExpression(op sansLexer.Token, left Node, right Node) Node {
+	return BinaryExpression{Left: left, Operator: op.Value, Right: right}
+}
+
+func buildAssignmentExpression(op sansLexer.Token, left Node, right Node) Node {
+	return AssignmentExpression{Left: left, Operator: op.Value, Right: right}
+}
+
+var (
+	// 中缀运算符表，+= 这类复合赋值还是生成 BinaryExpression
+	infixOperators = map[sansLexer.TokenType]infixOperator{
+		sansLexer.TokenTypeAssign:            {powerAssign, true, buildAssignmentExpression},
+		sansLexer.TokenTypePlusAssign:        {powerAssign, true, buildBinaryExpression},
+		sansLexer.TokenTypeMinusAssign:       {powerAssign, true, buildBinaryExpression},
+		sansLexer.TokenTypeMulAssign:         {powerAssign, true, buildBinaryExpression},
+		sansLexer.TokenTypeDivAssign:         {powerAssign, true, buildBinaryExpression},
+		sansLexer.TokenTypeOr:                {powerOr, false, buildBinaryExpression},
+		sansLexer.TokenTypeAnd:               {powerAnd, false, buildBinaryExpression},
+		sansLexer.TokenTypeEquals:            {powerEquals, false, buildBinaryExpression},
+		sansLexer.TokenTypeNotEquals:         {powerEquals, false, buildBinaryExpression},
+		sansLexer.TokenTypeLessThan:          {powerCompare, false, buildBinaryExpression},
+		sansLexer.TokenTypeLessThanEquals:    {powerCompare, false, buildBinaryExpression},
+		sansLexer.TokenTypeGreaterThan:       {powerCompare, false, buildBinaryExpression},
+		sansLexer.TokenTypeGreaterThanEquals: {powerCompare, false, buildBinaryExpression},
+		sansLexer.TokenTypePlus:              {powerAddSub, false, buildBinaryExpression},
+		sansLexer.TokenTypeMinus:             {powerAddSub, false, buildBinaryExpression},
+		sansLexer.TokenTypeMul:               {powerMulDiv, false, buildBinaryExpression},
+		sansLexer.TokenTypeDiv:               {powerMulDiv, false, buildBinaryExpression},
+		sansLexer.TokenTypeMod:               {powerMulDiv, false, buildBinaryExpression},
+	}
+	// 前缀运算符表，生成 UnaryExpression
+	prefixOperators = map[sansLexer.TokenType]int{
+		sansLexer.TokenTypeNot:   powerPrefix,
+		sansLexer.TokenTypeMinus: powerPrefix,
+	}
+	// 后缀运算符表，具体怎么解析见 astParsePostfixExpression
+	postfixOperators = map[sansLexer.TokenType]int{
+		sansLexer.TokenTypeLParen:   powerPostfix,
+		sansLexer.TokenTypeDot:      powerPostfix,
+		sansLexer.TokenTypeLBracket: powerPostfix,
 	}
-	fmt.Printf("astParseMulDivExpression %v\n", leftAst)
-	return leftAst
-}
+)
 
-// + -
-func (this *SansLangParser) astParseAddSubExpression() Node {
-	// 处理左值，如果左值有，才会继续往下走，否则直接返回 null
-	// 这样是因为有可能处理到类似 a + 1 而不是 a * 1 的情况，
-	// 如果是 a + 1, 就直接返回 a 就好了
-	leftAst := this.astParseMulDivExpression()
-	if leftAst != nil {
-		for this.Expect(sansLexer.TokenTypePlus) || this.Expect(sansLexer.TokenTypeMinus) {
-			op := this.Current()
-			this.Next()
-			rightAst := this.astParseMulDivExpression()
-			if rightAst != nil {
-				leftAst = BinaryExpression{Left: leftAst, Operator: op.Value, Right: rightAst}
-			} else {
-				break
-			}
-		}
+// Pratt 解析，只吃掉绑定力不小于 minPower 的运算符
+func (this *SansLangParser) astParseExpressionWithPower(minPower int) Node {
+	leftAst := this.astParsePrefixExpression()
+	if leftAst == nil {
+		return nil
 	}
-	fmt.Printf("astParseAddSubExpression %v\n", leftAst)
-	return leftAst
-}
-
-// < <= > >=
-func (this *SansLangParser) astParseCompareExpression() Node {
-	leftAst := this.astParseAddSubExpression()
-	if leftAst != nil {
-		for this.Expect(sansLexer.TokenTypeLessThan) || this.Expect(sansLexer.TokenTypeGreaterThan) || this.Expect(sansLexer.TokenTypeLessThanEquals) || this.Expect(sansLexer.TokenTypeGreaterThanEquals) {
-			op := this.Current()
-			this.Next()
-			rightAst := this.astParseAddSubExpression()
-			if rightAst != nil {
-				leftAst = BinaryExpression{Left: leftAst, Operator: op.Value, Right: rightAst}
-			} else {
-				break
+	for {
+		op := this.Current()
+		if power, ok := postfixOperators[op.Type]; ok && power >= minPower {
+			leftAst = this.astParsePostfixExpression(leftAst)
+			if leftAst == nil {
+				return nil
 			}
+			continue
 		}
-	}
-	fmt.Printf("astParseCompareExpression %v\n", leftAst)
-	return leftAst
-}
 
-func (this *SansLangParser) astParseEqualsAndNotEqualExpression() Node {
-	leftAst := this.astParseCompareExpression()
-	if leftAst != nil {
-		for this.Expect(sansLexer.TokenTypeNotEquals) || this.Expect(sansLexer.TokenTypeEquals) {
-			op := this.Current()
-			this.Next()
-			rightAst := this.astParseCompareExpression()
-			if rightAst != nil {
-				leftAst = BinaryExpression{Left: leftAst, Operator: op.Value, Right: rightAst}
-			} else {
-				break
-			}
+		infix, ok := infixOperators[op.Type]
+		if !ok || infix.power < minPower {
+			break
 		}
-	}
-	fmt.Printf("astParseEqualsAndNotEqualExpression %v\n", leftAst)
-	return leftAst
-}
-
-func (this *SansLangParser) astParseAndOrExpression() Node {
-	leftAst := this.astParseEqualsAndNotEqualExpression()
-	if leftAst != nil {
-		for this.Expect(sansLexer.TokenTypeAnd) || this.Expect(sansLexer.TokenTypeOr) {
-			op := this.Current()
-			this.Next()
-			rightAst := this.astParseEqualsAndNotEqualExpression()
-			if rightAst != nil {
-				leftAst = BinaryExpression{Left: leftAst, Operator: op.Value, Right: rightAst}
-			} else {
-				break
-			}
+		this.Next()
+		// 左结合的右边只能吃更紧的运算符，右结合的可以吃同级的
+		rightPower := infix.power + 1
+		if infix.rightAssoc {
+			rightPower = infix.power
 		}
-	}
-	fmt.Printf("astParseAndOrExpression %v\n", leftAst)
-	return leftAst
-}
-
-func (this *SansLangParser) astParseAssignmentExpression() Node {
-	leftAst := this.astParseAndOrExpression()
-	if leftAst != nil {
-		op := this.Current()
-		if this.Expect(sansLexer.TokenTypeAssign) {
-			this.Next()
-			rightAst := this.astParseAndOrExpression()
-			if rightAst != nil {
-				return AssignmentExpression{Left: leftAst, Operator: op.Value, Right: rightAst}
-			}
+		rightAst := this.astParseExpressionWithPower(rightPower)
+		if rightAst == nil {
+			return nil
 		}
+		leftAst = infix.build(op, leftAst, rightAst)
 	}
-	fmt.Printf("astParseAssignmentExpression %v\n", leftAst)
+	debugf("astParseExpressionWithPower %v %v\n", minPower, leftAst)
 	return leftAst
 }
 
-func (this *SansLangParser) astParseAssignExpression() Node {
-	leftAst := this.astParseAssignmentExpression()
-	if leftAst != nil {
-		op := this.Current()
-		if this.Expect(sansLexer.TokenTypePlusAssign) || this.Expect(sansLexer.TokenTypeMinusAssign) || this.Expect(sansLexer.TokenTypeMulAssign) || this.Expect(sansLexer.TokenTypeDivAssign) {
-			this.Next()
-			rightAst := this.astParseAssignmentExpression()
-			if rightAst != nil {
-				return BinaryExpression{Left: leftAst, Operator: op.Value, Right: rightAst}
-			}
+// not or -
+func (this *SansLangParser) astParsePrefixExpression() Node {
+	op := this.Current()
+	if power, ok := prefixOperators[op.Type]; ok {
+		this.Next()
+		rightAst := this.astParseExpressionWithPower(power)
+		if rightAst != nil {
+			return UnaryExpression{Value: rightAst, Operator: op.Value}
 		}
+		return nil
 	}
-	fmt.Printf("astParseAssignExpression %v\n", leftAst)
-	return leftAst
+	return this.astParseFactor()
 }
 
 func (this *SansLangParser) astParseExpressionStatement() Node {
 	exp := this.astParseExpression()
 	if exp != nil {
-		fmt.Printf("astParseExpressionStatement %v\n", exp)
+		debugf("astParseExpressionStatement %v\n", exp)
 		return ExpressionStatement{Exp: exp}
 	}
 	return nil
 }
 
 func (this *SansLangParser) astParseExpression() Node {
-	// 优先级由高到低
+	// 优先级由低到高，同一行的优先级相同
 	// expression ->
-	// | identifier
-	// | literal
-	// | expression '[' expression ']'
-	// | expression '.' identifier
-	// | expression arguments
-	// | ( '+' | '-' | '!' ) expression
-	// | expression ( '*' | '/' | '%' ) expression
-	// | expression ( '+' | '-' ) expression
-	// | expression ( '<<' | '>>' ) expression
+	// | expression ( '=' | '+=' | '-=' | '*=' | '/=' ) expression    右结合
+	// | expression 'or' expression
+	// | expression 'and' expression
+	// | expression ( '==' | '!=' ) expression
 	// | expression ( '<' | '>' | '<=' | '>=' ) expression
-	// | expression ( '==' | '!=' | '===' | '!==' ) expression
-	// | expression '&' expression
-	// | expression '|' expression
-	// | expression '&&' expression
-	// | expression '||' expression
-	// | assignmentExpression
-	// | expression ( '+=' | '-=' | '*=' | '/=' ) expression
-	// | '(' expression ')'
-	exp := this.astParseAssignExpression()
+	// | expression ( '+' | '-' ) expression
+	// | expression ( '*' | '/' | '%' ) expression
+	// | ( 'not' | '-' ) expression
+	// | expression ( arguments | '.' identifier | '[' expression ']' )
+	// | factor
+	// 运算符表见 infixOperators / prefixOperators / postfixOperators
+	exp := this.astParseExpressionWithPower(powerLowest)
 	if exp != nil {
 		return exp
 	}
-	fmt.Printf("astParseExpression out %v\n", exp)
+	debugf("astParseExpression out %v\n", exp)
 	return nil
 }
 
@@ -920,6 +773,11 @@ func (this *SansLangParser) astParseLiteral() Node {
 		return str
 	}
 
+	template := this.astParseTemplate()
+	if template != nil {
+		return template
+	}
+
 	boolValue := this.astParseBoolean()
 	if boolValue != nil {
 		return boolValue
@@ -938,22 +796,11 @@ func (this *SansLangParser) astParseLiteral() Node {
 	}
 
 	identifier := this.astParseIdentifier()
-	mark := this.Mark()
 	if identifier != nil {
 		// 点语法
 		if this.Expect(sansLexer.TokenTypeDot) {
-			this.Match(sansLexer.TokenTypeDot)
-			prop := this.astParseIdentifier()
-			if prop != nil {
-				node := MemberExpression{
-					Object:      identifier,
-					Property:    prop,
-					ElementType: "dot",
-				}
-				return this.astParseCallMemberExpressionTail(node)
-			}
+			return this.astParseCallMemberExpressionTail(identifier)
 		}
-		this.Reset(mark)
 		return identifier
 	}
 
@@ -1000,43 +847,24 @@ func (this *SansLangParser) astParseFactor() Node {
 	//     | identifier
 	//     | functionExpression
 	//     | classExpression
-	mark := this.Mark()
-	if this.Expect(sansLexer.TokenTypeLParen) {
-		lp := this.Match(sansLexer.TokenTypeLParen)
-		if !lp.Error() {
-			exp := this.astParseExpression()
-			if exp != nil {
-				this.Match(sansLexer.TokenTypeRParen)
+	switch this.Current().Type {
+	case sansLexer.TokenTypeLParen:
+		this.Match(sansLexer.TokenTypeLParen)
+		exp := this.astParseExpression()
+		if exp != nil {
+			rp := this.Match(sansLexer.TokenTypeRParen)
+			if !rp.Error() {
 				return exp
 			}
 		}
+		return nil
+	case sansLexer.TokenTypeFunction:
+		return this.astParseFunctionExpression()
+	case sansLexer.TokenTypeClass:
+		return this.astParseClassExpression()
+	default:
+		return this.astParseLiteral()
 	}
-	this.Reset(mark)
-
-	value := this.astParseLiteral()
-	if value != nil {
-		return value
-	}
-
-	value = this.astParseIdentifier()
-	if value != nil {
-		return value
-	}
-
-	value = this.astParseFunctionExpression()
-	if value != nil {
-		return value
-	}
-	value = this.astParseClassExpression()
-	if value != nil {
-		return value
-	}
-
-	if this.Expect(sansLexer.TokenTypeClass) {
-		this.Match(sansLexer.TokenTypeClass)
-		return ClassLiteral{}
-	}
-	return nil
 }
 
 func (this *SansLangParser) astParseIdentifier() Node {
@@ -1055,15 +883,58 @@ func (this *SansLangParser) astParseString() Node {
 	return nil
 }
 
+// template: templateHead expression (templateMiddle expression)* templateTail
+func (this *SansLangParser) astParseTemplate() Node {
+	if !this.Expect(sansLexer.TokenTypeTemplateHead) {
+		return nil
+	}
+	head := this.Match(sansLexer.TokenTypeTemplateHead)
+	quasis := []string{head.Value}
+	expressions := []Node{}
+	for {
+		exp := this.astParseExpression()
+		if exp == nil {
+			return nil
+		}
+		expressions = append(expressions, exp)
+		if this.Expect(sansLexer.TokenTypeTemplateMiddle) {
+			middle := this.Match(sansLexer.TokenTypeTemplateMiddle)
+			quasis = append(quasis, middle.Value)
+			continue
+		}
+		tail := this.Match(sansLexer.TokenTypeTemplateTail)
+		if tail.Error() {
+			return nil
+		}
+		quasis = append(quasis, tail.Value)
+		return TemplateLiteral{Quasis: quasis, Expressions: expressions}
+	}
+}
+
 func (this *SansLangParser) astParseNumber() Node {
 	if this.Expect(sansLexer.TokenTypeNumeric) {
 		id := this.Match(sansLexer.TokenTypeNumeric)
-		floatValue, err := strconv.ParseFloat(id.Value, 64)
+		// 格式 lexer 已经检查过了，_ 只是分隔符，n 是大整数的后缀
+		text := numberText(id.Value)
+		var floatValue float64
+		var err error
+		if intValue, ok := parseInteger(text); ok {
+			// 整数都按大整数读，精确值看 Raw，Value 只是近似值
+			// 超过 float64 范围的取最大值，不然 JSON 输出不了 Inf
+			floatValue, _ = new(big.Float).SetInt(intValue).Float64()
+			if math.IsInf(floatValue, 0) {
+				floatValue = math.Copysign(math.MaxFloat64, floatValue)
+			}
+		} else if isPrefixedNumber(text) || !strings.ContainsAny(text, ".eE") {
+			err = fmt.Errorf("invalid number %s", id.Value)
+		} else {
+			floatValue, err = strconv.ParseFloat(text, 64)
+		}
 		if err != nil {
-			fmt.Printf("Parse number error: %s\n", err)
+			this.errorAt(id.Pos, err.Error())
 			return nil
 		}
-		return NumberLiteral{Value: floatValue}
+		return NumberLiteral{Value: floatValue, Raw: id.Value}
 	}
 	return nil
 }
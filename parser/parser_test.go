@@ -2,7 +2,11 @@ package parser
 
 import (
 	"fmt"
+	"go-compiler/internal/testutil"
 	sansLexer "go-compiler/lexer"
+	"math"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -250,3 +254,285 @@ func testParser8() {
 
 	fmt.Println("====================== parser end =======================")
 }
+
+// exprString 把表达式加上括号打印出来，方便看结合方式
+func exprString(node Node) string {
+	switch n := node.(type) {
+	case ExpressionStatement:
+		return exprString(n.Exp)
+	case BinaryExpression:
+		return fmt.Sprintf("(%s %s %s)", exprString(n.Left), n.Operator, exprString(n.Right))
+	case AssignmentExpression:
+		return fmt.Sprintf("(%s %s %s)", exprString(n.Left), n.Operator, exprString(n.Right))
+	case UnaryExpression:
+		return fmt.Sprintf("(%s %s)", n.Operator, exprString(n.Value))
+	case MemberExpression:
+		if n.ElementType == "dot" {
+			return fmt.Sprintf("%s.%s", exprString(n.Object), exprString(n.Property))
+		}
+		return fmt.Sprintf("%s[%s]", exprString(n.Object), exprString(n.Property))
+	case CallExpression:
+		args := []string{}
+		for _, arg := range n.Args {
+			args = append(args, exprString(arg))
+		}
+		return fmt.Sprintf("%s(%s)", exprString(n.Object), strings.Join(args, ", "))
+	case Identifier:
+		return n.Value
+	case NumberLiteral:
+		return fmt.Sprintf("%v", n.Value)
+	case TemplateLiteral:
+		s := "`" + n.Quasis[0]
+		for i, exp := range n.Expressions {
+			s += "${" + exprString(exp) + "}" + n.Quasis[i+1]
+		}
+		return s + "`"
+	}
+	return node.Type().Name()
+}
+
+func TestExpressionPrecedence(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"a or b and c", "(a or (b and c))"},
+		{"a and b or c", "((a and b) or c)"},
+		{"a == b or c != d", "((a == b) or (c != d))"},
+		{"a < b == c > d", "((a < b) == (c > d))"},
+		{"1 + 2 * 3 - 4 % 5", "((1 + (2 * 3)) - (4 % 5))"},
+		{"a - b - c", "((a - b) - c)"},
+		{"a / b * c", "((a / b) * c)"},
+		{"-a * b", "((- a) * b)"},
+		{"not a == b", "((not a) == b)"},
+		{"-a.b[c](1)", "(- a.b[c](1))"},
+		{"(a + b) * c", "((a + b) * c)"},
+		{"a = b = c + 1", "(a = (b = (c + 1)))"},
+		{"a += b * 2", "(a += (b * 2))"},
+		{"a.b = c[1] + f(2)", "(a.b = (c[1] + f(2)))"},
+		{"f(a + 1, g(b)(c), -d)", "f((a + 1), g(b)(c), (- d))"},
+		{"f(a, b,)", "f(a, b)"},
+		{"f()", "f()"},
+		{"f(function(x) { return x })", "f(FunctionExpression)"},
+		{"`a${x + 1}b${f(y)}`", "`a${(x + 1)}b${f(y)}`"},
+		{"`${a}` + b", "(`${a}` + b)"},
+		{"`${ `${a}` }`.length", "`${`${a}`}`.length"},
+	}
+
+	for _, tt := range tests {
+		ast := parseCode(tt.input)
+		if len(ast.Body) != 1 {
+			t.Errorf("%s: want 1 statement, got %d", tt.input, len(ast.Body))
+			continue
+		}
+		got := exprString(ast.Body[0])
+		if got != tt.expected {
+			t.Errorf("%s: got=%s, want=%s", tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestNumberLiterals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"123", 123},
+		{"1_000_000", 1000000},
+		{"1.5e-3", 0.0015},
+		{"2E+3", 2000},
+		{"0xFF", 255},
+		{"0xdead_beef", 0xdeadbeef},
+		{"0o17", 15},
+		{"0b1010", 10},
+		{"0x7fff_ffff_ffff_ffff", 0x7fffffffffffffff},
+		{"0x1_0000_0000_0000_0000", 1 << 64},
+		{"123n", 123},
+	}
+
+	for _, tt := range tests {
+		ast := parseCode(tt.input)
+		number, ok := ast.Body[0].(ExpressionStatement).Exp.(NumberLiteral)
+		if !ok {
+			t.Errorf("%s: not a number. got=%+v", tt.input, ast.Body[0])
+			continue
+		}
+		if number.Value != tt.expected {
+			t.Errorf("%s: got=%v, want=%v", tt.input, number.Value, tt.expected)
+		}
+	}
+}
+
+func TestNumberLiteralIntegers(t *testing.T) {
+	tests := []struct {
+		raw    string
+		big    string // 不是整数的时候为空
+		isInt  bool
+		bigInt bool
+	}{
+		{"123", "123", true, false},
+		{"1.0", "", false, false},
+		{"1e3", "", false, false},
+		{"9223372036854775807", "9223372036854775807", true, false},
+		{"9223372036854775808", "9223372036854775808", false, false},
+		{"0xFFFF_FFFF_FFFF_FFFF_FF", "4722366482869645213695", false, false},
+		{"5n", "5", true, true},
+		{"0b11n", "3", true, true},
+	}
+
+	for _, tt := range tests {
+		number := NumberLiteral{Raw: tt.raw}
+		got := ""
+		if v, ok := number.BigValue(); ok {
+			got = v.String()
+		}
+		if got != tt.big {
+			t.Errorf("%s: BigValue=%q, want %q", tt.raw, got, tt.big)
+		}
+		if _, ok := number.IntValue(); ok != tt.isInt {
+			t.Errorf("%s: IntValue ok=%v, want %v", tt.raw, ok, tt.isInt)
+		}
+		if number.IsBigInt() != tt.bigInt {
+			t.Errorf("%s: IsBigInt=%v, want %v", tt.raw, number.IsBigInt(), tt.bigInt)
+		}
+	}
+}
+
+func TestLargeIntegerLiteral(t *testing.T) {
+	// 超过 float64 范围的整数也要按整数读，不能丢掉语句
+	digits := "1" + strings.Repeat("0", 400)
+	for _, raw := range []string{digits, digits + "n", "-" + digits} {
+		lexer := sansLexer.NewSansLangLexer("var a = " + raw + "\nvar b = 1")
+		ast, err := NewSansLangParser(lexer).ParseProgram()
+		if err != nil {
+			t.Fatalf("%s: %v", raw, err)
+		}
+		if len(ast.Body) != 2 {
+			t.Fatalf("%s: parsed %d statements, want 2", raw, len(ast.Body))
+		}
+		value := ast.Body[0].(VariableDeclaration).Value
+		if unary, ok := value.(UnaryExpression); ok {
+			value = unary.Value
+		}
+		number := value.(NumberLiteral)
+		if v, ok := number.BigValue(); !ok || v.String() != digits {
+			t.Errorf("%s: BigValue=%v, want %s", raw, v, digits)
+		}
+		if number.Value != math.MaxFloat64 {
+			t.Errorf("%s: Value=%v, want the largest float64", raw, number.Value)
+		}
+	}
+}
+
+func TestFunctionParameters(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"function() {}", []string{}},
+		{"function(a, b,) {}", []string{"a", "b"}},
+		{"function(a, b = 1 + 2) {}", []string{"a", "b = (1 + 2)"}},
+		{"function(a = 1, ...rest) {}", []string{"a = 1", "...rest"}},
+		{"function(...rest) {}", []string{"...rest"}},
+	}
+
+	for _, tt := range tests {
+		ast := parseCode(tt.input)
+		fn, ok := ast.Body[0].(ExpressionStatement).Exp.(FunctionExpression)
+		if !ok {
+			t.Errorf("%s: not a function. got=%+v", tt.input, ast.Body[0])
+			continue
+		}
+		got := []string{}
+		for _, param := range fn.Params {
+			switch p := param.(type) {
+			case DefaultParameter:
+				got = append(got, exprString(p.Name)+" = "+exprString(p.Value))
+			case RestParameter:
+				got = append(got, "..."+exprString(p.Name))
+			default:
+				got = append(got, exprString(p))
+			}
+		}
+		if strings.Join(got, ", ") != strings.Join(tt.expected, ", ") {
+			t.Errorf("%s: got=%v, want=%v", tt.input, got, tt.expected)
+		}
+	}
+
+	// ...rest 后面不能再有参数
+	for _, input := range []string{"function(...rest, a) {}", "function(... ) {}"} {
+		ast := parseCode(input)
+		for _, node := range ast.Body {
+			if s, ok := node.(ExpressionStatement); ok && s.Exp.Type() == AstTypeFunctionExpression {
+				t.Errorf("%s: should not parse as function", input)
+			}
+		}
+	}
+}
+
+func TestParseFromReader(t *testing.T) {
+	// 一组 3 条顶层语句
+	code, statements := testutil.GenerateProgram(70), 3*70
+	lexer := sansLexer.NewSansLangLexerFromReader(strings.NewReader(code))
+	parser := NewSansLangParser(lexer)
+	ast := parser.Parse()
+	if len(ast.Body) != statements {
+		t.Fatalf("parsed %d statements, want %d", len(ast.Body), statements)
+	}
+	if !reflect.DeepEqual(ast, parseCode(code)) {
+		t.Errorf("parsing from a reader gives a different ast")
+	}
+	// 不回溯，用掉的 token 不留
+	if len(parser.Cache) > 1 {
+		t.Errorf("parser keeps %d tokens", len(parser.Cache))
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		err   string
+	}{
+		{"var a = (1 +", "1:13: unexpected end of input"},
+		{"var a = 1\nlog(a +)", "2:8: unexpected token \")\""},
+		{"if (a > 0) {\nlog(a)\n", "3:1: unexpected end of input"},
+		{"while (true) {\nvar = 1\n}", "2:5: unexpected token \"=\""},
+		{"class A {\nconst = 1\n}", "2:7: unexpected token \"=\""},
+		{"var a = 1\nlog(a)", ""},
+	}
+
+	for _, tt := range tests {
+		lexer := sansLexer.NewSansLangLexer(tt.input)
+		parser := NewSansLangParser(lexer)
+		_, err := parser.ParseProgram()
+		got := ""
+		if err != nil {
+			got = err.Error()
+		}
+		if got != tt.err {
+			t.Errorf("%q: err=%q, want %q", tt.input, got, tt.err)
+		}
+	}
+}
+
+func BenchmarkParse(b *testing.B) {
+	for _, lines := range []int{1000, 4000, 16000} {
+		code, statements := testutil.GenerateProgram(lines/3), lines/3*3
+		lexer := sansLexer.SansLangLexer{}
+		lexer.Code = code
+		tokens := lexer.TokenList()
+
+		b.Run(fmt.Sprintf("lines=%d", lines), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				tokensLexer := sansLexer.TokenList{
+					Tokens: tokens,
+				}
+				parser := NewSansLangParser(&tokensLexer)
+				ast := parser.Parse()
+				if len(ast.Body) != statements {
+					b.Fatalf("parsed %d statements, want %d", len(ast.Body), statements)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,513 @@
+package parser
+
+import "fmt"
+
+// Visitor 按节点种类注册的回调
+// 没有注册回调的节点种类交给 Default，Default 也没有就直接往子节点走
+// 回调返回 false 表示不再访问这个节点的子节点
+type Visitor struct {
+	Program                  func(node Program) bool
+	BlockStatement           func(node BlockStatement) bool
+	ExpressionStatement      func(node ExpressionStatement) bool
+	VariableDeclaration      func(node VariableDeclaration) bool
+	ClassVariableDeclaration func(node ClassVariableDeclaration) bool
+	Identifier               func(node Identifier) bool
+	NumberLiteral            func(node NumberLiteral) bool
+	StringLiteral            func(node StringLiteral) bool
+	BooleanLiteral           func(node BooleanLiteral) bool
+	NullLiteral              func(node NullLiteral) bool
+	ArrayLiteral             func(node ArrayLiteral) bool
+	TemplateLiteral          func(node TemplateLiteral) bool
+	DictLiteral              func(node DictLiteral) bool
+	PropertyAssignment       func(node PropertyAssignment) bool
+	AssignmentExpression     func(node AssignmentExpression) bool
+	BinaryExpression         func(node BinaryExpression) bool
+	UnaryExpression          func(node UnaryExpression) bool
+	FunctionExpression       func(node FunctionExpression) bool
+	DefaultParameter         func(node DefaultParameter) bool
+	RestParameter            func(node RestParameter) bool
+	CallExpression           func(node CallExpression) bool
+	MemberExpression         func(node MemberExpression) bool
+	ReturnStatement          func(node ReturnStatement) bool
+	BreakStatement           func(node BreakStatement) bool
+	ContinueStatement        func(node ContinueStatement) bool
+	IfStatement              func(node IfStatement) bool
+	WhileStatement           func(node WhileStatement) bool
+	ForStatement             func(node ForStatement) bool
+	ClassExpression          func(node ClassExpression) bool
+	ClassBodyStatement       func(node ClassBodyStatement) bool
+	ClassLiteral             func(node ClassLiteral) bool
+	Default                  func(node Node) bool
+}
+
+// Walk 深度优先遍历，先访问父节点再访问子节点
+// 语义检查的语句遍历用的是 Walk，表达式求类型、stack 的 AST 编译器要靠返回值，还是各自递归
+func Walk(node Node, v *Visitor) {
+	if node == nil {
+		return
+	}
+	if !v.visit(node) {
+		return
+	}
+	for _, child := range Children(node) {
+		Walk(child, v)
+	}
+}
+
+func (v *Visitor) visit(node Node) bool {
+	switch n := node.(type) {
+	case Program:
+		if v.Program != nil {
+			return v.Program(n)
+		}
+	case BlockStatement:
+		if v.BlockStatement != nil {
+			return v.BlockStatement(n)
+		}
+	case ExpressionStatement:
+		if v.ExpressionStatement != nil {
+			return v.ExpressionStatement(n)
+		}
+	case VariableDeclaration:
+		if v.VariableDeclaration != nil {
+			return v.VariableDeclaration(n)
+		}
+	case ClassVariableDeclaration:
+		if v.ClassVariableDeclaration != nil {
+			return v.ClassVariableDeclaration(n)
+		}
+	case Identifier:
+		if v.Identifier != nil {
+			return v.Identifier(n)
+		}
+	case NumberLiteral:
+		if v.NumberLiteral != nil {
+			return v.NumberLiteral(n)
+		}
+	case StringLiteral:
+		if v.StringLiteral != nil {
+			return v.StringLiteral(n)
+		}
+	case BooleanLiteral:
+		if v.BooleanLiteral != nil {
+			return v.BooleanLiteral(n)
+		}
+	case NullLiteral:
+		if v.NullLiteral != nil {
+			return v.NullLiteral(n)
+		}
+	case ArrayLiteral:
+		if v.ArrayLiteral != nil {
+			return v.ArrayLiteral(n)
+		}
+	case TemplateLiteral:
+		if v.TemplateLiteral != nil {
+			return v.TemplateLiteral(n)
+		}
+	case DictLiteral:
+		if v.DictLiteral != nil {
+			return v.DictLiteral(n)
+		}
+	case PropertyAssignment:
+		if v.PropertyAssignment != nil {
+			return v.PropertyAssignment(n)
+		}
+	case AssignmentExpression:
+		if v.AssignmentExpression != nil {
+			return v.AssignmentExpression(n)
+		}
+	case BinaryExpression:
+		if v.BinaryExpression != nil {
+			return v.BinaryExpression(n)
+		}
+	case UnaryExpression:
+		if v.UnaryExpression != nil {
+			return v.UnaryExpression(n)
+		}
+	case FunctionExpression:
+		if v.FunctionExpression != nil {
+			return v.FunctionExpression(n)
+		}
+	case DefaultParameter:
+		if v.DefaultParameter != nil {
+			return v.DefaultParameter(n)
+		}
+	case RestParameter:
+		if v.RestParameter != nil {
+			return v.RestParameter(n)
+		}
+	case CallExpression:
+		if v.CallExpression != nil {
+			return v.CallExpression(n)
+		}
+	case MemberExpression:
+		if v.MemberExpression != nil {
+			return v.MemberExpression(n)
+		}
+	case ReturnStatement:
+		if v.ReturnStatement != nil {
+			return v.ReturnStatement(n)
+		}
+	case BreakStatement:
+		if v.BreakStatement != nil {
+			return v.BreakStatement(n)
+		}
+	case ContinueStatement:
+		if v.ContinueStatement != nil {
+			return v.ContinueStatement(n)
+		}
+	case IfStatement:
+		if v.IfStatement != nil {
+			return v.IfStatement(n)
+		}
+	case WhileStatement:
+		if v.WhileStatement != nil {
+			return v.WhileStatement(n)
+		}
+	case ForStatement:
+		if v.ForStatement != nil {
+			return v.ForStatement(n)
+		}
+	case ClassExpression:
+		if v.ClassExpression != nil {
+			return v.ClassExpression(n)
+		}
+	case ClassBodyStatement:
+		if v.ClassBodyStatement != nil {
+			return v.ClassBodyStatement(n)
+		}
+	case ClassLiteral:
+		if v.ClassLiteral != nil {
+			return v.ClassLiteral(n)
+		}
+	default:
+		panic(fmt.Errorf("walk: unknown node type: %T", node))
+	}
+	if v.Default != nil {
+		return v.Default(node)
+	}
+	return true
+}
+
+// Inspect 不区分种类的遍历，f 返回 false 就不再访问子节点
+func Inspect(node Node, f func(node Node) bool) {
+	if node == nil {
+		return
+	}
+	if !f(node) {
+		return
+	}
+	for _, child := range Children(node) {
+		Inspect(child, f)
+	}
+}
+
+// Rewriter 按节点种类注册的改写回调
+// 回调拿到的是子节点已经改写完的节点，返回值会替换掉原来的节点
+type Rewriter struct {
+	Program                  func(node Program) Node
+	BlockStatement           func(node BlockStatement) Node
+	ExpressionStatement      func(node ExpressionStatement) Node
+	VariableDeclaration      func(node VariableDeclaration) Node
+	ClassVariableDeclaration func(node ClassVariableDeclaration) Node
+	Identifier               func(node Identifier) Node
+	NumberLiteral            func(node NumberLiteral) Node
+	StringLiteral            func(node StringLiteral) Node
+	BooleanLiteral           func(node BooleanLiteral) Node
+	NullLiteral              func(node NullLiteral) Node
+	ArrayLiteral             func(node ArrayLiteral) Node
+	TemplateLiteral          func(node TemplateLiteral) Node
+	DictLiteral              func(node DictLiteral) Node
+	PropertyAssignment       func(node PropertyAssignment) Node
+	AssignmentExpression     func(node AssignmentExpression) Node
+	BinaryExpression         func(node BinaryExpression) Node
+	UnaryExpression          func(node UnaryExpression) Node
+	FunctionExpression       func(node FunctionExpression) Node
+	DefaultParameter         func(node DefaultParameter) Node
+	RestParameter            func(node RestParameter) Node
+	CallExpression           func(node CallExpression) Node
+	MemberExpression         func(node MemberExpression) Node
+	ReturnStatement          func(node ReturnStatement) Node
+	BreakStatement           func(node BreakStatement) Node
+	ContinueStatement        func(node ContinueStatement) Node
+	IfStatement              func(node IfStatement) Node
+	WhileStatement           func(node WhileStatement) Node
+	ForStatement             func(node ForStatement) Node
+	ClassExpression          func(node ClassExpression) Node
+	ClassBodyStatement       func(node ClassBodyStatement) Node
+	ClassLiteral             func(node ClassLiteral) Node
+}
+
+// Rewrite 后序遍历改写，先改写子节点再改写父节点
+// 原来的树不会被修改，返回的是一棵新树
+func Rewrite(node Node, r *Rewriter) Node {
+	if node == nil {
+		return nil
+	}
+	node = mapChildren(node, func(child Node) Node {
+		return Rewrite(child, r)
+	})
+	return r.rewrite(node)
+}
+
+func (r *Rewriter) rewrite(node Node) Node {
+	switch n := node.(type) {
+	case Program:
+		if r.Program != nil {
+			return r.Program(n)
+		}
+	case BlockStatement:
+		if r.BlockStatement != nil {
+			return r.BlockStatement(n)
+		}
+	case ExpressionStatement:
+		if r.ExpressionStatement != nil {
+			return r.ExpressionStatement(n)
+		}
+	case VariableDeclaration:
+		if r.VariableDeclaration != nil {
+			return r.VariableDeclaration(n)
+		}
+	case ClassVariableDeclaration:
+		if r.ClassVariableDeclaration != nil {
+			return r.ClassVariableDeclaration(n)
+		}
+	case Identifier:
+		if r.Identifier != nil {
+			return r.Identifier(n)
+		}
+	case NumberLiteral:
+		if r.NumberLiteral != nil {
+			return r.NumberLiteral(n)
+		}
+	case StringLiteral:
+		if r.StringLiteral != nil {
+			return r.StringLiteral(n)
+		}
+	case BooleanLiteral:
+		if r.BooleanLiteral != nil {
+			return r.BooleanLiteral(n)
+		}
+	case NullLiteral:
+		if r.NullLiteral != nil {
+			return r.NullLiteral(n)
+		}
+	case ArrayLiteral:
+		if r.ArrayLiteral != nil {
+			return r.ArrayLiteral(n)
+		}
+	case TemplateLiteral:
+		if r.TemplateLiteral != nil {
+			return r.TemplateLiteral(n)
+		}
+	case DictLiteral:
+		if r.DictLiteral != nil {
+			return r.DictLiteral(n)
+		}
+	case PropertyAssignment:
+		if r.PropertyAssignment != nil {
+			return r.PropertyAssignment(n)
+		}
+	case AssignmentExpression:
+		if r.AssignmentExpression != nil {
+			return r.AssignmentExpression(n)
+		}
+	case BinaryExpression:
+		if r.BinaryExpression != nil {
+			return r.BinaryExpression(n)
+		}
+	case UnaryExpression:
+		if r.UnaryExpression != nil {
+			return r.UnaryExpression(n)
+		}
+	case FunctionExpression:
+		if r.FunctionExpression != nil {
+			return r.FunctionExpression(n)
+		}
+	case DefaultParameter:
+		if r.DefaultParameter != nil {
+			return r.DefaultParameter(n)
+		}
+	case RestParameter:
+		if r.RestParameter != nil {
+			return r.RestParameter(n)
+		}
+	case CallExpression:
+		if r.CallExpression != nil {
+			return r.CallExpression(n)
+		}
+	case MemberExpression:
+		if r.MemberExpression != nil {
+			return r.MemberExpression(n)
+		}
+	case ReturnStatement:
+		if r.ReturnStatement != nil {
+			return r.ReturnStatement(n)
+		}
+	case BreakStatement:
+		if r.BreakStatement != nil {
+			return r.BreakStatement(n)
+		}
+	case ContinueStatement:
+		if r.ContinueStatement != nil {
+			return r.ContinueStatement(n)
+		}
+	case IfStatement:
+		if r.IfStatement != nil {
+			return r.IfStatement(n)
+		}
+	case WhileStatement:
+		if r.WhileStatement != nil {
+			return r.WhileStatement(n)
+		}
+	case ForStatement:
+		if r.ForStatement != nil {
+			return r.ForStatement(n)
+		}
+	case ClassExpression:
+		if r.ClassExpression != nil {
+			return r.ClassExpression(n)
+		}
+	case ClassBodyStatement:
+		if r.ClassBodyStatement != nil {
+			return r.ClassBodyStatement(n)
+		}
+	case ClassLiteral:
+		if r.ClassLiteral != nil {
+			return r.ClassLiteral(n)
+		}
+	default:
+		panic(fmt.Errorf("rewrite: unknown node type: %T", node))
+	}
+	return node
+}
+
+// Children 按源码顺序返回节点的直接子节点，nil 的子节点会被跳过
+func Children(node Node) []Node {
+	children := []Node{}
+	mapChildren(node, func(child Node) Node {
+		children = append(children, child)
+		return child
+	})
+	return children
+}
+
+// mapChildren 是唯一列举各种节点子节点的地方
+// Walk、Inspect、Rewrite 都走这里，加新节点只用改这一处
+func mapChildren(node Node, f func(child Node) Node) Node {
+	one := func(child Node) Node {
+		if child == nil {
+			return nil
+		}
+		return f(child)
+	}
+	list := func(children []Node) []Node {
+		if children == nil {
+			return nil
+		}
+		ret := make([]Node, 0, len(children))
+		for _, child := range children {
+			if child == nil {
+				ret = append(ret, nil)
+				continue
+			}
+			ret = append(ret, f(child))
+		}
+		return ret
+	}
+
+	switch n := node.(type) {
+	case Program:
+		n.Body = list(n.Body)
+		return n
+	case BlockStatement:
+		n.Body = list(n.Body)
+		return n
+	case ExpressionStatement:
+		n.Exp = one(n.Exp)
+		return n
+	case VariableDeclaration:
+		n.Name = one(n.Name)
+		n.Value = one(n.Value)
+		return n
+	case ClassVariableDeclaration:
+		n.Name = one(n.Name)
+		n.Value = one(n.Value)
+		return n
+	case ArrayLiteral:
+		n.Values = list(n.Values)
+		return n
+	case TemplateLiteral:
+		n.Expressions = list(n.Expressions)
+		return n
+	case DictLiteral:
+		n.Values = list(n.Values)
+		return n
+	case PropertyAssignment:
+		n.Key = one(n.Key)
+		n.Value = one(n.Value)
+		return n
+	case AssignmentExpression:
+		n.Left = one(n.Left)
+		n.Right = one(n.Right)
+		return n
+	case BinaryExpression:
+		n.Left = one(n.Left)
+		n.Right = one(n.Right)
+		return n
+	case UnaryExpression:
+		n.Value = one(n.Value)
+		return n
+	case FunctionExpression:
+		n.Params = list(n.Params)
+		n.Body = one(n.Body)
+		return n
+	case DefaultParameter:
+		n.Name = one(n.Name)
+		n.Value = one(n.Value)
+		return n
+	case RestParameter:
+		n.Name = one(n.Name)
+		return n
+	case CallExpression:
+		n.Object = one(n.Object)
+		n.Args = list(n.Args)
+		return n
+	case MemberExpression:
+		n.Object = one(n.Object)
+		n.Property = one(n.Property)
+		return n
+	case ReturnStatement:
+		n.Value = one(n.Value)
+		return n
+	case IfStatement:
+		n.Condition = one(n.Condition)
+		n.Consequent = one(n.Consequent)
+		n.Alternate = one(n.Alternate)
+		return n
+	case WhileStatement:
+		n.Condition = one(n.Condition)
+		n.Body = one(n.Body)
+		return n
+	case ForStatement:
+		n.Init = one(n.Init)
+		n.Test = one(n.Test)
+		n.Update = one(n.Update)
+		n.Body = one(n.Body)
+		return n
+	case ClassExpression:
+		n.Name = one(n.Name)
+		n.SuperClass = one(n.SuperClass)
+		n.Body = one(n.Body)
+		return n
+	case ClassBodyStatement:
+		n.Body = list(n.Body)
+		return n
+	// 叶子节点
+	case Identifier, NumberLiteral, StringLiteral, BooleanLiteral, NullLiteral,
+		BreakStatement, ContinueStatement, ClassLiteral:
+		return n
+	default:
+		panic(fmt.Errorf("unknown node type: %T", node))
+	}
+}
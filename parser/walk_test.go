@@ -0,0 +1,162 @@
+package parser
+
+import (
+	sansLexer "go-compiler/lexer"
+	"testing"
+)
+
+func parseCode(code string) Program {
+	lexer := sansLexer.SansLangLexer{}
+	lexer.Code = code
+	tokensLexer := sansLexer.TokenList{
+		Tokens: lexer.TokenList(),
+	}
+	parser := NewSansLangParser(&tokensLexer)
+	return parser.Parse()
+}
+
+func TestWalkAllNodeTypes(t *testing.T) {
+	// 覆盖所有节点种类，Walk 和 Rewrite 都不能 panic
+	ast := parseCode(`
+		var a = 1
+		const b = "s"
+		var c = [true, null, -a]
+		var d = {"k": 1}
+		var f = function(x) {
+			for(var i = 1; i <= 10; i += 1) {
+				if(i == 1){
+					continue
+				} else {
+					break
+				}
+			}
+			while(not true){
+				x = x + 1
+			}
+			return x
+		}
+		var g = function(x, y = 2, ...z) { return z }
+		` + "var h = `a${b}c${-a}`" + `
+		f(a)
+		class A {
+			const cls.age = 1
+			const new = function() {
+				this.name = d["k"]
+			}
+		}
+	`)
+
+	seen := map[string]bool{}
+	Inspect(ast, func(node Node) bool {
+		seen[node.Type().Name()] = true
+		return true
+	})
+	for _, name := range []string{
+		"Program", "VariableDeclaration", "ClassVariableDeclaration", "Identifier",
+		"NumberLiteral", "StringLiteral", "BooleanLiteral", "NullLiteral",
+		"ArrayLiteral", "DictLiteral", "PropertyAssignment", "UnaryExpression",
+		"FunctionExpression", "BlockStatement", "ForStatement", "IfStatement",
+		"ContinueStatement", "BreakStatement", "WhileStatement", "AssignmentExpression",
+		"BinaryExpression", "ReturnStatement", "CallExpression", "ClassExpression",
+		"ClassBodyStatement", "MemberExpression", "DefaultParameter", "RestParameter",
+		"TemplateLiteral",
+	} {
+		if !seen[name] {
+			t.Errorf("Inspect did not reach %s", name)
+		}
+	}
+
+	Walk(ast, &Visitor{})
+	Rewrite(ast, &Rewriter{})
+}
+
+func TestInspectCountIdentifiers(t *testing.T) {
+	ast := parseCode(`var a = b + c * d`)
+
+	count := 0
+	Inspect(ast, func(node Node) bool {
+		if node.Type() == AstTypeIdentifier {
+			count += 1
+		}
+		return true
+	})
+	if count != 4 {
+		t.Errorf("identifier count wrong. got=%d, want=4", count)
+	}
+}
+
+func TestWalkSkipChildren(t *testing.T) {
+	ast := parseCode(`
+		var a = 1
+		var f = function(x) {
+			var b = 2
+		}
+	`)
+
+	names := []string{}
+	Walk(ast, &Visitor{
+		VariableDeclaration: func(node VariableDeclaration) bool {
+			names = append(names, node.Name.(Identifier).Value)
+			return true
+		},
+		FunctionExpression: func(node FunctionExpression) bool {
+			return false
+		},
+	})
+	if len(names) != 2 || names[0] != "a" || names[1] != "f" {
+		t.Errorf("function body should be skipped. got=%v", names)
+	}
+}
+
+func TestWalkDefault(t *testing.T) {
+	ast := parseCode(`
+		var a = 1
+		a = a + 2
+	`)
+
+	// 注册了回调的种类不走 Default
+	others := []AstType{}
+	Walk(ast, &Visitor{
+		VariableDeclaration: func(node VariableDeclaration) bool {
+			return false
+		},
+		Default: func(node Node) bool {
+			others = append(others, node.Type())
+			return node.Type() == AstTypeProgram
+		},
+	})
+	if len(others) != 2 || others[0] != AstTypeProgram || others[1] != AstTypeExpressionStatement {
+		t.Errorf("wrong nodes visited by Default. got=%v", others)
+	}
+}
+
+func TestRewriteConstantFolding(t *testing.T) {
+	ast := parseCode(`var a = 1 + 2 * 3`)
+
+	folded := Rewrite(ast, &Rewriter{
+		BinaryExpression: func(node BinaryExpression) Node {
+			left, ok1 := node.Left.(NumberLiteral)
+			right, ok2 := node.Right.(NumberLiteral)
+			if !ok1 || !ok2 {
+				return node
+			}
+			switch node.Operator {
+			case "+":
+				return NumberLiteral{Value: left.Value + right.Value}
+			case "*":
+				return NumberLiteral{Value: left.Value * right.Value}
+			}
+			return node
+		},
+	}).(Program)
+
+	value := folded.Body[0].(VariableDeclaration).Value
+	if n, ok := value.(NumberLiteral); !ok || n.Value != 7 {
+		t.Errorf("constant folding failed. got=%+v", value)
+	}
+
+	// 原来的树不变
+	if ast.Body[0].(VariableDeclaration).Value.Type() != AstTypeBinaryExpression {
+		t.Errorf("Rewrite modified the original tree")
+	}
+}
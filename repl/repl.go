@@ -34,14 +34,18 @@ func Start(in io.Reader, out io.Writer) {
 			Tokens: l.TokenList(),
 		}
 		p := sansParser.NewSansLangParser(&tokensLexer)
-		ast := p.Parse()
+		ast, err := p.ParseProgram()
+		if err != nil {
+			printParseErrors(out, []string{err.Error()})
+			continue
+		}
 
 		compiler := asm_vm_stack_base.NewCompiler()
 		compiler.Compile(ast)
 		bytecode := compiler.ReturnBytecode()
 
 		vm := asm_vm_stack_base.NewVM(bytecode)
-		err := vm.Run()
+		err = vm.Run()
 		if err != nil {
 			utils.LogErrorFormat("vm.Run failed", err)
 		}
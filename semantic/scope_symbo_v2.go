@@ -54,6 +54,9 @@ func (s *ScopeV2) LookupSignature(name string) (Signature, bool) {
 
 // 输出当前作用域所有符号 + symbol
 func (s *ScopeV2) LogNowScope() {
+	if !utils.Verbose {
+		return
+	}
 	str := fmt.Sprintf("\nScopeV2:")
 	if len(s.Table) == 0 {
 		str += fmt.Sprintf("Empty\n")
@@ -21,48 +21,84 @@ func NewSemanticAnalysisV2(program parser.Program) *SemanticAnalysisV2 {
 }
 
 func (this *SemanticAnalysisV2) Visit() {
-	if this.Ast.Type() != parser.AstTypeProgram.Name() {
+	if this.Ast.Type() != parser.AstTypeProgram {
 		return
 	}
-	this.visitProgram(this.Ast.Body)
-
+	parser.Walk(this.Ast, this.statementVisitor(nil))
 }
 
-func (this *SemanticAnalysisV2) visitProgram(body []parser.Node) {
-	for _, item := range body {
-		utils.LogInfo("visitProgram visit item", item.Type())
-		switch item.Type() {
+// 语句的分发交给 parser.Walk，每种语句的回调自己检查完子节点后返回 false
+// 表达式的类型要自底向上算，还是由 visitExpression 这些函数递归处理
+// ret 收集当前 block 里 return 的类型，nil 表示在顶层，不允许 return、break、continue
+func (this *SemanticAnalysisV2) statementVisitor(ret *AllType) *parser.Visitor {
+	// 顶层之外的语句都放在 block 里
+	outside := func(node parser.Node) bool {
+		if ret == nil {
+			utils.LogError("visitProgram visit item default", node.Type())
+		}
+		return false
+	}
+	return &parser.Visitor{
+		Program: func(node parser.Program) bool {
+			return true
+		},
 		// 变量定义
-		case parser.AstTypeVariableDeclaration.Name():
-			this.visitVariableDeclaration(item)
-		//// 赋值
-		case parser.AstTypeAssignmentExpression.Name():
-			this.visitAssignmentExpression(item)
-		//// 访问 if
-		case parser.AstTypeIfStatement.Name():
-			this.visitIfStatement(item)
-		// 访问 while
-		case parser.AstTypeWhileStatement.Name():
-			this.visitWhileStatement(item)
-		//// 访问 for
-		case parser.AstTypeForStatement.Name():
-			this.visitForStatement(item)
-		//// 访问 block
-		case parser.AstTypeBlockStatement.Name():
-			this.visitBlockStatement(item)
-		// 访问 class
-		case parser.AstTypeClassExpression.Name():
-			this.visitClassExpression(item)
+		VariableDeclaration: func(node parser.VariableDeclaration) bool {
+			this.visitVariableDeclaration(node)
+			return false
+		},
+		// 赋值
+		AssignmentExpression: func(node parser.AssignmentExpression) bool {
+			this.visitAssignmentExpression(node)
+			return false
+		},
+		IfStatement: func(node parser.IfStatement) bool {
+			this.visitIfStatement(node)
+			return false
+		},
+		WhileStatement: func(node parser.WhileStatement) bool {
+			this.visitWhileStatement(node)
+			return false
+		},
+		ForStatement: func(node parser.ForStatement) bool {
+			this.visitForStatement(node)
+			return false
+		},
+		BlockStatement: func(node parser.BlockStatement) bool {
+			this.visitBlockStatement(node)
+			return false
+		},
+		ClassExpression: func(node parser.ClassExpression) bool {
+			this.visitClassExpression(node)
+			return false
+		},
 		// 调用函数
-		case parser.AstTypeCallExpression.Name():
-			this.visitCallExpression(item)
-		case parser.AstTypeExpressionStatement.Name():
-			this.visitExpressionStatement(item)
-		default:
-			utils.LogError("visitProgram visit item default", item.Type())
-		}
-		utils.LogInfo("visitProgram visit item after currentScope")
-		this.CurrentScope.LogNowScope()
+		CallExpression: func(node parser.CallExpression) bool {
+			this.visitCallExpression(node)
+			return false
+		},
+		ExpressionStatement: func(node parser.ExpressionStatement) bool {
+			this.visitExpressionStatement(node)
+			return false
+		},
+		BreakStatement: func(node parser.BreakStatement) bool {
+			this.visitBreakStatement(node)
+			return outside(node)
+		},
+		ContinueStatement: func(node parser.ContinueStatement) bool {
+			this.visitContinueStatement(node)
+			return outside(node)
+		},
+		ReturnStatement: func(node parser.ReturnStatement) bool {
+			if ret != nil {
+				*ret = this.visitReturnStatement(node)
+			}
+			return outside(node)
+		},
+		Default: func(node parser.Node) bool {
+			utils.LogError("not support statement type", node.Type())
+			return false
+		},
 	}
 }
 
@@ -77,7 +113,7 @@ func (this *SemanticAnalysisV2) visitVariableDeclaration(node parser.Node) {
 	left := node.(parser.VariableDeclaration).Name
 	var variableName string
 	switch left.Type() {
-	case parser.AstTypeIdentifier.Name():
+	case parser.AstTypeIdentifier:
 		_, variableName, _ = this.visitIdentifier(left)
 	default:
 		utils.LogError("visitVariableDeclaration invalid left variable declaration", left)
@@ -88,50 +124,17 @@ func (this *SemanticAnalysisV2) visitVariableDeclaration(node parser.Node) {
 		utils.LogError("visitVariableDeclaration invalid left variable declaration", left)
 		return
 	}
-	//
-	var valueType AllType
 	right := node.(parser.VariableDeclaration).Value
 
-	switch right.Type() {
-	// 访问函数，函数的返回类型
-	case parser.AstTypeFunctionExpression.Name():
-		valueType = this.visitFunctionExpression(right)
-	case parser.AstTypeBinaryExpression.Name():
-		valueType = this.visitBinaryExpression(right)
-	case parser.AstTypeNumberLiteral.Name():
-		valueType = this.visitNumberLiteral(right)
-	case parser.AstTypeNullLiteral.Name():
-		valueType = this.visitNullLiteral(right)
-	case parser.AstTypeBooleanLiteral.Name():
-		valueType = this.visitBooleanLiteral(right)
-	case parser.AstTypeStringLiteral.Name():
-		valueType, _ = this.visitStringLiteral(right)
-	case parser.AstTypeArrayLiteral.Name():
-		valueType = this.visitArrayLiteral(right)
-	case parser.AstTypeUnaryExpression.Name():
-		valueType = this.visitUnaryExpression(right)
-	case parser.AstTypeDictLiteral.Name():
-		valueType = this.visitDictLiteral(right)
-	case parser.AstTypeIdentifier.Name():
-		var varName string
-		_, varName, _ = this.visitIdentifier(right)
-		signature, ok := this.CurrentScope.LookupSignature(varName)
-		if ok {
-			valueType = signature.ReturnType
-		} else {
-			utils.LogError("undeclared variable", varName)
-			return
-		}
-	case parser.AstTypeCallExpression.Name():
-		valueType, _ = this.visitCallExpression(right)
-	default:
+	valueType, ok := this.visitExpression(right)
+	if !ok {
 		utils.LogError("visitVariableDeclaration invalid right variable declaration", right)
 		return
 	}
 	// 先不处理常量方法
 	this.CurrentScope.AddSignature(variableName, valueType, false, varType)
 
-	fmt.Printf("in visitVariableDeclaration this.CurrentScope")
+	utils.LogInfo("in visitVariableDeclaration this.CurrentScope")
 	this.CurrentScope.LogNowScope()
 	return
 }
@@ -142,15 +145,15 @@ func (this *SemanticAnalysisV2) visitAssignmentExpression(node parser.Node) {
 	utils.LogInfo("visitClassVariableDeclaration visitAssignmentExpression", node.(parser.AssignmentExpression))
 	var variableName string
 	switch left.Type() {
-	case parser.AstTypeIdentifier.Name():
+	case parser.AstTypeIdentifier:
 		_, variableName, _ = this.visitIdentifier(left)
-	//case AstTypeMemberExpression.Name():
+	//case AstTypeMemberExpression:
 	//	_, variableName = this.visitMemberExpression(left)
 	default:
 		utils.LogError("invalid assignment expression", left)
 		return
 	}
-	fmt.Printf("visitAssignmentExpression variableName %v left:%v\n", variableName, left)
+	utils.LogInfo("visitAssignmentExpression variableName left", variableName, left)
 	varSignature, ok := this.CurrentScope.LookupSignature(variableName)
 	// const 检查
 	if ok && varSignature.VarType == lexer.TokenTypeConst.Name() {
@@ -164,25 +167,27 @@ func (this *SemanticAnalysisV2) visitAssignmentExpression(node parser.Node) {
 	//valueType := ValueTypeIdentifier
 	right := node.(parser.AssignmentExpression).Right
 	switch right.Type() {
-	case parser.AstTypeBinaryExpression.Name():
+	case parser.AstTypeBinaryExpression:
 		valueType = this.visitBinaryExpression(right)
-	case parser.AstTypeIdentifier.Name():
+	case parser.AstTypeIdentifier:
 		valueType, _, varType = this.visitIdentifier(right)
-	case parser.AstTypeNumberLiteral.Name():
+	case parser.AstTypeNumberLiteral:
 		valueType = this.visitNumberLiteral(right)
-	case parser.AstTypeStringLiteral.Name():
+	case parser.AstTypeStringLiteral:
 		valueType, _ = this.visitStringLiteral(right)
-	case parser.AstTypeBooleanLiteral.Name():
+	case parser.AstTypeTemplateLiteral:
+		valueType = this.visitTemplateLiteral(right)
+	case parser.AstTypeBooleanLiteral:
 		valueType = this.visitBooleanLiteral(right)
-	case parser.AstTypeArrayLiteral.Name():
+	case parser.AstTypeArrayLiteral:
 		valueType = this.visitArrayLiteral(right)
-	case parser.AstTypeDictLiteral.Name():
+	case parser.AstTypeDictLiteral:
 		valueType = this.visitDictLiteral(right)
-	case parser.AstTypeNullLiteral.Name():
+	case parser.AstTypeNullLiteral:
 		valueType = this.visitNullLiteral(right)
-	case parser.AstTypeUnaryExpression.Name():
+	case parser.AstTypeUnaryExpression:
 		valueType = this.visitUnaryExpression(right)
-	case parser.AstTypeCallExpression.Name():
+	case parser.AstTypeCallExpression:
 		valueType, _ = this.visitCallExpression(right)
 	default:
 		utils.LogError("invalid assignment expression", right)
@@ -202,7 +207,7 @@ func (this *SemanticAnalysisV2) visitAssignmentExpression(node parser.Node) {
 }
 
 func (this *SemanticAnalysisV2) visitFunctionExpression(node parser.Node) (functionType AllType) {
-	if node.Type() != parser.AstTypeFunctionExpression.Name() {
+	if node.Type() != parser.AstTypeFunctionExpression {
 		return UnKnownType{}
 	}
 	params := node.(parser.FunctionExpression).Params
@@ -217,12 +222,55 @@ func (this *SemanticAnalysisV2) visitFunctionExpression(node parser.Node) (funct
 	}()
 
 	signatures := make([]Signature, 0)
-	for _, param := range params {
-		if param.Type() != parser.AstTypeIdentifier.Name() {
+	numDefaults := 0
+	hasRest := false
+	for index, param := range params {
+		var valueType AllType
+		var variableName, varType string
+		switch param.Type() {
+		case parser.AstTypeIdentifier:
+			// 默认参数后面不能再跟普通参数
+			if numDefaults > 0 {
+				utils.LogError("required param after default param", param)
+				return UnKnownType{}
+			}
+			valueType, variableName, varType = this.visitIdentifier(param)
+		case parser.AstTypeDefaultParameter:
+			p := param.(parser.DefaultParameter)
+			if p.Name.Type() != parser.AstTypeIdentifier {
+				utils.LogError("param must be identifier", p.Name.Type())
+				return UnKnownType{}
+			}
+			// 默认值在定义函数的地方求值，所以在外层作用域里检查
+			funcScope := this.CurrentScope
+			this.CurrentScope = funcScope.Parent
+			valueType = this.visitCallArgument(p.Value)
+			this.CurrentScope = funcScope
+			switch valueType.(type) {
+			case VoidType, UnKnownType:
+				utils.LogError("invalid default param value type", p.Value.Type(), valueType.ValueType())
+				return UnKnownType{}
+			}
+			_, variableName, varType = this.visitIdentifier(p.Name)
+			numDefaults += 1
+		case parser.AstTypeRestParameter:
+			p := param.(parser.RestParameter)
+			if index != len(params)-1 {
+				utils.LogError("rest param must be the last param", p.Name)
+				return UnKnownType{}
+			}
+			if p.Name.Type() != parser.AstTypeIdentifier {
+				utils.LogError("param must be identifier", p.Name.Type())
+				return UnKnownType{}
+			}
+			// 多出来的参数打包成数组
+			_, variableName, varType = this.visitIdentifier(p.Name)
+			valueType = ArrayType{ElementType: UnKnownType{}}
+			hasRest = true
+		default:
 			utils.LogError("param must be identifier", param.Type())
 			return UnKnownType{}
 		}
-		valueType, variableName, varType := this.visitIdentifier(param)
 		s := Signature{
 			Name:       variableName,
 			ReturnType: valueType,
@@ -237,13 +285,15 @@ func (this *SemanticAnalysisV2) visitFunctionExpression(node parser.Node) (funct
 
 	var funcReturnType AllType
 	funcReturnType = VoidType{}
-	if body.Type() == parser.AstTypeBlockStatement.Name() {
+	if body.Type() == parser.AstTypeBlockStatement {
 		funcReturnType = this.visitBlockStatement(body)
 	}
 
 	return FunctionType{
-		Params:     signatures,
-		ReturnType: funcReturnType,
+		Params:      signatures,
+		ReturnType:  funcReturnType,
+		NumDefaults: numDefaults,
+		HasRest:     hasRest,
 	}
 }
 
@@ -255,7 +305,7 @@ func (this *SemanticAnalysisV2) visitBinaryExpression(node parser.Node) AllType
 	//	Left     Node   // left属性
 	//	Right    Node   // right属性
 	//}
-	if node.Type() != parser.AstTypeBinaryExpression.Name() {
+	if node.Type() != parser.AstTypeBinaryExpression {
 		return UnKnownType{}
 	}
 	// op
@@ -265,13 +315,15 @@ func (this *SemanticAnalysisV2) visitBinaryExpression(node parser.Node) AllType
 		left := node.(parser.BinaryExpression).Left
 		var leftValueType AllType
 		switch left.Type() {
-		case parser.AstTypeBinaryExpression.Name():
+		case parser.AstTypeBinaryExpression:
 			leftValueType = this.visitBinaryExpression(left)
-		case parser.AstTypeNumberLiteral.Name():
+		case parser.AstTypeNumberLiteral:
 			leftValueType = this.visitNumberLiteral(left)
-		case parser.AstTypeStringLiteral.Name():
+		case parser.AstTypeStringLiteral:
 			leftValueType, _ = this.visitStringLiteral(left)
-		case parser.AstTypeIdentifier.Name():
+		case parser.AstTypeTemplateLiteral:
+			leftValueType = this.visitTemplateLiteral(left)
+		case parser.AstTypeIdentifier:
 			leftValueType, _, _ = this.visitIdentifier(left)
 		default:
 			utils.LogError("左值类型错误", node.(parser.BinaryExpression).Left)
@@ -282,13 +334,15 @@ func (this *SemanticAnalysisV2) visitBinaryExpression(node parser.Node) AllType
 		right := node.(parser.BinaryExpression).Right
 		var rightValueType AllType
 		switch right.Type() {
-		case parser.AstTypeBinaryExpression.Name():
+		case parser.AstTypeBinaryExpression:
 			rightValueType = this.visitBinaryExpression(right)
-		case parser.AstTypeNumberLiteral.Name():
+		case parser.AstTypeNumberLiteral:
 			rightValueType = this.visitNumberLiteral(right)
-		case parser.AstTypeStringLiteral.Name():
+		case parser.AstTypeStringLiteral:
 			rightValueType, _ = this.visitStringLiteral(right)
-		case parser.AstTypeIdentifier.Name():
+		case parser.AstTypeTemplateLiteral:
+			rightValueType = this.visitTemplateLiteral(right)
+		case parser.AstTypeIdentifier:
 			rightValueType, _, _ = this.visitIdentifier(right)
 		default:
 			utils.LogError("右值类型错误", node.(parser.BinaryExpression).Right)
@@ -299,7 +353,7 @@ func (this *SemanticAnalysisV2) visitBinaryExpression(node parser.Node) AllType
 		isString := false
 
 		switch leftValueType {
-		case NumberType{}:
+		case IntegerType{}, FloatType{}:
 		case StringType{}:
 			isString = true
 		default:
@@ -308,7 +362,7 @@ func (this *SemanticAnalysisV2) visitBinaryExpression(node parser.Node) AllType
 		}
 
 		switch rightValueType {
-		case NumberType{}:
+		case IntegerType{}, FloatType{}:
 		case StringType{}:
 			isString = true
 		default:
@@ -319,13 +373,15 @@ func (this *SemanticAnalysisV2) visitBinaryExpression(node parser.Node) AllType
 		if isString {
 			return StringType{}
 		}
-		return NumberType{}
+		return promoteNumberType(leftValueType, rightValueType)
 	case "-":
 		fallthrough
 	case "*":
 		fallthrough
 	case "/":
 		fallthrough
+	case "%":
+		fallthrough
 	case "+=":
 		fallthrough
 	case "-=":
@@ -337,11 +393,11 @@ func (this *SemanticAnalysisV2) visitBinaryExpression(node parser.Node) AllType
 		left := node.(parser.BinaryExpression).Left
 		var leftValueType AllType
 		switch left.Type() {
-		case parser.AstTypeIdentifier.Name():
+		case parser.AstTypeIdentifier:
 			leftValueType, _, _ = this.visitIdentifier(left)
-		case parser.AstTypeBinaryExpression.Name():
+		case parser.AstTypeBinaryExpression:
 			leftValueType = this.visitBinaryExpression(left)
-		case parser.AstTypeNumberLiteral.Name():
+		case parser.AstTypeNumberLiteral:
 			leftValueType = this.visitNumberLiteral(left)
 		default:
 			utils.LogError("左值类型错误", node.(parser.BinaryExpression).Left)
@@ -352,28 +408,29 @@ func (this *SemanticAnalysisV2) visitBinaryExpression(node parser.Node) AllType
 		right := node.(parser.BinaryExpression).Right
 		var rightValueType AllType
 		switch right.Type() {
-		case parser.AstTypeBinaryExpression.Name():
+		case parser.AstTypeBinaryExpression:
 			rightValueType = this.visitBinaryExpression(right)
-		case parser.AstTypeNumberLiteral.Name():
+		case parser.AstTypeNumberLiteral:
 			rightValueType = this.visitNumberLiteral(right)
 		default:
 			utils.LogError("右值类型错误", node.(parser.BinaryExpression).Right)
 			return UnKnownType{}
 		}
 		switch leftValueType {
-		case NumberType{}:
+		case IntegerType{}, FloatType{}:
 		default:
 			utils.LogError("左值类型错误", node.(parser.BinaryExpression).Left)
 			return UnKnownType{}
 		}
 
 		switch rightValueType {
-		case NumberType{}:
+		case IntegerType{}, FloatType{}:
 		default:
 			utils.LogError("右值类型错误", node.(parser.BinaryExpression).Right)
 			return UnKnownType{}
 		}
-		return NumberType{}
+		// 整数除法向零截断，结果还是整数
+		return promoteNumberType(leftValueType, rightValueType)
 	case ">":
 		fallthrough
 	case "<":
@@ -385,13 +442,15 @@ func (this *SemanticAnalysisV2) visitBinaryExpression(node parser.Node) AllType
 		left := node.(parser.BinaryExpression).Left
 		var leftValueType AllType
 		switch left.Type() {
-		case parser.AstTypeBinaryExpression.Name():
+		case parser.AstTypeBinaryExpression:
 			leftValueType = this.visitBinaryExpression(left)
-		case parser.AstTypeNumberLiteral.Name():
+		case parser.AstTypeNumberLiteral:
 			leftValueType = this.visitNumberLiteral(left)
-		case parser.AstTypeStringLiteral.Name():
+		case parser.AstTypeStringLiteral:
 			leftValueType, _ = this.visitStringLiteral(left)
-		case parser.AstTypeIdentifier.Name():
+		case parser.AstTypeTemplateLiteral:
+			leftValueType = this.visitTemplateLiteral(left)
+		case parser.AstTypeIdentifier:
 			leftValueType, _, _ = this.visitIdentifier(left)
 		default:
 			utils.LogError("左值类型错误", node.(parser.BinaryExpression).Left)
@@ -402,13 +461,15 @@ func (this *SemanticAnalysisV2) visitBinaryExpression(node parser.Node) AllType
 		right := node.(parser.BinaryExpression).Right
 		var rightValueType AllType
 		switch right.Type() {
-		case parser.AstTypeBinaryExpression.Name():
+		case parser.AstTypeBinaryExpression:
 			rightValueType = this.visitBinaryExpression(right)
-		case parser.AstTypeNumberLiteral.Name():
+		case parser.AstTypeNumberLiteral:
 			rightValueType = this.visitNumberLiteral(right)
-		case parser.AstTypeStringLiteral.Name():
+		case parser.AstTypeStringLiteral:
 			rightValueType, _ = this.visitStringLiteral(right)
-		case parser.AstTypeIdentifier.Name():
+		case parser.AstTypeTemplateLiteral:
+			rightValueType = this.visitTemplateLiteral(right)
+		case parser.AstTypeIdentifier:
 			rightValueType, _, _ = this.visitIdentifier(right)
 		default:
 			utils.LogError("右值类型错误", node.(parser.BinaryExpression).Right)
@@ -416,7 +477,8 @@ func (this *SemanticAnalysisV2) visitBinaryExpression(node parser.Node) AllType
 		}
 		utils.LogInfo("visitBinaryExpression", leftValueType, rightValueType)
 
-		if leftValueType != rightValueType {
+		// 整数和浮点数可以互相比较
+		if leftValueType != rightValueType && !(isNumberType(leftValueType) && isNumberType(rightValueType)) {
 			utils.LogError("类型不匹配", node.(parser.BinaryExpression).Left, node.(parser.BinaryExpression).Right)
 			return UnKnownType{}
 		}
@@ -428,17 +490,19 @@ func (this *SemanticAnalysisV2) visitBinaryExpression(node parser.Node) AllType
 		left := node.(parser.BinaryExpression).Left
 		var leftValueType AllType
 		switch left.Type() {
-		case parser.AstTypeBinaryExpression.Name():
+		case parser.AstTypeBinaryExpression:
 			leftValueType = this.visitBinaryExpression(left)
-		case parser.AstTypeNumberLiteral.Name():
+		case parser.AstTypeNumberLiteral:
 			leftValueType = this.visitNumberLiteral(left)
-		case parser.AstTypeStringLiteral.Name():
+		case parser.AstTypeStringLiteral:
 			leftValueType, _ = this.visitStringLiteral(left)
-		case parser.AstTypeIdentifier.Name():
+		case parser.AstTypeTemplateLiteral:
+			leftValueType = this.visitTemplateLiteral(left)
+		case parser.AstTypeIdentifier:
 			leftValueType, _, _ = this.visitIdentifier(left)
-		case parser.AstTypeBooleanLiteral.Name():
+		case parser.AstTypeBooleanLiteral:
 			leftValueType = this.visitBooleanLiteral(left)
-		case parser.AstTypeNullLiteral.Name():
+		case parser.AstTypeNullLiteral:
 			leftValueType = this.visitNullLiteral(left)
 		default:
 			utils.LogError("左值类型错误", node.(parser.BinaryExpression).Left)
@@ -449,17 +513,19 @@ func (this *SemanticAnalysisV2) visitBinaryExpression(node parser.Node) AllType
 		right := node.(parser.BinaryExpression).Right
 		var rightValueType AllType
 		switch right.Type() {
-		case parser.AstTypeBinaryExpression.Name():
+		case parser.AstTypeBinaryExpression:
 			rightValueType = this.visitBinaryExpression(right)
-		case parser.AstTypeNumberLiteral.Name():
+		case parser.AstTypeNumberLiteral:
 			rightValueType = this.visitNumberLiteral(right)
-		case parser.AstTypeStringLiteral.Name():
+		case parser.AstTypeStringLiteral:
 			rightValueType, _ = this.visitStringLiteral(right)
-		case parser.AstTypeIdentifier.Name():
+		case parser.AstTypeTemplateLiteral:
+			rightValueType = this.visitTemplateLiteral(right)
+		case parser.AstTypeIdentifier:
 			rightValueType, _, _ = this.visitIdentifier(right)
-		case parser.AstTypeBooleanLiteral.Name():
+		case parser.AstTypeBooleanLiteral:
 			rightValueType = this.visitBooleanLiteral(right)
-		case parser.AstTypeNullLiteral.Name():
+		case parser.AstTypeNullLiteral:
 			rightValueType = this.visitNullLiteral(right)
 		default:
 			utils.LogError("右值类型错误", node.(parser.BinaryExpression).Right)
@@ -467,7 +533,8 @@ func (this *SemanticAnalysisV2) visitBinaryExpression(node parser.Node) AllType
 		}
 		utils.LogInfo("visitBinaryExpression", leftValueType, rightValueType)
 
-		if leftValueType != rightValueType {
+		// 整数和浮点数可以互相比较
+		if leftValueType != rightValueType && !(isNumberType(leftValueType) && isNumberType(rightValueType)) {
 			utils.LogError("类型不匹配", node.(parser.BinaryExpression).Left, node.(parser.BinaryExpression).Right)
 			return UnKnownType{}
 		}
@@ -479,11 +546,11 @@ func (this *SemanticAnalysisV2) visitBinaryExpression(node parser.Node) AllType
 		left := node.(parser.BinaryExpression).Left
 		var leftValueType AllType
 		switch left.Type() {
-		case parser.AstTypeBinaryExpression.Name():
+		case parser.AstTypeBinaryExpression:
 			leftValueType = this.visitBinaryExpression(left)
-		case parser.AstTypeIdentifier.Name():
+		case parser.AstTypeIdentifier:
 			leftValueType, _, _ = this.visitIdentifier(left)
-		case parser.AstTypeBooleanLiteral.Name():
+		case parser.AstTypeBooleanLiteral:
 			leftValueType = this.visitBooleanLiteral(left)
 		default:
 			utils.LogError("左值类型错误", node.(parser.BinaryExpression).Left)
@@ -494,11 +561,11 @@ func (this *SemanticAnalysisV2) visitBinaryExpression(node parser.Node) AllType
 		right := node.(parser.BinaryExpression).Right
 		var rightValueType AllType
 		switch right.Type() {
-		case parser.AstTypeBinaryExpression.Name():
+		case parser.AstTypeBinaryExpression:
 			rightValueType = this.visitBinaryExpression(right)
-		case parser.AstTypeIdentifier.Name():
+		case parser.AstTypeIdentifier:
 			rightValueType, _, _ = this.visitIdentifier(right)
-		case parser.AstTypeBooleanLiteral.Name():
+		case parser.AstTypeBooleanLiteral:
 			rightValueType = this.visitBooleanLiteral(right)
 		default:
 			utils.LogError("右值类型错误", node.(parser.BinaryExpression).Right)
@@ -519,7 +586,7 @@ func (this *SemanticAnalysisV2) visitBinaryExpression(node parser.Node) AllType
 
 // not
 func (this *SemanticAnalysisV2) visitUnaryExpression(node parser.Node) AllType {
-	if node.Type() != parser.AstTypeUnaryExpression.Name() {
+	if node.Type() != parser.AstTypeUnaryExpression {
 		return UnKnownType{}
 	}
 	op := node.(parser.UnaryExpression).Operator
@@ -529,11 +596,11 @@ func (this *SemanticAnalysisV2) visitUnaryExpression(node parser.Node) AllType {
 		// not 后面只能加 identifier / bool
 		v := node.(parser.UnaryExpression).Value
 		switch v.Type() {
-		case parser.AstTypeBinaryExpression.Name():
+		case parser.AstTypeBinaryExpression:
 			vValueType = this.visitBinaryExpression(v)
-		case parser.AstTypeIdentifier.Name():
+		case parser.AstTypeIdentifier:
 			vValueType, _, _ = this.visitIdentifier(v)
-		case parser.AstTypeBooleanLiteral.Name():
+		case parser.AstTypeBooleanLiteral:
 			vValueType = this.visitBooleanLiteral(v)
 		}
 		boolType := BooleanType{}.ValueType()
@@ -547,19 +614,18 @@ func (this *SemanticAnalysisV2) visitUnaryExpression(node parser.Node) AllType {
 		// - 后面只能加 identifier / number
 		v := node.(parser.UnaryExpression).Value
 		switch v.Type() {
-		case parser.AstTypeBinaryExpression.Name():
+		case parser.AstTypeBinaryExpression:
 			vValueType = this.visitBinaryExpression(v)
-		case parser.AstTypeIdentifier.Name():
+		case parser.AstTypeIdentifier:
 			vValueType, _, _ = this.visitIdentifier(v)
-		case parser.AstTypeNumberLiteral.Name():
+		case parser.AstTypeNumberLiteral:
 			vValueType = this.visitNumberLiteral(v)
 		}
-		numberType := NumberType{}.ValueType()
-		if vValueType.ValueType() != numberType {
+		if !isNumberType(vValueType) {
 			utils.LogError("not value type error", vValueType)
 			return UnKnownType{}
 		}
-		return NumberType{}
+		return vValueType
 	default:
 		utils.LogError("not support unary expression operator", node.(parser.UnaryExpression).Operator)
 		return UnKnownType{}
@@ -568,7 +634,7 @@ func (this *SemanticAnalysisV2) visitUnaryExpression(node parser.Node) AllType {
 }
 
 func (this *SemanticAnalysisV2) visitIdentifier(node parser.Node) (valueType AllType, variableName string, varType string) {
-	if node.Type() != parser.AstTypeIdentifier.Name() {
+	if node.Type() != parser.AstTypeIdentifier {
 		return VoidType{}, "", varType
 	}
 	signature, ok := this.CurrentScope.LookupSignature(node.(parser.Identifier).Value)
@@ -580,13 +646,17 @@ func (this *SemanticAnalysisV2) visitIdentifier(node parser.Node) (valueType All
 
 func (this *SemanticAnalysisV2) visitDictKeyLiteral(node parser.Node) (valueType AllType, variableName string, varType string) {
 	switch node.Type() {
-	case parser.AstTypeStringLiteral.Name():
+	case parser.AstTypeStringLiteral:
 		valueType, variableName = this.visitStringLiteral(node)
 		return valueType, variableName, varType
-	case parser.AstTypeNumberLiteral.Name():
+	case parser.AstTypeNumberLiteral:
 		valueType = this.visitNumberLiteral(node)
-		return valueType, fmt.Sprintf("%d", int64(node.(parser.NumberLiteral).Value)), varType
-	case parser.AstTypeIdentifier.Name():
+		number := node.(parser.NumberLiteral)
+		if i, ok := number.BigValue(); ok {
+			return valueType, i.String(), varType
+		}
+		return valueType, fmt.Sprintf("%g", number.Value), varType
+	case parser.AstTypeIdentifier:
 		return this.visitIdentifier(node)
 	default:
 		utils.LogError("visitDictKeyLiteral error, unknownType", node)
@@ -596,46 +666,67 @@ func (this *SemanticAnalysisV2) visitDictKeyLiteral(node parser.Node) (valueType
 }
 
 func (this *SemanticAnalysisV2) visitStringLiteral(node parser.Node) (valueType AllType, value string) {
-	if node.Type() != parser.AstTypeStringLiteral.Name() {
+	if node.Type() != parser.AstTypeStringLiteral {
 		return VoidType{}, ""
 	}
 	value = node.(parser.StringLiteral).Value
 	return StringType{}, value
 }
 
+// 模板字符串 `a${x}b`，${} 里的值运行的时候转成字符串再拼起来
+// 函数、类和没有值的表达式不能放进去
+func (this *SemanticAnalysisV2) visitTemplateLiteral(node parser.Node) AllType {
+	if node.Type() != parser.AstTypeTemplateLiteral {
+		return VoidType{}
+	}
+	for _, exp := range node.(parser.TemplateLiteral).Expressions {
+		valueType := this.visitCallArgument(exp)
+		switch valueType.(type) {
+		case VoidType, FunctionType, ClassType:
+			utils.LogError("template literal value type error", valueType)
+			return UnKnownType{}
+		}
+	}
+	return StringType{}
+}
+
 func (this *SemanticAnalysisV2) visitBooleanLiteral(node parser.Node) AllType {
-	if node.Type() != parser.AstTypeBooleanLiteral.Name() {
+	if node.Type() != parser.AstTypeBooleanLiteral {
 		return VoidType{}
 	}
 	return BooleanType{}
 }
 
 func (this *SemanticAnalysisV2) visitNullLiteral(node parser.Node) AllType {
-	if node.Type() != parser.AstTypeNullLiteral.Name() {
+	if node.Type() != parser.AstTypeNullLiteral {
 		return VoidType{}
 	}
 	return NullType{}
 }
 
 func (this *SemanticAnalysisV2) visitNumberLiteral(node parser.Node) AllType {
-	if node.Type() != parser.AstTypeNumberLiteral.Name() {
+	if node.Type() != parser.AstTypeNumberLiteral {
 		return VoidType{}
 	}
-	return NumberType{}
+	// 整数溢出会自动变成大整数，所以大整数也是 IntegerType
+	if _, ok := node.(parser.NumberLiteral).BigValue(); ok {
+		return IntegerType{}
+	}
+	return FloatType{}
 }
 
 func (this *SemanticAnalysisV2) visitWhileStatement(node parser.Node) AllType {
-	if node.Type() != parser.AstTypeWhileStatement.Name() {
+	if node.Type() != parser.AstTypeWhileStatement {
 		return UnKnownType{}
 	}
 	condition := node.(parser.WhileStatement).Condition
 	var conditionType AllType
 	switch condition.Type() {
-	case parser.AstTypeBinaryExpression.Name():
+	case parser.AstTypeBinaryExpression:
 		conditionType = this.visitBinaryExpression(condition)
-	case parser.AstTypeIdentifier.Name():
+	case parser.AstTypeIdentifier:
 		conditionType, _, _ = this.visitIdentifier(condition)
-	case parser.AstTypeBooleanLiteral.Name():
+	case parser.AstTypeBooleanLiteral:
 		conditionType = this.visitBooleanLiteral(condition)
 	default:
 		utils.LogError("not support while statement condition type", conditionType)
@@ -649,7 +740,7 @@ func (this *SemanticAnalysisV2) visitWhileStatement(node parser.Node) AllType {
 	}
 
 	body := node.(parser.WhileStatement).Body
-	if body.Type() == parser.AstTypeBlockStatement.Name() {
+	if body.Type() == parser.AstTypeBlockStatement {
 		this.visitBlockStatement(body)
 	}
 
@@ -657,7 +748,7 @@ func (this *SemanticAnalysisV2) visitWhileStatement(node parser.Node) AllType {
 }
 
 func (this *SemanticAnalysisV2) visitForStatement(node parser.Node) AllType {
-	if node.Type() != parser.AstTypeForStatement.Name() {
+	if node.Type() != parser.AstTypeForStatement {
 		return UnKnownType{}
 	} // 开始新的作用域
 
@@ -673,11 +764,11 @@ func (this *SemanticAnalysisV2) visitForStatement(node parser.Node) AllType {
 	var initType AllType
 	initType = UnKnownType{}
 	switch init.Type() {
-	case parser.AstTypeVariableDeclaration.Name():
+	case parser.AstTypeVariableDeclaration:
 		this.visitVariableDeclaration(init)
-	case parser.AstTypeAssignmentExpression.Name():
+	case parser.AstTypeAssignmentExpression:
 		this.visitAssignmentExpression(init)
-	case parser.AstTypeBooleanLiteral.Name():
+	case parser.AstTypeBooleanLiteral:
 		initType = this.visitBooleanLiteral(init)
 	default:
 		utils.LogError("not support for statement init type", init)
@@ -689,7 +780,7 @@ func (this *SemanticAnalysisV2) visitForStatement(node parser.Node) AllType {
 	var testType AllType
 	testType = UnKnownType{}
 	switch testExp.Type() {
-	case parser.AstTypeBinaryExpression.Name():
+	case parser.AstTypeBinaryExpression:
 		testType = this.visitBinaryExpression(testExp)
 	default:
 		utils.LogError("not support for statement test type", testExp)
@@ -701,7 +792,7 @@ func (this *SemanticAnalysisV2) visitForStatement(node parser.Node) AllType {
 	var updateType AllType
 	updateType = UnKnownType{}
 	switch update.Type() {
-	case parser.AstTypeBinaryExpression.Name():
+	case parser.AstTypeBinaryExpression:
 		testType = this.visitBinaryExpression(update)
 	default:
 		utils.LogError("not support for statement update type", update)
@@ -710,7 +801,7 @@ func (this *SemanticAnalysisV2) visitForStatement(node parser.Node) AllType {
 	utils.LogInfo("for updateType type", updateType)
 
 	body := node.(parser.ForStatement).Body
-	if body.Type() == parser.AstTypeBlockStatement.Name() {
+	if body.Type() == parser.AstTypeBlockStatement {
 		this.visitBlockStatement(body)
 	}
 
@@ -718,18 +809,18 @@ func (this *SemanticAnalysisV2) visitForStatement(node parser.Node) AllType {
 }
 
 func (this *SemanticAnalysisV2) visitIfStatement(node parser.Node) AllType {
-	if node.Type() == parser.AstTypeIfStatement.Name() {
+	if node.Type() == parser.AstTypeIfStatement {
 		return UnKnownType{}
 	}
 	condition := node.(parser.IfStatement).Condition
 	var conditionType AllType
 	conditionType = UnKnownType{}
 	switch condition.Type() {
-	case parser.AstTypeBinaryExpression.Name():
+	case parser.AstTypeBinaryExpression:
 		conditionType = this.visitBinaryExpression(condition)
-	case parser.AstTypeIdentifier.Name():
+	case parser.AstTypeIdentifier:
 		conditionType, _, _ = this.visitIdentifier(condition)
-	case parser.AstTypeBooleanLiteral.Name():
+	case parser.AstTypeBooleanLiteral:
 		conditionType = this.visitBooleanLiteral(condition)
 	default:
 		utils.LogError("not support if statement condition type", conditionType)
@@ -744,13 +835,13 @@ func (this *SemanticAnalysisV2) visitIfStatement(node parser.Node) AllType {
 	}
 
 	consequent := node.(parser.IfStatement).Consequent
-	if consequent.Type() == parser.AstTypeBlockStatement.Name() {
+	if consequent.Type() == parser.AstTypeBlockStatement {
 		this.visitBlockStatement(consequent)
 	}
 
 	alternate := node.(parser.IfStatement).Alternate
 	if alternate != nil {
-		if alternate.Type() == parser.AstTypeBlockStatement.Name() {
+		if alternate.Type() == parser.AstTypeBlockStatement {
 			this.visitBlockStatement(alternate)
 		}
 	}
@@ -776,33 +867,10 @@ func (this *SemanticAnalysisV2) visitBlockStatement(node parser.Node) AllType {
 	var retValueType AllType
 	retValueType = UnKnownType{}
 	utils.LogInfo("visitBlockStatement visit node before", node.Type())
+	v := this.statementVisitor(&retValueType)
 	for _, item := range node.(parser.BlockStatement).Body {
 		utils.LogInfo("visitBlockStatement visit item", item.Type())
-		switch item.Type() {
-		// 变量定义
-		case parser.AstTypeVariableDeclaration.Name():
-			this.visitVariableDeclaration(item)
-		// 赋值
-		case parser.AstTypeAssignmentExpression.Name():
-			this.visitAssignmentExpression(item)
-		// break
-		case parser.AstTypeBreakStatement.Name():
-			this.visitBreakStatement(item)
-		// continue
-		case parser.AstTypeContinueStatement.Name():
-			this.visitContinueStatement(item)
-		// return
-		case parser.AstTypeReturnStatement.Name():
-			retValueType = this.visitReturnStatement(item)
-		// 函数调用
-		case parser.AstTypeCallExpression.Name():
-			this.visitCallExpression(item)
-		// exp
-		case parser.AstTypeExpressionStatement.Name():
-			this.visitExpressionStatement(item)
-		default:
-			utils.LogError("not support block statement type", item)
-		}
+		parser.Walk(item, v)
 	}
 	utils.LogInfo("visitBlockStatement before current Scope", retValueType)
 	this.CurrentScope.LogNowScope()
@@ -819,7 +887,7 @@ func (this *SemanticAnalysisV2) visitContinueStatement(node parser.Node) AllType
 }
 
 func (this *SemanticAnalysisV2) visitReturnStatement(node parser.Node) AllType {
-	if node.Type() != parser.AstTypeReturnStatement.Name() {
+	if node.Type() != parser.AstTypeReturnStatement {
 		return UnKnownType{}
 	}
 	v := node.(parser.ReturnStatement).Value
@@ -830,23 +898,25 @@ func (this *SemanticAnalysisV2) visitReturnStatement(node parser.Node) AllType {
 	var rightType AllType
 	rightType = VoidType{}
 	switch v.Type() {
-	case parser.AstTypeBinaryExpression.Name():
+	case parser.AstTypeBinaryExpression:
 		rightType = this.visitBinaryExpression(v)
-	case parser.AstTypeNumberLiteral.Name():
+	case parser.AstTypeNumberLiteral:
 		rightType = this.visitNumberLiteral(v)
-	case parser.AstTypeNullLiteral.Name():
+	case parser.AstTypeNullLiteral:
 		rightType = this.visitNullLiteral(v)
-	case parser.AstTypeBooleanLiteral.Name():
+	case parser.AstTypeBooleanLiteral:
 		rightType = this.visitBooleanLiteral(v)
-	case parser.AstTypeStringLiteral.Name():
+	case parser.AstTypeStringLiteral:
 		rightType, _ = this.visitStringLiteral(v)
-	case parser.AstTypeArrayLiteral.Name():
+	case parser.AstTypeTemplateLiteral:
+		rightType = this.visitTemplateLiteral(v)
+	case parser.AstTypeArrayLiteral:
 		rightType = this.visitArrayLiteral(v)
-	case parser.AstTypeUnaryExpression.Name():
+	case parser.AstTypeUnaryExpression:
 		rightType = this.visitUnaryExpression(v)
-	case parser.AstTypeDictLiteral.Name():
+	case parser.AstTypeDictLiteral:
 		rightType = this.visitDictLiteral(v)
-	case parser.AstTypeIdentifier.Name():
+	case parser.AstTypeIdentifier:
 		var varName string
 		_, varName, _ = this.visitIdentifier(v)
 		symbol, ok := this.CurrentScope.LookupSignature(varName)
@@ -866,7 +936,7 @@ func (this *SemanticAnalysisV2) visitReturnStatement(node parser.Node) AllType {
 
 // array
 func (this *SemanticAnalysisV2) visitArrayLiteral(node parser.Node) AllType {
-	if node.Type() != parser.AstTypeArrayLiteral.Name() {
+	if node.Type() != parser.AstTypeArrayLiteral {
 		return VoidType{}
 	}
 	// 做一下限制，不能多种类型混合在数组里面一起
@@ -875,13 +945,15 @@ func (this *SemanticAnalysisV2) visitArrayLiteral(node parser.Node) AllType {
 		var firstElementType AllType
 		checkType := firstElement.Type()
 		switch checkType {
-		case parser.AstTypeStringLiteral.Name():
+		case parser.AstTypeStringLiteral:
 			firstElementType, _ = this.visitStringLiteral(firstElement)
-		case parser.AstTypeNullLiteral.Name():
+		case parser.AstTypeTemplateLiteral:
+			firstElementType = this.visitTemplateLiteral(firstElement)
+		case parser.AstTypeNullLiteral:
 			firstElementType = this.visitNumberLiteral(firstElement)
-		case parser.AstTypeBooleanLiteral.Name():
+		case parser.AstTypeBooleanLiteral:
 			firstElementType = this.visitBooleanLiteral(firstElement)
-		case parser.AstTypeNumberLiteral.Name():
+		case parser.AstTypeNumberLiteral:
 			firstElementType = this.visitNumberLiteral(firstElement)
 		default:
 			utils.LogError("array literal type error", checkType, node.(parser.ArrayLiteral).Values[0].Type())
@@ -903,7 +975,7 @@ func (this *SemanticAnalysisV2) visitArrayLiteral(node parser.Node) AllType {
 
 // dict
 func (this *SemanticAnalysisV2) visitDictLiteral(node parser.Node) AllType {
-	if node.Type() != parser.AstTypeDictLiteral.Name() {
+	if node.Type() != parser.AstTypeDictLiteral {
 		return VoidType{}
 	}
 	// 做一下限制，不能多种类型混合在dict
@@ -937,7 +1009,7 @@ func (this *SemanticAnalysisV2) visitDictLiteral(node parser.Node) AllType {
 
 // k:v
 func (this *SemanticAnalysisV2) visitPropertyAssignment(node parser.Node) (vType AllType, keyName string) {
-	if node.Type() != parser.AstTypePropertyAssignment.Name() {
+	if node.Type() != parser.AstTypePropertyAssignment {
 		return VoidType{}, ""
 	}
 
@@ -947,38 +1019,14 @@ func (this *SemanticAnalysisV2) visitPropertyAssignment(node parser.Node) (vType
 	keyValueType, keyName, _ = this.visitDictKeyLiteral(kv.Key)
 
 	switch keyValueType {
-	case StringType{}, NumberType{}:
+	case StringType{}, IntegerType{}, FloatType{}:
 	default:
 		utils.LogError("property assignment key type error", keyValueType, kv.Key.Type())
 	}
 
 	v := kv.Value
-	switch v.Type() {
-	case parser.AstTypeFunctionExpression.Name():
-		vType = this.visitFunctionExpression(v)
-	case parser.AstTypeBinaryExpression.Name():
-		vType = this.visitBinaryExpression(v)
-	case parser.AstTypeNumberLiteral.Name():
-		vType = this.visitNumberLiteral(v)
-	case parser.AstTypeNullLiteral.Name():
-		vType = this.visitNullLiteral(v)
-	case parser.AstTypeStringLiteral.Name():
-		vType, _ = this.visitStringLiteral(v)
-	case parser.AstTypeArrayLiteral.Name():
-		vType = this.visitArrayLiteral(v)
-	case parser.AstTypeDictLiteral.Name():
-		vType = this.visitDictLiteral(v)
-	case parser.AstTypeIdentifier.Name():
-		var varName string
-		_, varName, _ = this.visitIdentifier(v)
-		symbol, ok := this.CurrentScope.LookupSignature(varName)
-		if ok {
-			vType = symbol.ReturnType
-		} else {
-			utils.LogError("undeclared variable", varName)
-			return
-		}
-	default:
+	vType, ok := this.visitExpression(v)
+	if !ok {
 		utils.LogError("property assignment type error", v.Type(), node.Type())
 	}
 	return vType, keyName
@@ -986,15 +1034,22 @@ func (this *SemanticAnalysisV2) visitPropertyAssignment(node parser.Node) (vType
 
 // 调用函数
 func (this *SemanticAnalysisV2) visitCallExpression(node parser.Node) (AllType, string) {
-	if node.Type() != parser.AstTypeCallExpression.Name() {
+	if node.Type() != parser.AstTypeCallExpression {
 		return UnKnownType{}, ""
 	}
 
 	n := node.(parser.CallExpression)
 
-	if n.Object.Type() == parser.AstTypeMemberExpression.Name() {
+	// 参数是任意表达式，先逐个检查
+	argTypes := make([]AllType, 0, len(n.Args))
+	for _, arg := range n.Args {
+		argTypes = append(argTypes, this.visitCallArgument(arg))
+	}
+	utils.LogInfo("visitCallExpression args", argTypes)
+
+	if n.Object.Type() == parser.AstTypeMemberExpression {
 		return this.visitMemberExpression(node.(parser.CallExpression).Object)
-	} else if n.Object.Type() == parser.AstTypeIdentifier.Name() {
+	} else if n.Object.Type() == parser.AstTypeIdentifier {
 
 		valueType, variableName, _ := this.visitIdentifier(n.Object)
 
@@ -1003,9 +1058,9 @@ func (this *SemanticAnalysisV2) visitCallExpression(node parser.Node) (AllType,
 		if valueType.ValueType() == functionValueType.ValueType() {
 			fn := valueType.(FunctionType)
 			// 这里要检查
-			// 1. 参数个数
+			// 1. 参数个数，默认参数可以不传，...rest 不限个数
 			// todo 2. 参数类型
-			if len(fn.Params) != len(n.Args) {
+			if len(n.Args) < fn.MinArgs() || (fn.MaxArgs() >= 0 && len(n.Args) > fn.MaxArgs()) {
 				utils.LogError("call expression param number error", len(fn.Params), len(n.Args))
 			}
 
@@ -1017,8 +1072,60 @@ func (this *SemanticAnalysisV2) visitCallExpression(node parser.Node) (AllType,
 	return UnKnownType{}, ""
 }
 
+// 表达式的类型，变量的值、调用参数、默认参数、dict 的值都走这里
+// 不是表达式的节点返回 false，由调用的地方报错
+func (this *SemanticAnalysisV2) visitExpression(node parser.Node) (AllType, bool) {
+	switch node.Type() {
+	case parser.AstTypeFunctionExpression:
+		return this.visitFunctionExpression(node), true
+	case parser.AstTypeBinaryExpression:
+		return this.visitBinaryExpression(node), true
+	case parser.AstTypeUnaryExpression:
+		return this.visitUnaryExpression(node), true
+	case parser.AstTypeNumberLiteral:
+		return this.visitNumberLiteral(node), true
+	case parser.AstTypeNullLiteral:
+		return this.visitNullLiteral(node), true
+	case parser.AstTypeBooleanLiteral:
+		return this.visitBooleanLiteral(node), true
+	case parser.AstTypeStringLiteral:
+		valueType, _ := this.visitStringLiteral(node)
+		return valueType, true
+	case parser.AstTypeTemplateLiteral:
+		return this.visitTemplateLiteral(node), true
+	case parser.AstTypeArrayLiteral:
+		return this.visitArrayLiteral(node), true
+	case parser.AstTypeDictLiteral:
+		return this.visitDictLiteral(node), true
+	case parser.AstTypeIdentifier:
+		_, varName, _ := this.visitIdentifier(node)
+		signature, ok := this.CurrentScope.LookupSignature(varName)
+		if !ok {
+			utils.LogError("undeclared variable", varName)
+			return UnKnownType{}, true
+		}
+		return signature.ReturnType, true
+	case parser.AstTypeCallExpression:
+		valueType, _ := this.visitCallExpression(node)
+		return valueType, true
+	case parser.AstTypeMemberExpression:
+		valueType, _ := this.visitMemberExpression(node)
+		return valueType, true
+	}
+	return UnKnownType{}, false
+}
+
+// 调用参数，返回参数的类型
+func (this *SemanticAnalysisV2) visitCallArgument(node parser.Node) AllType {
+	valueType, ok := this.visitExpression(node)
+	if !ok {
+		utils.LogError("visitCallArgument invalid argument", node.Type())
+	}
+	return valueType
+}
+
 func (this *SemanticAnalysisV2) visitExpressionStatement(node parser.Node) (AllType, string) {
-	if node.Type() != parser.AstTypeExpressionStatement.Name() {
+	if node.Type() != parser.AstTypeExpressionStatement {
 		return UnKnownType{}, ""
 	}
 
@@ -1026,25 +1133,27 @@ func (this *SemanticAnalysisV2) visitExpressionStatement(node parser.Node) (AllT
 	exp := n.Exp
 
 	switch exp.Type() {
-	case parser.AstTypeCallExpression.Name():
+	case parser.AstTypeCallExpression:
 		this.visitCallExpression(exp)
-	case parser.AstTypeMemberExpression.Name():
+	case parser.AstTypeMemberExpression:
 		this.visitMemberExpression(exp)
-	case parser.AstTypeIdentifier.Name():
+	case parser.AstTypeIdentifier:
 		this.visitIdentifier(exp)
-	case parser.AstTypeBinaryExpression.Name():
+	case parser.AstTypeBinaryExpression:
 		this.visitBinaryExpression(exp)
-	case parser.AstTypeNumberLiteral.Name():
+	case parser.AstTypeNumberLiteral:
 		this.visitNumberLiteral(exp)
-	case parser.AstTypeStringLiteral.Name():
+	case parser.AstTypeStringLiteral:
 		this.visitStringLiteral(exp)
-	case parser.AstTypeArrayLiteral.Name():
+	case parser.AstTypeTemplateLiteral:
+		this.visitTemplateLiteral(exp)
+	case parser.AstTypeArrayLiteral:
 		this.visitArrayLiteral(exp)
-	case parser.AstTypeDictLiteral.Name():
+	case parser.AstTypeDictLiteral:
 		this.visitDictLiteral(exp)
-	case parser.AstTypeNullLiteral.Name():
+	case parser.AstTypeNullLiteral:
 		this.visitNullLiteral(exp)
-	case parser.AstTypeBooleanLiteral.Name():
+	case parser.AstTypeBooleanLiteral:
 		this.visitBooleanLiteral(exp)
 	default:
 		utils.LogInfo("visitExpressionStatement", exp.Type())
@@ -1057,7 +1166,7 @@ func (this *SemanticAnalysisV2) visitExpressionStatement(node parser.Node) (AllT
 // 这里写的有点乱，要看看怎么搞比较好
 func (this *SemanticAnalysisV2) visitMemberExpression(node parser.Node) (AllType, string) {
 	var variableName string
-	if node.Type() != parser.AstTypeMemberExpression.Name() {
+	if node.Type() != parser.AstTypeMemberExpression {
 		return UnKnownType{}, ""
 	}
 	et := node.(parser.MemberExpression).ElementType
@@ -1108,7 +1217,7 @@ func (this *SemanticAnalysisV2) visitMemberExpression(node parser.Node) (AllType
 
 func (this *SemanticAnalysisV2) visitClassExpression(node parser.Node) AllType {
 	// 1.检查 super 的 class 是否存在
-	if node.Type() != parser.AstTypeClassExpression.Name() {
+	if node.Type() != parser.AstTypeClassExpression {
 		return UnKnownType{}
 	}
 
@@ -1146,7 +1255,7 @@ func (this *SemanticAnalysisV2) visitClassExpression(node parser.Node) AllType {
 	classBody := node.(parser.ClassExpression).Body
 	memberSignatures := make([]Signature, 0)
 	utils.LogInfo("visitClassExpression classBody", classBody.Type())
-	if classBody.Type() == parser.AstTypeClassBodyStatement.Name() {
+	if classBody.Type() == parser.AstTypeClassBodyStatement {
 		memberSignatures = this.visitClassBodyStatement(classBody)
 	}
 	thisClassType := ClassType{
@@ -1163,14 +1272,14 @@ func (this *SemanticAnalysisV2) visitClassExpression(node parser.Node) AllType {
 }
 
 func (this *SemanticAnalysisV2) visitClassBodyStatement(node parser.Node) []Signature {
-	if node.Type() != parser.AstTypeClassBodyStatement.Name() {
+	if node.Type() != parser.AstTypeClassBodyStatement {
 		return nil
 	}
 	signatures := make([]Signature, 0)
 	for _, item := range node.(parser.ClassBodyStatement).Body {
 		utils.LogInfo("visitClassBodyStatement visit item", item.Type())
 		switch item.Type() {
-		case parser.AstTypeClassVariableDeclaration.Name():
+		case parser.AstTypeClassVariableDeclaration:
 			signature := this.visitClassVariableDeclaration(item)
 			signatures = append(signatures, signature)
 		default:
@@ -1200,55 +1309,25 @@ func (this *SemanticAnalysisV2) visitClassVariableDeclaration(node parser.Node)
 	left := node.(parser.ClassVariableDeclaration).Name
 	var variableName string
 	switch left.Type() {
-	case parser.AstTypeMemberExpression.Name():
+	case parser.AstTypeMemberExpression:
 		_, variableName = this.visitMemberExpression(left)
-	case parser.AstTypeIdentifier.Name():
+	case parser.AstTypeIdentifier:
 		_, variableName, _ = this.visitIdentifier(left)
 	default:
 		utils.LogError("invalid class variable declaration", left)
 		return Signature{}
 	}
 
-	var valueType AllType
 	right := node.(parser.ClassVariableDeclaration).Value
-	switch right.Type() {
-	// 访问函数
-	case parser.AstTypeFunctionExpression.Name():
-		valueType = this.visitFunctionExpression(right)
-	case parser.AstTypeBinaryExpression.Name():
-		valueType = this.visitBinaryExpression(right)
-	case parser.AstTypeNumberLiteral.Name():
-		valueType = this.visitNumberLiteral(right)
-	case parser.AstTypeNullLiteral.Name():
-		valueType = this.visitNullLiteral(right)
-	case parser.AstTypeBooleanLiteral.Name():
-		valueType = this.visitBooleanLiteral(right)
-	case parser.AstTypeStringLiteral.Name():
-		valueType, _ = this.visitStringLiteral(right)
-	case parser.AstTypeArrayLiteral.Name():
-		valueType = this.visitArrayLiteral(right)
-	case parser.AstTypeUnaryExpression.Name():
-		valueType = this.visitUnaryExpression(right)
-	case parser.AstTypeDictLiteral.Name():
-		valueType = this.visitDictLiteral(right)
-	case parser.AstTypeIdentifier.Name():
-		var varName string
-		_, varName, _ = this.visitIdentifier(right)
-		symbol, ok := this.CurrentScope.LookupSignature(varName)
-		if ok {
-			valueType = symbol.ReturnType
-		} else {
-			utils.LogError("undeclared variable", varName)
-			return Signature{}
-		}
-	default:
+	valueType, ok := this.visitExpression(right)
+	if !ok {
 		utils.LogError("invalid class variable declaration", right)
 		return Signature{}
 	}
 	// 先这么写 false
 	this.CurrentScope.AddSignature(variableName, valueType, false, "const")
 
-	fmt.Printf("visitClassVariableDeclaration this.CurrentScope: %+v\n", this.CurrentScope)
+	utils.LogInfo("visitClassVariableDeclaration this.CurrentScope", *this.CurrentScope)
 	return Signature{
 		Name:       variableName,
 		ReturnType: valueType,
@@ -3,6 +3,7 @@ package semantic
 import (
 	"encoding/json"
 	"fmt"
+	"go-compiler/internal/testutil"
 	lexer2 "go-compiler/lexer"
 	parser2 "go-compiler/parser"
 	"testing"
@@ -517,3 +518,153 @@ func testSemanticAnalysis5_6() {
 	semanticAnalysis.Visit()
 	fmt.Println("====================== NewSemanticAnalysis end =======================")
 }
+
+func TestCallExpressionArgs(t *testing.T) {
+	tests := []struct {
+		input string
+		panic bool
+	}{
+		{"var f = function(x) { return x }\nvar a = 1\nf(a + 1)", false},
+		{"var f = function(x) { return x }\nf(f(2))", false},
+		{"var f = function(x) { return x }\nf(function(y) { return y },)", false},
+		{"var f = function(x, y) { return x }\nf(-1, [1, 2])", false},
+		{"var f = function(x) { return x }\nf(1, 2)", true},
+		{"var f = function(x, y) { return x }\nf(f(1, 2, 3), 2)", true},
+		{"var f = function(x) { return x }\nf(b + 1)", true},
+		{"var f = function(x, y = 2) { return x }\nf(1)", false},
+		{"var f = function(x, y = 2) { return x }\nf(1, 2)", false},
+		{"var f = function(x, y = 2) { return x }\nf()", true},
+		{"var f = function(x, y = 2) { return x }\nf(1, 2, 3)", true},
+		{"var f = function(x, ...y) { return y }\nf(1, 2, 3, 4)", false},
+		{"var f = function(x, ...y) { return y }\nf()", true},
+		{"var f = function(x = 1, y) { return x }", true},
+		{"var f = function(x, y = x) { return x }", true},
+		{"var a = 1\nvar f = function(x, y = a * 2) { return x }\nf(1)", false},
+	}
+
+	for _, tt := range tests {
+		panicked := func() (panicked bool) {
+			defer func() {
+				if r := recover(); r != nil {
+					panicked = true
+				}
+			}()
+			NewSemanticAnalysisV2(benchmarkAst(tt.input)).Visit()
+			return false
+		}()
+		if panicked != tt.panic {
+			t.Errorf("%q: panic=%v, want %v", tt.input, panicked, tt.panic)
+		}
+	}
+}
+
+func TestNumberTypes(t *testing.T) {
+	tests := []struct {
+		input string
+		want  AllType
+	}{
+		{"var a = 1", IntegerType{}},
+		{"var a = 1.5", FloatType{}},
+		{"var a = 0x10", IntegerType{}},
+		{"var a = 123n", IntegerType{}},
+		{"var a = 99999999999999999999 * 2", IntegerType{}},
+		{"var a = 1e3", FloatType{}},
+		{"var a = 1 + 2", IntegerType{}},
+		{"var a = 1 + 2.0", FloatType{}},
+		{"var a = 7 / 2", IntegerType{}},
+		{"var a = 7 % 2", IntegerType{}},
+		{"var a = 7.0 * 2", FloatType{}},
+		{"var a = -1.5", FloatType{}},
+		{"var a = 1 < 1.5", BooleanType{}},
+	}
+
+	for _, tt := range tests {
+		s := NewSemanticAnalysisV2(benchmarkAst(tt.input))
+		s.Visit()
+		signature, ok := s.CurrentScope.LookupSignature("a")
+		if !ok {
+			t.Errorf("%q: a not found", tt.input)
+			continue
+		}
+		if signature.ReturnType != tt.want {
+			t.Errorf("%q: type=%v, want %v", tt.input, signature.ReturnType.ValueType(), tt.want.ValueType())
+		}
+	}
+}
+
+func TestTemplateLiteral(t *testing.T) {
+	tests := []struct {
+		input string
+		panic bool
+	}{
+		{"var a = 1\nvar s = `a=${a}`", false},
+		{"var a = 1\nvar s = `${a + 1.5}${\"x\"}${true}${null}` + \"!\"", false},
+		{"var f = function(x) { return x }\nvar s = `${f(1)}`", false},
+		{"var s = `${b}`", true},
+		{"var f = function(x) { return x }\nvar s = `${f}`", true},
+		{"var s = `${function() {}}`", true},
+	}
+
+	for _, tt := range tests {
+		panicked := func() (panicked bool) {
+			defer func() {
+				if r := recover(); r != nil {
+					panicked = true
+				}
+			}()
+			NewSemanticAnalysisV2(benchmarkAst(tt.input)).Visit()
+			return false
+		}()
+		if panicked != tt.panic {
+			t.Errorf("%q: panic=%v, want %v", tt.input, panicked, tt.panic)
+		}
+	}
+}
+
+func TestStatements(t *testing.T) {
+	tests := []struct {
+		input string
+		panic bool
+	}{
+		// 函数体里也可以有循环
+		{"var f = function() {\nvar i = 0\nwhile (i < 3) {\ni = i + 1\nbreak\n}\nreturn i\n}", false},
+		{"var f = function() {\nvar i = \"a\"\nwhile (i) {\n}\n}", true},
+		{"var a = 1\n{\nvar b = a\n}", false},
+		{"return 1", true},
+		{"break", true},
+	}
+
+	for _, tt := range tests {
+		panicked := func() (panicked bool) {
+			defer func() {
+				if r := recover(); r != nil {
+					panicked = true
+				}
+			}()
+			NewSemanticAnalysisV2(benchmarkAst(tt.input)).Visit()
+			return false
+		}()
+		if panicked != tt.panic {
+			t.Errorf("%q: panic=%v, want %v", tt.input, panicked, tt.panic)
+		}
+	}
+}
+
+func benchmarkAst(code string) parser2.Program {
+	lexer := lexer2.SansLangLexer{}
+	lexer.Code = code
+	tokensLexer := lexer2.TokenList{
+		Tokens: lexer.TokenList(),
+	}
+	parser := parser2.NewSansLangParser(&tokensLexer)
+	return parser.Parse()
+}
+
+func BenchmarkSemanticAnalysisV2(b *testing.B) {
+	ast := benchmarkAst(testutil.GenerateProgram(1000))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s := NewSemanticAnalysisV2(ast)
+		s.Visit()
+	}
+}
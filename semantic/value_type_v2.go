@@ -25,11 +25,35 @@ func (s StringType) ValueType() string {
 	return "StringType"
 }
 
-type NumberType struct {
+type IntegerType struct {
 }
 
-func (n NumberType) ValueType() string {
-	return "NumberType"
+func (i IntegerType) ValueType() string {
+	return "IntegerType"
+}
+
+type FloatType struct {
+}
+
+func (f FloatType) ValueType() string {
+	return "FloatType"
+}
+
+// 整数和浮点数都算数字
+func isNumberType(t AllType) bool {
+	switch t {
+	case IntegerType{}, FloatType{}:
+		return true
+	}
+	return false
+}
+
+// 两个数字运算的结果类型，两边都是整数才是整数，否则提升为浮点数
+func promoteNumberType(left AllType, right AllType) AllType {
+	if left == (IntegerType{}) && right == (IntegerType{}) {
+		return IntegerType{}
+	}
+	return FloatType{}
 }
 
 type VoidType struct {
@@ -71,14 +95,33 @@ func (b BooleanType) ValueType() string {
 }
 
 type FunctionType struct {
-	Params     []Signature `json:"params"`
-	ReturnType AllType     `json:"returnType"`
+	Params      []Signature `json:"params"`
+	ReturnType  AllType     `json:"returnType"`
+	NumDefaults int         `json:"numDefaults"` // 带默认值的参数个数
+	HasRest     bool        `json:"hasRest"`     // 最后一个参数是不是 ...rest
 }
 
 func (f FunctionType) ValueType() string {
 	return "FunctionType"
 }
 
+// 调用时最少要传的参数个数
+func (f FunctionType) MinArgs() int {
+	n := len(f.Params) - f.NumDefaults
+	if f.HasRest {
+		n -= 1
+	}
+	return n
+}
+
+// 调用时最多能传的参数个数，-1 表示不限
+func (f FunctionType) MaxArgs() int {
+	if f.HasRest {
+		return -1
+	}
+	return len(f.Params)
+}
+
 type ClassType struct {
 	MemberSignatures []Signature `json:"memberSignatures"` // 成员方法签名
 	SuperType        AllType     `json:"returnType"`
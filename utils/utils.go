@@ -6,7 +6,13 @@ import (
 	"strings"
 )
 
+// Verbose 为 true 时 LogInfo 才输出，调试解析器和编译器的时候打开
+var Verbose = false
+
 func LogInfo(msg string, args ...interface{}) {
+	if !Verbose {
+		return
+	}
 	str := fmt.Sprintf("[INFO] %s", msg)
 	if len(args) > 0 {
 		params := make([]string, 0, len(args))